@@ -0,0 +1,77 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"filippo.io/age"
+	"filippo.io/age/armor"
+)
+
+// Parse the PAYLOAD_AGE_RECIPIENTS age public keys, separated by commas or newlines, and the identities of
+// the PAYLOAD_AGE_IDENTITY_FILE file, either empty if not set.
+func parsePayloadAge(recipients, identityFile string) ([]age.Recipient, []age.Identity, error) {
+	var (
+		parsedRecipients []age.Recipient
+		identities       []age.Identity
+		err              error
+	)
+	if recipients = strings.TrimSpace(recipients); recipients != "" {
+		parsedRecipients, err = age.ParseRecipients(strings.NewReader(strings.ReplaceAll(recipients, ",", "\n")))
+		if err != nil {
+			return nil, nil, fmt.Errorf("PAYLOAD_AGE_RECIPIENTS env is invalid: %w", err)
+		}
+	}
+	if identityFile != "" {
+		file, err := os.Open(identityFile)
+		if err != nil {
+			return nil, nil, fmt.Errorf("PAYLOAD_AGE_IDENTITY_FILE env is invalid: %w", err)
+		}
+		defer file.Close()
+		if identities, err = age.ParseIdentities(file); err != nil {
+			return nil, nil, fmt.Errorf("PAYLOAD_AGE_IDENTITY_FILE env is invalid: %w", err)
+		}
+	}
+	return parsedRecipients, identities, nil
+}
+
+// Whether the stored value is an age payload, which only the private keys of its recipients decrypt.
+func isAgePayload(value string) bool {
+	return strings.HasPrefix(strings.TrimSpace(value), armor.Header)
+}
+
+// Encrypt the init response to the operator age recipients, if configured.
+func (a *App) sealAgePayload(data []byte) ([]byte, error) {
+	if len(a.config.PayloadAgeRecipients) == 0 {
+		return data, nil
+	}
+	encrypted, err := ageEncryptTo(string(data), a.config.PayloadAgeRecipients...)
+	if err != nil {
+		return nil, err
+	}
+	return []byte(encrypted), nil
+}
+
+// Decrypt the init response if it is an age payload. Without an identity of its recipients, the keys cannot
+// be read, and an operator must unseal Vault.
+func (a *App) openAgePayload(value string) (string, error) {
+	if !isAgePayload(value) {
+		return value, nil
+	}
+	if len(a.config.PayloadAgeIdentities) == 0 {
+		return "", errors.New("the init response is encrypted to the operators age keys, set PAYLOAD_AGE_IDENTITY_FILE to decrypt it")
+	}
+
+	decrypted, err := age.Decrypt(armor.NewReader(strings.NewReader(strings.TrimSpace(value))), a.config.PayloadAgeIdentities...)
+	if err != nil {
+		return "", fmt.Errorf("decrypt age payload: %w", err)
+	}
+	payload, err := io.ReadAll(decrypted)
+	if err != nil {
+		return "", fmt.Errorf("decrypt age payload: %w", err)
+	}
+	return string(payload), nil
+}
@@ -0,0 +1,47 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"filippo.io/age"
+)
+
+func TestAgePayload(t *testing.T) {
+	operators := make([]*age.X25519Identity, 2)
+	var recipients []string
+	for i := range operators {
+		identity, err := age.GenerateX25519Identity()
+		if err != nil {
+			t.Fatal(err)
+		}
+		operators[i] = identity
+		recipients = append(recipients, identity.Recipient().String())
+	}
+	parsed, _, err := parsePayloadAge(strings.Join(recipients, ","), "")
+	if err != nil || len(parsed) != 2 {
+		t.Fatalf("expected 2 recipients, got %d, %v", len(parsed), err)
+	}
+
+	app, vault, secretsManager := newTestApp(0)
+	app.config.PayloadAgeRecipients = parsed
+
+	// Without an operator key, the tool cannot unseal Vault, nor overwrite the keys.
+	if _, err := app.CheckVaultStatus(context.Background()); err == nil || !vault.sealed {
+		t.Fatalf("expected unsealing to fail without an identity, got %v", err)
+	}
+	if !isAgePayload(*secretsManager.value) || strings.Contains(*secretsManager.value, "root_token") {
+		t.Fatal("expected the secret to hold an age payload")
+	}
+	if err := app.checkSecretUnused(context.Background()); !errors.Is(err, ErrSecretInUse) {
+		t.Errorf("expected ErrSecretInUse, got %v", err)
+	}
+
+	// Any operator key decrypts it.
+	app.config.PayloadAgeIdentities = []age.Identity{operators[1]}
+	if _, err := app.CheckVaultStatus(context.Background()); err != nil || vault.sealed {
+		t.Fatalf("expected Vault unsealed with an operator key, got %v", err)
+	}
+}
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/spf13/viper"
+)
+
+// Cluster an alert is about, when several are managed, and its webhook overriding ALERT_WEBHOOK_URL.
+type alertTarget struct {
+	Cluster    string
+	WebhookURL string
+}
+
+type alertTargetKey struct{}
+
+// Returns a context sending the alerts raised with it to the target.
+func withAlertTarget(ctx context.Context, target alertTarget) context.Context {
+	return context.WithValue(ctx, alertTargetKey{}, target)
+}
+
+// Sink alerts are sent to. The webhook is the built-in notifier, and plugins may provide others.
+type notifier interface {
+	notify(ctx context.Context, notification alertNotification) error
+}
+
+// Alert as sent to the notifiers.
+type alertNotification struct {
+	Text       string            `json:"text"`
+	Attributes map[string]string `json:"attributes"`
+}
+
+// Log an alert and send it to the webhook and the ALERT_PLUGINS, if configured.
+// The arguments are key-value pairs, as in slog.
+func alert(ctx context.Context, msg string, args ...any) {
+	url := viper.GetString("alert_webhook_url")
+	if target, ok := ctx.Value(alertTargetKey{}).(alertTarget); ok {
+		args = append([]any{"cluster", target.Cluster}, args...)
+		if target.WebhookURL != "" {
+			url = target.WebhookURL
+		}
+	}
+
+	slog.Error(msg, append([]any{"alert", true}, args...)...)
+
+	var notifiers []notifier
+	if url != "" {
+		notifiers = append(notifiers, webhookNotifier{url: url})
+	}
+	for _, path := range parseList(viper.GetString("alert_plugins")) {
+		notifiers = append(notifiers, pluginNotifier{path: path})
+	}
+	if len(notifiers) == 0 {
+		return
+	}
+
+	notification := alertNotification{Text: msg, Attributes: make(map[string]string, len(args)/2)}
+	for i := 0; i+1 < len(args); i += 2 {
+		notification.Attributes[fmt.Sprint(args[i])] = fmt.Sprint(args[i+1])
+	}
+	for _, n := range notifiers {
+		if err := n.notify(ctx, notification); err != nil {
+			slog.Error("Cannot send alert", "error", err)
+		}
+	}
+}
+
+// Built-in notifier, posting the alerts as JSON to a webhook URL.
+type webhookNotifier struct {
+	url string
+}
+
+func (n webhookNotifier) notify(ctx context.Context, notification alertNotification) error {
+	body, err := json.Marshal(notification)
+	if err != nil {
+		return fmt.Errorf("marshal alert: %w", err)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, n.url, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("post alert: %w", err)
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode >= 300 {
+		return fmt.Errorf("post alert: unexpected status %s", res.Status)
+	}
+	return nil
+}
@@ -0,0 +1,847 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"math/rand"
+	"strconv"
+	"time"
+
+	"filippo.io/age"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/secretsmanager"
+	"github.com/aws/aws-sdk-go-v2/service/secretsmanager/types"
+	"github.com/hashicorp/vault/api"
+	"github.com/spiffe/go-spiffe/v2/svid/x509svid"
+)
+
+// Subset of the AWS Secrets Manager API used by the App.
+// Satisfied by *secretsmanager.Client.
+type secretsManagerAPI interface {
+	CreateSecret(ctx context.Context, params *secretsmanager.CreateSecretInput, optFns ...func(*secretsmanager.Options)) (*secretsmanager.CreateSecretOutput, error)
+	DescribeSecret(ctx context.Context, params *secretsmanager.DescribeSecretInput, optFns ...func(*secretsmanager.Options)) (*secretsmanager.DescribeSecretOutput, error)
+	GetSecretValue(ctx context.Context, params *secretsmanager.GetSecretValueInput, optFns ...func(*secretsmanager.Options)) (*secretsmanager.GetSecretValueOutput, error)
+	ListSecrets(ctx context.Context, params *secretsmanager.ListSecretsInput, optFns ...func(*secretsmanager.Options)) (*secretsmanager.ListSecretsOutput, error)
+	PutSecretValue(ctx context.Context, params *secretsmanager.PutSecretValueInput, optFns ...func(*secretsmanager.Options)) (*secretsmanager.PutSecretValueOutput, error)
+	PutResourcePolicy(ctx context.Context, params *secretsmanager.PutResourcePolicyInput, optFns ...func(*secretsmanager.Options)) (*secretsmanager.PutResourcePolicyOutput, error)
+	UpdateSecret(ctx context.Context, params *secretsmanager.UpdateSecretInput, optFns ...func(*secretsmanager.Options)) (*secretsmanager.UpdateSecretOutput, error)
+	UpdateSecretVersionStage(ctx context.Context, params *secretsmanager.UpdateSecretVersionStageInput, optFns ...func(*secretsmanager.Options)) (*secretsmanager.UpdateSecretVersionStageOutput, error)
+	ReplicateSecretToRegions(ctx context.Context, params *secretsmanager.ReplicateSecretToRegionsInput, optFns ...func(*secretsmanager.Options)) (*secretsmanager.ReplicateSecretToRegionsOutput, error)
+	RotateSecret(ctx context.Context, params *secretsmanager.RotateSecretInput, optFns ...func(*secretsmanager.Options)) (*secretsmanager.RotateSecretOutput, error)
+	TagResource(ctx context.Context, params *secretsmanager.TagResourceInput, optFns ...func(*secretsmanager.Options)) (*secretsmanager.TagResourceOutput, error)
+}
+
+// Config holds the settings of an App.
+type Config struct {
+	// Name of the Vault cluster, labeling its metrics and alerts when several are managed. Empty otherwise.
+	Cluster string
+
+	// AWS Secrets Manager secret storing the Vault init response.
+	SecretID string
+	// Tags the secret was discovered by, with SECRETSMANAGER_SECRET_FILTER. Nil if SecretID was given.
+	SecretFilter map[string]string
+	// AWS account of the Secrets Manager credentials, empty if it could not be resolved.
+	CallerAccount string
+
+	// Secret the first replica publishes the Vault status to, for External Secrets Operator. Empty if not used.
+	StatusSecretName string
+
+	// Regions the secret is replicated to by AWS Secrets Manager.
+	ReplicaRegions []ReplicaRegion
+
+	// Tags applied to the secret.
+	Tags map[string]string
+
+	// Rotation Lambda and schedule expression associated with the secret. Empty to leave rotation untouched.
+	RotationLambdaARN string
+	RotationSchedule  string
+
+	// Secret version ID or staging label to read the unseal keys from. Empty to read AWSCURRENT.
+	SecretVersionID    string
+	SecretVersionStage string
+
+	// Secret created to hold the root token apart from the unseal keys, readable only by the break-glass role
+	// and managed only by it and the role of the tool. Empty to store the root token with the unseal keys.
+	RootTokenSecretName    string
+	RootTokenRoleARN       string
+	RootTokenWriterRoleARN string
+
+	// Age after which the root token stored with the unseal keys is revoked. 0 to keep it.
+	RootTokenMaxAge time.Duration
+	// What becomes of the root token after initialization: stored, discarded, or revoked once bootstrapped.
+	RootTokenPolicy rootTokenPolicy
+
+	// SSM SecureString parameter to read the init response from instead of the secret, which is still
+	// the one written on initialization. Used while migrating between both services.
+	SSMParameterName string
+
+	// KMS key the secret must be encrypted with, and whether to re-encrypt the secret if it is not.
+	SecretKMSKeyID      string
+	EnforceSecretKMSKey bool
+	// Whether to create the secret at startup if it is missing, and the resource policy to attach to it.
+	CreateSecret         bool
+	SecretResourcePolicy string
+	// Whether to write the init response as SecretBinary rather than SecretString, and gzip compressed.
+	// Values of either type are read.
+	SecretBinary   bool
+	CompressSecret bool
+
+	// KMS key to encrypt the init response with locally before storing it. Empty to store it as is.
+	EnvelopeKMSKeyID string
+	// Operator age recipients to encrypt the init response to before storing it, and identities decrypting
+	// it. Without identities, the stored keys cannot be read and operators unseal Vault.
+	PayloadAgeRecipients []age.Recipient
+	PayloadAgeIdentities []age.Identity
+	// Schema the init response is written with, the latest if 0. Payloads of any schema are read.
+	PayloadSchema int
+
+	// KMS key of the Vault awskms seal, verified before initialization. Empty if not used.
+	SealKMSKeyID string
+
+	// Whether to unseal with the migrate flag when a seal migration is pending.
+	SealMigrate bool
+
+	// Whether to send and receive unseal keys over plaintext HTTP to Vault addresses other than loopback.
+	AllowPlaintext bool
+
+	// Time the init response writes may fail before alerting, and file to persist the init response to then.
+	WriteEscalateAfter time.Duration
+	FallbackFile       string
+
+	// Whether to initialize Vault even if the secret already holds an init response, overwriting it.
+	ForceOverwrite bool
+
+	// Maximum age of the cached secret metadata. The periodic secret check always describes the secret.
+	SecretMetadataTTL time.Duration
+
+	// Vault API writes applied after initialization with a token of the bootstrap policy, valid for the TTL.
+	BootstrapSteps    []BootstrapStep
+	BootstrapPolicy   string
+	BootstrapTokenTTL time.Duration
+
+	// Vault secret shares and threshold used for initialization.
+	SecretShares    int
+	SecretThreshold int
+
+	// Vault recovery shares and threshold used for initialization instead with auto-unseal seals.
+	RecoveryShares    int
+	RecoveryThreshold int
+
+	// Ordinal of the Vault replica in its statefulset. Only replica 0 initializes Vault,
+	// the rest join its Raft cluster.
+	Replica int
+
+	// Raft leader connection settings. Certificates and keys may use the `@<file-path>` format.
+	RaftLeaderAPIAddr    string
+	RaftLeaderCACert     string
+	RaftLeaderClientCert string
+	RaftLeaderClientKey  string
+
+	// Store of the init response, of the SECRET_BACKEND backend. Nil for the AWS Secrets Manager secret.
+	KeyStore keyStore
+	// Stores the init response is mirrored to, read if the primary store fails.
+	KeyStoreMirrors []keyStoreMirror
+	// Secrets each holding one unseal key share, so that no secret alone holds a quorum. Empty to store the
+	// shares with the init response.
+	ShareSecrets []shareSecret
+
+	// Desired state the status checks converge toward. Nil for an initialized and unsealed Vault.
+	DesiredState *DesiredState
+	// Token administering Vault for the desired state and snapshots when no root token is stored.
+	VaultToken string
+	// Whether the Vault API is reached through a Vault Agent listener (VAULT_AGENT_ADDR) adding its auto-auth
+	// token to the requests sent without one, used instead of VaultToken for the desired state and snapshots.
+	VaultAgent bool
+	// Store the Raft snapshots of the desired state are uploaded to. Nil if not configured.
+	SnapshotStore *snapshotStore
+
+	// Canary node to wait for before unsealing a sealed node, unless this node is the canary. Nil if not used.
+	UnsealCanary *canaryGate
+
+	// Journal the side-effectful actions are recorded to, claiming initialization. Nil if not used.
+	Journal *operationJournal
+
+	// Source of the SPIFFE X.509 SVID used as Raft leader client certificate, unless RaftLeaderClientCert is set.
+	// Nil if not used.
+	SVIDSource x509svid.Source
+}
+
+// App initializes, joins and unseals a Vault server, storing the init response in AWS Secrets Manager.
+type App struct {
+	config         Config
+	vault          vaultAPI
+	secretsManager secretsManagerAPI
+	kms            kmsAPI
+	ssm            ssmAPI
+	metadata       secretMetadataCache
+
+	// Root token kept from initialization until the bootstrap steps are applied, and steps applied so far.
+	rootToken        string
+	bootstrapApplied int
+	// Whether the progress recorded on the secret was resumed after starting.
+	progressResumed bool
+	// Root token kept from initialization until revoked, with the revoke-after-bootstrap policy.
+	revokedRootToken string
+	// Fingerprint of the stored keys that failed to unseal Vault, not to submit them again.
+	failedKeys string
+
+	// Status last written to the status secret, and whether both secrets were tagged.
+	publishedStatus *publishedStatus
+	statusTagged    bool
+
+	// Token converging the desired state, and time of the latest snapshot, both read once.
+	specToken    string
+	lastSnapshot time.Time
+}
+
+// Create an App from its configuration and API clients.
+func NewApp(config Config, vault vaultAPI, secretsManager secretsManagerAPI, kms kmsAPI, ssm ssmAPI) *App {
+	return &App{
+		config:         config,
+		vault:          vault,
+		secretsManager: secretsManager,
+		kms:            kms,
+		ssm:            ssm,
+	}
+}
+
+// Check the AWS Secrets Manager secret exists and is not scheduled for deletion.
+func (a *App) CheckSecretExistence(ctx context.Context) error {
+	secret, err := a.describeSecret(ctx, true)
+	if err != nil {
+		var notFound *types.ResourceNotFoundException
+		if errors.As(err, &notFound) {
+			return fmt.Errorf("describe secret: %w: %w", ErrSecretMissing, err)
+		}
+		return fmt.Errorf("describe secret: %w", err)
+	}
+	if secret.DeletedDate != nil {
+		return fmt.Errorf("describe secret: %w: scheduled for deletion on %s", ErrSecretMissing, secret.DeletedDate)
+	}
+
+	slog.Debug("Secret exists", "arn", aws.ToString(secret.ARN))
+	return nil
+}
+
+// Check vault health status and initialize, join Raft cluster and unseal as needed.
+// Each state leads to the actions taking the node to the next one, until it is unsealed.
+func (a *App) CheckVaultStatus(ctx context.Context) (*CheckResult, error) {
+	slog.Debug("Checking vault status")
+
+	result, err := a.readState(ctx)
+	if err != nil {
+		return nil, err
+	}
+	recordState(a.config.Cluster, result.State)
+
+	if a.config.StatusSecretName != "" && a.config.Replica == 0 {
+		if err := a.PublishStatus(ctx, result); err != nil {
+			slog.Error("Publishing status", "error", err)
+		}
+	}
+
+	slog.Debug("Got vault state", "state", result.State)
+
+	spec := a.desiredState()
+	defer func() {
+		result.Spec = a.convergeSpec(ctx, result)
+	}()
+
+	switch result.State {
+	case StateUninitialized:
+		slog.Debug("Vault replica", "n", a.config.Replica)
+		if !spec.Initialized {
+			break
+		}
+
+		switch a.config.Replica {
+		case 0:
+			result.Init, err = a.Initialize(ctx)
+			a.config.Journal.record(ctx, a.journalCluster(), "init", "", err)
+			if recordAction(a.config.Cluster, "init", err) != nil {
+				return result, fmt.Errorf("initialize: %w", vaultError(err))
+			}
+
+		default:
+			result.Join, err = a.JoinRaftCluster(ctx)
+			a.config.Journal.record(ctx, a.journalCluster(), "raft join", a.config.RaftLeaderAPIAddr, err)
+			if recordAction(a.config.Cluster, "join", err) != nil {
+				return result, fmt.Errorf("raft join: %w", vaultError(err))
+			}
+		}
+		fallthrough
+
+	case StateSealed, StateMigrating:
+		if spec.Sealed {
+			break
+		}
+		// Migrating the seal rewrites the keyring, so it waits for a maintenance window unless refused anyway.
+		if result.State == StateMigrating && a.config.SealMigrate {
+			if err := checkMaintenanceWindow("seal migration", time.Now()); err != nil {
+				slog.Info("Waiting for a maintenance window to migrate the seal", "error", err)
+				return result, nil
+			}
+		}
+		// Nodes that just initialized or joined have no canary to wait for.
+		if result.State == StateSealed && a.config.UnsealCanary != nil {
+			if ready, reason := a.config.UnsealCanary.ready(ctx); !ready {
+				slog.Info("Waiting for the canary node before unsealing", "reason", reason)
+				return result, nil
+			}
+		}
+
+		result.Unseal, err = a.unsealWithFallback(ctx, result.State == StateMigrating)
+		a.config.Journal.record(ctx, a.journalCluster(), "unseal", "", err)
+		if recordAction(a.config.Cluster, "unseal", err) != nil {
+			return result, fmt.Errorf("unseal: %w", vaultError(err))
+		}
+		result.Sealed = result.Unseal.Sealed
+		if result.Sealed {
+			return result, nil
+		}
+		fallthrough
+
+	case StateStandby, StateActive:
+		if !a.progressResumed {
+			if err := a.resumeProgress(ctx); err != nil {
+				slog.Warn("Cannot read the progress recorded on the secret", "error", err)
+			}
+		}
+		// Retried on later checks until they succeed, as Vault may not be active right after unsealing.
+		if a.rootToken != "" {
+			result.Bootstrap, err = a.Bootstrap(ctx)
+			a.config.Journal.record(ctx, a.journalCluster(), "bootstrap", "", err)
+			if recordAction(a.config.Cluster, "bootstrap", err) != nil {
+				return result, fmt.Errorf("bootstrap: %w", vaultError(err))
+			}
+		}
+		if a.revokedRootToken != "" {
+			err = a.RevokeRootToken(ctx, a.revokedRootToken)
+			a.config.Journal.record(ctx, a.journalCluster(), "revoke root token", "", err)
+			if recordAction(a.config.Cluster, "revoke_root_token", err) != nil {
+				return result, fmt.Errorf("revoke root token: %w", vaultError(err))
+			}
+			a.revokedRootToken = ""
+			a.saveProgress(ctx, rootTokenRevocationTag, "done")
+			result.RootTokenRevoked = true
+		}
+
+	case StateDRSecondary:
+		slog.Debug("Vault is a DR secondary, nothing to do", "sealed", result.Sealed)
+	}
+
+	return result, nil
+}
+
+// Initialize vault server and save generated keys in AWS Secrets Manager secret.
+// The initialization process is just executed for the first replica of the statefulset,
+// where the hostname ends with a 0.
+func (a *App) Initialize(ctx context.Context) (*InitResult, error) {
+	slog.Info("Initializing vault server...")
+
+	if err := a.checkNotDRSecondary(ctx); err != nil {
+		return nil, err
+	}
+
+	if err := a.checkKeyTransport(); err != nil {
+		return nil, err
+	}
+
+	if err := a.CheckKMSKeys(ctx); err != nil {
+		return nil, fmt.Errorf("check KMS keys: %w", err)
+	}
+
+	if !a.config.ForceOverwrite {
+		if err := a.checkSecretUnused(ctx); err != nil {
+			return nil, err
+		}
+	}
+
+	sealStatus, err := a.vault.SealStatus(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("read seal status: %w", err)
+	}
+
+	// Auto-unseal seals generate recovery keys instead of unseal keys, and reject the secret shares settings.
+	result := &InitResult{SealType: sealStatus.Type}
+	if sealStatus.Type == "shamir" {
+		result.SecretShares = a.config.SecretShares
+		result.SecretThreshold = a.config.SecretThreshold
+	} else {
+		result.RecoveryShares = a.config.RecoveryShares
+		result.RecoveryThreshold = a.config.RecoveryThreshold
+	}
+
+	if err := a.config.Journal.claim(ctx, a.journalCluster(), "init"); err != nil {
+		return nil, err
+	}
+
+	// Other key stores keep previous values as they see fit.
+	if a.usesSecretsManager() {
+		archivedStage, err := a.ArchiveSecretValue(ctx)
+		if err != nil {
+			a.config.Journal.release(context.WithoutCancel(ctx), a.journalCluster(), "init")
+			return nil, fmt.Errorf("archive secret: %w", err)
+		}
+		result.ArchivedStage = archivedStage
+	}
+
+	initResponse, err := a.vault.Init(ctx, &api.InitRequest{
+		SecretShares:      result.SecretShares,
+		SecretThreshold:   result.SecretThreshold,
+		RecoveryShares:    result.RecoveryShares,
+		RecoveryThreshold: result.RecoveryThreshold,
+	})
+	if err != nil {
+		// Vault was not initialized, or its keys were lost with the response, so the claim protects nothing.
+		a.config.Journal.release(context.WithoutCancel(ctx), a.journalCluster(), "init")
+		return nil, fmt.Errorf("init vault: %w", err)
+	}
+	if len(a.config.BootstrapSteps) > 0 {
+		a.rootToken, a.bootstrapApplied = initResponse.RootToken, 0
+	}
+	switch a.config.RootTokenPolicy {
+	case rootTokenDiscard:
+		initResponse.RootToken = ""
+	case rootTokenRevokeAfterBootstrap:
+		a.revokedRootToken = initResponse.RootToken
+	}
+
+	slog.Info("Vault server initialized successfully, uploading result to AWS...", "secretID", a.config.SecretID)
+
+	// Vault cannot be initialized again, so the writes outlive the check deadline.
+	ctx = context.WithoutCancel(ctx)
+
+	// Persisted as is if the writes keep failing, so the keys are never lost.
+	fullResponse, err := json.Marshal(&initResponse)
+	if err != nil {
+		panic("couldn't marshal init response:" + err.Error())
+	}
+
+	if a.config.RootTokenSecretName != "" && initResponse.RootToken != "" {
+		err = a.retryWrite(ctx, "store root token", fullResponse, func() (err error) {
+			result.RootTokenSecretARN, err = a.StoreRootToken(ctx, initResponse.RootToken)
+			return err
+		})
+		if err != nil {
+			return result, fmt.Errorf("store root token: %w", err)
+		}
+		initResponse.RootToken = ""
+	}
+
+	err = a.retryWrite(ctx, "update secret", fullResponse, func() error {
+		version, err := a.writeInitResponse(ctx, initResponse)
+		if err != nil {
+			return err
+		}
+
+		result.SecretARN = version.ARN
+		result.SecretVersionID = version.VersionID
+		slog.Info("Updated secret", "arn", result.SecretARN, "version", result.SecretVersionID)
+		return nil
+	})
+	if err != nil {
+		return result, fmt.Errorf("update secret: %w", err)
+	}
+
+	if err := a.ReplicateSecret(ctx); err != nil {
+		slog.Error("Cannot replicate secret", "error", err)
+	}
+	if err := a.TagSecret(ctx); err != nil {
+		slog.Error("Cannot tag secret", "error", err)
+	}
+	if err := a.TagClusterMetadata(ctx, result); err != nil {
+		slog.Error("Cannot tag secret with the cluster metadata", "error", err)
+	}
+	if len(a.config.BootstrapSteps) > 0 {
+		a.saveProgress(ctx, bootstrapProgressTag, fmt.Sprintf("0/%d", len(a.config.BootstrapSteps)))
+	}
+	if a.revokedRootToken != "" {
+		a.saveProgress(ctx, rootTokenRevocationTag, "pending")
+	}
+	if err := a.ConfigureRotation(ctx); err != nil {
+		slog.Error("Cannot configure secret rotation", "error", err)
+	}
+
+	slog.Info("Initialization process completed")
+	return result, nil
+}
+
+// Check the secret does not hold an init response yet, as overwriting it would lose the keys of
+// a previously initialized cluster, e.g. after redeploying with a new storage volume by mistake.
+func (a *App) checkSecretUnused(ctx context.Context) error {
+	if a.config.KeyStore == nil && len(a.config.KeyStoreMirrors) == 0 {
+		return a.checkSecretsManagerUnused(ctx)
+	}
+
+	stored, err := a.keyStore().exists(ctx)
+	if err != nil {
+		return err
+	}
+	if stored {
+		return fmt.Errorf("%w: the key store holds a value, set FORCE_OVERWRITE=true to overwrite it", ErrSecretInUse)
+	}
+	return nil
+}
+
+// Check the AWS Secrets Manager secret does not hold an init response yet.
+func (a *App) checkSecretsManagerUnused(ctx context.Context) error {
+	secret, err := a.secretsManager.GetSecretValue(ctx, &secretsmanager.GetSecretValueInput{
+		SecretId: &a.config.SecretID,
+	})
+	if err != nil {
+		var notFound *types.ResourceNotFoundException
+		if errors.As(err, &notFound) {
+			// The secret has no value yet.
+			return nil
+		}
+		return fmt.Errorf("get AWS secret: %w", err)
+	}
+
+	if len(secret.SecretBinary) > 0 {
+		return fmt.Errorf("%w: version %s holds a binary value, set FORCE_OVERWRITE=true to overwrite it", ErrSecretInUse, aws.ToString(secret.VersionId))
+	}
+	if isAgePayload(aws.ToString(secret.SecretString)) {
+		return fmt.Errorf("%w: version %s holds an age encrypted init response, set FORCE_OVERWRITE=true to overwrite it", ErrSecretInUse, aws.ToString(secret.VersionId))
+	}
+
+	var (
+		initResponse api.InitResponse
+		manifest     chunkManifest
+		sealed       envelope
+		versioned    versionedPayload
+	)
+	if json.Unmarshal([]byte(aws.ToString(secret.SecretString)), &initResponse) != nil {
+		return nil
+	}
+	_ = json.Unmarshal([]byte(aws.ToString(secret.SecretString)), &manifest)
+	_ = json.Unmarshal([]byte(aws.ToString(secret.SecretString)), &sealed)
+	_ = json.Unmarshal([]byte(aws.ToString(secret.SecretString)), &versioned)
+	if len(initResponse.KeysB64) > 0 || len(initResponse.RecoveryKeysB64) > 0 || initResponse.RootToken != "" || len(manifest.Chunks) > 0 || len(sealed.Ciphertext) > 0 || versioned.Schema > 0 {
+		return fmt.Errorf("%w: version %s holds an init response, set FORCE_OVERWRITE=true to overwrite it", ErrSecretInUse, aws.ToString(secret.VersionId))
+	}
+	return nil
+}
+
+// Check Vault is not a DR secondary right before acting on it, as Initialize and Unseal may be called
+// without checking its status first.
+func (a *App) checkNotDRSecondary(ctx context.Context) error {
+	health, err := a.vault.Health(ctx)
+	if err != nil {
+		return fmt.Errorf("read health: %w", err)
+	}
+	if health.ReplicationDRMode == "secondary" {
+		return fmt.Errorf("%w: refusing to use the stored keys", ErrDRSecondary)
+	}
+	return nil
+}
+
+// Join Raft cluster contacting leader, used to bootstrap follower replicas.
+func (a *App) JoinRaftCluster(ctx context.Context) (*JoinResult, error) {
+	slog.Info("Joining RAFT cluster...")
+
+	opts := api.RaftJoinRequest{LeaderAPIAddr: a.config.RaftLeaderAPIAddr}
+	// Read on every join, so renewed certificates are used without restarting.
+	for _, setting := range []struct {
+		env, raw string
+		value    *string
+	}{
+		{"RAFT_LEADER_CA_CERT", a.config.RaftLeaderCACert, &opts.LeaderCACert},
+		{"RAFT_LEADER_CLIENT_CERT", a.config.RaftLeaderClientCert, &opts.LeaderClientCert},
+		{"RAFT_LEADER_CLIENT_KEY", a.config.RaftLeaderClientKey, &opts.LeaderClientKey},
+	} {
+		value, err := parseEnvFile(setting.raw)
+		if err != nil {
+			return nil, fmt.Errorf("%s env is invalid: %w", setting.env, err)
+		}
+		*setting.value = value
+	}
+
+	if a.config.SVIDSource != nil && opts.LeaderClientCert == "" {
+		svid, err := a.config.SVIDSource.GetX509SVID()
+		if err != nil {
+			return nil, fmt.Errorf("get X.509 SVID: %w", err)
+		}
+		certPEM, keyPEM, err := svid.Marshal()
+		if err != nil {
+			return nil, fmt.Errorf("marshal X.509 SVID: %w", err)
+		}
+		opts.LeaderClientCert, opts.LeaderClientKey = string(certPEM), string(keyPEM)
+	}
+
+	res, err := a.vault.RaftJoin(ctx, &opts)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &JoinResult{
+		LeaderAPIAddr: opts.LeaderAPIAddr,
+		Joined:        res.Joined,
+	}
+	if !res.Joined {
+		return result, fmt.Errorf("%w: leader %s", ErrNotLeader, opts.LeaderAPIAddr)
+	}
+
+	slog.Info("Joined RAFT cluster successfully")
+	return result, nil
+}
+
+// Unseal Vault right away, as requested by an operator, without waiting for the canary node. Returns nil if
+// Vault is not sealed. Migrating the seal still needs VAULT_SEAL_MIGRATE and a maintenance window.
+func (a *App) UnsealNow(ctx context.Context) (*UnsealResult, error) {
+	state, err := a.readState(ctx)
+	if err != nil {
+		return nil, err
+	}
+	switch state.State {
+	case StateSealed:
+	case StateMigrating:
+		if err := checkMaintenanceWindow("seal migration", time.Now()); err != nil {
+			return nil, err
+		}
+	default:
+		slog.Info("Vault is not sealed, nothing to unseal", "state", state.State)
+		return nil, nil
+	}
+
+	result, err := a.unsealWithFallback(ctx, state.State == StateMigrating)
+	a.config.Journal.record(ctx, a.journalCluster(), "unseal", "", err)
+	return result, recordAction(a.config.Cluster, "unseal", err)
+}
+
+// Fetch unseal keys from AWS Secrets Manager secret, or the SSM parameter if configured, and unseal Vault server.
+// With migrate, the keys are submitted to complete a pending seal migration, which must be allowed by the config.
+func (a *App) Unseal(ctx context.Context, migrate bool) (*UnsealResult, error) {
+	if migrate && !a.config.SealMigrate {
+		return nil, fmt.Errorf("%w: seal migration pending, set VAULT_SEAL_MIGRATE=true to unseal migrating the seal", ErrUnsealFailed)
+	}
+
+	// Auto-unseal seals unseal Vault by themselves, and only take the keys of the old seal when migrating.
+	if status, err := a.vault.SealStatus(ctx); !migrate && err == nil && status.Type != "shamir" {
+		slog.Info("Vault uses an auto-unseal seal, waiting for it to unseal itself", "sealType", status.Type)
+		return &UnsealResult{Sealed: status.Sealed}, nil
+	}
+
+	secretString, err := a.readInitResponse(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	fingerprint := fmt.Sprintf("%x", sha256.Sum256([]byte(secretString)))
+	if fingerprint == a.failedKeys {
+		return nil, fmt.Errorf("%w: the stored keys already failed to unseal vault, waiting for them to change", ErrUnsealFailed)
+	}
+
+	var initResponse api.InitResponse
+
+	err = json.Unmarshal([]byte(secretString), &initResponse)
+	if err != nil {
+		// Reading the same value again cannot help either.
+		a.failedKeys = fingerprint
+		return nil, fmt.Errorf("%w: unmarshal: %w", ErrKeysInvalid, err)
+	}
+
+	if err := a.checkKeyTransport(); err != nil {
+		return nil, err
+	}
+
+	if err := a.checkNotDRSecondary(ctx); err != nil {
+		return nil, err
+	}
+
+	slog.Info("Unseal keys received, unsealing vault server...", "migrate", migrate)
+
+	// Progress left by an interrupted attempt would be combined with the new shares.
+	if status, err := a.vault.SealStatus(ctx); err == nil && status.Progress > 0 {
+		slog.Warn("Vault has unseal progress from a previous attempt, resetting it", "progress", status.Progress)
+		a.resetUnseal(ctx)
+	}
+
+	// Shares are submitted in random order, so every stored share is exercised over time
+	// rather than only the first ones up to the threshold.
+	result := &UnsealResult{Sealed: true, Migrate: migrate}
+	for _, i := range rand.Perm(len(initResponse.KeysB64)) {
+		key := initResponse.KeysB64[i]
+		status, err := a.vault.Unseal(ctx, &api.UnsealOpts{Key: key, Migrate: migrate})
+		if err != nil {
+			a.resetUnseal(ctx)
+		}
+		if isKeyMismatch(err) {
+			// Retrying cannot help, so the keys are not submitted again until they change.
+			a.failedKeys = fingerprint
+			alert(ctx, "The stored unseal keys do not match this Vault's barrier, the secret may belong to another cluster or the storage was wiped", "shard", i, "error", err)
+			return result, &ShardError{Index: i, Err: fmt.Errorf("%w: %w", ErrKeyMismatch, err)}
+		}
+		if err != nil {
+			return result, &ShardError{Index: i, Err: err}
+		}
+		result.KeysSubmitted++
+		result.SharesSubmitted = append(result.SharesSubmitted, i)
+		result.Threshold = status.T
+		result.Progress = status.Progress
+		result.Sealed = status.Sealed
+		sharesCounter.WithLabelValues(a.config.Cluster, strconv.Itoa(i)).Inc()
+
+		slog.Info("Unseal", "share", i, "progress", status.Progress)
+		if status.Progress <= 0 {
+			break
+		}
+	}
+
+	// Confirmed with a fresh health check, as the unseal responses may be stale on a busy node.
+	if health, err := a.vault.Health(ctx); err != nil {
+		slog.Warn("Cannot confirm vault is unsealed", "error", err)
+	} else {
+		result.Sealed = health.Sealed
+	}
+
+	if result.Sealed {
+		if result.Threshold > 0 && result.KeysSubmitted >= result.Threshold {
+			// The same keys would fail again, so they are not submitted until they change.
+			a.failedKeys = fingerprint
+			alert(ctx, "Vault still sealed after submitting the threshold of unseal keys, not retrying with the same keys", "keysSubmitted", result.KeysSubmitted, "threshold", result.Threshold)
+		}
+		return result, fmt.Errorf("%w: vault still sealed after submitting %d keys", ErrUnsealFailed, result.KeysSubmitted)
+	}
+	a.failedKeys = ""
+
+	slog.Info("Vault server unsealed successfully")
+	return result, nil
+}
+
+// Discard the shares submitted so far, so the next attempt starts over. Done even if the context is done,
+// as it is called after failures.
+func (a *App) resetUnseal(ctx context.Context) {
+	if err := a.vault.ResetUnseal(context.WithoutCancel(ctx)); err != nil {
+		slog.Warn("Cannot reset unseal progress", "error", err)
+		return
+	}
+	slog.Info("Reset unseal progress")
+}
+
+// Read the init response JSON from the key store, or the SSM parameter if configured, joining its chunks
+// and decrypting it as needed.
+func (a *App) readInitResponse(ctx context.Context) (string, error) {
+	var (
+		secretString string
+		err          error
+	)
+	if a.config.SSMParameterName != "" {
+		slog.Info("Fetching unseal keys...", "ssmParameter", a.config.SSMParameterName)
+		secretString, err = a.readSSMParameter(ctx, a.config.SSMParameterName)
+		if err == nil {
+			secretString, err = joinChunks(ctx, secretString, ssmChunkReader(a.ssm))
+		}
+	} else {
+		secretString, err = a.keyStore().readPayload(ctx)
+	}
+	if err == nil {
+		secretString, err = a.openPayload(ctx, secretString)
+	}
+	if err == nil {
+		secretString, err = unwrapPayload(secretString)
+	}
+	if err == nil && len(a.config.ShareSecrets) > 0 {
+		secretString, err = a.joinShares(ctx, secretString)
+	}
+	return secretString, err
+}
+
+// Write the init response to the key store, encrypting it as configured. With share secrets, the shares
+// are written to them first, and the key store holds the init response without them.
+func (a *App) writeInitResponse(ctx context.Context, initResponse *api.InitResponse) (storedVersion, error) {
+	if len(a.config.ShareSecrets) > 0 {
+		var err error
+		if initResponse, err = a.writeShares(ctx, initResponse); err != nil {
+			return storedVersion{}, err
+		}
+	}
+
+	data, err := json.Marshal(initResponse)
+	if err == nil {
+		data, err = wrapPayload(data, a.config.PayloadSchema)
+	}
+	if err != nil {
+		return storedVersion{}, fmt.Errorf("marshal init response: %w", err)
+	}
+	ctx = withWriteToken(ctx, a.config.SecretID, data)
+	if data, err = a.sealPayload(ctx, data); err != nil {
+		return storedVersion{}, fmt.Errorf("encrypt init response: %w", err)
+	}
+
+	version, err := a.keyStore().writePayload(ctx, string(data))
+	detail := a.config.SecretID
+	if err == nil {
+		detail += " version " + version.VersionID
+	}
+	a.config.Journal.record(ctx, a.journalCluster(), "secret written", detail, err)
+	return version, err
+}
+
+// Encrypt the payload to the operator age recipients and with the envelope KMS key, as configured.
+func (a *App) sealPayload(ctx context.Context, data []byte) ([]byte, error) {
+	data, err := a.sealAgePayload(data)
+	if err != nil || a.config.EnvelopeKMSKeyID == "" {
+		return data, err
+	}
+	return a.sealEnvelope(ctx, data)
+}
+
+// Decrypt the payload sealed by sealPayload. Payloads stored unencrypted are returned as is.
+func (a *App) openPayload(ctx context.Context, value string) (string, error) {
+	value, err := a.openEnvelope(ctx, value)
+	if err != nil {
+		return "", err
+	}
+	return a.openAgePayload(value)
+}
+
+// Read the init response from the AWS Secrets Manager secret, at the pinned version if configured.
+func (a *App) readSecretValue(ctx context.Context) (string, error) {
+	input := &secretsmanager.GetSecretValueInput{
+		SecretId: &a.config.SecretID,
+	}
+	if a.config.SecretVersionID != "" {
+		input.VersionId = &a.config.SecretVersionID
+	}
+	if a.config.SecretVersionStage != "" {
+		input.VersionStage = &a.config.SecretVersionStage
+	}
+	if stage := secretVersionStage(ctx); stage != nil {
+		input.VersionStage = stage
+	}
+
+	secret, err := a.secretsManager.GetSecretValue(ctx, input)
+	if err != nil {
+		var notFound *types.ResourceNotFoundException
+		if errors.As(err, &notFound) {
+			return "", fmt.Errorf("get AWS secret: %w: %w", ErrSecretMissing, err)
+		}
+		return "", fmt.Errorf("get AWS secret: %w", err)
+	}
+	slog.Info("Read secret value", "version", aws.ToString(secret.VersionId), "stages", secret.VersionStages)
+	if secret.SecretString == nil && len(secret.SecretBinary) > 0 {
+		return decodeSecretBinary(secret.SecretBinary)
+	}
+	if secret.SecretString == nil {
+		return "", fmt.Errorf("get AWS secret: %w: no secret string", ErrSecretMissing)
+	}
+	return *secret.SecretString, nil
+}
+
+// Read a chunk of the init response from the secret created for it, at the version if set.
+func (a *App) readSecretChunk(ctx context.Context, name, version string) (string, error) {
+	input := &secretsmanager.GetSecretValueInput{SecretId: &name, VersionStage: secretVersionStage(ctx)}
+	if version != "" {
+		input.VersionId, input.VersionStage = &version, nil
+	}
+	secret, err := a.secretsManager.GetSecretValue(ctx, input)
+	if err != nil {
+		return "", fmt.Errorf("get AWS secret: %w", err)
+	}
+	return aws.ToString(secret.SecretString), nil
+}
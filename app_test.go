@@ -0,0 +1,199 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+
+	"github.com/hashicorp/vault/api"
+)
+
+func newTestApp(replica int) (*App, *fakeVault, *fakeSecretsManager) {
+	vault := newFakeVault()
+	secretsManager := newFakeSecretsManager()
+	config := Config{
+		SecretID:        "vault",
+		SecretShares:    5,
+		SecretThreshold: 3,
+		Replica:         replica,
+	}
+	return NewApp(config, vault, secretsManager, nil, nil), vault, secretsManager
+}
+
+func TestCheckVaultStatusInitializesAndUnseals(t *testing.T) {
+	app, vault, secretsManager := newTestApp(0)
+
+	result, err := app.CheckVaultStatus(context.Background())
+	if err != nil {
+		t.Fatalf("check status: %v", err)
+	}
+	if result.Init == nil || result.Init.SecretShares != 5 || secretsManager.value == nil {
+		t.Fatalf("expected Vault initialized and the secret updated, got %+v", result.Init)
+	}
+	if result.Unseal == nil || result.Unseal.Sealed || result.Unseal.KeysSubmitted != 3 {
+		t.Fatalf("expected Vault unsealed with 3 keys, got %+v", result.Unseal)
+	}
+	if vault.inits != 1 || vault.sealed {
+		t.Fatalf("expected a single init and Vault unsealed, got %d inits, sealed %v", vault.inits, vault.sealed)
+	}
+}
+
+func TestCheckVaultStatusUnsealsWithStoredKeys(t *testing.T) {
+	app, vault, _ := newTestApp(0)
+	if _, err := app.CheckVaultStatus(context.Background()); err != nil {
+		t.Fatalf("initialize: %v", err)
+	}
+
+	// Restarted node.
+	vault.sealed = true
+	vault.standby = true
+
+	result, err := app.CheckVaultStatus(context.Background())
+	if err != nil {
+		t.Fatalf("check status: %v", err)
+	}
+	if result.State != StateSealed || result.Init != nil {
+		t.Fatalf("expected a sealed node unsealed without init, got %+v", result)
+	}
+	if result.Unseal == nil || result.Unseal.Sealed || vault.sealed {
+		t.Fatalf("expected Vault unsealed, got %+v", result.Unseal)
+	}
+}
+
+func TestCheckVaultStatusJoinsFollowers(t *testing.T) {
+	leader, _, secretsManager := newTestApp(0)
+	if _, err := leader.CheckVaultStatus(context.Background()); err != nil {
+		t.Fatalf("initialize leader: %v", err)
+	}
+
+	follower, vault, _ := newTestApp(1)
+	follower.secretsManager = secretsManager
+	// Raft followers share the keys of the leader.
+	leaderVault := leader.vault.(*fakeVault)
+	vault.keys, vault.threshold = leaderVault.keys, leaderVault.threshold
+
+	result, err := follower.CheckVaultStatus(context.Background())
+	if err != nil {
+		t.Fatalf("check status: %v", err)
+	}
+	if result.Join == nil || vault.joins != 1 || vault.inits != 0 {
+		t.Fatalf("expected the follower to join without init, got %+v", result)
+	}
+	if vault.sealed {
+		t.Fatalf("expected the follower unsealed")
+	}
+}
+
+func TestCheckVaultStatusLeavesDRSecondaries(t *testing.T) {
+	app, vault, _ := newTestApp(0)
+	vault.drSecondary = true
+
+	result, err := app.CheckVaultStatus(context.Background())
+	if err != nil {
+		t.Fatalf("check status: %v", err)
+	}
+	if result.State != StateDRSecondary || vault.inits != 0 || vault.unseals != 0 {
+		t.Fatalf("expected the DR secondary left alone, got %+v", result)
+	}
+}
+
+func TestUnsealStopsOnKeyMismatch(t *testing.T) {
+	app, vault, _ := newTestApp(0)
+	if _, err := app.CheckVaultStatus(context.Background()); err != nil {
+		t.Fatalf("initialize: %v", err)
+	}
+
+	// Vault restored from a backup of another cluster.
+	vault.sealed = true
+	vault.keys = []string{"other"}
+
+	_, err := app.CheckVaultStatus(context.Background())
+	if !errors.Is(err, ErrKeyMismatch) {
+		t.Fatalf("expected a key mismatch, got %v", err)
+	}
+
+	unseals := vault.unseals
+	_, err = app.CheckVaultStatus(context.Background())
+	if !errors.Is(err, ErrUnsealFailed) || vault.unseals != unseals {
+		t.Fatalf("expected the mismatched keys not submitted again, got %v after %d unseals", err, vault.unseals-unseals)
+	}
+}
+
+// Counts the unseal progress resets, failing the unseal requests with err if set.
+type resettingVault struct {
+	*fakeVault
+	resets    int
+	unsealErr error
+}
+
+func (v *resettingVault) Unseal(ctx context.Context, opts *api.UnsealOpts) (*api.SealStatusResponse, error) {
+	if v.unsealErr != nil {
+		v.progress = append(v.progress, opts.Key)
+		return nil, v.unsealErr
+	}
+	return v.fakeVault.Unseal(ctx, opts)
+}
+
+func (v *resettingVault) ResetUnseal(ctx context.Context) error {
+	v.resets++
+	return v.fakeVault.ResetUnseal(ctx)
+}
+
+func TestUnsealResetsProgress(t *testing.T) {
+	// Left by an interrupted attempt, and combined with the new shares if not reset.
+	app, fake := initializedTestApp(t, 0)
+	vault := &resettingVault{fakeVault: fake}
+	app.vault = vault
+	fake.progress = []string{"stale"}
+	if _, err := app.Unseal(context.Background(), false); err != nil || fake.sealed || vault.resets != 1 {
+		t.Fatalf("expected the stale progress reset and Vault unsealed, got %d resets, sealed %t, %v", vault.resets, fake.sealed, err)
+	}
+
+	// Discarded after a transient failure, so the next attempt starts over.
+	app, fake = initializedTestApp(t, 0)
+	vault = &resettingVault{fakeVault: fake, unsealErr: &api.ResponseError{StatusCode: http.StatusServiceUnavailable, Errors: []string{"Vault is sealed"}}}
+	app.vault = vault
+	_, err := app.Unseal(context.Background(), false)
+	if err == nil || errors.Is(err, ErrKeyMismatch) {
+		t.Fatalf("expected a transient unseal failure, got %v", err)
+	}
+	if vault.resets != 1 || len(fake.progress) != 0 {
+		t.Errorf("expected the progress reset after the failure, got %d resets and progress %v", vault.resets, fake.progress)
+	}
+}
+
+func TestUnsealLeavesAutoUnsealToVault(t *testing.T) {
+	app, vault, _ := newTestApp(0)
+	if _, err := app.CheckVaultStatus(context.Background()); err != nil {
+		t.Fatalf("initialize: %v", err)
+	}
+
+	// Vault restarted with an awskms seal, still unsealing itself.
+	vault.sealed = true
+	vault.sealType = "awskms"
+
+	unseals := vault.unseals
+	result, err := app.Unseal(context.Background(), false)
+	if err != nil || result == nil || !result.Sealed || result.KeysSubmitted != 0 || vault.unseals != unseals {
+		t.Fatalf("expected no keys submitted, got %+v, %v", result, err)
+	}
+}
+
+func TestUnsealNow(t *testing.T) {
+	app, vault, _ := newTestApp(0)
+	if _, err := app.CheckVaultStatus(context.Background()); err != nil {
+		t.Fatalf("initialize: %v", err)
+	}
+
+	unseals := vault.unseals
+	if result, err := app.UnsealNow(context.Background()); err != nil || result != nil || vault.unseals != unseals {
+		t.Fatalf("expected an unsealed Vault left alone, got %+v, %v", result, err)
+	}
+
+	vault.sealed = true
+	result, err := app.UnsealNow(context.Background())
+	if err != nil || result == nil || result.Sealed || vault.sealed {
+		t.Fatalf("expected Vault unsealed, got %+v, %v", result, err)
+	}
+}
@@ -0,0 +1,47 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/secretsmanager"
+	"github.com/aws/aws-sdk-go-v2/service/secretsmanager/types"
+)
+
+// Prefix of the staging labels attached to archived secret versions.
+const archiveStagePrefix = "ARCHIVED-"
+
+// Archive the current secret value before it is overwritten, attaching an `ARCHIVED-<timestamp>` staging
+// label to its version. Labeled versions are never deprecated by AWS Secrets Manager, so the value can be
+// recovered, or used to unseal with SECRETSMANAGER_VERSION_STAGE. Returns the label, or an empty string if
+// the secret has no value.
+func (a *App) ArchiveSecretValue(ctx context.Context) (string, error) {
+	secret, err := a.secretsManager.GetSecretValue(ctx, &secretsmanager.GetSecretValueInput{
+		SecretId: &a.config.SecretID,
+	})
+	if err != nil {
+		var notFound *types.ResourceNotFoundException
+		if errors.As(err, &notFound) {
+			return "", nil
+		}
+		return "", fmt.Errorf("get AWS secret: %w", err)
+	}
+
+	stage := archiveStagePrefix + time.Now().UTC().Format("20060102T150405Z")
+
+	_, err = a.secretsManager.UpdateSecretVersionStage(ctx, &secretsmanager.UpdateSecretVersionStageInput{
+		SecretId:        &a.config.SecretID,
+		VersionStage:    &stage,
+		MoveToVersionId: secret.VersionId,
+	})
+	if err != nil {
+		return "", fmt.Errorf("label secret version: %w", err)
+	}
+
+	slog.Info("Archived secret value", "version", aws.ToString(secret.VersionId), "stage", stage)
+	return stage, nil
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/secretsmanager"
+	"github.com/aws/aws-sdk-go-v2/service/secretsmanager/types"
+)
+
+// Records the staging labels moved, failing if the version to move them to is gone.
+type labelingSecretsManager struct {
+	*fakeSecretsManager
+	moved   map[string]string
+	missing bool
+}
+
+func (s *labelingSecretsManager) UpdateSecretVersionStage(ctx context.Context, params *secretsmanager.UpdateSecretVersionStageInput, optFns ...func(*secretsmanager.Options)) (*secretsmanager.UpdateSecretVersionStageOutput, error) {
+	if s.missing {
+		return nil, &types.ResourceNotFoundException{Message: aws.String("secret version not found")}
+	}
+	s.moved[aws.ToString(params.VersionStage)] = aws.ToString(params.MoveToVersionId)
+	return s.fakeSecretsManager.UpdateSecretVersionStage(ctx, params, optFns...)
+}
+
+func TestArchiveSecretValue(t *testing.T) {
+	tests := map[string]struct {
+		value   *string
+		missing bool
+		err     string
+	}{
+		"current value labeled": {value: aws.String("init response")},
+		"no value":              {},
+		"version gone":          {value: aws.String("init response"), missing: true, err: "label secret version"},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			app, _, secretsManager := newTestApp(0)
+			secretsManager.value, secretsManager.version = test.value, 3
+			client := &labelingSecretsManager{fakeSecretsManager: secretsManager, moved: map[string]string{}, missing: test.missing}
+			app.secretsManager = client
+
+			stage, err := app.ArchiveSecretValue(context.Background())
+			if test.err != "" {
+				if err == nil || !strings.Contains(err.Error(), test.err) {
+					t.Fatalf("expected an error containing %q, got %v", test.err, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("archive: %v", err)
+			}
+			if test.value == nil {
+				if stage != "" || len(client.moved) != 0 {
+					t.Errorf("expected nothing archived, got %q, %v", stage, client.moved)
+				}
+				return
+			}
+			if !strings.HasPrefix(stage, archiveStagePrefix) || client.moved[stage] != "3" {
+				t.Errorf("expected the %s label moved to the current version, got %v", stage, client.moved)
+			}
+		})
+	}
+}
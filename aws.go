@@ -0,0 +1,237 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/aws/arn"
+	awshttp "github.com/aws/aws-sdk-go-v2/aws/transport/http"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/credentials/stscreds"
+	"github.com/aws/aws-sdk-go-v2/service/secretsmanager"
+	"github.com/aws/aws-sdk-go-v2/service/sts"
+	ststypes "github.com/aws/aws-sdk-go-v2/service/sts/types"
+	"github.com/spf13/viper"
+)
+
+// Create SDK client for AWS Secrets Manager service.
+// The SDK client can be configured using environment variables. See:
+// - https://aws.github.io/aws-sdk-go-v2/docs/configuring-sdk
+// - https://pkg.go.dev/github.com/aws/aws-sdk-go-v2/config#EnvConfig
+//
+// If SECRETSMANAGER_ROLE_ARN is set, the client assumes that role using the base credentials.
+// The client is pinned to the region of the secret (see secretRegion) instead of the SDK default region.
+// The resolved identity is logged, to tell which role is used when AWS denies access, and its account returned.
+func newAWSSecretManagerClient(ctx context.Context) (*secretsmanager.Client, string, error) {
+	cfg, err := loadAWSConfig(ctx)
+	if err != nil {
+		return nil, "", fmt.Errorf("load SDK config: %w", err)
+	}
+
+	if roleARN := viper.GetString("secretsmanager_role_arn"); roleARN != "" {
+		provider, err := newAssumeRoleProvider(cfg, roleARN)
+		if err != nil {
+			return nil, "", fmt.Errorf("assume role %s: %w", roleARN, err)
+		}
+		cfg.Credentials = aws.NewCredentialsCache(provider)
+	}
+
+	account := logCallerIdentity(ctx, cfg)
+	checkCrossAccountSecret(viper.GetString("secretsmanager_secret_id"), account)
+
+	return secretsmanager.NewFromConfig(cfg, func(o *secretsmanager.Options) {
+		o.BaseEndpoint = endpointURL("secretsmanager")
+		if region := secretRegion(); region != "" {
+			o.Region = region
+		}
+	}), account, nil
+}
+
+// Create an AWS Secrets Manager client assuming the role of the share secret, pinned to the region of the
+// secret if it is an ARN.
+func newAWSShareSecretClient(ctx context.Context, share shareSecret) (*secretsmanager.Client, error) {
+	cfg, err := loadAWSConfig(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("load SDK config: %w", err)
+	}
+	provider, err := newAssumeRoleProvider(cfg, share.RoleARN)
+	if err != nil {
+		return nil, fmt.Errorf("assume role %s: %w", share.RoleARN, err)
+	}
+	cfg.Credentials = aws.NewCredentialsCache(provider)
+
+	return secretsmanager.NewFromConfig(cfg, func(o *secretsmanager.Options) {
+		o.BaseEndpoint = endpointURL("secretsmanager")
+		if secretARN, err := arn.Parse(share.ID); err == nil {
+			o.Region = secretARN.Region
+		}
+	}), nil
+}
+
+// Returns the region of the secret: SECRETSMANAGER_REGION if set, otherwise the region of the secret ID
+// if it is an ARN, as secrets in other accounts are always referenced by ARN. Empty for the SDK default region.
+func secretRegion() string {
+	if region := viper.GetString("secretsmanager_region"); region != "" {
+		return region
+	}
+	if secretARN, err := arn.Parse(viper.GetString("secretsmanager_secret_id")); err == nil {
+		return secretARN.Region
+	}
+	return ""
+}
+
+// Log whether the secret belongs to another account than the caller, and warn about references
+// that cannot work across accounts.
+func checkCrossAccountSecret(secretID, callerAccount string) {
+	secretARN, err := arn.Parse(secretID)
+	if err != nil || callerAccount == "" || secretARN.AccountID == callerAccount {
+		return
+	}
+
+	slog.Info("Accessing secret cross-account", "secretAccount", secretARN.AccountID, "callerAccount", callerAccount)
+
+	// Complete secret ARNs end with a hyphen and 6 random characters.
+	name := strings.TrimPrefix(secretARN.Resource, "secret:")
+	if i := strings.LastIndex(name, "-"); i < 0 || len(name)-i-1 != 6 {
+		slog.Warn("Cross-account secret ID looks like a partial ARN, use the complete ARN including its random suffix", "secretID", secretID)
+	}
+}
+
+// Load the AWS SDK config shared by all AWS clients.
+// FIPS and dual-stack endpoints are forced with the USE_FIPS_ENDPOINT and USE_DUALSTACK_ENDPOINT envs,
+// otherwise the SDK defaults apply (including its AWS_USE_FIPS_ENDPOINT and AWS_USE_DUALSTACK_ENDPOINT envs).
+//
+// If WEB_IDENTITY_ROLE_ARN is set, the base credentials are obtained assuming that role with the token
+// in WEB_IDENTITY_TOKEN_FILE, instead of the SDK default credential chain (e.g. IRSA's AWS_ROLE_ARN and
+// AWS_WEB_IDENTITY_TOKEN_FILE envs).
+//
+// SDK logs are written to the application log at debug level, with secret payloads and credentials redacted.
+//
+// Retries default to the adaptive mode with more attempts than the SDK default, so the tool keeps working
+// during partial AWS degradation, and each attempt is bounded by AWS_CALL_TIMEOUT.
+//
+// AWS_PROXY_URL sets the proxy for AWS requests apart from the Vault API ones.
+//
+// With CHAOS_AWS_THROTTLE_RATE, requests are answered with throttling errors at that rate.
+func loadAWSConfig(ctx context.Context) (aws.Config, error) {
+	retryMode, err := aws.ParseRetryMode(viper.GetString("aws_retry_mode"))
+	if err != nil {
+		return aws.Config{}, fmt.Errorf("AWS_RETRY_MODE env is invalid: %w", err)
+	}
+
+	logMode, err := parseAWSLogMode(viper.GetString("aws_log_mode"))
+	if err != nil {
+		return aws.Config{}, fmt.Errorf("AWS_LOG_MODE env is invalid: %w", err)
+	}
+
+	proxy, err := parseProxy(viper.GetString("aws_proxy_url"))
+	if err != nil {
+		return aws.Config{}, fmt.Errorf("AWS_PROXY_URL env is invalid: %w", err)
+	}
+	var httpClient aws.HTTPClient = awshttp.NewBuildableClient().
+		WithTimeout(viper.GetDuration("aws_call_timeout")).
+		WithTransportOptions(func(t *http.Transport) { t.Proxy = proxy })
+	if chaos := newChaosConfig(); chaos.AWSThrottleRate > 0 {
+		httpClient = &chaosAWSClient{HTTPClient: httpClient, chaos: chaos}
+	}
+
+	opts := []func(*config.LoadOptions) error{
+		config.WithLogger(awsLogger{}),
+		config.WithClientLogMode(logMode),
+		config.WithRetryMode(retryMode),
+		config.WithRetryMaxAttempts(viper.GetInt("aws_max_attempts")),
+		config.WithHTTPClient(httpClient),
+	}
+
+	if viper.GetBool("use_fips_endpoint") {
+		opts = append(opts, config.WithUseFIPSEndpoint(aws.FIPSEndpointStateEnabled))
+	}
+	if viper.GetBool("use_dualstack_endpoint") {
+		opts = append(opts, config.WithUseDualStackEndpoint(aws.DualStackEndpointStateEnabled))
+	}
+
+	cfg, err := config.LoadDefaultConfig(ctx, opts...)
+	if err != nil {
+		return aws.Config{}, err
+	}
+
+	if roleARN := viper.GetString("web_identity_role_arn"); roleARN != "" {
+		tokenFile := viper.GetString("web_identity_token_file")
+		if tokenFile == "" {
+			return aws.Config{}, fmt.Errorf("WEB_IDENTITY_TOKEN_FILE env is required with WEB_IDENTITY_ROLE_ARN")
+		}
+
+		slog.Debug("Using web identity credentials", "roleARN", roleARN, "tokenFile", tokenFile)
+
+		client := sts.NewFromConfig(cfg, func(o *sts.Options) {
+			o.BaseEndpoint = endpointURL("sts")
+		})
+		cfg.Credentials = aws.NewCredentialsCache(stscreds.NewWebIdentityRoleProvider(client, roleARN, stscreds.IdentityTokenFile(tokenFile), func(o *stscreds.WebIdentityRoleOptions) {
+			o.RoleSessionName = viper.GetString("secretsmanager_role_session_name")
+		}))
+	}
+
+	return cfg, nil
+}
+
+// Log the AWS identity the credentials resolve to, returning its account. Failures are logged but not
+// returned, as the credentials may lack sts:GetCallerIdentity or STS may be unreachable.
+func logCallerIdentity(ctx context.Context, cfg aws.Config) string {
+	client := sts.NewFromConfig(cfg, func(o *sts.Options) {
+		o.BaseEndpoint = endpointURL("sts")
+	})
+
+	identity, err := client.GetCallerIdentity(ctx, &sts.GetCallerIdentityInput{})
+	if err != nil {
+		slog.Warn("Cannot resolve AWS identity", "error", err)
+		return ""
+	}
+
+	var source string
+	if creds, err := cfg.Credentials.Retrieve(ctx); err == nil {
+		source = creds.Source
+	}
+
+	slog.Info("Resolved AWS identity", "arn", aws.ToString(identity.Arn), "account", aws.ToString(identity.Account), "source", source)
+	return aws.ToString(identity.Account)
+}
+
+// Returns the endpoint URL configured for the AWS service with the <SERVICE>_ENDPOINT_URL env,
+// e.g. SECRETSMANAGER_ENDPOINT_URL, or nil to use the default endpoint resolution.
+func endpointURL(service string) *string {
+	if url := viper.GetString(service + "_endpoint_url"); url != "" {
+		return aws.String(url)
+	}
+	return nil
+}
+
+// Create a credentials provider assuming the role with STS, configured by the SECRETSMANAGER_ROLE_* envs.
+func newAssumeRoleProvider(cfg aws.Config, roleARN string) (*stscreds.AssumeRoleProvider, error) {
+	sessionTags, err := parseKeyValues(viper.GetString("secretsmanager_role_session_tags"))
+	if err != nil {
+		return nil, fmt.Errorf("parse session tags: %w", err)
+	}
+
+	tags := make([]ststypes.Tag, 0, len(sessionTags))
+	for key, value := range sessionTags {
+		tags = append(tags, ststypes.Tag{Key: aws.String(key), Value: aws.String(value)})
+	}
+
+	slog.Debug("Assuming role for AWS Secrets Manager", "roleARN", roleARN, "sessionTags", sessionTags)
+
+	client := sts.NewFromConfig(cfg, func(o *sts.Options) {
+		o.BaseEndpoint = endpointURL("sts")
+	})
+
+	return stscreds.NewAssumeRoleProvider(client, roleARN, func(o *stscreds.AssumeRoleOptions) {
+		o.RoleSessionName = viper.GetString("secretsmanager_role_session_name")
+		o.Tags = tags
+		if externalID := viper.GetString("secretsmanager_role_external_id"); externalID != "" {
+			o.ExternalID = aws.String(externalID)
+		}
+	}), nil
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"regexp"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/smithy-go/logging"
+)
+
+var awsLogModes = map[string]aws.ClientLogMode{
+	"signing":            aws.LogSigning,
+	"retries":            aws.LogRetries,
+	"request":            aws.LogRequest,
+	"request_with_body":  aws.LogRequestWithBody,
+	"response":           aws.LogResponse,
+	"response_with_body": aws.LogResponseWithBody,
+	"deprecated_usage":   aws.LogDeprecatedUsage,
+}
+
+// Parses comma-separated AWS SDK client log modes, e.g. `request,response,retries`.
+func parseAWSLogMode(raw string) (aws.ClientLogMode, error) {
+	var mode aws.ClientLogMode
+
+	for _, name := range strings.Split(raw, ",") {
+		name = strings.ToLower(strings.TrimSpace(name))
+		if name == "" {
+			continue
+		}
+		m, ok := awsLogModes[name]
+		if !ok {
+			return 0, fmt.Errorf("unknown log mode %q", name)
+		}
+		mode |= m
+	}
+	return mode, nil
+}
+
+var (
+	// JSON fields of AWS requests and responses holding secret payloads or credentials.
+	secretFieldPattern = regexp.MustCompile(`(?i)"(SecretString|SecretBinary|Value|Plaintext|CiphertextBlob|SecretAccessKey|SessionToken|AccessToken)"\s*:\s*"(?:[^"\\]|\\.)*"`)
+	// XML elements of STS responses holding credentials.
+	secretElementPattern = regexp.MustCompile(`(?s)<(SecretAccessKey|SessionToken)>.*?</(?:SecretAccessKey|SessionToken)>`)
+	// Form fields of STS requests and query parameters of presigned URLs holding credentials.
+	secretParamPattern = regexp.MustCompile(`(?i)\b(WebIdentityToken|SAMLAssertion|X-Amz-Security-Token|X-Amz-Signature)=[^&\s]*`)
+	// HTTP headers holding credentials.
+	secretHeaderPattern = regexp.MustCompile(`(?mi)^(Authorization|X-Amz-Security-Token|X-Aws-Ec2-Metadata-Token):.*$`)
+)
+
+// Log modes logging the request and response bodies, refused for S3 as objects are logged as is.
+const awsLogBodyModes = aws.LogRequestWithBody | aws.LogResponseWithBody
+
+// Logger for the AWS SDK writing to slog, redacting secret payloads and credentials.
+type awsLogger struct{}
+
+func (awsLogger) Logf(classification logging.Classification, format string, v ...interface{}) {
+	msg := redactAWSLog(fmt.Sprintf(format, v...))
+
+	if classification == logging.Warn {
+		slog.Warn(msg, "source", "aws-sdk")
+		return
+	}
+	slog.Debug(msg, "source", "aws-sdk")
+}
+
+func redactAWSLog(msg string) string {
+	msg = secretFieldPattern.ReplaceAllString(msg, `"$1":"[REDACTED]"`)
+	msg = secretElementPattern.ReplaceAllString(msg, "<$1>[REDACTED]</$1>")
+	msg = secretParamPattern.ReplaceAllString(msg, "$1=[REDACTED]")
+	return secretHeaderPattern.ReplaceAllString(msg, "$1: [REDACTED]")
+}
+
+// Returns the log mode without the body modes, warning if set. S3 object bodies, such as the encrypted
+// init response and the snapshots, cannot be redacted.
+func withoutBodyLogging(mode aws.ClientLogMode) aws.ClientLogMode {
+	if mode&awsLogBodyModes != 0 {
+		slog.Warn("Request and response bodies are not logged for S3, as objects cannot be redacted")
+	}
+	return mode &^ awsLogBodyModes
+}
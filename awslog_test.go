@@ -0,0 +1,108 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+)
+
+func TestParseAWSLogMode(t *testing.T) {
+	tests := map[string]struct {
+		raw  string
+		mode aws.ClientLogMode
+		err  bool
+	}{
+		"empty":          {raw: ""},
+		"single":         {raw: "retries", mode: aws.LogRetries},
+		"several":        {raw: "request, Response,retries", mode: aws.LogRequest | aws.LogResponse | aws.LogRetries},
+		"with bodies":    {raw: "request_with_body,response_with_body", mode: aws.LogRequestWithBody | aws.LogResponseWithBody},
+		"trailing comma": {raw: "signing,", mode: aws.LogSigning},
+		"unknown":        {raw: "request,everything", err: true},
+	}
+
+	for name, test := range tests {
+		mode, err := parseAWSLogMode(test.raw)
+		if (err != nil) != test.err {
+			t.Errorf("%s: expected error %v, got %v", name, test.err, err)
+			continue
+		}
+		if mode != test.mode {
+			t.Errorf("%s: expected mode %v, got %v", name, test.mode, mode)
+		}
+	}
+}
+
+func TestRedactAWSLog(t *testing.T) {
+	tests := map[string]struct {
+		msg string
+		// Secrets that must not be logged, and text that must be kept.
+		secrets []string
+		kept    []string
+	}{
+		"secret value": {
+			msg:     `{"SecretId":"vault","SecretString":"{\"root_token\":\"hvs.root\"}"}`,
+			secrets: []string{"hvs.root"},
+			kept:    []string{`"SecretId":"vault"`},
+		},
+		"KMS data key": {
+			msg:     `{"CiphertextBlob":"AQID","KeyId":"alias/vault","Plaintext":"c2VjcmV0"}`,
+			secrets: []string{"AQID", "c2VjcmV0"},
+			kept:    []string{"alias/vault"},
+		},
+		"headers": {
+			msg:     "POST / HTTP/1.1\r\nAuthorization: AWS4-HMAC-SHA256 Credential=AKIA/20240101, Signature=abc\r\nX-Amz-Security-Token: FwoGZX\r\nX-Aws-Ec2-Metadata-Token: AQAEA\r\nContent-Type: application/json",
+			secrets: []string{"Signature=abc", "FwoGZX", "AQAEA"},
+			kept:    []string{"Content-Type: application/json"},
+		},
+		"STS credentials": {
+			msg: `<AssumeRoleWithWebIdentityResponse><AssumeRoleWithWebIdentityResult><Credentials>
+<AccessKeyId>ASIAEXAMPLE</AccessKeyId>
+<SecretAccessKey>wJalrXUtnFEMI</SecretAccessKey>
+<SessionToken>IQoJb3JpZ2lu
+ZWNEFAKE</SessionToken>
+<Expiration>2024-01-01T00:00:00Z</Expiration></Credentials></AssumeRoleWithWebIdentityResult></AssumeRoleWithWebIdentityResponse>`,
+			secrets: []string{"wJalrXUtnFEMI", "IQoJb3JpZ2lu", "ZWNEFAKE"},
+			kept:    []string{"ASIAEXAMPLE", "<Expiration>2024-01-01T00:00:00Z</Expiration>"},
+		},
+		"SSO credentials": {
+			msg:     `{"roleCredentials":{"accessKeyId":"ASIAEXAMPLE","secretAccessKey":"wJalrXUtnFEMI","sessionToken":"IQoJb3JpZ2lu"}}`,
+			secrets: []string{"wJalrXUtnFEMI", "IQoJb3JpZ2lu"},
+			kept:    []string{"ASIAEXAMPLE"},
+		},
+		"web identity form": {
+			msg:     "Action=AssumeRoleWithWebIdentity&RoleArn=arn%3Aaws%3Aiam%3A%3A111111111111%3Arole%2Fvault-init&WebIdentityToken=eyJhbGciOi.eyJzdWIiOi.sig&Version=2011-06-15",
+			secrets: []string{"eyJhbGciOi"},
+			kept:    []string{"RoleArn=arn%3Aaws", "Version=2011-06-15"},
+		},
+		"presigned URL": {
+			msg:     "GET /snapshots/latest?X-Amz-Credential=AKIA&X-Amz-Security-Token=FwoGZX&X-Amz-Signature=0123abcd HTTP/1.1",
+			secrets: []string{"FwoGZX", "0123abcd"},
+			kept:    []string{"X-Amz-Credential=AKIA"},
+		},
+	}
+
+	for name, test := range tests {
+		redacted := redactAWSLog(test.msg)
+		for _, secret := range test.secrets {
+			if strings.Contains(redacted, secret) {
+				t.Errorf("%s: expected %q redacted, got %s", name, secret, redacted)
+			}
+		}
+		for _, kept := range test.kept {
+			if !strings.Contains(redacted, kept) {
+				t.Errorf("%s: expected %q kept, got %s", name, kept, redacted)
+			}
+		}
+		if !strings.Contains(redacted, "[REDACTED]") {
+			t.Errorf("%s: expected a redaction marker, got %s", name, redacted)
+		}
+	}
+}
+
+func TestS3RefusesBodyLogging(t *testing.T) {
+	mode := withoutBodyLogging(aws.LogRequestWithBody | aws.LogResponseWithBody | aws.LogRetries)
+	if mode != aws.LogRetries {
+		t.Fatalf("expected only the body modes dropped, got %v", mode)
+	}
+}
@@ -0,0 +1,160 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+
+	"github.com/spf13/viper"
+)
+
+const (
+	// Version of the Key Vault REST API.
+	azureKeyVaultAPIVersion = "7.4"
+	// Resource the access tokens are requested for.
+	azureKeyVaultResource = "https://vault.azure.net"
+	// Instance metadata service endpoint of the managed identities.
+	azureIMDSURL = "http://169.254.169.254"
+)
+
+// Key store keeping the payload in an Azure Key Vault secret, setting a new version on each write. Calls are
+// authenticated with AKS workload identity if its envs are injected, with the managed identity of the VM
+// otherwise.
+type azureKeyVaultStore struct {
+	vaultURI string
+	name     string
+
+	// Workload identity federation, exchanging the service account token in the file. Empty if not used.
+	authorityHost string
+	tenantID      string
+	clientID      string
+	tokenFile     string
+	// Instance metadata service, requesting tokens for the user-assigned identity clientID if set.
+	imdsURL string
+}
+
+// Create the key store of the `azurekeyvault` backend, storing in the AZURE_SECRET_NAME secret of the
+// AZURE_KEY_VAULT_URI vault.
+func newAzureKeyVaultStore() (keyStore, error) {
+	vaultURI := strings.TrimSuffix(viper.GetString("azure_key_vault_uri"), "/")
+	if u, err := url.Parse(vaultURI); err != nil || u.Scheme != "https" || u.Host == "" {
+		return nil, fmt.Errorf("AZURE_KEY_VAULT_URI env must be the https URI of the vault, got %q", vaultURI)
+	}
+	name := viper.GetString("azure_secret_name")
+	if name == "" {
+		return nil, errors.New("AZURE_SECRET_NAME env is required with the azurekeyvault secret backend")
+	}
+
+	// Envs injected by the AKS workload identity webhook, and read by the Azure SDKs.
+	authorityHost := os.Getenv("AZURE_AUTHORITY_HOST")
+	if authorityHost == "" {
+		authorityHost = "https://login.microsoftonline.com/"
+	}
+	return azureKeyVaultStore{
+		vaultURI:      vaultURI,
+		name:          name,
+		authorityHost: strings.TrimSuffix(authorityHost, "/") + "/",
+		tenantID:      os.Getenv("AZURE_TENANT_ID"),
+		clientID:      os.Getenv("AZURE_CLIENT_ID"),
+		tokenFile:     os.Getenv("AZURE_FEDERATED_TOKEN_FILE"),
+		imdsURL:       azureIMDSURL,
+	}, nil
+}
+
+// Returns the headers authenticating the Key Vault calls.
+func (s azureKeyVaultStore) authHeader(ctx context.Context) (http.Header, error) {
+	var token struct {
+		AccessToken string `json:"access_token"`
+	}
+
+	if s.tokenFile != "" {
+		assertion, err := os.ReadFile(s.tokenFile)
+		if err != nil {
+			return nil, fmt.Errorf("read federated token: %w", err)
+		}
+		err = callRESTAPI(ctx, http.DefaultClient, http.MethodPost, s.authorityHost+s.tenantID+"/oauth2/v2.0/token", nil, url.Values{
+			"grant_type":            {"client_credentials"},
+			"client_id":             {s.clientID},
+			"client_assertion_type": {"urn:ietf:params:oauth:client-assertion-type:jwt-bearer"},
+			"client_assertion":      {strings.TrimSpace(string(assertion))},
+			"scope":                 {azureKeyVaultResource + "/.default"},
+		}, &token)
+		if err != nil {
+			return nil, fmt.Errorf("get Azure workload identity token: %w", err)
+		}
+	} else {
+		query := url.Values{"api-version": {"2018-02-01"}, "resource": {azureKeyVaultResource}}
+		if s.clientID != "" {
+			query.Set("client_id", s.clientID)
+		}
+		err := callRESTAPI(ctx, http.DefaultClient, http.MethodGet, s.imdsURL+"/metadata/identity/oauth2/token?"+query.Encode(),
+			http.Header{"Metadata": {"true"}}, nil, &token)
+		if err != nil {
+			return nil, fmt.Errorf("get Azure managed identity token: %w", err)
+		}
+	}
+	return http.Header{"Authorization": {"Bearer " + token.AccessToken}}, nil
+}
+
+// Secret bundle of the Key Vault API, identified by the URI of its version.
+type azureSecretBundle struct {
+	ID          string `json:"id,omitempty"`
+	Value       string `json:"value"`
+	ContentType string `json:"contentType,omitempty"`
+}
+
+func (s azureKeyVaultStore) secretURL() string {
+	return s.vaultURI + "/secrets/" + url.PathEscape(s.name) + "?api-version=" + azureKeyVaultAPIVersion
+}
+
+func (s azureKeyVaultStore) readPayload(ctx context.Context) (string, error) {
+	header, err := s.authHeader(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	var secret azureSecretBundle
+	err = callRESTAPI(ctx, http.DefaultClient, http.MethodGet, s.secretURL(), header, nil, &secret)
+	var apiErr *restAPIError
+	if errors.As(err, &apiErr) && apiErr.StatusCode == http.StatusNotFound {
+		return "", fmt.Errorf("get Azure secret: %w: %w", ErrSecretMissing, err)
+	}
+	if err != nil {
+		return "", fmt.Errorf("get Azure secret: %w", err)
+	}
+	if secret.Value == "" {
+		return "", fmt.Errorf("get Azure secret: %w: empty value", ErrSecretMissing)
+	}
+	return secret.Value, nil
+}
+
+func (s azureKeyVaultStore) writePayload(ctx context.Context, payload string) (storedVersion, error) {
+	header, err := s.authHeader(ctx)
+	if err != nil {
+		return storedVersion{}, err
+	}
+
+	var secret azureSecretBundle
+	request := azureSecretBundle{Value: payload, ContentType: "application/json"}
+	if err := callRESTAPI(ctx, http.DefaultClient, http.MethodPut, s.secretURL(), header, request, &secret); err != nil {
+		return storedVersion{}, fmt.Errorf("set Azure secret: %w", err)
+	}
+	id, version, _ := cutLast(secret.ID, "/")
+	return storedVersion{ARN: id, VersionID: version}, nil
+}
+
+func (s azureKeyVaultStore) exists(ctx context.Context) (bool, error) {
+	return payloadStored(ctx, s)
+}
+
+// Slices s around the last instance of sep, like strings.Cut.
+func cutLast(s, sep string) (before, after string, found bool) {
+	if i := strings.LastIndex(s, sep); i >= 0 {
+		return s[:i], s[i+len(sep):], true
+	}
+	return s, "", false
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// Key Vault, Entra ID and instance metadata service keeping the versions of a secret in memory.
+func newAzureKeyVaultServer(t *testing.T, name string) *httptest.Server {
+	t.Helper()
+	var versions []string
+	mux := http.NewServeMux()
+	mux.HandleFunc("/metadata/identity/oauth2/token", func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Metadata") != "true" || r.URL.Query().Get("resource") != azureKeyVaultResource {
+			http.Error(w, "bad request", http.StatusBadRequest)
+			return
+		}
+		fmt.Fprint(w, `{"access_token": "token"}`)
+	})
+	mux.HandleFunc("/tenant/oauth2/v2.0/token", func(w http.ResponseWriter, r *http.Request) {
+		if r.PostFormValue("client_assertion") != "service-account-token" || r.PostFormValue("client_id") != "client" {
+			http.Error(w, "invalid assertion", http.StatusUnauthorized)
+			return
+		}
+		fmt.Fprint(w, `{"access_token": "token"}`)
+	})
+	mux.HandleFunc("/secrets/"+name, func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer token" {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		id := fmt.Sprintf("https://%s/secrets/%s/", r.Host, name)
+		switch r.Method {
+		case http.MethodGet:
+			if len(versions) == 0 {
+				http.Error(w, `{"error": {"code": "SecretNotFound"}}`, http.StatusNotFound)
+				return
+			}
+			_ = json.NewEncoder(w).Encode(azureSecretBundle{ID: id + "v1", Value: versions[len(versions)-1]})
+		case http.MethodPut:
+			var secret azureSecretBundle
+			if err := json.NewDecoder(r.Body).Decode(&secret); err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			versions = append(versions, secret.Value)
+			_ = json.NewEncoder(w).Encode(azureSecretBundle{ID: fmt.Sprintf("%sv%d", id, len(versions)), Value: secret.Value})
+		}
+	})
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestAzureKeyVaultStore(t *testing.T) {
+	server := newAzureKeyVaultServer(t, "vault-init")
+	store := azureKeyVaultStore{vaultURI: server.URL, name: "vault-init", imdsURL: server.URL}
+
+	if _, err := store.readPayload(context.Background()); !errors.Is(err, ErrSecretMissing) {
+		t.Fatalf("expected ErrSecretMissing without versions, got %v", err)
+	}
+
+	app, vault, _ := newTestApp(0)
+	app.config.KeyStore = store
+	result, err := app.CheckVaultStatus(context.Background())
+	if err != nil {
+		t.Fatalf("check status: %v", err)
+	}
+	if vault.sealed {
+		t.Fatal("expected Vault unsealed with the keys of the secret")
+	}
+	if result.Init.SecretVersionID != "v1" || !strings.HasSuffix(result.Init.SecretARN, "/secrets/vault-init") {
+		t.Errorf("expected version v1 of the secret, got %s %s", result.Init.SecretARN, result.Init.SecretVersionID)
+	}
+
+	// Workload identity exchanges the service account token.
+	tokenFile := filepath.Join(t.TempDir(), "token")
+	if err := os.WriteFile(tokenFile, []byte("service-account-token\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	store = azureKeyVaultStore{vaultURI: server.URL, name: "vault-init", authorityHost: server.URL + "/", tenantID: "tenant", clientID: "client", tokenFile: tokenFile}
+	if stored, err := store.exists(context.Background()); err != nil || !stored {
+		t.Errorf("expected the payload stored, got %v, %v", stored, err)
+	}
+}
+
+func TestNewAzureKeyVaultStore(t *testing.T) {
+	t.Setenv("AZURE_SECRET_NAME", "vault-init")
+	t.Setenv("AZURE_KEY_VAULT_URI", "http://example.vault.azure.net")
+	if _, err := newAzureKeyVaultStore(); err == nil {
+		t.Error("expected plaintext vault URIs rejected")
+	}
+	t.Setenv("AZURE_KEY_VAULT_URI", "https://example.vault.azure.net/")
+	if _, err := newAzureKeyVaultStore(); err != nil {
+		t.Errorf("expected the vault URI accepted, got %v", err)
+	}
+}
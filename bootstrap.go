@@ -0,0 +1,129 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/hashicorp/vault/api"
+)
+
+// Name of the policy attached to the bootstrap token.
+const bootstrapPolicyName = "vault-init-bootstrap"
+
+// BootstrapStep is a write to a Vault API path, e.g. `sys/mounts/secret` with `{"type": "kv-v2"}`.
+type BootstrapStep struct {
+	Path string         `json:"path"`
+	Data map[string]any `json:"data"`
+	// Vault Enterprise namespace the path is relative to, e.g. `team-a`. Empty for the root namespace.
+	Namespace string `json:"namespace,omitempty"`
+}
+
+// Read the bootstrap steps from a JSON file holding a list of steps.
+func loadBootstrapSteps(path string) ([]BootstrapStep, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var steps []BootstrapStep
+	if err := json.Unmarshal(data, &steps); err != nil {
+		return nil, fmt.Errorf("parse bootstrap file: %w", err)
+	}
+	for i, step := range steps {
+		if step.Path == "" {
+			return nil, fmt.Errorf("bootstrap step %d: path is required", i)
+		}
+	}
+	return steps, nil
+}
+
+// Configure a newly initialized Vault by applying the bootstrap steps. The root token is only used to create
+// a short-lived token with the bootstrap policy, which applies the steps and is revoked when done. Each
+// applied step is recorded on the secret, and later attempts, even after a restart, resume from the first
+// step not applied.
+func (a *App) Bootstrap(ctx context.Context) (*BootstrapResult, error) {
+	slog.Info("Bootstrapping Vault configuration...", "steps", len(a.config.BootstrapSteps))
+
+	root, err := a.vault.WithToken(a.rootToken)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := root.Sys().PutPolicyWithContext(ctx, bootstrapPolicyName, a.config.BootstrapPolicy); err != nil {
+		return nil, fmt.Errorf("put bootstrap policy: %w", err)
+	}
+
+	secret, err := root.Auth().Token().CreateWithContext(ctx, &api.TokenCreateRequest{
+		Policies:        []string{bootstrapPolicyName},
+		TTL:             a.config.BootstrapTokenTTL.String(),
+		NoDefaultPolicy: true,
+		DisplayName:     "vault-init-bootstrap",
+	})
+	if err != nil {
+		return nil, fmt.Errorf("create bootstrap token: %w", err)
+	}
+
+	result := &BootstrapResult{TokenAccessor: secret.Auth.Accessor}
+
+	client, err := a.vault.WithToken(secret.Auth.ClientToken)
+	if err != nil {
+		return nil, err
+	}
+
+	defer func() {
+		// Cleaned up even if the context is done, as the token and policy are no longer needed either way.
+		ctx := context.WithoutCancel(ctx)
+		if err := client.Auth().Token().RevokeSelfWithContext(ctx, ""); err != nil {
+			slog.Error("Cannot revoke bootstrap token, it expires on its own", "accessor", result.TokenAccessor, "ttl", a.config.BootstrapTokenTTL, "error", err)
+		}
+		if err := root.Sys().DeletePolicyWithContext(ctx, bootstrapPolicyName); err != nil {
+			slog.Error("Cannot delete bootstrap policy", "error", err)
+		}
+	}()
+
+	// Steps applied by previous attempts are skipped, as writes such as enabling a mount fail when repeated.
+	steps := a.config.BootstrapSteps
+	result.StepsApplied = min(a.bootstrapApplied, len(steps))
+	for i := result.StepsApplied; i < len(steps); i++ {
+		step := steps[i]
+		if _, err := client.WithNamespace(step.Namespace).Logical().WriteWithContext(ctx, step.Path, step.Data); err != nil {
+			return result, fmt.Errorf("bootstrap step %d (%s%s): %w", i, namespacePrefix(step.Namespace), step.Path, err)
+		}
+		result.StepsApplied++
+		a.bootstrapApplied = result.StepsApplied
+		a.saveProgress(ctx, bootstrapProgressTag, fmt.Sprintf("%d/%d", result.StepsApplied, len(steps)))
+		slog.Info("Applied bootstrap step", "namespace", step.Namespace, "path", step.Path)
+	}
+
+	a.rootToken = ""
+	slog.Info("Vault configuration bootstrapped")
+	return result, nil
+}
+
+// Returns the namespace as a path prefix, empty for the root namespace.
+func namespacePrefix(namespace string) string {
+	if namespace == "" {
+		return ""
+	}
+	return strings.Trim(namespace, "/") + "/"
+}
+
+// Validate the bootstrap settings, as they are only used once Vault is initialized.
+func validateBootstrap(steps []BootstrapStep, policy string, ttl time.Duration) error {
+	if len(steps) == 0 {
+		return nil
+	}
+	if policy == "" {
+		return errors.New("BOOTSTRAP_POLICY env is required with BOOTSTRAP_FILE")
+	}
+	if ttl <= 0 {
+		return errors.New("BOOTSTRAP_TOKEN_TTL env must be positive")
+	}
+	return nil
+}
@@ -0,0 +1,129 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// Vault API serving the bootstrap calls, recording the step writes, prefixed with their namespace, and
+// failing the ones in fail once.
+func newBootstrapServer(t *testing.T, fail map[string]bool) (*httptest.Server, *[]string) {
+	var writes []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		path := namespacePrefix(r.Header.Get("X-Vault-Namespace")) + strings.TrimPrefix(r.URL.Path, "/v1/")
+		switch {
+		case path == "auth/token/create":
+			json.NewEncoder(w).Encode(map[string]any{"auth": map[string]any{"client_token": "bootstrap", "accessor": "accessor"}})
+		case path == "auth/token/revoke-self" || strings.HasPrefix(path, "sys/policies/acl/") || strings.HasPrefix(path, "sys/policy/"):
+			w.WriteHeader(http.StatusNoContent)
+		case fail[path]:
+			delete(fail, path)
+			http.Error(w, `{"errors": ["unavailable"]}`, http.StatusInternalServerError)
+		case strings.Contains(path, "sys/mounts/"):
+			for _, write := range writes {
+				if write == path {
+					http.Error(w, `{"errors": ["path is already in use"]}`, http.StatusBadRequest)
+					return
+				}
+			}
+			writes = append(writes, path)
+			w.WriteHeader(http.StatusNoContent)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	t.Cleanup(server.Close)
+	return server, &writes
+}
+
+func newBootstrapApp(apiAddr string) (*App, *fakeVault, *fakeSecretsManager) {
+	app, vault, secretsManager := newTestApp(0)
+	vault.apiAddr = apiAddr
+	app.config.BootstrapSteps = []BootstrapStep{
+		{Path: "sys/mounts/kv", Data: map[string]any{"type": "kv-v2"}},
+		{Path: "sys/mounts/pki", Data: map[string]any{"type": "pki"}},
+	}
+	app.config.BootstrapPolicy = `path "sys/mounts/*" { capabilities = ["create", "update"] }`
+	app.config.BootstrapTokenTTL = time.Minute
+	return app, vault, secretsManager
+}
+
+func TestBootstrapResumesFromTheFailedStep(t *testing.T) {
+	server, writes := newBootstrapServer(t, map[string]bool{"sys/mounts/pki": true})
+	app, _, secretsManager := newBootstrapApp(server.URL)
+
+	if _, err := app.CheckVaultStatus(context.Background()); err == nil {
+		t.Fatalf("expected the second step to fail")
+	}
+	if tag := secretsManager.tags["vault"][bootstrapProgressTag]; tag != "1/2" {
+		t.Fatalf("expected the first step recorded, got %q", tag)
+	}
+
+	result, err := app.CheckVaultStatus(context.Background())
+	if err != nil {
+		t.Fatalf("check status: %v", err)
+	}
+	if result.Bootstrap == nil || result.Bootstrap.StepsApplied != 2 || len(*writes) != 2 {
+		t.Fatalf("expected the bootstrap resumed at the second step, got %+v after writes %v", result.Bootstrap, *writes)
+	}
+	if tag := secretsManager.tags["vault"][bootstrapProgressTag]; tag != "2/2" {
+		t.Fatalf("expected the bootstrap recorded as done, got %q", tag)
+	}
+}
+
+func TestBootstrapResumesAfterRestart(t *testing.T) {
+	server, writes := newBootstrapServer(t, map[string]bool{"sys/mounts/pki": true})
+	app, vault, secretsManager := newBootstrapApp(server.URL)
+	if _, err := app.CheckVaultStatus(context.Background()); err == nil {
+		t.Fatalf("expected the second step to fail")
+	}
+
+	// Restarted process, reading the root token back from the init response.
+	restarted, _, _ := newBootstrapApp(server.URL)
+	restarted.vault, restarted.secretsManager = vault, secretsManager
+	result, err := restarted.CheckVaultStatus(context.Background())
+	if err != nil {
+		t.Fatalf("check status: %v", err)
+	}
+	if result.Bootstrap == nil || result.Bootstrap.StepsApplied != 2 || len(*writes) != 2 {
+		t.Fatalf("expected the bootstrap resumed after the restart, got %+v after writes %v", result.Bootstrap, *writes)
+	}
+}
+
+func TestBootstrapWithoutStoredRootTokenAfterRestart(t *testing.T) {
+	server, writes := newBootstrapServer(t, map[string]bool{"sys/mounts/pki": true})
+	app, vault, secretsManager := newBootstrapApp(server.URL)
+	app.config.RootTokenPolicy = rootTokenDiscard
+	if _, err := app.CheckVaultStatus(context.Background()); err == nil {
+		t.Fatalf("expected the second step to fail")
+	}
+
+	restarted, _, _ := newBootstrapApp(server.URL)
+	restarted.vault, restarted.secretsManager = vault, secretsManager
+	restarted.config.RootTokenPolicy = rootTokenDiscard
+	result, err := restarted.CheckVaultStatus(context.Background())
+	if err != nil {
+		t.Fatalf("check status: %v", err)
+	}
+	if result.Bootstrap != nil || len(*writes) != 1 || restarted.rootToken != "" {
+		t.Fatalf("expected the bootstrap left to the operator, got %+v after writes %v", result.Bootstrap, *writes)
+	}
+}
+
+func TestBootstrapStepNamespaces(t *testing.T) {
+	server, writes := newBootstrapServer(t, nil)
+	app, _, _ := newBootstrapApp(server.URL)
+	app.config.BootstrapSteps[1].Namespace = "team-a"
+
+	if _, err := app.CheckVaultStatus(context.Background()); err != nil {
+		t.Fatalf("check status: %v", err)
+	}
+	if len(*writes) != 2 || (*writes)[0] != "sys/mounts/kv" || (*writes)[1] != "team-a/sys/mounts/pki" {
+		t.Fatalf("expected the second step written in its namespace, got %v", *writes)
+	}
+}
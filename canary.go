@@ -0,0 +1,53 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"time"
+)
+
+// Canary unseal strategy: after the cluster restarts, the nodes other than the canary only unseal once the
+// canary node unsealed with the stored keys and stayed healthy for the soak time. Bad keys or storage then
+// only affect the canary, while the other nodes stay sealed.
+type canaryGate struct {
+	// Vault API of the canary node.
+	vault vaultAPI
+	soak  time.Duration
+
+	// Time the canary was first seen healthy, zero while it is not.
+	healthySince time.Time
+	now          func() time.Time
+}
+
+func newCanaryGate(vault vaultAPI, soak time.Duration) *canaryGate {
+	return &canaryGate{vault: vault, soak: soak, now: time.Now}
+}
+
+// Check whether the canary node is unsealed and healthy since the soak time, returning why it is not.
+// The soak time restarts whenever the canary is seen unhealthy.
+func (g *canaryGate) ready(ctx context.Context) (bool, string) {
+	health, err := g.vault.Health(ctx)
+	switch {
+	case err != nil:
+		g.healthySince = time.Time{}
+		return false, fmt.Sprintf("canary %s unreachable: %v", g.vault.Address(), err)
+	case !health.Initialized || health.Sealed:
+		g.healthySince = time.Time{}
+		return false, fmt.Sprintf("canary %s is sealed", g.vault.Address())
+	// Only nodes that rejoined the Raft cluster report its ID.
+	case health.ClusterID == "":
+		g.healthySince = time.Time{}
+		return false, fmt.Sprintf("canary %s has not rejoined the cluster", g.vault.Address())
+	}
+
+	now := g.now()
+	if g.healthySince.IsZero() {
+		slog.Info("Canary node unsealed, waiting for the soak time", "canary", g.vault.Address(), "soak", g.soak)
+		g.healthySince = now
+	}
+	if healthy := now.Sub(g.healthySince); healthy < g.soak {
+		return false, fmt.Sprintf("canary %s healthy for %s of %s", g.vault.Address(), healthy.Round(time.Second), g.soak)
+	}
+	return true, ""
+}
@@ -0,0 +1,47 @@
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestCanaryUnseal(t *testing.T) {
+	app, vault, _ := newTestApp(0)
+	if _, err := app.CheckVaultStatus(context.Background()); err != nil {
+		t.Fatalf("initialize: %v", err)
+	}
+	// The cluster restarted, sealing every node.
+	vault.sealed = true
+
+	canary := newFakeVault()
+	canary.initialized = true
+	now := time.Now()
+	gate := newCanaryGate(canary, time.Minute)
+	gate.now = func() time.Time { return now }
+	app.config.UnsealCanary = gate
+
+	check := func() {
+		t.Helper()
+		if _, err := app.CheckVaultStatus(context.Background()); err != nil {
+			t.Fatalf("check status: %v", err)
+		}
+	}
+
+	check()
+	if !vault.sealed {
+		t.Fatal("expected the node sealed while the canary is")
+	}
+
+	canary.sealed = false
+	check()
+	if !vault.sealed {
+		t.Fatal("expected the node sealed during the soak time")
+	}
+
+	now = now.Add(time.Minute)
+	check()
+	if vault.sealed {
+		t.Fatal("expected the node unsealed after the soak time")
+	}
+}
@@ -0,0 +1,319 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"filippo.io/age"
+	"filippo.io/age/armor"
+	"github.com/hashicorp/vault/api"
+)
+
+// Prefix of ceremony stores naming a Secrets Manager secret, created by the tool if missing.
+const secretsManagerStorePrefix = "secretsmanager:"
+
+// CeremonyRecipient is the holder of one unseal key share in a key ceremony: either the tool itself,
+// storing the share in the secret for automated unseal, or a custodian the share is encrypted to.
+type CeremonyRecipient struct {
+	Name string `json:"name"`
+	// Whether the share is stored in the secret, for automated unseal.
+	Automated bool `json:"automated,omitempty"`
+	// age public key (`age1...`) the share of a custodian is encrypted to.
+	AgeRecipient string `json:"ageRecipient,omitempty"`
+	// PGP public key file Vault itself encrypts the share of a custodian to, instead of an age recipient,
+	// so the tool never sees the share. Vault encrypts either all the shares or none.
+	PGPKey string `json:"pgpKey,omitempty"`
+	// Where the encrypted share of a custodian is written: a file path, or a Secrets Manager secret name
+	// prefixed with `secretsmanager:`.
+	Store string `json:"store,omitempty"`
+}
+
+// CeremonyPlan describes how the unseal key shares are split between the recipients, one share each.
+type CeremonyPlan struct {
+	Threshold  int                 `json:"threshold"`
+	Recipients []CeremonyRecipient `json:"recipients"`
+	// PGP public key file Vault encrypts the root token to. The encrypted root token is printed rather
+	// than stored in the secret, which then holds no root token.
+	RootTokenPGPKey string `json:"rootTokenPGPKey,omitempty"`
+}
+
+// Read the ceremony plan from the JSON file.
+func loadCeremonyPlan(path string) (*CeremonyPlan, error) {
+	contents, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var plan CeremonyPlan
+	if err := json.Unmarshal(contents, &plan); err != nil {
+		return nil, fmt.Errorf("unmarshal: %w", err)
+	}
+	return &plan, plan.validate()
+}
+
+func (p *CeremonyPlan) validate() error {
+	if p.Threshold < 1 || p.Threshold > len(p.Recipients) {
+		return fmt.Errorf("threshold must be between 1 and the %d recipients", len(p.Recipients))
+	}
+
+	automated, pgp := 0, 0
+	for i, recipient := range p.Recipients {
+		switch {
+		case recipient.Name == "":
+			return fmt.Errorf("recipient %d: name is required", i)
+		case recipient.Automated && (recipient.AgeRecipient != "" || recipient.PGPKey != "" || recipient.Store != ""):
+			return fmt.Errorf("recipient %s: automated shares are stored in the secret, unencrypted", recipient.Name)
+		case recipient.Automated:
+			automated++
+			continue
+		case recipient.Store == "":
+			return fmt.Errorf("recipient %s: store is required", recipient.Name)
+		case recipient.AgeRecipient != "" && recipient.PGPKey != "":
+			return fmt.Errorf("recipient %s: ageRecipient and pgpKey are mutually exclusive", recipient.Name)
+		case recipient.PGPKey != "":
+			pgp++
+			if _, err := readPGPKey(recipient.PGPKey); err != nil {
+				return fmt.Errorf("recipient %s: pgpKey is invalid: %w", recipient.Name, err)
+			}
+			continue
+		}
+		if _, err := age.ParseX25519Recipient(recipient.AgeRecipient); err != nil {
+			return fmt.Errorf("recipient %s: ageRecipient is invalid: %w", recipient.Name, err)
+		}
+	}
+	if pgp > 0 && pgp < len(p.Recipients) {
+		return fmt.Errorf("as Vault encrypts either all the shares or none, all recipients need a pgpKey, only %d of %d have one", pgp, len(p.Recipients))
+	}
+	if p.RootTokenPGPKey != "" {
+		if _, err := readPGPKey(p.RootTokenPGPKey); err != nil {
+			return fmt.Errorf("rootTokenPGPKey is invalid: %w", err)
+		}
+	}
+
+	// Automated unseal needs a quorum of automated shares, while having none leaves unsealing to the custodians.
+	if automated > 0 && automated < p.Threshold {
+		return fmt.Errorf("%d automated shares cannot unseal Vault on their own, %d are required", automated, p.Threshold)
+	}
+	return nil
+}
+
+// Initialize Vault in a key ceremony: after the operator confirms the plan, each share is encrypted to its
+// custodian and written to the custodian store, while the automated shares and the root token are stored in
+// the secret. Prints a fingerprint of each share, for custodians to check the share they decrypt.
+// Encrypted shares that cannot be written are printed instead, as Vault cannot be initialized again.
+func (a *App) Ceremony(ctx context.Context, plan *CeremonyPlan, in io.Reader, out io.Writer) error {
+	if err := a.checkNotDRSecondary(ctx); err != nil {
+		return err
+	}
+	if err := a.checkKeyTransport(); err != nil {
+		return err
+	}
+	if !a.config.ForceOverwrite {
+		if err := a.checkSecretUnused(ctx); err != nil {
+			return err
+		}
+	}
+
+	sealStatus, err := a.vault.SealStatus(ctx)
+	if err != nil {
+		return fmt.Errorf("read seal status: %w", err)
+	}
+	if sealStatus.Initialized {
+		return errors.New("vault is already initialized")
+	}
+	if sealStatus.Type != "shamir" {
+		return fmt.Errorf("key ceremonies split unseal keys, vault uses the %s seal", sealStatus.Type)
+	}
+
+	fmt.Fprintf(out, "Initializing Vault at %s with %d shares, threshold %d:\n", a.vault.Address(), len(plan.Recipients), plan.Threshold)
+	for _, recipient := range plan.Recipients {
+		if recipient.Automated {
+			fmt.Fprintf(out, "  %s: stored in secret %s for automated unseal\n", recipient.Name, a.config.SecretID)
+			continue
+		}
+		if recipient.PGPKey != "" {
+			fmt.Fprintf(out, "  %s: encrypted by Vault to %s, written to %s\n", recipient.Name, recipient.PGPKey, recipient.Store)
+			continue
+		}
+		fmt.Fprintf(out, "  %s: encrypted to %s, written to %s\n", recipient.Name, recipient.AgeRecipient, recipient.Store)
+	}
+	if plan.RootTokenPGPKey != "" {
+		fmt.Fprintf(out, "Root token: encrypted by Vault to %s, printed\n", plan.RootTokenPGPKey)
+	}
+	fmt.Fprint(out, "Type yes to proceed: ")
+	answer, _ := bufio.NewReader(in).ReadString('\n')
+	if strings.TrimSpace(answer) != "yes" {
+		return errors.New("ceremony aborted")
+	}
+
+	request, err := plan.initRequest()
+	if err != nil {
+		return err
+	}
+	initResponse, err := a.vault.Init(ctx, request)
+	if err != nil {
+		return fmt.Errorf("init vault: %w", err)
+	}
+
+	// Vault cannot be initialized again, so the shares must be persisted whatever happens.
+	ctx = context.WithoutCancel(ctx)
+
+	stored := &api.InitResponse{RootToken: initResponse.RootToken}
+	if plan.RootTokenPGPKey != "" {
+		stored.RootToken = ""
+		encrypted, err := pgpArmor(initResponse.RootToken)
+		if err != nil {
+			encrypted = initResponse.RootToken
+		}
+		fmt.Fprintf(out, "\nRoot token, encrypted to %s:\n%s\n", plan.RootTokenPGPKey, encrypted)
+	}
+
+	var failed []string
+	fmt.Fprintln(out, "\nShare fingerprints:")
+	for i, recipient := range plan.Recipients {
+		if recipient.PGPKey != "" {
+			// Vault returns the shares encrypted, the custodians check them by unsealing.
+			fmt.Fprintf(out, "  %s: encrypted by Vault\n", recipient.Name)
+		} else {
+			fmt.Fprintf(out, "  %s: %s\n", recipient.Name, shareFingerprint(initResponse.KeysB64[i]))
+		}
+
+		if recipient.Automated {
+			stored.Keys = append(stored.Keys, initResponse.Keys[i])
+			stored.KeysB64 = append(stored.KeysB64, initResponse.KeysB64[i])
+			continue
+		}
+
+		var (
+			location  string
+			encrypted string
+		)
+		if recipient.PGPKey != "" {
+			encrypted, err = pgpArmor(initResponse.KeysB64[i])
+		} else {
+			encrypted, err = ageEncrypt(initResponse.KeysB64[i], recipient.AgeRecipient)
+		}
+		if err == nil {
+			location, err = a.writeShare(ctx, recipient, encrypted)
+		}
+		if err == nil {
+			fmt.Fprintf(out, "    written to %s\n", location)
+		} else {
+			failed = append(failed, recipient.Name)
+			fmt.Fprintf(out, "    cannot write the share to %s: %v\n", recipient.Store, err)
+			if encrypted != "" {
+				fmt.Fprintf(out, "    hand this encrypted share to %s instead:\n%s\n", recipient.Name, encrypted)
+			}
+		}
+	}
+
+	if _, err := a.writeInitResponse(ctx, stored); err != nil {
+		fullResponse, _ := json.Marshal(stored)
+		a.escalateWrite(ctx, "store ceremony shares", fullResponse, err)
+		return fmt.Errorf("update secret: %w", err)
+	}
+	if len(failed) > 0 {
+		return fmt.Errorf("shares of %s not written to their stores", strings.Join(failed, ", "))
+	}
+	return nil
+}
+
+// Returns the init request of the plan, with the PGP keys Vault encrypts the shares and root token to.
+func (p *CeremonyPlan) initRequest() (*api.InitRequest, error) {
+	request := &api.InitRequest{
+		SecretShares:    len(p.Recipients),
+		SecretThreshold: p.Threshold,
+	}
+	for _, recipient := range p.Recipients {
+		if recipient.PGPKey == "" {
+			continue
+		}
+		key, err := pgpKeyBase64(recipient.PGPKey)
+		if err != nil {
+			return nil, fmt.Errorf("recipient %s: read pgpKey: %w", recipient.Name, err)
+		}
+		request.PGPKeys = append(request.PGPKeys, key)
+	}
+	if p.RootTokenPGPKey != "" {
+		key, err := pgpKeyBase64(p.RootTokenPGPKey)
+		if err != nil {
+			return nil, fmt.Errorf("read rootTokenPGPKey: %w", err)
+		}
+		request.RootTokenPGPKey = key
+	}
+	return request, nil
+}
+
+// Returns a short fingerprint of the share, the start of its SHA-256 hash.
+func shareFingerprint(shareB64 string) string {
+	share, _ := base64.StdEncoding.DecodeString(shareB64)
+	sum := sha256.Sum256(share)
+	return fmt.Sprintf("%x", sum[:8])
+}
+
+// Encrypt the plaintext to the age recipient, returning it ASCII armored.
+func ageEncrypt(plaintext, ageRecipient string) (string, error) {
+	recipient, err := age.ParseX25519Recipient(ageRecipient)
+	if err != nil {
+		return "", fmt.Errorf("parse age recipient: %w", err)
+	}
+	return ageEncryptTo(plaintext, recipient)
+}
+
+// Encrypt the plaintext to all the age recipients, returning it ASCII armored.
+func ageEncryptTo(plaintext string, recipients ...age.Recipient) (string, error) {
+	var buf bytes.Buffer
+	armored := armor.NewWriter(&buf)
+	w, err := age.Encrypt(armored, recipients...)
+	if err != nil {
+		return "", fmt.Errorf("encrypt: %w", err)
+	}
+	if _, err := io.WriteString(w, plaintext); err != nil {
+		return "", fmt.Errorf("encrypt: %w", err)
+	}
+	if err := w.Close(); err != nil {
+		return "", fmt.Errorf("encrypt: %w", err)
+	}
+	if err := armored.Close(); err != nil {
+		return "", fmt.Errorf("armor: %w", err)
+	}
+	return buf.String(), nil
+}
+
+// Write the encrypted share to the store of its custodian, returning where it was written.
+func (a *App) writeShare(ctx context.Context, recipient CeremonyRecipient, encrypted string) (string, error) {
+	name, ok := strings.CutPrefix(recipient.Store, secretsManagerStorePrefix)
+	if !ok {
+		return recipient.Store, os.WriteFile(recipient.Store, []byte(encrypted), 0o600)
+	}
+	return a.putManagedSecret(ctx, name, "Vault unseal key share of "+recipient.Name+", encrypted with age", encrypted, a.config.SecretKMSKeyID)
+}
+
+// Run the `ceremony` subcommand with the plan in CEREMONY_FILE. Returns the process exit code.
+func runCeremony(ctx context.Context, app *App, planFile string) int {
+	if planFile == "" {
+		fmt.Fprintln(os.Stderr, "CEREMONY_FILE env is required")
+		return 1
+	}
+	plan, err := loadCeremonyPlan(planFile)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "CEREMONY_FILE env is invalid: %v\n", err)
+		return 1
+	}
+
+	if err := app.Ceremony(ctx, plan, os.Stdin, os.Stdout); err != nil {
+		fmt.Fprintf(os.Stderr, "Ceremony failed: %v\n", err)
+		return 1
+	}
+	fmt.Println("Ceremony completed")
+	return 0
+}
@@ -0,0 +1,183 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"filippo.io/age"
+	"filippo.io/age/armor"
+	"github.com/hashicorp/vault/api"
+	"golang.org/x/crypto/openpgp"
+	pgparmor "golang.org/x/crypto/openpgp/armor"
+)
+
+func TestCeremony(t *testing.T) {
+	app, vault, secretsManager := newTestApp(0)
+
+	identity, err := age.GenerateX25519Identity()
+	if err != nil {
+		t.Fatalf("generate identity: %v", err)
+	}
+	store := filepath.Join(t.TempDir(), "alice.age")
+	plan := &CeremonyPlan{
+		Threshold: 2,
+		Recipients: []CeremonyRecipient{
+			{Name: "vault-init-1", Automated: true},
+			{Name: "vault-init-2", Automated: true},
+			{Name: "alice", AgeRecipient: identity.Recipient().String(), Store: store},
+		},
+	}
+	if err := plan.validate(); err != nil {
+		t.Fatalf("validate plan: %v", err)
+	}
+
+	var out strings.Builder
+	if err := app.Ceremony(context.Background(), plan, strings.NewReader("no\n"), &out); err == nil || vault.inits != 0 {
+		t.Fatalf("expected the ceremony aborted without init, got %v", err)
+	}
+
+	out.Reset()
+	if err := app.Ceremony(context.Background(), plan, strings.NewReader("yes\n"), &out); err != nil {
+		t.Fatalf("ceremony: %v\n%s", err, out.String())
+	}
+
+	var stored api.InitResponse
+	if err := json.Unmarshal([]byte(secretsManager.storedInitResponse()), &stored); err != nil {
+		t.Fatalf("unmarshal secret: %v", err)
+	}
+	if len(stored.KeysB64) != 2 || stored.RootToken == "" {
+		t.Fatalf("expected 2 automated shares and the root token stored, got %+v", stored)
+	}
+
+	encrypted, err := os.Open(store)
+	if err != nil {
+		t.Fatalf("open custodian share: %v", err)
+	}
+	defer encrypted.Close()
+	r, err := age.Decrypt(armor.NewReader(encrypted), identity)
+	if err != nil {
+		t.Fatalf("decrypt custodian share: %v", err)
+	}
+	share, _ := io.ReadAll(r)
+	if string(share) != vault.keys[2] {
+		t.Fatalf("expected the third share, got %s", share)
+	}
+	if !strings.Contains(out.String(), "alice: "+shareFingerprint(vault.keys[2])) {
+		t.Fatalf("expected the fingerprint of the custodian share, got\n%s", out.String())
+	}
+
+	// The automated shares unseal Vault on their own.
+	vault.sealed = true
+	if _, err := app.CheckVaultStatus(context.Background()); err != nil || vault.sealed {
+		t.Fatalf("expected Vault unsealed with the automated shares, got %v", err)
+	}
+}
+
+func TestCeremonyPlanValidate(t *testing.T) {
+	identity, _ := age.GenerateX25519Identity()
+	custodian := CeremonyRecipient{Name: "alice", AgeRecipient: identity.Recipient().String(), Store: "alice.age"}
+
+	for name, plan := range map[string]CeremonyPlan{
+		"threshold above recipients": {Threshold: 2, Recipients: []CeremonyRecipient{custodian}},
+		"automated below threshold":  {Threshold: 2, Recipients: []CeremonyRecipient{{Name: "a", Automated: true}, custodian}},
+		"custodian without store":    {Threshold: 1, Recipients: []CeremonyRecipient{{Name: "bob", AgeRecipient: custodian.AgeRecipient}}},
+		"invalid age recipient":      {Threshold: 1, Recipients: []CeremonyRecipient{{Name: "bob", AgeRecipient: "age1nope", Store: "bob.age"}}},
+	} {
+		if err := plan.validate(); err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+	}
+}
+
+// Write the armored public key of a new PGP entity to a file, returning the entity and the file.
+func writeTestPGPKey(t *testing.T, name string) (*openpgp.Entity, string) {
+	t.Helper()
+	entity, err := openpgp.NewEntity(name, "", name+"@example.com", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var publicKey bytes.Buffer
+	w, _ := pgparmor.Encode(&publicKey, openpgp.PublicKeyType, nil)
+	if err := entity.Serialize(w); err != nil {
+		t.Fatal(err)
+	}
+	w.Close()
+	path := filepath.Join(t.TempDir(), name+".asc")
+	if err := os.WriteFile(path, publicKey.Bytes(), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return entity, path
+}
+
+// Decrypt the armored PGP message with the entity.
+func pgpDecrypt(t *testing.T, message string, entity *openpgp.Entity) string {
+	t.Helper()
+	block, err := pgparmor.Decode(strings.NewReader(message))
+	if err != nil {
+		t.Fatalf("dearmor: %v", err)
+	}
+	md, err := openpgp.ReadMessage(block.Body, openpgp.EntityList{entity}, nil, nil)
+	if err != nil {
+		t.Fatalf("decrypt: %v", err)
+	}
+	plaintext, _ := io.ReadAll(md.UnverifiedBody)
+	return string(plaintext)
+}
+
+func TestCeremonyPGP(t *testing.T) {
+	app, vault, secretsManager := newTestApp(0)
+	alice, aliceKey := writeTestPGPKey(t, "alice")
+	bob, bobKey := writeTestPGPKey(t, "bob")
+	admin, adminKey := writeTestPGPKey(t, "admin")
+	dir := t.TempDir()
+	plan := &CeremonyPlan{
+		Threshold: 2,
+		Recipients: []CeremonyRecipient{
+			{Name: "alice", PGPKey: aliceKey, Store: filepath.Join(dir, "alice.asc")},
+			{Name: "bob", PGPKey: bobKey, Store: filepath.Join(dir, "bob.asc")},
+		},
+		RootTokenPGPKey: adminKey,
+	}
+	if err := plan.validate(); err != nil {
+		t.Fatalf("validate plan: %v", err)
+	}
+
+	var out strings.Builder
+	if err := app.Ceremony(context.Background(), plan, strings.NewReader("yes\n"), &out); err != nil {
+		t.Fatalf("ceremony: %v\n%s", err, out.String())
+	}
+
+	for i, custodian := range []*openpgp.Entity{alice, bob} {
+		encrypted, err := os.ReadFile(plan.Recipients[i].Store)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if share := pgpDecrypt(t, string(encrypted), custodian); share != vault.keys[i] {
+			t.Errorf("expected share %d encrypted by Vault, got %s", i, share)
+		}
+	}
+
+	_, printed, _ := strings.Cut(out.String(), "Root token, encrypted to "+adminKey+":\n")
+	if token := pgpDecrypt(t, printed, admin); token != "root" {
+		t.Errorf("expected the root token printed encrypted, got %q", token)
+	}
+	var stored api.InitResponse
+	if err := json.Unmarshal([]byte(secretsManager.storedInitResponse()), &stored); err != nil {
+		t.Fatalf("unmarshal secret: %v", err)
+	}
+	if stored.RootToken != "" || len(stored.KeysB64) != 0 {
+		t.Errorf("expected nothing stored in the secret, got %+v", stored)
+	}
+
+	// Vault encrypts all the shares or none.
+	plan.Recipients = append(plan.Recipients, CeremonyRecipient{Name: "vault-init", Automated: true})
+	if err := plan.validate(); err == nil {
+		t.Error("expected automated shares rejected with PGP keys")
+	}
+}
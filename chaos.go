@@ -0,0 +1,138 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"math/rand"
+	"net/http"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/hashicorp/vault/api"
+	"github.com/spf13/viper"
+)
+
+// Fault injection, to rehearse how the tool handles failures in staging. Each rate is the probability,
+// from 0 to 1, of the fault replacing a call. Zero rates disable chaos mode.
+type chaosConfig struct {
+	AWSThrottleRate   float64
+	VaultTimeoutRate  float64
+	UnsealFailureRate float64
+
+	// Source of randomness, replaced by tests.
+	rand func() float64
+}
+
+// Read the chaos configuration from the CHAOS_* envs.
+func newChaosConfig() *chaosConfig {
+	return &chaosConfig{
+		AWSThrottleRate:   viper.GetFloat64("chaos_aws_throttle_rate"),
+		VaultTimeoutRate:  viper.GetFloat64("chaos_vault_timeout_rate"),
+		UnsealFailureRate: viper.GetFloat64("chaos_unseal_failure_rate"),
+	}
+}
+
+func (c *chaosConfig) enabled() bool {
+	return c.AWSThrottleRate > 0 || c.VaultTimeoutRate > 0 || c.UnsealFailureRate > 0
+}
+
+func (c *chaosConfig) inject(rate float64) bool {
+	if rate <= 0 {
+		return false
+	}
+	if c.rand == nil {
+		return rand.Float64() < rate
+	}
+	return c.rand() < rate
+}
+
+// AWS HTTP client answering requests with throttling errors at the configured rate, which the SDK
+// retries like real ones.
+type chaosAWSClient struct {
+	aws.HTTPClient
+	chaos *chaosConfig
+}
+
+func (c *chaosAWSClient) Do(req *http.Request) (*http.Response, error) {
+	if !c.chaos.inject(c.chaos.AWSThrottleRate) {
+		return c.HTTPClient.Do(req)
+	}
+
+	slog.Warn("Chaos: injecting AWS throttling", "host", req.URL.Host)
+	body := `{"__type":"ThrottlingException","message":"Rate exceeded (injected by chaos mode)"}`
+	return &http.Response{
+		Status:     "400 Bad Request",
+		StatusCode: http.StatusBadRequest,
+		Proto:      req.Proto,
+		ProtoMajor: req.ProtoMajor,
+		ProtoMinor: req.ProtoMinor,
+		Header: http.Header{
+			"Content-Type":     []string{"application/x-amz-json-1.1"},
+			"X-Amzn-Errortype": []string{"ThrottlingException"},
+		},
+		Body:          io.NopCloser(strings.NewReader(body)),
+		ContentLength: int64(len(body)),
+		Request:       req,
+	}, nil
+}
+
+// Vault API failing calls with timeouts, and unseal key submissions with server errors, at the
+// configured rates.
+type chaosVault struct {
+	vaultAPI
+	chaos *chaosConfig
+}
+
+func (v *chaosVault) timeout(call string) error {
+	if !v.chaos.inject(v.chaos.VaultTimeoutRate) {
+		return nil
+	}
+	slog.Warn("Chaos: injecting Vault timeout", "call", call)
+	return fmt.Errorf("%s (injected by chaos mode): %w", call, context.DeadlineExceeded)
+}
+
+func (v *chaosVault) Health(ctx context.Context) (*api.HealthResponse, error) {
+	if err := v.timeout("health"); err != nil {
+		return nil, err
+	}
+	return v.vaultAPI.Health(ctx)
+}
+
+func (v *chaosVault) SealStatus(ctx context.Context) (*api.SealStatusResponse, error) {
+	if err := v.timeout("seal status"); err != nil {
+		return nil, err
+	}
+	return v.vaultAPI.SealStatus(ctx)
+}
+
+func (v *chaosVault) Init(ctx context.Context, request *api.InitRequest) (*api.InitResponse, error) {
+	if err := v.timeout("init"); err != nil {
+		return nil, err
+	}
+	return v.vaultAPI.Init(ctx, request)
+}
+
+func (v *chaosVault) Unseal(ctx context.Context, opts *api.UnsealOpts) (*api.SealStatusResponse, error) {
+	if err := v.timeout("unseal"); err != nil {
+		return nil, err
+	}
+	if v.chaos.inject(v.chaos.UnsealFailureRate) {
+		slog.Warn("Chaos: injecting unseal failure")
+		return nil, &api.ResponseError{
+			HTTPMethod: http.MethodPut,
+			URL:        "sys/unseal",
+			StatusCode: http.StatusInternalServerError,
+			Errors:     []string{"internal error (injected by chaos mode)"},
+		}
+	}
+	return v.vaultAPI.Unseal(ctx, opts)
+}
+
+func (v *chaosVault) RaftJoin(ctx context.Context, request *api.RaftJoinRequest) (*api.RaftJoinResponse, error) {
+	if err := v.timeout("raft join"); err != nil {
+		return nil, err
+	}
+	return v.vaultAPI.RaftJoin(ctx, request)
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/credentials"
+	"github.com/aws/aws-sdk-go-v2/service/secretsmanager"
+	"github.com/aws/smithy-go"
+)
+
+func TestChaosAWSThrottling(t *testing.T) {
+	client := secretsmanager.New(secretsmanager.Options{
+		Region:           "us-east-1",
+		Credentials:      credentials.NewStaticCredentialsProvider("key", "secret", ""),
+		RetryMaxAttempts: 1,
+		HTTPClient:       &chaosAWSClient{HTTPClient: http.DefaultClient, chaos: &chaosConfig{AWSThrottleRate: 1}},
+	})
+
+	_, err := client.GetSecretValue(context.Background(), &secretsmanager.GetSecretValueInput{SecretId: aws.String("vault")})
+	var apiErr smithy.APIError
+	if !errors.As(err, &apiErr) || apiErr.ErrorCode() != "ThrottlingException" {
+		t.Fatalf("expected a throttling error, got %v", err)
+	}
+}
+
+func TestChaosUnsealFailure(t *testing.T) {
+	app, vault, _ := newTestApp(0)
+	if _, err := app.CheckVaultStatus(context.Background()); err != nil {
+		t.Fatalf("initialize: %v", err)
+	}
+	vault.sealed = true
+
+	// Fail the second share submitted.
+	calls := 0
+	chaos := &chaosConfig{UnsealFailureRate: 0.5, rand: func() float64 {
+		calls++
+		if calls == 2 {
+			return 0
+		}
+		return 1
+	}}
+	app.vault = &chaosVault{vaultAPI: vault, chaos: chaos}
+
+	if _, err := app.CheckVaultStatus(context.Background()); !errors.Is(err, ErrUnsealFailed) {
+		t.Fatalf("expected the unseal to fail, got %v", err)
+	}
+	if !vault.sealed || len(vault.progress) != 0 {
+		t.Fatalf("expected Vault sealed with the unseal progress reset, got sealed %v, progress %d", vault.sealed, len(vault.progress))
+	}
+
+	// The next check recovers.
+	if _, err := app.CheckVaultStatus(context.Background()); err != nil || vault.sealed {
+		t.Fatalf("expected Vault unsealed, got %v", err)
+	}
+}
+
+func TestChaosVaultTimeout(t *testing.T) {
+	app, vault, _ := newTestApp(0)
+	app.vault = &chaosVault{vaultAPI: vault, chaos: &chaosConfig{VaultTimeoutRate: 1}}
+
+	if _, err := app.CheckVaultStatus(context.Background()); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected a timeout, got %v", err)
+	}
+	if vault.inits != 0 {
+		t.Fatalf("expected no init")
+	}
+}
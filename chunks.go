@@ -0,0 +1,135 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/aws/arn"
+	"github.com/aws/aws-sdk-go-v2/service/secretsmanager"
+	"github.com/aws/aws-sdk-go-v2/service/secretsmanager/types"
+)
+
+// Maximum size of a Secrets Manager secret value.
+const maxSecretSize = 65536
+
+// Stored instead of the init response when it exceeds the secret size limit, e.g. with many
+// PGP-encrypted shares. Lists the secrets (or SSM parameters) holding the consecutive chunks.
+type chunkManifest struct {
+	Chunks []string `json:"chunks"`
+	// Versions of the chunks written with the manifest, so a manifest read at a pinned or previous version
+	// is joined with its own chunks. Manifests written before chunk versions were recorded, or by hand, have
+	// none, and their chunks are read at their current version.
+	Versions []string `json:"versions,omitempty"`
+}
+
+// Returns the value to store in the secret for the payload. Payloads exceeding the secret size limit are
+// split into `<secret-name>-chunk-<n>` secrets, created by the tool with the KMS key of the secret,
+// and a chunk manifest is returned instead. Chunks are created in the account of the credentials, so payloads
+// of secrets in other accounts are refused rather than split away from their secret.
+func (a *App) chunkPayload(ctx context.Context, payload string) (string, error) {
+	if len(payload) <= maxSecretSize {
+		return payload, nil
+	}
+
+	secret, err := a.describeSecret(ctx, false)
+	if err != nil {
+		return "", fmt.Errorf("describe secret: %w", err)
+	}
+	if secretARN, err := arn.Parse(aws.ToString(secret.ARN)); err == nil && a.config.CallerAccount != "" && secretARN.AccountID != a.config.CallerAccount {
+		return "", fmt.Errorf("init response of %d bytes exceeds the secret size limit, and cannot be split into chunks as the secret is in account %s, not in account %s of the credentials", len(payload), secretARN.AccountID, a.config.CallerAccount)
+	}
+
+	var manifest chunkManifest
+	for i := 0; i*maxSecretSize < len(payload); i++ {
+		chunk := payload[i*maxSecretSize : min((i+1)*maxSecretSize, len(payload))]
+		name := fmt.Sprintf("%s-chunk-%d", aws.ToString(secret.Name), i+1)
+
+		version, err := putManagedSecretVersion(ctx, a.secretsManager, name, "Vault init response chunk, written by vault-init", chunk, aws.ToString(secret.KmsKeyId))
+		if err != nil {
+			return "", fmt.Errorf("chunk %d: %w", i+1, err)
+		}
+		manifest.Chunks = append(manifest.Chunks, name)
+		manifest.Versions = append(manifest.Versions, version.VersionID)
+	}
+
+	slog.Info("Init response exceeds the secret size limit, stored in chunks", "size", len(payload), "chunks", len(manifest.Chunks))
+
+	data, err := json.Marshal(manifest)
+	if err != nil {
+		return "", fmt.Errorf("marshal chunk manifest: %w", err)
+	}
+	return string(data), nil
+}
+
+// Reassemble the payload if the stored value is a chunk manifest, reading each chunk with read, at the
+// version recorded in the manifest if any. Other values are returned as is.
+func joinChunks(ctx context.Context, value string, read func(ctx context.Context, name, version string) (string, error)) (string, error) {
+	var manifest chunkManifest
+	if json.Unmarshal([]byte(value), &manifest) != nil || len(manifest.Chunks) == 0 {
+		return value, nil
+	}
+	if len(manifest.Versions) > 0 && len(manifest.Versions) != len(manifest.Chunks) {
+		return "", fmt.Errorf("%w: chunk manifest lists %d chunks and %d versions", ErrKeysInvalid, len(manifest.Chunks), len(manifest.Versions))
+	}
+
+	var payload string
+	for i, name := range manifest.Chunks {
+		var version string
+		if len(manifest.Versions) > 0 {
+			version = manifest.Versions[i]
+		}
+		chunk, err := read(ctx, name, version)
+		if err != nil {
+			return "", fmt.Errorf("read chunk %s: %w", name, err)
+		}
+		payload += chunk
+	}
+	return payload, nil
+}
+
+// Create a secret managed by the tool, or put a new value if it exists.
+// The KMS key is only used when creating the secret; empty to use aws/secretsmanager.
+func (a *App) putManagedSecret(ctx context.Context, name, description, value, kmsKeyID string) (string, error) {
+	return putManagedSecret(ctx, a.secretsManager, name, description, value, kmsKeyID)
+}
+
+// Same as App.putManagedSecret, with the client of another account.
+func putManagedSecret(ctx context.Context, client secretsManagerAPI, name, description, value, kmsKeyID string) (string, error) {
+	version, err := putManagedSecretVersion(ctx, client, name, description, value, kmsKeyID)
+	return version.ARN, err
+}
+
+// Same as putManagedSecret, returning the version written.
+func putManagedSecretVersion(ctx context.Context, client secretsManagerAPI, name, description, value, kmsKeyID string) (storedVersion, error) {
+	input := &secretsmanager.CreateSecretInput{
+		Name:         &name,
+		Description:  &description,
+		SecretString: &value,
+	}
+	if kmsKeyID != "" {
+		input.KmsKeyId = &kmsKeyID
+	}
+
+	created, err := client.CreateSecret(ctx, input)
+	if err == nil {
+		return storedVersion{ARN: aws.ToString(created.ARN), VersionID: aws.ToString(created.VersionId)}, nil
+	}
+
+	var exists *types.ResourceExistsException
+	if !errors.As(err, &exists) {
+		return storedVersion{}, fmt.Errorf("create secret %s: %w", name, err)
+	}
+
+	updated, err := client.PutSecretValue(ctx, &secretsmanager.PutSecretValueInput{
+		SecretId:     &name,
+		SecretString: &value,
+	})
+	if err != nil {
+		return storedVersion{}, fmt.Errorf("put secret %s value: %w", name, err)
+	}
+	return storedVersion{ARN: aws.ToString(updated.ARN), VersionID: aws.ToString(updated.VersionId)}, nil
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/secretsmanager"
+)
+
+func TestChunkedPayloadsReadTheirOwnChunkVersions(t *testing.T) {
+	app, _, secretsManager := newTestApp(0)
+	store := secretsManagerStore{app: app}
+	ctx := context.Background()
+
+	first, second := strings.Repeat("a", maxSecretSize+1), strings.Repeat("b", maxSecretSize+1)
+	if _, err := store.writePayload(ctx, first); err != nil {
+		t.Fatalf("write first payload: %v", err)
+	}
+	manifest := *secretsManager.value
+	if _, err := store.writePayload(ctx, second); err != nil {
+		t.Fatalf("write second payload: %v", err)
+	}
+
+	if payload, err := store.readPayload(ctx); err != nil || payload != second {
+		t.Fatalf("expected the second payload, got %d bytes, %v", len(payload), err)
+	}
+	// The first manifest, e.g. read at a pinned or previous version, still joins the first chunks.
+	payload, err := joinChunks(ctx, manifest, app.readSecretChunk)
+	if err != nil || payload != first {
+		t.Fatalf("expected the first payload, got %d bytes, %v", len(payload), err)
+	}
+}
+
+func TestJoinChunksWithoutVersions(t *testing.T) {
+	app, _, secretsManager := newTestApp(0)
+	ctx := context.Background()
+	for name, value := range map[string]string{"vault-chunk-1": "ab", "vault-chunk-2": "cd"} {
+		if _, err := secretsManager.CreateSecret(ctx, &secretsmanager.CreateSecretInput{Name: aws.String(name), SecretString: aws.String(value)}); err != nil {
+			t.Fatalf("create %s: %v", name, err)
+		}
+	}
+
+	payload, err := joinChunks(ctx, `{"chunks": ["vault-chunk-1", "vault-chunk-2"]}`, app.readSecretChunk)
+	if err != nil || payload != "abcd" {
+		t.Fatalf("expected the chunks joined, got %q, %v", payload, err)
+	}
+	if _, err := joinChunks(ctx, `{"chunks": ["vault-chunk-1", "vault-chunk-2"], "versions": ["1"]}`, app.readSecretChunk); err == nil {
+		t.Fatalf("expected an error for a manifest missing versions")
+	}
+}
+
+func TestChunkPayloadAccounts(t *testing.T) {
+	payload := strings.Repeat("a", maxSecretSize+1)
+
+	tests := map[string]struct {
+		callerAccount string
+		err           string
+	}{
+		"same account":    {callerAccount: "123456789012"},
+		"unknown account": {},
+		"other account":   {callerAccount: "210987654321", err: "secret is in account 123456789012, not in account 210987654321"},
+	}
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			app, _, secretsManager := newTestApp(0)
+			app.config.CallerAccount = test.callerAccount
+
+			_, err := app.chunkPayload(context.Background(), payload)
+			if test.err != "" {
+				if err == nil || !strings.Contains(err.Error(), test.err) {
+					t.Fatalf("expected an error containing %q, got %v", test.err, err)
+				}
+				if len(secretsManager.managed) != 0 {
+					t.Errorf("expected no chunk created, got %v", secretsManager.managed)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("chunk payload: %v", err)
+			}
+			if len(secretsManager.managed) != 2 {
+				t.Errorf("expected the payload split in 2 chunks, got %d secrets", len(secretsManager.managed))
+			}
+		})
+	}
+}
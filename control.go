@@ -0,0 +1,150 @@
+package main
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// Authenticated HTTP API for external orchestration to drive the tool: read the status, trigger a status
+// check, a snapshot or an unseal, and pause or resume the automatic checks. Requests carry the token as a
+// bearer token.
+//
+// Pausing stops the periodic, SQS and dashboard triggered checks, so that an orchestrator taking over the
+// node is the only one acting on it. The actions requested through the API still run while paused, as they
+// are how the orchestrator drives the node.
+type controlAPI struct {
+	token   string
+	history *checkHistory
+	events  chan<- reconcileEvent
+	// Whether the automatic checks are paused.
+	paused *atomic.Bool
+}
+
+// Status returned by the control API.
+type controlStatus struct {
+	Paused bool `json:"paused"`
+	// Error of the requested snapshot or unseal, if it failed.
+	Error string `json:"error,omitempty"`
+	// Most recent status check, if any.
+	Last *controlCheck `json:"last,omitempty"`
+}
+
+type controlCheck struct {
+	Time   time.Time    `json:"time"`
+	Result *CheckResult `json:"result,omitempty"`
+	Error  string       `json:"error,omitempty"`
+}
+
+// Serve the API under /v1/.
+func (c *controlAPI) handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/v1/status", c.authorize(http.MethodGet, c.serveStatus))
+	mux.HandleFunc("/v1/reconcile", c.authorize(http.MethodPost, c.serveAction("")))
+	mux.HandleFunc("/v1/snapshot", c.authorize(http.MethodPost, c.serveAction(actionSnapshot)))
+	mux.HandleFunc("/v1/unseal", c.authorize(http.MethodPost, c.serveAction(actionUnseal)))
+	mux.HandleFunc("/v1/pause", c.authorize(http.MethodPost, c.setPaused(true)))
+	mux.HandleFunc("/v1/resume", c.authorize(http.MethodPost, c.setPaused(false)))
+	return mux
+}
+
+// Wrap the handler, refusing requests with another method or without the token.
+func (c *controlAPI) authorize(method string, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !ok || subtle.ConstantTimeCompare([]byte(token), []byte(c.token)) != 1 {
+			slog.Warn("Unauthorized control API request", "path", r.URL.Path, "remoteAddr", r.RemoteAddr)
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		if r.Method != method {
+			w.Header().Set("Allow", method)
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		next(w, r)
+	}
+}
+
+func (c *controlAPI) serveStatus(w http.ResponseWriter, _ *http.Request) {
+	c.writeStatus(w, http.StatusOK)
+}
+
+// Trigger the action, a status check if empty, returning the status once it completes. Fails with 502 if the
+// action fails, with its error.
+func (c *controlAPI) serveAction(action eventAction) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		slog.Info("Action requested from the control API", "action", action, "remoteAddr", r.RemoteAddr)
+
+		done := make(chan error, 1)
+		select {
+		case c.events <- reconcileEvent{Action: action, Manual: true, Done: func(err error) { done <- err }}:
+		case <-r.Context().Done():
+			return
+		}
+
+		var err error
+		select {
+		case err = <-done:
+		case <-r.Context().Done():
+			return
+		}
+
+		if err != nil && action != "" {
+			c.write(w, http.StatusBadGateway, err)
+			return
+		}
+		status := http.StatusOK
+		if err != nil {
+			status = http.StatusBadGateway
+		}
+		c.writeStatus(w, status)
+	}
+}
+
+func (c *controlAPI) setPaused(paused bool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if c.paused.Swap(paused) != paused {
+			slog.Warn("Automatic status checks toggled from the control API", "paused", paused, "remoteAddr", r.RemoteAddr)
+		}
+		c.writeStatus(w, http.StatusOK)
+	}
+}
+
+func (c *controlAPI) writeStatus(w http.ResponseWriter, code int) {
+	c.write(w, code, nil)
+}
+
+// Write the status, with the error of the requested action if any.
+func (c *controlAPI) write(w http.ResponseWriter, code int, actionErr error) {
+	status := controlStatus{Paused: c.paused.Load()}
+	if actionErr != nil {
+		status.Error = actionErr.Error()
+	}
+	if recent := c.history.list(); len(recent) > 0 {
+		status.Last = &controlCheck{
+			Time:   recent[0].Time,
+			Result: recent[0].Result,
+			Error:  recent[0].Error,
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	if err := json.NewEncoder(w).Encode(status); err != nil {
+		slog.Error("Writing control API response", "error", err)
+	}
+}
+
+// Serve the control API. Runs until the server fails.
+func serveControlAPI(addr string, c *controlAPI) {
+	slog.Info("Serving control API", "addr", addr)
+	if err := http.ListenAndServe(addr, c.handler()); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		slog.Error("Serving control API", "error", err)
+	}
+}
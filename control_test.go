@@ -0,0 +1,111 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+)
+
+func newTestControlAPI(checkErr error) (*controlAPI, func()) {
+	events := make(chan reconcileEvent)
+	c := &controlAPI{token: "secret", history: &checkHistory{}, events: events, paused: &atomic.Bool{}}
+	go func() {
+		for event := range events {
+			if !event.Manual {
+				panic("control API event not manual")
+			}
+			if event.Action != "" {
+				event.Done(checkErr)
+				continue
+			}
+			c.history.record(&CheckResult{State: StateActive}, checkErr)
+			event.Done(checkErr)
+		}
+	}()
+	return c, func() { close(events) }
+}
+
+func controlRequest(c *controlAPI, method, path, token string) (*httptest.ResponseRecorder, controlStatus) {
+	req := httptest.NewRequest(method, path, nil)
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	rec := httptest.NewRecorder()
+	c.handler().ServeHTTP(rec, req)
+
+	var status controlStatus
+	_ = json.Unmarshal(rec.Body.Bytes(), &status)
+	return rec, status
+}
+
+func TestControlAPIRequiresToken(t *testing.T) {
+	c, stop := newTestControlAPI(nil)
+	defer stop()
+
+	for _, token := range []string{"", "wrong"} {
+		if rec, _ := controlRequest(c, http.MethodPost, "/v1/reconcile", token); rec.Code != http.StatusUnauthorized {
+			t.Errorf("token %q: expected 401, got %d", token, rec.Code)
+		}
+	}
+	if len(c.history.list()) != 0 {
+		t.Fatalf("expected no status check run")
+	}
+}
+
+func TestControlAPIReconcile(t *testing.T) {
+	c, stop := newTestControlAPI(nil)
+	defer stop()
+
+	rec, status := controlRequest(c, http.MethodPost, "/v1/reconcile", "secret")
+	if rec.Code != http.StatusOK || status.Last == nil || status.Last.Result.State != StateActive {
+		t.Fatalf("expected the check result, got %d %s", rec.Code, rec.Body.String())
+	}
+
+	c, stop = newTestControlAPI(errors.New("vault unreachable"))
+	defer stop()
+
+	rec, status = controlRequest(c, http.MethodPost, "/v1/reconcile", "secret")
+	if rec.Code != http.StatusBadGateway || status.Last == nil || status.Last.Error != "vault unreachable" {
+		t.Fatalf("expected the check error, got %d %s", rec.Code, rec.Body.String())
+	}
+}
+
+func TestControlAPIPause(t *testing.T) {
+	c, stop := newTestControlAPI(nil)
+	defer stop()
+
+	if _, status := controlRequest(c, http.MethodPost, "/v1/pause", "secret"); !status.Paused || !c.paused.Load() {
+		t.Fatalf("expected checks paused")
+	}
+	if rec, _ := controlRequest(c, http.MethodGet, "/v1/pause", "secret"); rec.Code != http.StatusMethodNotAllowed {
+		t.Fatalf("expected 405, got %d", rec.Code)
+	}
+	if _, status := controlRequest(c, http.MethodPost, "/v1/resume", "secret"); status.Paused || c.paused.Load() {
+		t.Fatalf("expected checks resumed")
+	}
+}
+
+func TestControlAPIActions(t *testing.T) {
+	for _, path := range []string{"/v1/snapshot", "/v1/unseal"} {
+		c, stop := newTestControlAPI(nil)
+		c.paused.Store(true)
+
+		// Requested by the orchestrator, so run while paused.
+		if rec, status := controlRequest(c, http.MethodPost, path, "secret"); rec.Code != http.StatusOK || status.Error != "" {
+			t.Errorf("%s: expected the action run, got %d %s", path, rec.Code, rec.Body.String())
+		}
+		if len(c.history.list()) != 0 {
+			t.Errorf("%s: expected no status check run", path)
+		}
+		stop()
+
+		c, stop = newTestControlAPI(ErrOutsideMaintenanceWindow)
+		if rec, status := controlRequest(c, http.MethodPost, path, "secret"); rec.Code != http.StatusBadGateway || status.Error != ErrOutsideMaintenanceWindow.Error() {
+			t.Errorf("%s: expected the action error, got %d %s", path, rec.Code, rec.Body.String())
+		}
+		stop()
+	}
+}
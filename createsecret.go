@@ -0,0 +1,73 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sort"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/aws/arn"
+	"github.com/aws/aws-sdk-go-v2/service/secretsmanager"
+	"github.com/aws/aws-sdk-go-v2/service/secretsmanager/types"
+)
+
+// Create the secret, without a value, encrypted with the configured KMS key and tagged with the configured
+// tags, then attach the configured resource policy. A secret created meanwhile, e.g. by another replica,
+// is left as is.
+func (a *App) CreateSecret(ctx context.Context) error {
+	if arn.IsARN(a.config.SecretID) {
+		return fmt.Errorf("create secret: %w: a secret referenced by ARN cannot be created, set SECRETSMANAGER_SECRET_ID to its name", ErrSecretMissing)
+	}
+
+	input := &secretsmanager.CreateSecretInput{
+		Name:        &a.config.SecretID,
+		Description: aws.String("Vault init response, written by vault-init"),
+	}
+	if a.config.SecretKMSKeyID != "" {
+		input.KmsKeyId = &a.config.SecretKMSKeyID
+	}
+	keys := make([]string, 0, len(a.config.Tags))
+	for key := range a.config.Tags {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		input.Tags = append(input.Tags, types.Tag{Key: aws.String(key), Value: aws.String(a.config.Tags[key])})
+	}
+
+	created, err := a.secretsManager.CreateSecret(ctx, input)
+	var exists *types.ResourceExistsException
+	if errors.As(err, &exists) {
+		slog.Info("Secret created meanwhile, leaving it as is", "secretID", a.config.SecretID)
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("create secret: %w", err)
+	}
+	a.invalidateSecretMetadata()
+	slog.Info("Created secret", "arn", aws.ToString(created.ARN), "kmsKeyID", a.config.SecretKMSKeyID)
+
+	if a.config.SecretResourcePolicy == "" {
+		return nil
+	}
+	_, err = a.secretsManager.PutResourcePolicy(ctx, &secretsmanager.PutResourcePolicyInput{
+		SecretId:          created.ARN,
+		ResourcePolicy:    &a.config.SecretResourcePolicy,
+		BlockPublicPolicy: aws.Bool(true),
+	})
+	if err != nil {
+		return fmt.Errorf("put secret policy: %w", err)
+	}
+	return nil
+}
+
+// Parse the SECRETSMANAGER_RESOURCE_POLICY env, a policy JSON document.
+func parseSecretResourcePolicy(policy string) (string, error) {
+	if policy != "" && !json.Valid([]byte(policy)) {
+		return "", errors.New("SECRETSMANAGER_RESOURCE_POLICY env is not a JSON document")
+	}
+	return policy, nil
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"context"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/secretsmanager"
+)
+
+// Secrets Manager recording the secrets created and the resource policies put.
+type creatingSecretsManager struct {
+	*fakeSecretsManager
+	created  []*secretsmanager.CreateSecretInput
+	policies map[string]string
+}
+
+func (s *creatingSecretsManager) CreateSecret(ctx context.Context, params *secretsmanager.CreateSecretInput, optFns ...func(*secretsmanager.Options)) (*secretsmanager.CreateSecretOutput, error) {
+	s.created = append(s.created, params)
+	return s.fakeSecretsManager.CreateSecret(ctx, params, optFns...)
+}
+
+func (s *creatingSecretsManager) PutResourcePolicy(_ context.Context, params *secretsmanager.PutResourcePolicyInput, _ ...func(*secretsmanager.Options)) (*secretsmanager.PutResourcePolicyOutput, error) {
+	s.policies[aws.ToString(params.SecretId)] = aws.ToString(params.ResourcePolicy)
+	return &secretsmanager.PutResourcePolicyOutput{}, nil
+}
+
+func TestCreateSecret(t *testing.T) {
+	app, _, _ := newTestApp(0)
+	secretsManager := &creatingSecretsManager{fakeSecretsManager: newFakeSecretsManager(), policies: map[string]string{}}
+	app.secretsManager = secretsManager
+	app.config.SecretKMSKeyID = "alias/vault-init"
+	app.config.Tags = map[string]string{"team": "platform", "env": "prod"}
+	app.config.SecretResourcePolicy = `{"Version": "2012-10-17", "Statement": []}`
+
+	if err := app.CreateSecret(context.Background()); err != nil {
+		t.Fatalf("create secret: %v", err)
+	}
+	if len(secretsManager.created) != 1 {
+		t.Fatalf("expected the secret created, got %d calls", len(secretsManager.created))
+	}
+	created := secretsManager.created[0]
+	if aws.ToString(created.Name) != "vault" || aws.ToString(created.KmsKeyId) != "alias/vault-init" || created.SecretString != nil {
+		t.Errorf("expected the vault secret created empty with the KMS key, got %+v", created)
+	}
+	if len(created.Tags) != 2 || aws.ToString(created.Tags[0].Key) != "env" {
+		t.Errorf("expected the secret created with the sorted tags, got %+v", created.Tags)
+	}
+	if policy := secretsManager.policies["arn:aws:secretsmanager:us-east-1:123456789012:secret:vault"]; policy != app.config.SecretResourcePolicy {
+		t.Errorf("expected the resource policy attached, got %q", policy)
+	}
+
+	// Another replica created it meanwhile.
+	if err := app.CreateSecret(context.Background()); err != nil {
+		t.Errorf("expected the existing secret left as is, got %v", err)
+	}
+
+	app.config.SecretID = "arn:aws:secretsmanager:us-east-1:123456789012:secret:vault-AbCdEf"
+	if err := app.CreateSecret(context.Background()); err == nil {
+		t.Error("expected secrets referenced by ARN not created")
+	}
+}
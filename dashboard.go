@@ -0,0 +1,280 @@
+package main
+
+import (
+	"crypto/subtle"
+	"errors"
+	"html/template"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/hashicorp/vault/api"
+)
+
+// Number of recent status checks kept for the dashboard and the control API.
+const dashboardEvents = 50
+
+// A status check shown on the dashboard.
+type dashboardEvent struct {
+	Time   time.Time
+	Result *CheckResult
+	Error  string
+}
+
+// Actions taken by the check, for display.
+func (e dashboardEvent) Actions() []string {
+	var actions []string
+	if e.Result == nil {
+		return nil
+	}
+	if e.Result.Init != nil {
+		actions = append(actions, "init")
+	}
+	if e.Result.Join != nil {
+		actions = append(actions, "join")
+	}
+	if e.Result.Unseal != nil {
+		actions = append(actions, "unseal")
+	}
+	if e.Result.Bootstrap != nil {
+		actions = append(actions, "bootstrap")
+	}
+	return actions
+}
+
+// Recent status checks, shown by the dashboard and the control API, and the Raft topology read after the
+// latest check of an unsealed node. Safe for concurrent use.
+type checkHistory struct {
+	mu     sync.Mutex
+	recent []dashboardEvent
+
+	topology    *api.AutopilotState
+	topologyErr string
+}
+
+// Record the outcome of a status check.
+func (h *checkHistory) record(result *CheckResult, err error) {
+	event := dashboardEvent{Time: time.Now(), Result: result}
+	if err != nil {
+		event.Error = err.Error()
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.recent = append(h.recent, event)
+	if len(h.recent) > dashboardEvents {
+		h.recent = h.recent[len(h.recent)-dashboardEvents:]
+	}
+}
+
+// Record the Raft topology, or the error reading it.
+func (h *checkHistory) recordTopology(state *api.AutopilotState, err error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.topology, h.topologyErr = state, ""
+	if err != nil {
+		h.topologyErr = err.Error()
+	}
+}
+
+// Returns the recorded Raft topology, nil if none, and the error reading it.
+func (h *checkHistory) lastTopology() (*api.AutopilotState, string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.topology, h.topologyErr
+}
+
+// Returns the recorded checks, most recent first.
+func (h *checkHistory) list() []dashboardEvent {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	recent := make([]dashboardEvent, 0, len(h.recent))
+	for i := len(h.recent) - 1; i >= 0; i-- {
+		recent = append(recent, h.recent[i])
+	}
+	return recent
+}
+
+// Web status page of the Vault node, showing the recent status checks and the Raft topology, and triggering
+// reconciles and snapshots. It never shows keys nor tokens, only the check results. Browsers authenticate
+// with HTTP basic auth, the token as password. While the control API pauses the automatic checks, the
+// dashboard cannot trigger any either.
+type dashboard struct {
+	hostname string
+	token    string
+	history  *checkHistory
+	events   chan<- reconcileEvent
+	paused   *atomic.Bool
+}
+
+func newDashboard(hostname, token string, history *checkHistory, events chan<- reconcileEvent, paused *atomic.Bool) *dashboard {
+	return &dashboard{hostname: hostname, token: token, history: history, events: events, paused: paused}
+}
+
+var dashboardTemplate = template.Must(template.New("dashboard").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>vault-init {{.Hostname}}</title>
+<style>
+body { font-family: sans-serif; margin: 2em; }
+table { border-collapse: collapse; }
+td, th { border: 1px solid #ccc; padding: 0.3em 0.6em; text-align: left; }
+.error { color: #b00; }
+</style>
+</head>
+<body>
+<h1>{{.Hostname}}</h1>
+{{if .Paused}}<p class="error">Automatic checks are paused from the control API, so are the actions below.</p>{{end}}
+{{with .Last}}
+<table>
+<tr><th>State</th><td>{{if .Result}}{{.Result.State}}{{else}}unknown{{end}}</td></tr>
+{{with .Result}}
+<tr><th>Initialized</th><td>{{.Initialized}}</td></tr>
+<tr><th>Sealed</th><td>{{.Sealed}}</td></tr>
+<tr><th>Standby</th><td>{{.Standby}}</td></tr>
+<tr><th>Performance standby</th><td>{{.PerformanceStandby}}</td></tr>
+<tr><th>DR secondary</th><td>{{.DRSecondary}}</td></tr>
+{{end}}
+<tr><th>Checked</th><td>{{.Time.Format "2006-01-02 15:04:05 MST"}}</td></tr>
+</table>
+{{else}}
+<p>No status check yet.</p>
+{{end}}
+<form method="post" action="reconcile"><button type="submit"{{if .Paused}} disabled{{end}}>Reconcile now</button></form>
+<form method="post" action="snapshot"><button type="submit"{{if .Paused}} disabled{{end}}>Take snapshot</button></form>
+<h2>Raft topology</h2>
+{{with .Topology}}
+<table>
+<tr><th>Healthy</th><td>{{.Healthy}}</td></tr>
+<tr><th>Failure tolerance</th><td>{{.FailureTolerance}}</td></tr>
+<tr><th>Leader</th><td>{{.Leader}}</td></tr>
+</table>
+<table>
+<tr><th>Server</th><th>Address</th><th>Status</th><th>Healthy</th><th>Last contact</th><th>Version</th></tr>
+{{range .Servers}}
+<tr><td>{{.Name}}</td><td>{{.Address}}</td><td>{{.Status}}</td><td>{{.Healthy}}</td><td>{{.LastContact}}</td><td>{{.Version}}</td></tr>
+{{end}}
+</table>
+{{else}}
+<p{{if .TopologyError}} class="error"{{end}}>{{or .TopologyError "Not read yet, the node must be unsealed."}}</p>
+{{end}}
+<h2>Recent checks</h2>
+<table>
+<tr><th>Time</th><th>State</th><th>Actions</th><th>Error</th></tr>
+{{range .Recent}}
+<tr><td>{{.Time.Format "2006-01-02 15:04:05 MST"}}</td><td>{{if .Result}}{{.Result.State}}{{end}}</td><td>{{range .Actions}}{{.}} {{end}}</td><td class="error">{{.Error}}</td></tr>
+{{end}}
+</table>
+</body>
+</html>
+`))
+
+// Serve the status page on /, and the reconcile and snapshot actions on /reconcile and /snapshot.
+func (d *dashboard) handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/", d.authorize(d.serveStatus))
+	mux.HandleFunc("/reconcile", d.authorize(d.serveAction("")))
+	mux.HandleFunc("/snapshot", d.authorize(d.serveAction(actionSnapshot)))
+	return mux
+}
+
+// Wrap the handler, asking browsers for the token as basic auth password.
+func (d *dashboard) authorize(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		_, token, ok := r.BasicAuth()
+		if !ok || subtle.ConstantTimeCompare([]byte(token), []byte(d.token)) != 1 {
+			if ok {
+				slog.Warn("Unauthorized dashboard request", "path", r.URL.Path, "remoteAddr", r.RemoteAddr)
+			}
+			w.Header().Set("WWW-Authenticate", `Basic realm="vault-init", charset="UTF-8"`)
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		next(w, r)
+	}
+}
+
+func (d *dashboard) serveStatus(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != "/" {
+		http.NotFound(w, r)
+		return
+	}
+
+	recent := d.history.list()
+
+	data := struct {
+		Hostname      string
+		Paused        bool
+		Last          *dashboardEvent
+		Recent        []dashboardEvent
+		Topology      *api.AutopilotState
+		TopologyError string
+	}{Hostname: d.hostname, Paused: d.paused.Load(), Recent: recent}
+	if len(recent) > 0 {
+		data.Last = &recent[0]
+	}
+	data.Topology, data.TopologyError = d.history.lastTopology()
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	if err := dashboardTemplate.Execute(w, data); err != nil {
+		slog.Error("Rendering dashboard", "error", err)
+	}
+}
+
+// Trigger the action, a status check if empty, waiting for it to complete before redirecting to the status
+// page. Refused with 409 while the automatic checks are paused.
+func (d *dashboard) serveAction(action eventAction) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			w.Header().Set("Allow", http.MethodPost)
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		// Browsers send the origin of cross-site form posts, which are refused.
+		if origin := r.Header.Get("Origin"); origin != "" {
+			if u, err := url.Parse(origin); err != nil || u.Host != r.Host {
+				http.Error(w, "cross-origin request refused", http.StatusForbidden)
+				return
+			}
+		}
+		if d.paused.Load() {
+			http.Error(w, "automatic checks are paused from the control API", http.StatusConflict)
+			return
+		}
+
+		slog.Info("Action requested from the dashboard", "action", action, "remoteAddr", r.RemoteAddr)
+
+		done := make(chan error, 1)
+		select {
+		case d.events <- reconcileEvent{Action: action, Done: func(err error) { done <- err }}:
+		case <-r.Context().Done():
+			return
+		}
+		var err error
+		select {
+		case err = <-done:
+		case <-r.Context().Done():
+			return
+		}
+
+		// Failed checks are shown with the recent checks.
+		if err != nil && action != "" {
+			http.Error(w, string(action)+" failed: "+err.Error(), http.StatusBadGateway)
+			return
+		}
+		http.Redirect(w, r, "./", http.StatusSeeOther)
+	}
+}
+
+// Serve the dashboard. Runs until the server fails.
+func serveDashboard(addr string, d *dashboard) {
+	slog.Info("Serving dashboard", "addr", addr)
+	if err := http.ListenAndServe(addr, d.handler()); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		slog.Error("Serving dashboard", "error", err)
+	}
+}
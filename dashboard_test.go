@@ -0,0 +1,145 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/hashicorp/vault/api"
+)
+
+// Dashboard whose events run by recording an active check, failing snapshots with snapshotErr.
+func newTestDashboard(t *testing.T, snapshotErr error) (*dashboard, *[]reconcileEvent) {
+	events := make(chan reconcileEvent)
+	history := &checkHistory{}
+	var handled []reconcileEvent
+	go func() {
+		for event := range events {
+			handled = append(handled, event)
+			if event.Action == actionSnapshot {
+				event.Done(snapshotErr)
+				continue
+			}
+			history.record(&CheckResult{State: StateActive}, nil)
+			event.Done(nil)
+		}
+	}()
+	t.Cleanup(func() { close(events) })
+	return newDashboard("vault-0", "secret", history, events, &atomic.Bool{}), &handled
+}
+
+func dashboardRequest(d *dashboard, method, path, token string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, "http://vault-0:8080"+path, nil)
+	req.Header.Set("Origin", "http://vault-0:8080")
+	if token != "" {
+		req.SetBasicAuth("operator", token)
+	}
+	rec := httptest.NewRecorder()
+	d.handler().ServeHTTP(rec, req)
+	return rec
+}
+
+func TestDashboardReconcile(t *testing.T) {
+	d, _ := newTestDashboard(t, nil)
+
+	if rec := dashboardRequest(d, http.MethodPost, "/reconcile", "secret"); rec.Code != http.StatusSeeOther {
+		t.Fatalf("expected a redirect, got %d", rec.Code)
+	}
+
+	rec := dashboardRequest(d, http.MethodGet, "/", "secret")
+	if !strings.Contains(rec.Body.String(), string(StateActive)) {
+		t.Fatalf("expected the recorded state on the page, got %s", rec.Body.String())
+	}
+}
+
+func TestDashboardRequiresToken(t *testing.T) {
+	d, handled := newTestDashboard(t, nil)
+
+	for _, token := range []string{"", "wrong"} {
+		for _, path := range []string{"/", "/reconcile", "/snapshot"} {
+			rec := dashboardRequest(d, http.MethodPost, path, token)
+			if rec.Code != http.StatusUnauthorized || rec.Header().Get("WWW-Authenticate") == "" {
+				t.Errorf("token %q on %s: expected a basic auth challenge, got %d", token, path, rec.Code)
+			}
+		}
+	}
+	if len(*handled) != 0 {
+		t.Fatalf("expected no action run, got %d", len(*handled))
+	}
+}
+
+func TestDashboardRefusesCrossOriginReconcile(t *testing.T) {
+	d, _ := newTestDashboard(t, nil)
+
+	req := httptest.NewRequest(http.MethodPost, "http://vault-0:8080/reconcile", nil)
+	req.Header.Set("Origin", "http://evil.example")
+	req.SetBasicAuth("operator", "secret")
+	rec := httptest.NewRecorder()
+	d.handler().ServeHTTP(rec, req)
+	if rec.Code != http.StatusForbidden {
+		t.Fatalf("expected the request refused, got %d", rec.Code)
+	}
+}
+
+func TestDashboardRespectsPause(t *testing.T) {
+	d, handled := newTestDashboard(t, nil)
+	d.paused.Store(true)
+
+	for _, path := range []string{"/reconcile", "/snapshot"} {
+		if rec := dashboardRequest(d, http.MethodPost, path, "secret"); rec.Code != http.StatusConflict {
+			t.Errorf("%s: expected the action refused while paused, got %d", path, rec.Code)
+		}
+	}
+	if len(*handled) != 0 {
+		t.Fatalf("expected no action run, got %d", len(*handled))
+	}
+	if rec := dashboardRequest(d, http.MethodGet, "/", "secret"); !strings.Contains(rec.Body.String(), "paused") {
+		t.Fatalf("expected the pause shown, got %s", rec.Body.String())
+	}
+}
+
+func TestDashboardSnapshot(t *testing.T) {
+	d, handled := newTestDashboard(t, nil)
+	if rec := dashboardRequest(d, http.MethodPost, "/snapshot", "secret"); rec.Code != http.StatusSeeOther {
+		t.Fatalf("expected a redirect, got %d", rec.Code)
+	}
+	if len(*handled) != 1 || (*handled)[0].Action != actionSnapshot || (*handled)[0].Manual {
+		t.Fatalf("expected a snapshot requested, got %+v", *handled)
+	}
+
+	d, _ = newTestDashboard(t, errors.New("no snapshot store configured"))
+	rec := dashboardRequest(d, http.MethodPost, "/snapshot", "secret")
+	if rec.Code != http.StatusBadGateway || !strings.Contains(rec.Body.String(), "no snapshot store") {
+		t.Fatalf("expected the failure shown, got %d %s", rec.Code, rec.Body.String())
+	}
+}
+
+func TestDashboardRaftTopology(t *testing.T) {
+	d, _ := newTestDashboard(t, nil)
+	if rec := dashboardRequest(d, http.MethodGet, "/", "secret"); !strings.Contains(rec.Body.String(), "Not read yet") {
+		t.Fatalf("expected no topology yet, got %s", rec.Body.String())
+	}
+
+	d.history.recordTopology(&api.AutopilotState{
+		Healthy: true,
+		Leader:  "vault-0",
+		Servers: map[string]*api.AutopilotServer{
+			"vault-0": {Name: "vault-0", Address: "vault-0.vault-internal:8201", Status: "leader", Healthy: true},
+			"vault-1": {Name: "vault-1", Address: "vault-1.vault-internal:8201", Status: "voter", Healthy: false},
+		},
+	}, nil)
+	body := dashboardRequest(d, http.MethodGet, "/", "secret").Body.String()
+	for _, want := range []string{"vault-0.vault-internal:8201", "vault-1.vault-internal:8201", "voter"} {
+		if !strings.Contains(body, want) {
+			t.Errorf("expected %q on the page, got %s", want, body)
+		}
+	}
+
+	d.history.recordTopology(nil, errors.New("permission denied"))
+	if body := dashboardRequest(d, http.MethodGet, "/", "secret").Body.String(); !strings.Contains(body, "permission denied") {
+		t.Errorf("expected the error on the page, got %s", body)
+	}
+}
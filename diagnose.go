@@ -0,0 +1,31 @@
+package main
+
+import (
+	"context"
+	"os"
+
+	"github.com/aws/aws-sdk-go-v2/service/secretsmanager"
+)
+
+// Run the `diagnose` subcommand, printing how the Secrets Manager endpoint is reached and the result
+// of each permission check. Returns the process exit code.
+func runDiagnose(ctx context.Context, app *App, secretsManagerOptions secretsmanager.Options, format outputFormat) int {
+	output := commandOutput{Command: "diagnose"}
+
+	var route *EndpointRoute
+	endpoint, err := secretsManagerEndpoint(ctx, secretsManagerOptions)
+	if err == nil {
+		route, err = detectEndpointRoute(ctx, endpoint)
+	}
+	if err != nil {
+		output.step("secretsmanager endpoint", "", err)
+	} else {
+		output.step("secretsmanager endpoint", route.String(), nil)
+		output.Result = route
+	}
+
+	for _, check := range app.CheckPermissions(ctx) {
+		output.step(check.Action, "", check.Err)
+	}
+	return output.print(os.Stdout, format)
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"sort"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/secretsmanager"
+	"github.com/aws/aws-sdk-go-v2/service/secretsmanager/types"
+)
+
+// Find the ARN of the only secret having all the tags. Secrets scheduled for deletion are ignored.
+func discoverSecret(ctx context.Context, client secretsmanager.ListSecretsAPIClient, tags map[string]string) (string, error) {
+	keys := make([]string, 0, len(tags))
+	for key := range tags {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	// ListSecrets matches tag keys and values independently, so tags are checked again on each secret.
+	var filters []types.Filter
+	for _, key := range keys {
+		filters = append(filters,
+			types.Filter{Key: types.FilterNameStringTypeTagKey, Values: []string{key}},
+			types.Filter{Key: types.FilterNameStringTypeTagValue, Values: []string{tags[key]}},
+		)
+	}
+
+	var matches []string
+	paginator := secretsmanager.NewListSecretsPaginator(client, &secretsmanager.ListSecretsInput{Filters: filters})
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			return "", fmt.Errorf("list secrets: %w", err)
+		}
+		for _, secret := range page.SecretList {
+			if hasTags(secret.Tags, tags) {
+				matches = append(matches, aws.ToString(secret.ARN))
+			}
+		}
+	}
+
+	switch len(matches) {
+	case 0:
+		return "", fmt.Errorf("%w: no secret has tags %v", ErrSecretMissing, tags)
+	case 1:
+		slog.Info("Discovered secret by tags", "arn", matches[0], "tags", tags)
+		return matches[0], nil
+	default:
+		return "", fmt.Errorf("secrets %s all have tags %v", strings.Join(matches, ", "), tags)
+	}
+}
+
+func hasTags(tags []types.Tag, want map[string]string) bool {
+	found := 0
+	for _, tag := range tags {
+		if value, ok := want[aws.ToString(tag.Key)]; ok && value == aws.ToString(tag.Value) {
+			found++
+		}
+	}
+	return found == len(want)
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/secretsmanager"
+	"github.com/aws/aws-sdk-go-v2/service/secretsmanager/types"
+)
+
+// ListSecrets returning one secret per page, ignoring the filters like Secrets Manager ignores the pairing of
+// tag keys and values.
+type listedSecrets struct {
+	secrets []types.SecretListEntry
+	filters []types.Filter
+}
+
+func (l *listedSecrets) ListSecrets(_ context.Context, params *secretsmanager.ListSecretsInput, _ ...func(*secretsmanager.Options)) (*secretsmanager.ListSecretsOutput, error) {
+	l.filters = params.Filters
+	if len(l.secrets) == 0 {
+		return &secretsmanager.ListSecretsOutput{}, nil
+	}
+	var page int
+	if token := aws.ToString(params.NextToken); token != "" {
+		page = int(token[0] - '0')
+	}
+	output := &secretsmanager.ListSecretsOutput{SecretList: l.secrets[page : page+1]}
+	if page+1 < len(l.secrets) {
+		output.NextToken = aws.String(string(rune('0' + page + 1)))
+	}
+	return output, nil
+}
+
+func listedSecret(name string, tags map[string]string) types.SecretListEntry {
+	entry := types.SecretListEntry{ARN: aws.String("arn:aws:secretsmanager:us-east-1:123456789012:secret:" + name)}
+	for key, value := range tags {
+		entry.Tags = append(entry.Tags, types.Tag{Key: aws.String(key), Value: aws.String(value)})
+	}
+	return entry
+}
+
+func TestDiscoverSecret(t *testing.T) {
+	tags := map[string]string{"vault-cluster": "prod-eu", "team": "platform"}
+
+	tests := map[string]struct {
+		secrets []types.SecretListEntry
+		arn     string
+		err     string
+	}{
+		"single match": {
+			secrets: []types.SecretListEntry{
+				// Has both tag keys and values, but not paired.
+				listedSecret("staging", map[string]string{"vault-cluster": "platform", "team": "prod-eu"}),
+				listedSecret("prod", map[string]string{"vault-cluster": "prod-eu", "team": "platform", "owner": "sre"}),
+			},
+			arn: "arn:aws:secretsmanager:us-east-1:123456789012:secret:prod",
+		},
+		"no match": {
+			secrets: []types.SecretListEntry{listedSecret("staging", map[string]string{"vault-cluster": "staging-eu", "team": "platform"})},
+			err:     "no secret has tags",
+		},
+		"several matches": {
+			secrets: []types.SecretListEntry{listedSecret("prod", tags), listedSecret("prod-copy", tags)},
+			err:     "secret:prod, arn:aws:secretsmanager:us-east-1:123456789012:secret:prod-copy all have tags",
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			client := &listedSecrets{secrets: test.secrets}
+			arn, err := discoverSecret(context.Background(), client, tags)
+			if test.err != "" {
+				if err == nil || !strings.Contains(err.Error(), test.err) {
+					t.Fatalf("expected an error containing %q, got %v", test.err, err)
+				}
+				return
+			}
+			if err != nil || arn != test.arn {
+				t.Fatalf("expected %s, got %q, %v", test.arn, arn, err)
+			}
+			if len(client.filters) != 4 || client.filters[0].Key != types.FilterNameStringTypeTagKey || client.filters[0].Values[0] != "team" {
+				t.Errorf("expected the tag keys and values filtered in order, got %+v", client.filters)
+			}
+		})
+	}
+}
+
+func TestDiscoverSecretMissing(t *testing.T) {
+	_, err := discoverSecret(context.Background(), &listedSecrets{}, map[string]string{"vault-cluster": "prod-eu"})
+	if !errors.Is(err, ErrSecretMissing) {
+		t.Fatalf("expected ErrSecretMissing, got %v", err)
+	}
+}
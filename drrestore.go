@@ -0,0 +1,322 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/secretsmanager"
+	"github.com/hashicorp/vault/api"
+)
+
+// How long to wait for Vault to become active after initializing, unsealing or restoring it.
+const drActiveTimeout = 2 * time.Minute
+
+// Mounts and auth methods every Vault has, which tell nothing about the restored data.
+var (
+	defaultMounts      = map[string]bool{"sys/": true, "cubbyhole/": true, "identity/": true}
+	defaultAuthMethods = map[string]bool{"token/": true}
+)
+
+// DRStep describes a step of the disaster recovery restore workflow.
+type DRStep struct {
+	Name   string
+	Detail string
+	Err    error
+}
+
+// Restore the latest Raft snapshot onto this Vault node, after losing the storage of the cluster:
+//  1. Locate the latest snapshot.
+//  2. Get Vault unsealed and active. Uninitialized nodes are initialized with a throwaway key share,
+//     never stored, as snapshots can only be restored into an unsealed Vault.
+//  3. Restore the snapshot, forced as it comes from another cluster than the throwaway one.
+//  4. Unseal Vault with the stored keys, which match the barrier of the restored snapshot.
+//  5. Verify the Raft quorum is healthy and the restored data is present.
+//
+// Restoring and verifying requires a token: the root token stored with the unseal keys, otherwise the
+// given one (e.g. from VAULT_TOKEN). Stops at the first failing step, returning the steps run.
+//
+// Restoring is refused outside the maintenance windows, and onto an initialized Vault, whose data it would
+// replace, unless forced.
+func (a *App) RestoreSnapshot(ctx context.Context, store *snapshotStore, token string, force bool) []DRStep {
+	if err := checkMaintenanceWindow("dr restore", time.Now()); err != nil {
+		return []DRStep{{Name: "check maintenance window", Err: err}}
+	}
+	return a.restoreLatestSnapshot(ctx, store, token, force)
+}
+
+func (a *App) restoreLatestSnapshot(ctx context.Context, store *snapshotStore, token string, force bool) []DRStep {
+	var steps []DRStep
+	run := func(name string, step func() (string, error)) bool {
+		detail, err := step()
+		steps = append(steps, DRStep{Name: name, Detail: detail, Err: err})
+		if err != nil {
+			slog.Error("DR restore step failed", "step", name, "error", err)
+			return false
+		}
+		slog.Info("DR restore step completed", "step", name, "detail", detail)
+		return true
+	}
+
+	token = a.adminToken(ctx, token)
+
+	var key, restoreToken string
+	ok := run("locate snapshot", func() (detail string, err error) {
+		key, err = store.latest(ctx)
+		return fmt.Sprintf("s3://%s/%s", store.bucket, key), err
+	}) && run("prepare vault", func() (detail string, err error) {
+		detail, restoreToken, err = a.prepareRestore(ctx, token, force)
+		return detail, err
+	}) && run("restore snapshot", func() (string, error) {
+		return "", a.restoreSnapshot(ctx, store, key, restoreToken)
+	}) && run("unseal", func() (string, error) {
+		return a.unsealRestored(ctx)
+	}) && run("verify raft quorum", func() (string, error) {
+		return a.verifyQuorum(ctx, token)
+	}) && run("verify data", func() (string, error) {
+		return a.verifyData(ctx, token)
+	})
+	if ok {
+		slog.Info("DR restore completed", "snapshot", key)
+	}
+	return steps
+}
+
+// Get Vault unsealed and active to restore a snapshot into it, returning the token to restore it with. An
+// initialized Vault is only restored onto if forced, as it may be a live cluster.
+func (a *App) prepareRestore(ctx context.Context, token string, force bool) (detail, restoreToken string, err error) {
+	state, err := a.readState(ctx)
+	if err != nil {
+		return "", "", err
+	}
+
+	if state.State != StateUninitialized && state.State != StateDRSecondary && !force {
+		return "", "", fmt.Errorf("vault is already initialized (%s), restoring would replace its data, run with --force to restore anyway", state.State)
+	}
+
+	switch state.State {
+	case StateDRSecondary:
+		return "", "", ErrDRSecondary
+
+	case StateUninitialized:
+		restoreToken, err = a.initThrowaway(ctx)
+		if err != nil {
+			return "", "", err
+		}
+		detail = "initialized with a throwaway key share"
+
+	case StateSealed, StateMigrating:
+		if _, err := a.Unseal(ctx, state.State == StateMigrating); err != nil {
+			return "", "", fmt.Errorf("unseal: %w", err)
+		}
+		restoreToken, detail = token, "unsealed with the stored keys"
+
+	default:
+		restoreToken, detail = token, "already unsealed"
+	}
+
+	if restoreToken == "" {
+		return "", "", errors.New("no token to restore the snapshot with, store the root token with the unseal keys or set VAULT_TOKEN")
+	}
+	return detail, restoreToken, a.waitActive(ctx)
+}
+
+// Initialize Vault with a single key share, returning its root token. The keys are not stored, as the
+// restored snapshot replaces the barrier.
+func (a *App) initThrowaway(ctx context.Context) (string, error) {
+	sealStatus, err := a.vault.SealStatus(ctx)
+	if err != nil {
+		return "", fmt.Errorf("read seal status: %w", err)
+	}
+
+	request := &api.InitRequest{SecretShares: 1, SecretThreshold: 1}
+	if sealStatus.Type != "shamir" {
+		request = &api.InitRequest{RecoveryShares: 1, RecoveryThreshold: 1}
+	}
+	initResponse, err := a.vault.Init(ctx, request)
+	if err != nil {
+		return "", fmt.Errorf("init vault: %w", err)
+	}
+
+	// Auto-unseal seals unseal Vault on their own.
+	if sealStatus.Type == "shamir" {
+		if _, err := a.vault.Unseal(ctx, &api.UnsealOpts{Key: initResponse.KeysB64[0]}); err != nil {
+			return "", fmt.Errorf("unseal with the throwaway key: %w", err)
+		}
+	}
+	return initResponse.RootToken, nil
+}
+
+func (a *App) restoreSnapshot(ctx context.Context, store *snapshotStore, key, token string) error {
+	snapshot, err := store.open(ctx, key)
+	if err != nil {
+		return err
+	}
+	defer snapshot.Close()
+
+	client, err := a.vault.WithToken(token)
+	if err != nil {
+		return err
+	}
+	if err := client.Sys().RaftSnapshotRestoreWithContext(ctx, snapshot, true); err != nil {
+		return fmt.Errorf("restore snapshot: %w", err)
+	}
+	return nil
+}
+
+// Unseal Vault with the stored keys if the restore sealed it, and wait for it to become active.
+func (a *App) unsealRestored(ctx context.Context) (string, error) {
+	detail := "still unsealed"
+
+	state, err := a.readState(ctx)
+	if err != nil {
+		return "", err
+	}
+	if state.State == StateSealed {
+		result, err := a.Unseal(ctx, false)
+		if err != nil {
+			return "", err
+		}
+		detail = fmt.Sprintf("unsealed with %d stored keys", result.KeysSubmitted)
+	}
+	return detail, a.waitActive(ctx)
+}
+
+func (a *App) verifyQuorum(ctx context.Context, token string) (string, error) {
+	if token == "" {
+		return "", errors.New("no token to read the Raft state with, set VAULT_TOKEN")
+	}
+	client, err := a.vault.WithToken(token)
+	if err != nil {
+		return "", err
+	}
+
+	state, err := client.Sys().RaftAutopilotStateWithContext(ctx)
+	if err != nil {
+		return "", fmt.Errorf("read autopilot state: %w", err)
+	}
+	if state == nil {
+		return "", errors.New("autopilot state unavailable, Vault may not use Raft storage")
+	}
+
+	detail := fmt.Sprintf("leader %s, %d voters, failure tolerance %d", state.Leader, len(state.Voters), state.FailureTolerance)
+	if !state.Healthy {
+		return detail, fmt.Errorf("raft cluster unhealthy: %s", detail)
+	}
+	return detail, nil
+}
+
+// Check the restored Vault has mounts or auth methods besides the default ones.
+func (a *App) verifyData(ctx context.Context, token string) (string, error) {
+	client, err := a.vault.WithToken(token)
+	if err != nil {
+		return "", err
+	}
+
+	mounts, err := client.Sys().ListMountsWithContext(ctx)
+	if err != nil {
+		return "", fmt.Errorf("list mounts: %w", err)
+	}
+	authMethods, err := client.Sys().ListAuthWithContext(ctx)
+	if err != nil {
+		return "", fmt.Errorf("list auth methods: %w", err)
+	}
+
+	var customMounts, customAuthMethods int
+	for path := range mounts {
+		if !defaultMounts[path] {
+			customMounts++
+		}
+	}
+	for path := range authMethods {
+		if !defaultAuthMethods[path] {
+			customAuthMethods++
+		}
+	}
+
+	detail := fmt.Sprintf("%d secrets engines, %d auth methods", customMounts, customAuthMethods)
+	if customMounts == 0 && customAuthMethods == 0 {
+		return detail, errors.New("only default mounts and auth methods, the snapshot may be empty")
+	}
+	return detail, nil
+}
+
+// Returns the token to administer Vault with: the root token stored with the unseal keys, if any,
+// otherwise the given one.
+func (a *App) adminToken(ctx context.Context, token string) string {
+	if stored := a.storedRootToken(ctx); stored != "" {
+		return stored
+	}
+	return token
+}
+
+// Returns the root token stored with the unseal keys, or in the root token secret, empty if there is none
+// or it cannot be read, e.g. as the break-glass policy denies it.
+func (a *App) storedRootToken(ctx context.Context) string {
+	if a.config.RootTokenSecretName != "" {
+		secret, err := a.secretsManager.GetSecretValue(ctx, &secretsmanager.GetSecretValueInput{SecretId: &a.config.RootTokenSecretName})
+		if err != nil {
+			slog.Warn("Cannot read the stored root token", "secretID", a.config.RootTokenSecretName, "error", err)
+			return ""
+		}
+		var stored struct {
+			RootToken string `json:"root_token"`
+		}
+		if err := json.Unmarshal([]byte(aws.ToString(secret.SecretString)), &stored); err != nil {
+			slog.Warn("Cannot read the stored root token", "secretID", a.config.RootTokenSecretName, "error", err)
+		}
+		return stored.RootToken
+	}
+
+	secretString, err := a.readInitResponse(ctx)
+	if err != nil {
+		slog.Warn("Cannot read the stored root token", "error", err)
+		return ""
+	}
+
+	var initResponse api.InitResponse
+	if err := json.Unmarshal([]byte(secretString), &initResponse); err != nil {
+		slog.Warn("Cannot read the stored root token", "error", err)
+		return ""
+	}
+	return initResponse.RootToken
+}
+
+// Wait for Vault to become the active node, polling its state.
+func (a *App) waitActive(ctx context.Context) error {
+	ctx, cancel := context.WithTimeout(ctx, drActiveTimeout)
+	defer cancel()
+
+	ticker := time.NewTicker(2 * time.Second)
+	defer ticker.Stop()
+
+	for {
+		state, err := a.readState(ctx)
+		if err == nil && state.State == StateActive {
+			return nil
+		}
+
+		select {
+		case <-ctx.Done():
+			if err != nil {
+				return fmt.Errorf("wait for vault to become active: %w", err)
+			}
+			return fmt.Errorf("wait for vault to become active: still %s", state.State)
+		case <-ticker.C:
+		}
+	}
+}
+
+// Run the `dr restore` subcommand, printing the outcome of each step. Returns the process exit code.
+func runDRRestore(ctx context.Context, app *App, store *snapshotStore, token string, force bool, format outputFormat) int {
+	output := commandOutput{Command: "dr restore"}
+	for _, step := range app.RestoreSnapshot(ctx, store, token, force) {
+		output.step(step.Name, step.Detail, step.Err)
+	}
+	return output.print(os.Stdout, format)
+}
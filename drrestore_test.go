@@ -0,0 +1,31 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+func TestRestoreRefusesInitializedVault(t *testing.T) {
+	app, _, _ := newTestApp(0)
+	if _, err := app.CheckVaultStatus(context.Background()); err != nil {
+		t.Fatalf("initialize: %v", err)
+	}
+
+	if _, _, err := app.prepareRestore(context.Background(), "token", false); err == nil {
+		t.Fatal("expected the restore onto a live cluster refused")
+	}
+	detail, token, err := app.prepareRestore(context.Background(), "token", true)
+	if err != nil || token != "token" {
+		t.Fatalf("expected the forced restore prepared, got %q: %v", detail, err)
+	}
+}
+
+func TestRestoreOutsideMaintenanceWindow(t *testing.T) {
+	closeMaintenanceWindows(t)
+	app, vault, _ := newTestApp(0)
+	steps := app.RestoreSnapshot(context.Background(), nil, "token", true)
+	if len(steps) != 1 || !errors.Is(steps[0].Err, ErrOutsideMaintenanceWindow) || vault.inits != 0 {
+		t.Fatalf("expected the restore refused outside the maintenance windows, got %+v", steps)
+	}
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/kms"
+	"github.com/aws/aws-sdk-go-v2/service/secretsmanager"
+)
+
+// Check the secret is encrypted with the configured KMS key. If it is not, the mismatch is logged and,
+// when enforcing the key, the secret is re-encrypted with it within the maintenance windows.
+func (a *App) EnforceSecretKMSKey(ctx context.Context) error {
+	if a.config.SecretKMSKeyID == "" {
+		return nil
+	}
+
+	secret, err := a.describeSecret(ctx, false)
+	if err != nil {
+		return fmt.Errorf("describe secret: %w", err)
+	}
+
+	want, err := a.kmsKeyARN(ctx, a.config.SecretKMSKeyID)
+	if err != nil {
+		return err
+	}
+
+	// Secrets without a KMS key are encrypted with the aws/secretsmanager key.
+	current := aws.ToString(secret.KmsKeyId)
+	if current == "" {
+		current = "alias/aws/secretsmanager"
+	}
+	if current, err = a.kmsKeyARN(ctx, current); err != nil {
+		return err
+	}
+
+	if current == want {
+		slog.Debug("Secret encrypted with the configured KMS key", "keyARN", want)
+		return nil
+	}
+
+	slog.Warn("Secret is not encrypted with the configured KMS key", "current", current, "configured", want)
+	if !a.config.EnforceSecretKMSKey {
+		return nil
+	}
+
+	if err := checkMaintenanceWindow("re-encrypt secret", time.Now()); err != nil {
+		return err
+	}
+
+	_, err = a.secretsManager.UpdateSecret(ctx, &secretsmanager.UpdateSecretInput{
+		SecretId: &a.config.SecretID,
+		KmsKeyId: &want,
+	})
+	if err != nil {
+		return fmt.Errorf("re-encrypt secret: %w", err)
+	}
+	a.invalidateSecretMetadata()
+
+	slog.Info("Re-encrypted secret with the configured KMS key", "keyARN", want)
+	return nil
+}
+
+// Resolve a KMS key ID, ARN or alias to the key ARN.
+func (a *App) kmsKeyARN(ctx context.Context, keyID string) (string, error) {
+	output, err := a.kms.DescribeKey(ctx, &kms.DescribeKeyInput{KeyId: &keyID}, withKeyRegion(keyID))
+	if err != nil {
+		return "", fmt.Errorf("describe KMS key %s: %w", keyID, err)
+	}
+	return aws.ToString(output.KeyMetadata.Arn), nil
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	kmstypes "github.com/aws/aws-sdk-go-v2/service/kms/types"
+)
+
+func TestEnforceSecretKMSKey(t *testing.T) {
+	const configuredARN = "arn:aws:kms:us-east-1:123456789012:key/vault"
+
+	tests := map[string]struct {
+		// Configured key, and key the secret is encrypted with, empty for aws/secretsmanager.
+		configured, current string
+		enforce             bool
+		closedWindows       bool
+		// Key of the secret after the check.
+		want string
+		err  error
+		// Whether the configured key is not found.
+		missing bool
+	}{
+		"no key configured":      {current: "other", want: "other"},
+		"already encrypted":      {configured: "alias/vault", current: "vault", want: "vault"},
+		"mismatch reported":      {configured: "vault", current: "other", want: "other"},
+		"default key reported":   {configured: "vault"},
+		"re-encrypted":           {configured: "alias/vault", enforce: true, want: configuredARN},
+		"outside the windows":    {configured: "vault", current: "other", enforce: true, closedWindows: true, want: "other", err: ErrOutsideMaintenanceWindow},
+		"configured key missing": {configured: "deleted", current: "other", enforce: true, want: "other", missing: true},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			if test.closedWindows {
+				closeMaintenanceWindows(t)
+			}
+			app, _, secretsManager := newTestApp(0)
+			app.kms = &keyStatesKMS{
+				states:  map[string]kmstypes.KeyState{"vault": kmstypes.KeyStateEnabled, "other": kmstypes.KeyStateEnabled, "aws-managed": kmstypes.KeyStateEnabled},
+				aliases: map[string]string{"alias/vault": "vault", "alias/aws/secretsmanager": "aws-managed"},
+			}
+			app.config.SecretKMSKeyID, app.config.EnforceSecretKMSKey = test.configured, test.enforce
+			secretsManager.kmsKeyID = test.current
+
+			err := app.EnforceSecretKMSKey(context.Background())
+			var notFound *kmstypes.NotFoundException
+			if test.missing {
+				if !errors.As(err, &notFound) {
+					t.Fatalf("expected the configured key not found, got %v", err)
+				}
+			} else if !errors.Is(err, test.err) {
+				t.Fatalf("expected error %v, got %v", test.err, err)
+			}
+			if secretsManager.kmsKeyID != test.want {
+				t.Errorf("expected the secret encrypted with %q, got %q", test.want, secretsManager.kmsKeyID)
+			}
+		})
+	}
+}
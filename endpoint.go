@@ -0,0 +1,82 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/secretsmanager"
+)
+
+// EndpointRoute describes how an AWS service endpoint is reached from this host.
+type EndpointRoute struct {
+	Host  string
+	Addrs []string
+	// Whether the endpoint resolves to private addresses or a VPC endpoint DNS name,
+	// so it is reached through a VPC interface endpoint instead of the public endpoint.
+	VPCEndpoint bool
+}
+
+func (r *EndpointRoute) String() string {
+	route := "public endpoint"
+	if r.VPCEndpoint {
+		route = "VPC endpoint"
+	}
+	return fmt.Sprintf("%s via %s (%s)", r.Host, route, strings.Join(r.Addrs, ", "))
+}
+
+// Resolve the endpoint URL the Secrets Manager client sends requests to.
+func secretsManagerEndpoint(ctx context.Context, o secretsmanager.Options) (url.URL, error) {
+	endpoint, err := o.EndpointResolverV2.ResolveEndpoint(ctx, secretsmanager.EndpointParameters{
+		Region:       aws.String(o.Region),
+		UseFIPS:      aws.Bool(o.EndpointOptions.UseFIPSEndpoint == aws.FIPSEndpointStateEnabled),
+		UseDualStack: aws.Bool(o.EndpointOptions.UseDualStackEndpoint == aws.DualStackEndpointStateEnabled),
+		Endpoint:     o.BaseEndpoint,
+	})
+	if err != nil {
+		return url.URL{}, fmt.Errorf("resolve endpoint: %w", err)
+	}
+	return endpoint.URI, nil
+}
+
+// Detect whether the host is reached through a VPC interface endpoint and check it accepts connections.
+// Private subnets without a NAT gateway or VPC endpoint usually fail here, instead of hanging on API calls.
+func detectEndpointRoute(ctx context.Context, endpoint url.URL) (*EndpointRoute, error) {
+	host, port := endpoint.Hostname(), endpoint.Port()
+	if port == "" {
+		port = "443"
+		if endpoint.Scheme == "http" {
+			port = "80"
+		}
+	}
+
+	addrs, err := net.DefaultResolver.LookupIPAddr(ctx, host)
+	if err != nil {
+		return nil, fmt.Errorf("lookup %s: %w", host, err)
+	}
+
+	route := &EndpointRoute{
+		Host:        host,
+		VPCEndpoint: strings.Contains(host, ".vpce."),
+	}
+
+	private := len(addrs) > 0
+	for _, addr := range addrs {
+		route.Addrs = append(route.Addrs, addr.IP.String())
+		private = private && (addr.IP.IsPrivate() || addr.IP.IsLoopback())
+	}
+	route.VPCEndpoint = route.VPCEndpoint || private
+
+	dialer := net.Dialer{Timeout: 5 * time.Second}
+	conn, err := dialer.DialContext(ctx, "tcp", net.JoinHostPort(host, port))
+	if err != nil {
+		return route, fmt.Errorf("connect %s: %w", route, err)
+	}
+	conn.Close()
+
+	return route, nil
+}
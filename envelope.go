@@ -0,0 +1,92 @@
+package main
+
+import (
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/json"
+	"fmt"
+
+	"github.com/aws/aws-sdk-go-v2/service/kms"
+	"github.com/aws/aws-sdk-go-v2/service/kms/types"
+)
+
+// KMS encryption context bound to the data keys of envelopes.
+var envelopeContext = map[string]string{"purpose": "vault-init-response"}
+
+// Init response encrypted locally with AES-GCM, using a KMS data key stored encrypted alongside it.
+// Reading it requires kms:Decrypt on the KMS key besides access to the secret.
+type envelope struct {
+	KMSKeyID     string `json:"kms_key_id"`
+	EncryptedKey []byte `json:"encrypted_key"`
+	Nonce        []byte `json:"nonce"`
+	Ciphertext   []byte `json:"ciphertext"`
+}
+
+// Encrypt the payload with a new data key of the configured KMS key, returning the envelope JSON.
+func (a *App) sealEnvelope(ctx context.Context, payload []byte) ([]byte, error) {
+	keyID := a.config.EnvelopeKMSKeyID
+
+	dataKey, err := a.kms.GenerateDataKey(ctx, &kms.GenerateDataKeyInput{
+		KeyId:             &keyID,
+		KeySpec:           types.DataKeySpecAes256,
+		EncryptionContext: envelopeContext,
+	}, withKeyRegion(keyID))
+	if err != nil {
+		return nil, fmt.Errorf("generate data key: %w", err)
+	}
+
+	gcm, err := newGCM(dataKey.Plaintext)
+	if err != nil {
+		return nil, err
+	}
+
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, fmt.Errorf("generate nonce: %w", err)
+	}
+
+	return json.Marshal(envelope{
+		KMSKeyID:     keyID,
+		EncryptedKey: dataKey.CiphertextBlob,
+		Nonce:        nonce,
+		Ciphertext:   gcm.Seal(nil, nonce, payload, nil),
+	})
+}
+
+// Decrypt the payload if the stored value is an envelope. Other values are returned as is.
+func (a *App) openEnvelope(ctx context.Context, value string) (string, error) {
+	var e envelope
+	if json.Unmarshal([]byte(value), &e) != nil || len(e.Ciphertext) == 0 {
+		return value, nil
+	}
+
+	dataKey, err := a.kms.Decrypt(ctx, &kms.DecryptInput{
+		KeyId:             &e.KMSKeyID,
+		CiphertextBlob:    e.EncryptedKey,
+		EncryptionContext: envelopeContext,
+	}, withKeyRegion(e.KMSKeyID))
+	if err != nil {
+		return "", fmt.Errorf("decrypt data key: %w", err)
+	}
+
+	gcm, err := newGCM(dataKey.Plaintext)
+	if err != nil {
+		return "", err
+	}
+
+	payload, err := gcm.Open(nil, e.Nonce, e.Ciphertext, nil)
+	if err != nil {
+		return "", fmt.Errorf("decrypt envelope: %w", err)
+	}
+	return string(payload), nil
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, fmt.Errorf("create cipher: %w", err)
+	}
+	return cipher.NewGCM(block)
+}
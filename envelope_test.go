@@ -0,0 +1,61 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/service/kms"
+	kmstypes "github.com/aws/aws-sdk-go-v2/service/kms/types"
+)
+
+// KMS with enabled keys, generating data keys like dataKeyKMS.
+type envelopeKMS struct {
+	dataKeyKMS
+}
+
+func (envelopeKMS) DescribeKey(_ context.Context, params *kms.DescribeKeyInput, _ ...func(*kms.Options)) (*kms.DescribeKeyOutput, error) {
+	return &kms.DescribeKeyOutput{KeyMetadata: &kmstypes.KeyMetadata{KeyId: params.KeyId, KeyState: kmstypes.KeyStateEnabled}}, nil
+}
+
+func TestEnvelopePayload(t *testing.T) {
+	app, vault, secretsManager := newTestApp(0)
+	app.config.EnvelopeKMSKeyID = "alias/vault-init"
+	app.kms = envelopeKMS{}
+
+	if _, err := app.CheckVaultStatus(context.Background()); err != nil || vault.sealed {
+		t.Fatalf("expected Vault initialized and unsealed, got %v", err)
+	}
+
+	var stored envelope
+	if err := json.Unmarshal([]byte(*secretsManager.value), &stored); err != nil || len(stored.Ciphertext) == 0 {
+		t.Fatalf("expected the secret to hold an envelope, got %v", err)
+	}
+	if stored.KMSKeyID != "alias/vault-init" || len(stored.EncryptedKey) == 0 || strings.Contains(*secretsManager.value, "root_token") {
+		t.Fatalf("expected the init response encrypted with a data key of the KMS key, got %s", *secretsManager.value)
+	}
+
+	// Unsealing needs kms:Decrypt on the key besides access to the secret.
+	vault.sealed = true
+	app.kms = encryptOnlyKMS{}
+	if _, err := app.CheckVaultStatus(context.Background()); err == nil || !vault.sealed {
+		t.Fatalf("expected unsealing to fail without kms:Decrypt, got %v", err)
+	}
+
+	app.kms = envelopeKMS{}
+	if _, err := app.CheckVaultStatus(context.Background()); err != nil || vault.sealed {
+		t.Fatalf("expected Vault unsealed with the envelope, got %v", err)
+	}
+}
+
+func TestOpenEnvelopeKeepsPlainValues(t *testing.T) {
+	app, _, _ := newTestApp(0)
+
+	// Stored before envelope encryption was enabled.
+	plain := `{"keys_base64":["AQ=="],"root_token":"root"}`
+	value, err := app.openEnvelope(context.Background(), plain)
+	if err != nil || value != plain {
+		t.Fatalf("expected the plain value returned as is, got %q, %v", value, err)
+	}
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/hashicorp/vault/api"
+)
+
+var (
+	// ErrSecretMissing is returned when the AWS Secrets Manager secret does not exist
+	// or does not hold an init response yet.
+	ErrSecretMissing = errors.New("secret missing")
+
+	// ErrSecretInUse is returned when initializing Vault would overwrite an existing init response in the secret.
+	ErrSecretInUse = errors.New("secret already holds an init response")
+
+	// ErrNotLeader is returned when the configured Raft leader does not accept a join request.
+	ErrNotLeader = errors.New("raft leader did not accept join")
+
+	// ErrUnsealFailed is returned when Vault remains sealed after submitting the unseal keys.
+	ErrUnsealFailed = errors.New("unseal failed")
+
+	// ErrKeyMismatch is returned when Vault rejects the stored unseal keys as not matching its barrier,
+	// e.g. when the secret belongs to another cluster or the storage was wiped after initialization.
+	ErrKeyMismatch = errors.New("stored unseal keys do not match the vault barrier")
+
+	// ErrPermissionDenied is returned when AWS denies an action required by the App.
+	ErrPermissionDenied = errors.New("missing IAM permission")
+
+	// ErrKMSKeyUnavailable is returned when a KMS key Vault depends on is not accessible or not enabled.
+	ErrKMSKeyUnavailable = errors.New("KMS key unavailable")
+
+	// ErrVaultUnavailable is returned when Vault rate limits the request or cannot serve it yet, i.e. responds
+	// with 429 (rate limited or standby), 473 (performance standby) or 503 (sealed, standby or DR secondary).
+	ErrVaultUnavailable = errors.New("vault unavailable")
+
+	// ErrDRSecondary is returned when initializing or unsealing Vault is attempted on a DR secondary,
+	// which would break its replication from the primary cluster.
+	ErrDRSecondary = errors.New("vault is a DR secondary")
+
+	// ErrPlaintextTransport is returned when unseal keys would be sent or received over plaintext HTTP
+	// to another host.
+	ErrPlaintextTransport = errors.New("refusing to handle unseal keys over plaintext HTTP, set VAULT_ALLOW_PLAINTEXT=true to allow it")
+
+	// ErrOutsideMaintenanceWindow is returned when a disruptive operation is attempted outside
+	// the configured maintenance windows.
+	ErrOutsideMaintenanceWindow = errors.New("outside maintenance window")
+
+	// ErrActionClaimed is returned when another node claimed an action in the operation journal, e.g. initializing
+	// the cluster.
+	ErrActionClaimed = errors.New("action claimed by another node")
+
+	// ErrKeysInvalid is returned when the stored init response cannot unseal Vault, e.g. it does not parse
+	// or holds fewer shares than the threshold.
+	ErrKeysInvalid = errors.New("stored unseal keys are invalid")
+)
+
+// ShardError is returned when Vault rejects an individual unseal key shard.
+// It matches ErrUnsealFailed with errors.Is.
+type ShardError struct {
+	Index int
+	Err   error
+}
+
+func (e *ShardError) Error() string {
+	return fmt.Sprintf("unseal shard %d: %v", e.Index, e.Err)
+}
+
+func (e *ShardError) Unwrap() []error {
+	return []error{ErrUnsealFailed, e.Err}
+}
+
+// Errors returned by Vault when the combined unseal keys cannot decrypt its barrier.
+var keyMismatchErrors = []string{"message authentication failed", "failed to decrypt"}
+
+// Whether the unseal error means the keys do not match the Vault barrier, rather than a transient failure.
+func isKeyMismatch(err error) bool {
+	var responseErr *api.ResponseError
+	if !errors.As(err, &responseErr) || responseErr.StatusCode != http.StatusBadRequest {
+		return false
+	}
+	for _, msg := range responseErr.Errors {
+		for _, mismatch := range keyMismatchErrors {
+			if strings.Contains(msg, mismatch) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Wraps Vault responses that are worth retrying later with ErrVaultUnavailable.
+func vaultError(err error) error {
+	var responseErr *api.ResponseError
+	if !errors.As(err, &responseErr) {
+		return err
+	}
+
+	switch responseErr.StatusCode {
+	case http.StatusTooManyRequests, 473, http.StatusServiceUnavailable:
+		return fmt.Errorf("%w: %w", ErrVaultUnavailable, err)
+	}
+	return err
+}
@@ -0,0 +1,34 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/hashicorp/vault/api"
+)
+
+func TestIsKeyMismatch(t *testing.T) {
+	tests := map[string]struct {
+		err      error
+		mismatch bool
+	}{
+		"authentication failed": {err: &api.ResponseError{StatusCode: http.StatusBadRequest, Errors: []string{"cipher: message authentication failed"}}, mismatch: true},
+		"decryption failed":     {err: &api.ResponseError{StatusCode: http.StatusBadRequest, Errors: []string{"failed to decrypt keyring"}}, mismatch: true},
+		"wrapped": {
+			err:      fmt.Errorf("unseal: %w", &api.ResponseError{StatusCode: http.StatusBadRequest, Errors: []string{"cipher: message authentication failed"}}),
+			mismatch: true,
+		},
+		"invalid key":     {err: &api.ResponseError{StatusCode: http.StatusBadRequest, Errors: []string{"'key' must be a valid hex or base64 string"}}},
+		"server error":    {err: &api.ResponseError{StatusCode: http.StatusInternalServerError, Errors: []string{"failed to decrypt keyring"}}},
+		"network failure": {err: errors.New("dial tcp 10.0.0.1:8200: connect: connection refused")},
+		"no error":        {},
+	}
+
+	for name, test := range tests {
+		if mismatch := isKeyMismatch(test.err); mismatch != test.mismatch {
+			t.Errorf("%s: expected mismatch %t, got %t", name, test.mismatch, mismatch)
+		}
+	}
+}
@@ -70,10 +70,19 @@ resource "aws_iam_policy" "example" {
           Action = [
             "secretsmanager:DescribeSecret",
             "secretsmanager:GetSecretValue",
+            "secretsmanager:PutSecretValue",
+            "secretsmanager:TagResource",
             "secretsmanager:UpdateSecret",
+            "secretsmanager:UpdateSecretVersionStage",
           ],
           Effect   = "Allow"
           Resource = aws_secretsmanager_secret.example.arn
+        },
+        {
+          # Only needed to discover the secret with SECRETSMANAGER_SECRET_FILTER, or in fleet mode.
+          Action   = ["secretsmanager:ListSecrets"]
+          Effect   = "Allow"
+          Resource = "*"
         }
       ]
     }
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// Export the stored init response for offline escrow, encrypted to the recipient: an age public key
+// (`age1...`), or the path of a PGP public key file. Returns the ASCII armored ciphertext, so the plaintext
+// keys never leave the process.
+func (a *App) Export(ctx context.Context, recipient string) (string, error) {
+	if err := a.checkKeyTransport(); err != nil {
+		return "", err
+	}
+
+	encrypt := func(plaintext string) (string, error) {
+		return ageEncrypt(plaintext, recipient)
+	}
+	if !strings.HasPrefix(recipient, "age1") {
+		key, err := readPGPKey(recipient)
+		if err != nil {
+			return "", fmt.Errorf("read recipient: %w", err)
+		}
+		encrypt = func(plaintext string) (string, error) {
+			return pgpEncrypt(plaintext, key)
+		}
+	}
+
+	secretString, err := a.readInitResponse(ctx)
+	if err != nil {
+		return "", fmt.Errorf("read init response: %w", err)
+	}
+	return encrypt(secretString)
+}
+
+// Run the `export` subcommand, writing the init response encrypted to EXPORT_RECIPIENT to EXPORT_FILE, or
+// stdout if empty. Returns the process exit code.
+func runExport(ctx context.Context, app *App, recipient, path string) int {
+	if recipient == "" {
+		fmt.Fprintln(os.Stderr, "EXPORT_RECIPIENT env is required")
+		return 1
+	}
+
+	encrypted, err := app.Export(ctx, recipient)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Export failed: %v\n", err)
+		return 1
+	}
+
+	if path == "" {
+		fmt.Print(encrypted)
+		return 0
+	}
+	if err := os.WriteFile(path, []byte(encrypted), 0o600); err != nil {
+		fmt.Fprintf(os.Stderr, "Write %s: %v\n", path, err)
+		return 1
+	}
+	fmt.Fprintf(os.Stderr, "Encrypted init response written to %s\n", path)
+	return 0
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"filippo.io/age"
+	ageArmor "filippo.io/age/armor"
+	"golang.org/x/crypto/openpgp"
+	"golang.org/x/crypto/openpgp/armor"
+)
+
+func TestExportAge(t *testing.T) {
+	app, _, secretsManager := newTestApp(0)
+	if _, err := app.CheckVaultStatus(context.Background()); err != nil {
+		t.Fatalf("initialize: %v", err)
+	}
+
+	identity, _ := age.GenerateX25519Identity()
+	encrypted, err := app.Export(context.Background(), identity.Recipient().String())
+	if err != nil {
+		t.Fatalf("export: %v", err)
+	}
+	if strings.Contains(encrypted, "root") {
+		t.Fatal("expected the export encrypted")
+	}
+
+	r, err := age.Decrypt(ageArmor.NewReader(strings.NewReader(encrypted)), identity)
+	if err != nil {
+		t.Fatalf("decrypt: %v", err)
+	}
+	plaintext, _ := io.ReadAll(r)
+	if string(plaintext) != secretsManager.storedInitResponse() {
+		t.Fatalf("expected the stored init response, got %s", plaintext)
+	}
+}
+
+func TestExportPGP(t *testing.T) {
+	app, _, secretsManager := newTestApp(0)
+	if _, err := app.CheckVaultStatus(context.Background()); err != nil {
+		t.Fatalf("initialize: %v", err)
+	}
+
+	entity, err := openpgp.NewEntity("escrow", "", "escrow@example.com", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var publicKey bytes.Buffer
+	w, _ := armor.Encode(&publicKey, openpgp.PublicKeyType, nil)
+	if err := entity.Serialize(w); err != nil {
+		t.Fatal(err)
+	}
+	w.Close()
+	keyFile := filepath.Join(t.TempDir(), "escrow.asc")
+	if err := os.WriteFile(keyFile, publicKey.Bytes(), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	encrypted, err := app.Export(context.Background(), keyFile)
+	if err != nil {
+		t.Fatalf("export: %v", err)
+	}
+
+	block, err := armor.Decode(strings.NewReader(encrypted))
+	if err != nil {
+		t.Fatalf("dearmor: %v", err)
+	}
+	message, err := openpgp.ReadMessage(block.Body, openpgp.EntityList{entity}, nil, nil)
+	if err != nil {
+		t.Fatalf("decrypt: %v", err)
+	}
+	plaintext, _ := io.ReadAll(message.UnverifiedBody)
+	if string(plaintext) != secretsManager.storedInitResponse() {
+		t.Fatalf("expected the stored init response, got %s", plaintext)
+	}
+}
@@ -0,0 +1,358 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"slices"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/secretsmanager"
+	"github.com/aws/aws-sdk-go-v2/service/secretsmanager/types"
+	"github.com/hashicorp/vault/api"
+	"golang.org/x/crypto/openpgp"
+)
+
+// In-memory Vault node with a Shamir seal, implementing the vaultAPI subset used by the App.
+type fakeVault struct {
+	initialized bool
+	sealed      bool
+	standby     bool
+	drSecondary bool
+
+	// Seal type, shamir if empty.
+	sealType string
+	// Whether a seal migration is pending.
+	migration bool
+
+	threshold int
+	// Base64 encoded unseal keys.
+	keys []string
+	// Distinct keys submitted since the last unseal or reset.
+	progress []string
+
+	inits   int
+	unseals int
+	joins   int
+
+	// Vault API the clients of WithToken call, unsupported if empty.
+	apiAddr string
+}
+
+func newFakeVault() *fakeVault {
+	return &fakeVault{sealed: true}
+}
+
+func (v *fakeVault) Health(context.Context) (*api.HealthResponse, error) {
+	health := &api.HealthResponse{
+		Initialized: v.initialized,
+		Sealed:      v.sealed,
+		Standby:     v.standby,
+		Version:     "1.15.4",
+	}
+	if v.drSecondary {
+		health.ReplicationDRMode = "secondary"
+	}
+	if v.initialized && !v.sealed {
+		health.ClusterID = "cluster"
+	}
+	return health, nil
+}
+
+func (v *fakeVault) SealStatus(context.Context) (*api.SealStatusResponse, error) {
+	sealType := v.sealType
+	if sealType == "" {
+		sealType = "shamir"
+	}
+	return &api.SealStatusResponse{
+		Type:        sealType,
+		Initialized: v.initialized,
+		Sealed:      v.sealed,
+		T:           v.threshold,
+		N:           len(v.keys),
+		Progress:    len(v.progress),
+		Migration:   v.migration,
+	}, nil
+}
+
+func (v *fakeVault) Init(_ context.Context, request *api.InitRequest) (*api.InitResponse, error) {
+	if v.initialized {
+		return nil, &api.ResponseError{StatusCode: http.StatusBadRequest, Errors: []string{"Vault is already initialized"}}
+	}
+	v.inits++
+	v.initialized = true
+	v.threshold = request.SecretThreshold
+
+	response := &api.InitResponse{RootToken: "root"}
+	for i := 0; i < request.SecretShares; i++ {
+		key := bytes.Repeat([]byte{byte(i + 1)}, 33)
+		keyB64 := base64.StdEncoding.EncodeToString(key)
+		v.keys = append(v.keys, keyB64)
+		response.Keys = append(response.Keys, hex.EncodeToString(key))
+		response.KeysB64 = append(response.KeysB64, keyB64)
+	}
+
+	// Like Vault, return the values encrypted to the PGP keys, base64 encoded.
+	for i, pgpKey := range request.PGPKeys {
+		encrypted, err := pgpEncryptB64(response.KeysB64[i], pgpKey)
+		if err != nil {
+			return nil, err
+		}
+		response.Keys[i], response.KeysB64[i] = encrypted, encrypted
+	}
+	if request.RootTokenPGPKey != "" {
+		encrypted, err := pgpEncryptB64(response.RootToken, request.RootTokenPGPKey)
+		if err != nil {
+			return nil, err
+		}
+		response.RootToken = encrypted
+	}
+	return response, nil
+}
+
+func pgpEncryptB64(plaintext, keyB64 string) (string, error) {
+	key, err := parsePGPKey(keyB64)
+	if err != nil {
+		return "", err
+	}
+	var buf bytes.Buffer
+	w, err := openpgp.Encrypt(&buf, openpgp.EntityList{key}, nil, nil, nil)
+	if err != nil {
+		return "", err
+	}
+	if _, err := w.Write([]byte(plaintext)); err != nil {
+		return "", err
+	}
+	if err := w.Close(); err != nil {
+		return "", err
+	}
+	return base64.StdEncoding.EncodeToString(buf.Bytes()), nil
+}
+
+func (v *fakeVault) Unseal(_ context.Context, opts *api.UnsealOpts) (*api.SealStatusResponse, error) {
+	v.unseals++
+	if !slices.Contains(v.keys, opts.Key) {
+		v.progress = nil
+		return nil, &api.ResponseError{StatusCode: http.StatusBadRequest, Errors: []string{"cipher: message authentication failed"}}
+	}
+	if !slices.Contains(v.progress, opts.Key) {
+		v.progress = append(v.progress, opts.Key)
+	}
+	if len(v.progress) >= v.threshold {
+		v.sealed = false
+		v.progress = nil
+	}
+	return v.SealStatus(context.Background())
+}
+
+func (v *fakeVault) ResetUnseal(context.Context) error {
+	v.progress = nil
+	return nil
+}
+
+func (v *fakeVault) RaftJoin(context.Context, *api.RaftJoinRequest) (*api.RaftJoinResponse, error) {
+	v.joins++
+	v.initialized = true
+	return &api.RaftJoinResponse{Joined: true}, nil
+}
+
+func (v *fakeVault) Address() string {
+	return "https://vault.test:8200"
+}
+
+func (v *fakeVault) WithToken(token string) (*api.Client, error) {
+	if v.apiAddr == "" {
+		return nil, fmt.Errorf("not supported by the fake Vault")
+	}
+	client, err := api.NewClient(&api.Config{Address: v.apiAddr})
+	if err != nil {
+		return nil, err
+	}
+	client.SetToken(token)
+	return client, nil
+}
+
+// In-memory AWS Secrets Manager holding a single secret. Calls outside the ones implemented panic.
+type fakeSecretsManager struct {
+	secretsManagerAPI
+
+	arn     string
+	value   *string
+	binary  []byte
+	version int
+	// Value of the AWSPREVIOUS version, nil if there is none.
+	previous *string
+	// KMS key encrypting the secret, empty for aws/secretsmanager.
+	kmsKeyID string
+
+	// Values put with each client request token, and the token of the current value, if put with one.
+	tokens       map[string]string
+	currentToken string
+
+	// Values of the other secrets, created with CreateSecret, and tags of all secrets by name.
+	managed map[string]string
+	tags    map[string]map[string]string
+	// Values of every version of the other secrets, by `<name>@<version>`.
+	managedVersions map[string]string
+}
+
+func newFakeSecretsManager() *fakeSecretsManager {
+	return &fakeSecretsManager{
+		arn:     "arn:aws:secretsmanager:us-east-1:123456789012:secret:vault-AbCdEf",
+		tokens:  map[string]string{},
+		managed: map[string]string{},
+		tags:    map[string]map[string]string{},
+
+		managedVersions: map[string]string{},
+	}
+}
+
+// Set the value of another secret, returning its new version.
+func (s *fakeSecretsManager) putManaged(name, value string) string {
+	s.managed[name] = value
+	version := fmt.Sprint(len(s.managedVersions) + 1)
+	s.managedVersions[name+"@"+version] = value
+	return version
+}
+
+// Returns the init response JSON stored in the secret, unwrapped from its schema.
+func (s *fakeSecretsManager) storedInitResponse() string {
+	data, err := unwrapPayload(aws.ToString(s.value))
+	if err != nil {
+		return err.Error()
+	}
+	return data
+}
+
+func (s *fakeSecretsManager) DescribeSecret(context.Context, *secretsmanager.DescribeSecretInput, ...func(*secretsmanager.Options)) (*secretsmanager.DescribeSecretOutput, error) {
+	output := &secretsmanager.DescribeSecretOutput{ARN: &s.arn}
+	if s.kmsKeyID != "" {
+		output.KmsKeyId = &s.kmsKeyID
+	}
+	for key, value := range s.tags["vault"] {
+		output.Tags = append(output.Tags, types.Tag{Key: aws.String(key), Value: aws.String(value)})
+	}
+	return output, nil
+}
+
+func (s *fakeSecretsManager) GetSecretValue(_ context.Context, params *secretsmanager.GetSecretValueInput, _ ...func(*secretsmanager.Options)) (*secretsmanager.GetSecretValueOutput, error) {
+	if value, ok := s.managed[aws.ToString(params.SecretId)]; ok {
+		if params.VersionId != nil {
+			if value, ok = s.managedVersions[aws.ToString(params.SecretId)+"@"+*params.VersionId]; !ok {
+				return nil, &types.ResourceNotFoundException{Message: aws.String("secret version not found")}
+			}
+		}
+		return &secretsmanager.GetSecretValueOutput{
+			ARN:          aws.String("arn:aws:secretsmanager:us-east-1:123456789012:secret:" + aws.ToString(params.SecretId)),
+			SecretString: &value,
+		}, nil
+	}
+	if params.VersionId != nil {
+		value, ok := s.tokens[*params.VersionId]
+		if !ok {
+			return nil, &types.ResourceNotFoundException{Message: aws.String("secret version not found")}
+		}
+		output := &secretsmanager.GetSecretValueOutput{ARN: &s.arn, SecretString: &value, VersionId: params.VersionId}
+		if *params.VersionId == s.currentToken {
+			output.VersionStages = []string{"AWSCURRENT"}
+		}
+		return output, nil
+	}
+	if aws.ToString(params.VersionStage) == "AWSPREVIOUS" {
+		if s.previous == nil {
+			return nil, &types.ResourceNotFoundException{Message: aws.String("secret has no previous version")}
+		}
+		return &secretsmanager.GetSecretValueOutput{ARN: &s.arn, SecretString: s.previous, VersionStages: []string{"AWSPREVIOUS"}}, nil
+	}
+	if s.value == nil && s.binary == nil {
+		return nil, &types.ResourceNotFoundException{Message: aws.String("secret has no value")}
+	}
+	return &secretsmanager.GetSecretValueOutput{
+		ARN:          &s.arn,
+		SecretString: s.value,
+		SecretBinary: s.binary,
+		VersionId:    aws.String(fmt.Sprint(s.version)),
+	}, nil
+}
+
+func (s *fakeSecretsManager) UpdateSecret(_ context.Context, params *secretsmanager.UpdateSecretInput, _ ...func(*secretsmanager.Options)) (*secretsmanager.UpdateSecretOutput, error) {
+	// Re-encrypting the secret keeps its value.
+	if params.KmsKeyId != nil {
+		s.kmsKeyID = *params.KmsKeyId
+		if params.SecretString == nil && params.SecretBinary == nil {
+			return &secretsmanager.UpdateSecretOutput{ARN: &s.arn}, nil
+		}
+	}
+	s.value, s.binary, s.currentToken = params.SecretString, params.SecretBinary, ""
+	s.version++
+	return &secretsmanager.UpdateSecretOutput{ARN: &s.arn, VersionId: aws.String(fmt.Sprint(s.version))}, nil
+}
+
+func (s *fakeSecretsManager) UpdateSecretVersionStage(_ context.Context, params *secretsmanager.UpdateSecretVersionStageInput, _ ...func(*secretsmanager.Options)) (*secretsmanager.UpdateSecretVersionStageOutput, error) {
+	if aws.ToString(params.VersionStage) == "AWSCURRENT" && params.MoveToVersionId == nil {
+		return nil, &types.InvalidParameterException{Message: aws.String("you can only remove the AWSCURRENT label by moving it")}
+	}
+	return &secretsmanager.UpdateSecretVersionStageOutput{}, nil
+}
+
+func (s *fakeSecretsManager) ListSecrets(context.Context, *secretsmanager.ListSecretsInput, ...func(*secretsmanager.Options)) (*secretsmanager.ListSecretsOutput, error) {
+	return &secretsmanager.ListSecretsOutput{SecretList: []types.SecretListEntry{{Name: aws.String("vault"), ARN: &s.arn}}}, nil
+}
+
+func (s *fakeSecretsManager) CreateSecret(_ context.Context, params *secretsmanager.CreateSecretInput, _ ...func(*secretsmanager.Options)) (*secretsmanager.CreateSecretOutput, error) {
+	name := aws.ToString(params.Name)
+	if _, ok := s.managed[name]; ok {
+		return nil, &types.ResourceExistsException{Message: aws.String("secret exists")}
+	}
+	version := s.putManaged(name, aws.ToString(params.SecretString))
+	return &secretsmanager.CreateSecretOutput{ARN: aws.String("arn:aws:secretsmanager:us-east-1:123456789012:secret:" + name), VersionId: &version}, nil
+}
+
+func (s *fakeSecretsManager) PutSecretValue(_ context.Context, params *secretsmanager.PutSecretValueInput, _ ...func(*secretsmanager.Options)) (*secretsmanager.PutSecretValueOutput, error) {
+	if params.SecretString == nil && params.SecretBinary == nil {
+		return nil, &types.InvalidParameterException{Message: aws.String("you must provide either SecretString or SecretBinary")}
+	}
+	name := aws.ToString(params.SecretId)
+	if name == "vault" || name == s.arn {
+		return s.putValue(params)
+	}
+	if _, ok := s.managed[name]; !ok {
+		return nil, &types.ResourceNotFoundException{Message: aws.String("secret not found")}
+	}
+	version := s.putManaged(name, aws.ToString(params.SecretString))
+	return &secretsmanager.PutSecretValueOutput{ARN: aws.String("arn:aws:secretsmanager:us-east-1:123456789012:secret:" + name), VersionId: &version}, nil
+}
+
+// Put a value of the vault secret. Like Secrets Manager, values put again with the same token are only
+// accepted if unchanged.
+func (s *fakeSecretsManager) putValue(params *secretsmanager.PutSecretValueInput) (*secretsmanager.PutSecretValueOutput, error) {
+	token, value := aws.ToString(params.ClientRequestToken), aws.ToString(params.SecretString)+string(params.SecretBinary)
+	if previous, ok := s.tokens[token]; ok && token != "" {
+		if previous != value {
+			return nil, &types.ResourceExistsException{Message: aws.String("you can't modify an existing version")}
+		}
+		return &secretsmanager.PutSecretValueOutput{ARN: &s.arn, VersionId: &token}, nil
+	}
+
+	s.value, s.binary = params.SecretString, params.SecretBinary
+	s.version++
+	versionID := fmt.Sprint(s.version)
+	if token != "" {
+		s.tokens[token], s.currentToken, versionID = value, token, token
+	}
+	return &secretsmanager.PutSecretValueOutput{ARN: &s.arn, VersionId: &versionID}, nil
+}
+
+func (s *fakeSecretsManager) TagResource(_ context.Context, params *secretsmanager.TagResourceInput, _ ...func(*secretsmanager.Options)) (*secretsmanager.TagResourceOutput, error) {
+	name := aws.ToString(params.SecretId)
+	if s.tags[name] == nil {
+		s.tags[name] = map[string]string{}
+	}
+	for _, tag := range params.Tags {
+		s.tags[name][aws.ToString(tag.Key)] = aws.ToString(tag.Value)
+	}
+	return &secretsmanager.TagResourceOutput{}, nil
+}
@@ -0,0 +1,134 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"filippo.io/age"
+	"github.com/spf13/viper"
+)
+
+// Key store keeping the payload in a local file encrypted with age, for development against a local
+// Vault without AWS credentials.
+type fileKeyStore struct {
+	path       string
+	recipients []age.Recipient
+	identities []age.Identity
+}
+
+// Create the key store of the `file` backend, storing in the SECRET_FILE file encrypted with the keys of
+// the SECRET_FILE_AGE_IDENTITY_FILE identity file, or with the SECRET_FILE_PASSPHRASE passphrase.
+func newFileKeyStore() (keyStore, error) {
+	path := viper.GetString("secret_file")
+	if path == "" {
+		return nil, errors.New("SECRET_FILE env is required with the file secret backend")
+	}
+	identityFile := viper.GetString("secret_file_age_identity_file")
+	passphrase, err := parseEnvFile(viper.GetString("secret_file_passphrase"))
+	if err != nil {
+		return nil, fmt.Errorf("SECRET_FILE_PASSPHRASE env is invalid: %w", err)
+	}
+	passphrase = strings.TrimSpace(passphrase)
+	if (identityFile == "") == (passphrase == "") {
+		return nil, errors.New("either SECRET_FILE_AGE_IDENTITY_FILE or SECRET_FILE_PASSPHRASE env is required with the file secret backend")
+	}
+
+	store := fileKeyStore{path: path}
+	if passphrase != "" {
+		recipient, err := age.NewScryptRecipient(passphrase)
+		if err != nil {
+			return nil, fmt.Errorf("SECRET_FILE_PASSPHRASE env is invalid: %w", err)
+		}
+		identity, err := age.NewScryptIdentity(passphrase)
+		if err != nil {
+			return nil, fmt.Errorf("SECRET_FILE_PASSPHRASE env is invalid: %w", err)
+		}
+		store.recipients, store.identities = []age.Recipient{recipient}, []age.Identity{identity}
+		return store, nil
+	}
+
+	data, err := os.ReadFile(identityFile)
+	if err != nil {
+		return nil, fmt.Errorf("SECRET_FILE_AGE_IDENTITY_FILE env is invalid: %w", err)
+	}
+	if store.identities, err = age.ParseIdentities(bytes.NewReader(data)); err != nil {
+		return nil, fmt.Errorf("SECRET_FILE_AGE_IDENTITY_FILE env is invalid: %w", err)
+	}
+	// The file is encrypted to the identities themselves.
+	for _, identity := range store.identities {
+		if identity, ok := identity.(*age.X25519Identity); ok {
+			store.recipients = append(store.recipients, identity.Recipient())
+		}
+	}
+	if len(store.recipients) == 0 {
+		return nil, errors.New("SECRET_FILE_AGE_IDENTITY_FILE env is invalid: no X25519 identity")
+	}
+	return store, nil
+}
+
+func (s fileKeyStore) readPayload(context.Context) (string, error) {
+	file, err := os.Open(s.path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return "", fmt.Errorf("read secret file: %w: %w", ErrSecretMissing, err)
+	}
+	if err != nil {
+		return "", fmt.Errorf("read secret file: %w", err)
+	}
+	defer file.Close()
+
+	decrypted, err := age.Decrypt(file, s.identities...)
+	if err != nil {
+		return "", fmt.Errorf("decrypt secret file: %w", err)
+	}
+	payload, err := io.ReadAll(decrypted)
+	if err != nil {
+		return "", fmt.Errorf("decrypt secret file: %w", err)
+	}
+	return string(payload), nil
+}
+
+// Encrypts the payload to a temporary file renamed over the secret file, which is never left half written.
+func (s fileKeyStore) writePayload(_ context.Context, payload string) (storedVersion, error) {
+	file, err := os.CreateTemp(filepath.Dir(s.path), "."+filepath.Base(s.path)+"-*")
+	if err != nil {
+		return storedVersion{}, fmt.Errorf("create secret file: %w", err)
+	}
+	defer os.Remove(file.Name())
+	defer file.Close()
+
+	encrypted, err := age.Encrypt(file, s.recipients...)
+	if err == nil {
+		_, err = io.WriteString(encrypted, payload)
+	}
+	if err == nil {
+		err = encrypted.Close()
+	}
+	if err == nil {
+		err = file.Sync()
+	}
+	if err == nil {
+		err = file.Close()
+	}
+	if err == nil {
+		err = os.Rename(file.Name(), s.path)
+	}
+	if err != nil {
+		return storedVersion{}, fmt.Errorf("write secret file: %w", err)
+	}
+	return storedVersion{ARN: s.path}, nil
+}
+
+func (s fileKeyStore) exists(context.Context) (bool, error) {
+	_, err := os.Stat(s.path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return false, nil
+	}
+	return err == nil, err
+}
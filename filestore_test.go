@@ -0,0 +1,82 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"filippo.io/age"
+)
+
+func TestFileKeyStore(t *testing.T) {
+	dir := t.TempDir()
+	identity, err := age.GenerateX25519Identity()
+	if err != nil {
+		t.Fatal(err)
+	}
+	identityFile := filepath.Join(dir, "key.txt")
+	if err := os.WriteFile(identityFile, []byte(identity.String()+"\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("SECRET_FILE", filepath.Join(dir, "init.age"))
+	t.Setenv("SECRET_FILE_AGE_IDENTITY_FILE", identityFile)
+	store, err := newFileKeyStore()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := store.readPayload(context.Background()); !errors.Is(err, ErrSecretMissing) {
+		t.Fatalf("expected ErrSecretMissing without the file, got %v", err)
+	}
+
+	app, vault, _ := newTestApp(0)
+	app.config.KeyStore = store
+	if _, err := app.CheckVaultStatus(context.Background()); err != nil {
+		t.Fatalf("check status: %v", err)
+	}
+	if vault.sealed {
+		t.Fatal("expected Vault unsealed with the keys of the file")
+	}
+	data, err := os.ReadFile(filepath.Join(dir, "init.age"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(string(data), "age-encryption.org/") || strings.Contains(string(data), "keys") {
+		t.Error("expected the file encrypted with age")
+	}
+	if err := app.checkSecretUnused(context.Background()); !errors.Is(err, ErrSecretInUse) {
+		t.Errorf("expected ErrSecretInUse, got %v", err)
+	}
+
+	// The passphrase does not decrypt files encrypted to the identity.
+	t.Setenv("SECRET_FILE_AGE_IDENTITY_FILE", "")
+	t.Setenv("SECRET_FILE_PASSPHRASE", "correct horse battery staple")
+	store, err = newFileKeyStore()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := store.readPayload(context.Background()); err == nil {
+		t.Error("expected an error decrypting with the passphrase")
+	}
+	if _, err := store.writePayload(context.Background(), "payload"); err != nil {
+		t.Fatalf("write payload: %v", err)
+	}
+	if payload, err := store.readPayload(context.Background()); err != nil || payload != "payload" {
+		t.Errorf("expected the payload decrypted with the passphrase, got %q, %v", payload, err)
+	}
+
+	t.Setenv("SECRET_FILE_AGE_IDENTITY_FILE", identityFile)
+	if _, err := newFileKeyStore(); err == nil {
+		t.Error("expected the identity file and passphrase rejected together")
+	}
+
+	// Missing passphrase files are reported rather than panicking.
+	t.Setenv("SECRET_FILE_AGE_IDENTITY_FILE", "")
+	t.Setenv("SECRET_FILE_PASSPHRASE", "@"+filepath.Join(dir, "missing"))
+	if _, err := newFileKeyStore(); err == nil || !strings.Contains(err.Error(), "SECRET_FILE_PASSPHRASE env is invalid") {
+		t.Errorf("expected the missing passphrase file reported, got %v", err)
+	}
+}
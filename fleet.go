@@ -0,0 +1,328 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/kms"
+	"github.com/aws/aws-sdk-go-v2/service/secretsmanager"
+)
+
+// ClusterConfig is a Vault cluster managed in fleet mode, with its own Vault address, secret, thresholds
+// and alert webhook. Unset thresholds default to the ones of the environment.
+type ClusterConfig struct {
+	Name      string `json:"name"`
+	VaultAddr string `json:"vaultAddr"`
+	SecretID  string `json:"secretID"`
+
+	SecretShares      int `json:"secretShares,omitempty"`
+	SecretThreshold   int `json:"secretThreshold,omitempty"`
+	RecoveryShares    int `json:"recoveryShares,omitempty"`
+	RecoveryThreshold int `json:"recoveryThreshold,omitempty"`
+
+	// Raft leader joined by the node, which is initialized if empty.
+	RaftLeaderAPIAddr string `json:"raftLeaderAPIAddr,omitempty"`
+	// Webhook receiving the alerts of the cluster, instead of ALERT_WEBHOOK_URL.
+	AlertWebhookURL string `json:"alertWebhookURL,omitempty"`
+	// Secret the status of the cluster is published to, like STATUS_SECRET_NAME, which fleet mode ignores.
+	StatusSecretName string `json:"statusSecretName,omitempty"`
+	// Secret the root token of the cluster is stored in, like ROOT_TOKEN_SECRET_NAME, which fleet mode ignores.
+	RootTokenSecretName string `json:"rootTokenSecretName,omitempty"`
+	// SSM parameter the unseal keys of the cluster are read from, like SSM_PARAMETER_NAME, which fleet mode
+	// ignores.
+	SSMParameterName string `json:"ssmParameterName,omitempty"`
+}
+
+// Read the clusters from the JSON file, a `{"clusters": [...]}` object.
+func loadClusters(path string) ([]ClusterConfig, error) {
+	contents, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var file struct {
+		Clusters []ClusterConfig `json:"clusters"`
+	}
+	if err := json.Unmarshal(contents, &file); err != nil {
+		return nil, fmt.Errorf("unmarshal: %w", err)
+	}
+	if len(file.Clusters) == 0 {
+		return nil, errors.New("no clusters")
+	}
+
+	names := make(map[string]bool, len(file.Clusters))
+	for i, cluster := range file.Clusters {
+		switch {
+		case cluster.Name == "":
+			return nil, fmt.Errorf("cluster %d: name is required", i)
+		case names[cluster.Name]:
+			return nil, fmt.Errorf("cluster %s: duplicated name", cluster.Name)
+		case cluster.VaultAddr == "":
+			return nil, fmt.Errorf("cluster %s: vaultAddr is required", cluster.Name)
+		case cluster.SecretID == "":
+			return nil, fmt.Errorf("cluster %s: secretID is required", cluster.Name)
+		}
+		names[cluster.Name] = true
+	}
+	return file.Clusters, nil
+}
+
+// Returns the App config of the cluster: the base config with the cluster settings.
+func (c ClusterConfig) config(base Config) Config {
+	config := base
+	config.Cluster = c.Name
+	config.SecretID = c.SecretID
+	config.RaftLeaderAPIAddr = c.RaftLeaderAPIAddr
+	config.StatusSecretName = c.StatusSecretName
+	config.RootTokenSecretName = c.RootTokenSecretName
+	config.SSMParameterName = c.SSMParameterName
+	config.UnsealCanary = nil
+	// The snapshots, Vault token or agent, key store backends and share secrets of the environment belong to a
+	// single cluster.
+	config.SnapshotStore = nil
+	config.VaultToken = ""
+	config.VaultAgent = false
+	config.KeyStore = nil
+	config.KeyStoreMirrors = nil
+	config.ShareSecrets = nil
+	// A pinned version belongs to the secret of a single cluster too.
+	config.SecretVersionID = ""
+	config.SecretVersionStage = ""
+	// Each cluster falls back to its own file, so the init responses of clusters initialized while the key
+	// store is unavailable do not overwrite each other.
+	if base.FallbackFile != "" {
+		config.FallbackFile = base.FallbackFile + "." + c.Name
+	}
+
+	// Each cluster is managed through a single node, initialized unless it joins a leader.
+	config.Replica = 0
+	if c.RaftLeaderAPIAddr != "" {
+		config.Replica = 1
+	}
+
+	if c.SecretShares > 0 {
+		config.SecretShares = c.SecretShares
+	}
+	if c.SecretThreshold > 0 {
+		config.SecretThreshold = c.SecretThreshold
+	}
+	if c.RecoveryShares > 0 {
+		config.RecoveryShares = c.RecoveryShares
+	}
+	if c.RecoveryThreshold > 0 {
+		config.RecoveryThreshold = c.RecoveryThreshold
+	}
+	return config
+}
+
+// Cluster of the fleet, checked by one worker at a time.
+type fleetMember struct {
+	app        *App
+	webhookURL string
+
+	// Backoff while Vault is unavailable, and time of the next check.
+	unavailable *checkBackoff
+	next        time.Time
+	// Whether the secret was found, checked again before each check until it is.
+	secretChecked bool
+}
+
+func newFleetMember(app *App, webhookURL string, interval time.Duration) *fleetMember {
+	return &fleetMember{app: app, webhookURL: webhookURL, unavailable: newCheckBackoff(interval)}
+}
+
+// Check the secret and Vault of the cluster once.
+func (m *fleetMember) check(ctx context.Context, timeout time.Duration) {
+	ctx = withAlertTarget(ctx, alertTarget{Cluster: m.app.config.Cluster, WebhookURL: m.webhookURL})
+	log := slog.With("cluster", m.app.config.Cluster)
+
+	if !m.secretChecked {
+		if err := m.app.CheckSecretExistence(ctx); err != nil {
+			alert(ctx, "Secret of the cluster is missing, not checking Vault", "secretID", m.app.config.SecretID, "error", err)
+			return
+		}
+		m.secretChecked = true
+	}
+
+	if _, err := checkVaultStatus(ctx, m.app, timeout); m.unavailable.record(err) != nil {
+		log.Error("Checking Vault", "error", err)
+	}
+}
+
+// Checks the clusters of the fleet every interval with a bounded number of workers, so the Vault and AWS
+// API calls in flight stay bounded however many clusters are managed. The first checks are spread over the
+// interval, and clusters are never checked concurrently with themselves.
+type fleet struct {
+	members  []*fleetMember
+	workers  int
+	interval time.Duration
+	timeout  time.Duration
+}
+
+// Run the checks until the context is done, or once if the interval is not positive.
+func (f *fleet) run(ctx context.Context) {
+	jobs := make(chan *fleetMember)
+	// Each member is checked at most once at a time, so the workers never block reporting a check.
+	done := make(chan *fleetMember, len(f.members))
+	var wg sync.WaitGroup
+	for i := 0; i < min(f.workers, len(f.members)); i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for m := range jobs {
+				m.check(ctx, f.timeout)
+				done <- m
+			}
+		}()
+	}
+	defer wg.Wait()
+	defer close(jobs)
+
+	now := time.Now()
+	for i, m := range f.members {
+		if f.interval > 0 {
+			m.next = now.Add(f.interval * time.Duration(i) / time.Duration(len(f.members)))
+		} else {
+			m.next = now
+		}
+	}
+
+	// Members neither queued nor being checked are idle, and due once their next check time is reached.
+	idle := make(map[*fleetMember]bool, len(f.members))
+	for _, m := range f.members {
+		idle[m] = true
+	}
+	var (
+		queue   []*fleetMember
+		checked int
+	)
+
+	tick := time.NewTicker(fleetTick(f.interval, len(f.members)))
+	defer tick.Stop()
+	enqueue := func(t time.Time) {
+		for _, m := range f.members {
+			if idle[m] && !t.Before(m.next) && !m.unavailable.skip(t) {
+				idle[m] = false
+				queue = append(queue, m)
+			}
+		}
+	}
+	enqueue(now)
+
+	for {
+		// A nil channel never receives, so nothing is sent while the queue is empty.
+		var (
+			send chan<- *fleetMember
+			head *fleetMember
+		)
+		if len(queue) > 0 {
+			send, head = jobs, queue[0]
+		}
+
+		select {
+		case <-ctx.Done():
+			// Workers finish their checks, which have a deadline, but nothing else is sent.
+			return
+		case t := <-tick.C:
+			if f.interval > 0 {
+				enqueue(t)
+			}
+		case send <- head:
+			queue = queue[1:]
+		case m := <-done:
+			checked++
+			if f.interval <= 0 {
+				if checked == len(f.members) {
+					return
+				}
+				continue
+			}
+			m.next = time.Now().Add(f.interval)
+			idle[m] = true
+		}
+	}
+}
+
+// Returns how often the fleet looks for due clusters: often enough to spread them over the interval.
+func fleetTick(interval time.Duration, members int) time.Duration {
+	if interval <= 0 {
+		return time.Hour
+	}
+	return max(min(interval/time.Duration(members), time.Second), 10*time.Millisecond)
+}
+
+// Check the secrets of the clusters exist with a single listing, rather than describing each of them.
+// Clusters whose secret is not listed by name or ARN, or all of them if listing fails, have it described
+// on their first check.
+func checkFleetSecrets(ctx context.Context, client secretsmanager.ListSecretsAPIClient, members []*fleetMember) {
+	listed := make(map[string]bool)
+	paginator := secretsmanager.NewListSecretsPaginator(client, &secretsmanager.ListSecretsInput{})
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			slog.Warn("Cannot list the secrets of the fleet, describing them one by one", "error", err)
+			return
+		}
+		for _, secret := range page.SecretList {
+			// ListSecrets omits secrets scheduled for deletion.
+			listed[aws.ToString(secret.Name)] = true
+			listed[aws.ToString(secret.ARN)] = true
+		}
+	}
+
+	found := 0
+	for _, m := range members {
+		if listed[m.app.config.SecretID] {
+			m.secretChecked = true
+			found++
+		}
+	}
+	slog.Debug("Listed the secrets of the fleet", "found", found, "clusters", len(members))
+}
+
+// KMS client shared by the clusters, caching the key descriptions, as the keys checked before initializing
+// are the same for every cluster. Safe for concurrent use.
+type sharedKMS struct {
+	kmsAPI
+	ttl time.Duration
+
+	mu   sync.Mutex
+	keys map[string]describedKey
+}
+
+type describedKey struct {
+	output    *kms.DescribeKeyOutput
+	fetchedAt time.Time
+}
+
+func newSharedKMS(client kmsAPI, ttl time.Duration) *sharedKMS {
+	return &sharedKMS{kmsAPI: client, ttl: ttl, keys: make(map[string]describedKey)}
+}
+
+func (k *sharedKMS) DescribeKey(ctx context.Context, params *kms.DescribeKeyInput, optFns ...func(*kms.Options)) (*kms.DescribeKeyOutput, error) {
+	keyID := aws.ToString(params.KeyId)
+
+	k.mu.Lock()
+	cached, ok := k.keys[keyID]
+	k.mu.Unlock()
+	if ok && time.Since(cached.fetchedAt) < k.ttl {
+		return cached.output, nil
+	}
+
+	output, err := k.kmsAPI.DescribeKey(ctx, params, optFns...)
+	if err != nil {
+		return nil, err
+	}
+
+	k.mu.Lock()
+	k.keys[keyID] = describedKey{output: output, fetchedAt: time.Now()}
+	k.mu.Unlock()
+	return output, nil
+}
@@ -0,0 +1,165 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/kms"
+	kmstypes "github.com/aws/aws-sdk-go-v2/service/kms/types"
+	"github.com/aws/aws-sdk-go-v2/service/secretsmanager"
+	"github.com/aws/aws-sdk-go-v2/service/secretsmanager/types"
+)
+
+func TestLoadClusters(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "clusters.json")
+	write := func(contents string) {
+		if err := os.WriteFile(path, []byte(contents), 0o600); err != nil {
+			t.Fatalf("write: %v", err)
+		}
+	}
+
+	write(`{"clusters": [
+		{"name": "prod", "vaultAddr": "https://vault.prod:8200", "secretID": "prod", "secretThreshold": 4},
+		{"name": "dev", "vaultAddr": "https://vault.dev:8200", "secretID": "dev", "raftLeaderAPIAddr": "https://vault-0.dev:8200"}
+	]}`)
+	clusters, err := loadClusters(path)
+	if err != nil {
+		t.Fatalf("load clusters: %v", err)
+	}
+
+	base := Config{SecretShares: 5, SecretThreshold: 3, Replica: 2}
+	prod := clusters[0].config(base)
+	if prod.Cluster != "prod" || prod.SecretID != "prod" || prod.SecretShares != 5 || prod.SecretThreshold != 4 || prod.Replica != 0 {
+		t.Fatalf("unexpected prod config %+v", prod)
+	}
+	if dev := clusters[1].config(base); dev.Replica != 1 || dev.SecretThreshold != 3 {
+		t.Fatalf("unexpected dev config %+v", dev)
+	}
+
+	for _, invalid := range []string{
+		`{"clusters": []}`,
+		`{"clusters": [{"vaultAddr": "https://vault:8200", "secretID": "a"}]}`,
+		`{"clusters": [{"name": "a", "secretID": "a"}]}`,
+		`{"clusters": [{"name": "a", "vaultAddr": "https://a:8200", "secretID": "a"}, {"name": "a", "vaultAddr": "https://b:8200", "secretID": "b"}]}`,
+	} {
+		write(invalid)
+		if _, err := loadClusters(path); err == nil {
+			t.Errorf("expected an error for %s", invalid)
+		}
+	}
+}
+
+func TestClusterConfigsDoNotShareSettings(t *testing.T) {
+	base := Config{
+		RootTokenSecretName: "vault-root-token",
+		SSMParameterName:    "/vault/keys",
+		SecretVersionID:     "version",
+		SecretVersionStage:  "AWSPREVIOUS",
+		FallbackFile:        "/var/lib/vault-init/init.json",
+	}
+	prod := ClusterConfig{Name: "prod", SecretID: "prod", RootTokenSecretName: "prod-root-token", SSMParameterName: "/prod/keys"}.config(base)
+	dev := ClusterConfig{Name: "dev", SecretID: "dev"}.config(base)
+
+	if prod.RootTokenSecretName != "prod-root-token" || dev.RootTokenSecretName != "" {
+		t.Errorf("expected separate root token secrets, got %q and %q", prod.RootTokenSecretName, dev.RootTokenSecretName)
+	}
+	if prod.SSMParameterName != "/prod/keys" || dev.SSMParameterName != "" {
+		t.Errorf("expected separate SSM parameters, got %q and %q", prod.SSMParameterName, dev.SSMParameterName)
+	}
+	if prod.SecretVersionID != "" || prod.SecretVersionStage != "" || dev.SecretVersionID != "" || dev.SecretVersionStage != "" {
+		t.Errorf("expected no pinned versions, got %+v and %+v", prod, dev)
+	}
+	if prod.FallbackFile != "/var/lib/vault-init/init.json.prod" || dev.FallbackFile != "/var/lib/vault-init/init.json.dev" {
+		t.Errorf("expected separate fallback files, got %q and %q", prod.FallbackFile, dev.FallbackFile)
+	}
+}
+
+func TestFleetChecksEveryCluster(t *testing.T) {
+	var (
+		members []*fleetMember
+		vaults  []*fakeVault
+	)
+	for i := 0; i < 25; i++ {
+		app, vault, _ := newTestApp(0)
+		app.config.Cluster = fmt.Sprintf("cluster-%d", i)
+		members = append(members, newFleetMember(app, "", 0))
+		vaults = append(vaults, vault)
+	}
+
+	(&fleet{members: members, workers: 3, timeout: time.Minute}).run(context.Background())
+	for i, vault := range vaults {
+		if vault.inits != 1 || vault.sealed {
+			t.Errorf("expected cluster-%d initialized once and unsealed, got %d inits, sealed %t", i, vault.inits, vault.sealed)
+		}
+	}
+}
+
+// ListSecrets denied, e.g. to a role allowed to describe only its own secrets.
+type deniedListSecrets struct{}
+
+func (deniedListSecrets) ListSecrets(context.Context, *secretsmanager.ListSecretsInput, ...func(*secretsmanager.Options)) (*secretsmanager.ListSecretsOutput, error) {
+	return nil, errors.New("AccessDeniedException: not authorized to perform secretsmanager:ListSecrets")
+}
+
+func TestCheckFleetSecrets(t *testing.T) {
+	newMembers := func() []*fleetMember {
+		var members []*fleetMember
+		for _, secretID := range []string{"listed", "unlisted"} {
+			app, vault, _ := newTestApp(0)
+			app.config.Cluster, app.config.SecretID = secretID, secretID
+			vault.initialized, vault.sealed = true, false
+			members = append(members, newFleetMember(app, "", 0))
+		}
+		return members
+	}
+
+	members := newMembers()
+	checkFleetSecrets(context.Background(), &listedSecrets{secrets: []types.SecretListEntry{{Name: aws.String("listed")}}}, members)
+	if !members[0].secretChecked || members[1].secretChecked {
+		t.Errorf("expected only the listed secret checked, got %t and %t", members[0].secretChecked, members[1].secretChecked)
+	}
+
+	// Listing fails: every secret is described on the first check of its cluster instead.
+	members = newMembers()
+	checkFleetSecrets(context.Background(), deniedListSecrets{}, members)
+	for _, m := range members {
+		if m.secretChecked {
+			t.Fatalf("expected the secret of %s unchecked after a failed listing", m.app.config.Cluster)
+		}
+		m.check(context.Background(), time.Minute)
+		if !m.secretChecked {
+			t.Errorf("expected the secret of %s described on its first check", m.app.config.Cluster)
+		}
+	}
+}
+
+// Counts the DescribeKey calls. Other calls panic.
+type countingKMS struct {
+	kmsAPI
+	describes int
+}
+
+func (k *countingKMS) DescribeKey(_ context.Context, params *kms.DescribeKeyInput, _ ...func(*kms.Options)) (*kms.DescribeKeyOutput, error) {
+	k.describes++
+	return &kms.DescribeKeyOutput{KeyMetadata: &kmstypes.KeyMetadata{KeyId: params.KeyId}}, nil
+}
+
+func TestSharedKMS(t *testing.T) {
+	client := &countingKMS{}
+	shared := newSharedKMS(client, time.Minute)
+	for _, keyID := range []string{"seal", "secret", "seal", "seal"} {
+		output, err := shared.DescribeKey(context.Background(), &kms.DescribeKeyInput{KeyId: aws.String(keyID)})
+		if err != nil || aws.ToString(output.KeyMetadata.KeyId) != keyID {
+			t.Fatalf("describe %s: got %+v, %v", keyID, output, err)
+		}
+	}
+	if client.describes != 2 {
+		t.Errorf("expected each key described once, got %d calls", client.describes)
+	}
+}
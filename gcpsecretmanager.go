@@ -0,0 +1,122 @@
+package main
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path"
+	"regexp"
+
+	"github.com/spf13/viper"
+)
+
+// Secret names of Google Secret Manager, as `projects/<project>/secrets/<secret>`.
+var gcpSecretName = regexp.MustCompile(`^projects/[^/]+/secrets/[^/]+$`)
+
+// Key store keeping the payload in a Google Secret Manager secret, adding a version on each write. Calls are
+// authenticated with the service account of the metadata server, which is the Kubernetes service account
+// on GKE with Workload Identity.
+type gcpSecretManagerStore struct {
+	name string
+	// Base URLs of the Secret Manager API and of the metadata server.
+	endpoint    string
+	metadataURL string
+}
+
+// Create the key store of the `gcpsecretmanager` backend, storing in the GCP_SECRET_NAME secret.
+func newGCPSecretManagerStore() (keyStore, error) {
+	name := viper.GetString("gcp_secret_name")
+	if !gcpSecretName.MatchString(name) {
+		return nil, fmt.Errorf("GCP_SECRET_NAME env must be projects/<project>/secrets/<secret>, got %q", name)
+	}
+
+	return gcpSecretManagerStore{
+		name:        name,
+		endpoint:    "https://secretmanager.googleapis.com",
+		metadataURL: gcpMetadataURL(),
+	}, nil
+}
+
+// Returns the URL of the GCP metadata server, with the same override as the Google client libraries.
+func gcpMetadataURL() string {
+	metadataHost := os.Getenv("GCE_METADATA_HOST")
+	if metadataHost == "" {
+		metadataHost = "metadata.google.internal"
+	}
+	return "http://" + metadataHost
+}
+
+// Payload of the secret versions, base64 encoded.
+type gcpSecretPayload struct {
+	Data string `json:"data"`
+}
+
+func (s gcpSecretManagerStore) authHeader(ctx context.Context) (http.Header, error) {
+	return gcpAuthHeader(ctx, s.metadataURL)
+}
+
+// Returns the headers authenticating GCP API calls as the service account of the metadata server. The
+// metadata server caches the access token and serves it locally, so it is requested for each call.
+func gcpAuthHeader(ctx context.Context, metadataURL string) (http.Header, error) {
+	var token struct {
+		AccessToken string `json:"access_token"`
+	}
+	err := callRESTAPI(ctx, http.DefaultClient, http.MethodGet, metadataURL+"/computeMetadata/v1/instance/service-accounts/default/token",
+		http.Header{"Metadata-Flavor": {"Google"}}, nil, &token)
+	if err != nil {
+		return nil, fmt.Errorf("get GCP access token: %w", err)
+	}
+	return http.Header{"Authorization": {"Bearer " + token.AccessToken}}, nil
+}
+
+func (s gcpSecretManagerStore) readPayload(ctx context.Context) (string, error) {
+	header, err := s.authHeader(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	var version struct {
+		Payload gcpSecretPayload `json:"payload"`
+	}
+	err = callRESTAPI(ctx, http.DefaultClient, http.MethodGet, s.endpoint+"/v1/"+s.name+"/versions/latest:access", header, nil, &version)
+	var apiErr *restAPIError
+	if errors.As(err, &apiErr) && apiErr.StatusCode == http.StatusNotFound {
+		// The secret is missing or has no enabled version.
+		return "", fmt.Errorf("access GCP secret: %w: %w", ErrSecretMissing, err)
+	}
+	if err != nil {
+		return "", fmt.Errorf("access GCP secret: %w", err)
+	}
+
+	data, err := base64.StdEncoding.DecodeString(version.Payload.Data)
+	if err != nil {
+		return "", fmt.Errorf("decode GCP secret payload: %w", err)
+	}
+	if len(data) == 0 {
+		return "", fmt.Errorf("access GCP secret: %w: empty payload", ErrSecretMissing)
+	}
+	return string(data), nil
+}
+
+func (s gcpSecretManagerStore) writePayload(ctx context.Context, payload string) (storedVersion, error) {
+	header, err := s.authHeader(ctx)
+	if err != nil {
+		return storedVersion{}, err
+	}
+
+	var version struct {
+		Name string `json:"name"`
+	}
+	request := map[string]any{"payload": gcpSecretPayload{Data: base64.StdEncoding.EncodeToString([]byte(payload))}}
+	if err := callRESTAPI(ctx, http.DefaultClient, http.MethodPost, s.endpoint+"/v1/"+s.name+":addVersion", header, request, &version); err != nil {
+		return storedVersion{}, fmt.Errorf("add GCP secret version: %w", err)
+	}
+	return storedVersion{ARN: s.name, VersionID: path.Base(version.Name)}, nil
+}
+
+func (s gcpSecretManagerStore) exists(ctx context.Context) (bool, error) {
+	return payloadStored(ctx, s)
+}
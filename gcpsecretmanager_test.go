@@ -0,0 +1,83 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// Secret Manager API and metadata server keeping the versions of a secret in memory.
+func newGCPSecretManagerServer(t *testing.T, name string) *httptest.Server {
+	t.Helper()
+	var versions []gcpSecretPayload
+	mux := http.NewServeMux()
+	mux.HandleFunc("/computeMetadata/v1/instance/service-accounts/default/token", func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Metadata-Flavor") != "Google" {
+			http.Error(w, "missing header", http.StatusForbidden)
+			return
+		}
+		fmt.Fprint(w, `{"access_token": "token", "expires_in": 3600}`)
+	})
+	mux.HandleFunc("/v1/"+name+"/versions/latest:access", func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer token" {
+			http.Error(w, "unauthenticated", http.StatusUnauthorized)
+			return
+		}
+		if len(versions) == 0 {
+			http.Error(w, `{"error": {"status": "NOT_FOUND"}}`, http.StatusNotFound)
+			return
+		}
+		_ = json.NewEncoder(w).Encode(map[string]any{"payload": versions[len(versions)-1]})
+	})
+	mux.HandleFunc("/v1/"+name+":addVersion", func(w http.ResponseWriter, r *http.Request) {
+		var request struct {
+			Payload gcpSecretPayload `json:"payload"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		versions = append(versions, request.Payload)
+		fmt.Fprintf(w, `{"name": "%s/versions/%d"}`, name, len(versions))
+	})
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestGCPSecretManagerStore(t *testing.T) {
+	name := "projects/my-project/secrets/vault-init"
+	server := newGCPSecretManagerServer(t, name)
+	store := gcpSecretManagerStore{name: name, endpoint: server.URL, metadataURL: server.URL}
+
+	if _, err := store.readPayload(context.Background()); !errors.Is(err, ErrSecretMissing) {
+		t.Fatalf("expected ErrSecretMissing without versions, got %v", err)
+	}
+
+	app, vault, _ := newTestApp(0)
+	app.config.KeyStore = store
+	result, err := app.CheckVaultStatus(context.Background())
+	if err != nil {
+		t.Fatalf("check status: %v", err)
+	}
+	if vault.sealed {
+		t.Fatal("expected Vault unsealed with the keys of the secret")
+	}
+	if result.Init.SecretARN != name || result.Init.SecretVersionID != "1" {
+		t.Errorf("expected version 1 of %s, got %s %s", name, result.Init.SecretARN, result.Init.SecretVersionID)
+	}
+	if stored, err := store.exists(context.Background()); err != nil || !stored {
+		t.Errorf("expected the payload stored, got %v, %v", stored, err)
+	}
+}
+
+func TestNewGCPSecretManagerStore(t *testing.T) {
+	t.Setenv("GCP_SECRET_NAME", "vault-init")
+	if _, err := newGCPSecretManagerStore(); err == nil {
+		t.Error("expected secret names without project rejected")
+	}
+}
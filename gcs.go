@@ -0,0 +1,68 @@
+package main
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+)
+
+// Cloud KMS key names, as `projects/<project>/locations/<location>/keyRings/<key-ring>/cryptoKeys/<key>`.
+var gcpKMSKeyName = regexp.MustCompile(`^projects/[^/]+/locations/[^/]+/keyRings/[^/]+/cryptoKeys/[^/]+$`)
+
+// Init response stored by sethvargo/vault-init, or kelseyhightower/vault-init, in a GCS bucket: the
+// `unseal-keys.json.enc` object, holding the Cloud KMS ciphertext base64 encoded. Calls are authenticated
+// like the gcpsecretmanager backend, and need the `roles/storage.objectViewer` and
+// `roles/cloudkms.cryptoKeyDecrypter` roles.
+type gcsVaultInitSource struct {
+	bucket string
+	kmsKey string
+	// Base URLs of the Cloud Storage and Cloud KMS APIs, and of the metadata server.
+	storageEndpoint string
+	kmsEndpoint     string
+	metadataURL     string
+}
+
+// Create the source reading the bucket, decrypting with the Cloud KMS key.
+func newGCSVaultInitSource(bucket, kmsKey string) (gcsVaultInitSource, error) {
+	if !gcpKMSKeyName.MatchString(kmsKey) {
+		return gcsVaultInitSource{}, fmt.Errorf("MIGRATE_GCP_KMS_KEY env must be projects/<project>/locations/<location>/keyRings/<key-ring>/cryptoKeys/<key>, got %q", kmsKey)
+	}
+	return gcsVaultInitSource{
+		bucket:          bucket,
+		kmsKey:          kmsKey,
+		storageEndpoint: "https://storage.googleapis.com",
+		kmsEndpoint:     "https://cloudkms.googleapis.com",
+		metadataURL:     gcpMetadataURL(),
+	}, nil
+}
+
+// Read and decrypt the init response.
+func (s gcsVaultInitSource) read(ctx context.Context) (string, error) {
+	header, err := gcpAuthHeader(ctx, s.metadataURL)
+	if err != nil {
+		return "", err
+	}
+
+	var ciphertext []byte
+	objectURL := s.storageEndpoint + "/storage/v1/b/" + url.PathEscape(s.bucket) + "/o/" + url.PathEscape(vaultInitUnsealKeysObject) + "?alt=media"
+	if err := callRESTAPI(ctx, http.DefaultClient, http.MethodGet, objectURL, header, nil, &ciphertext); err != nil {
+		return "", fmt.Errorf("get GCS object: %w", err)
+	}
+
+	var decrypted struct {
+		Plaintext string `json:"plaintext"`
+	}
+	request := map[string]string{"ciphertext": strings.TrimSpace(string(ciphertext))}
+	if err := callRESTAPI(ctx, http.DefaultClient, http.MethodPost, s.kmsEndpoint+"/v1/"+s.kmsKey+":decrypt", header, request, &decrypted); err != nil {
+		return "", fmt.Errorf("decrypt GCS object: %w", err)
+	}
+	plaintext, err := base64.StdEncoding.DecodeString(decrypted.Plaintext)
+	if err != nil {
+		return "", fmt.Errorf("decode GCS object plaintext: %w", err)
+	}
+	return string(plaintext), nil
+}
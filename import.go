@@ -0,0 +1,176 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"strings"
+
+	"github.com/hashicorp/vault/api"
+)
+
+// Store init material of a Vault initialized outside the tool, e.g. manually before adopting it: an init
+// response JSON object, or one key share per line, base64 or hex encoded. Shares are stored as recovery keys
+// if Vault uses an auto-unseal seal. The material is checked like the stored keys before writing it, and read
+// back after, to confirm the secret holds the same keys.
+// Secrets already holding an init response are only overwritten with FORCE_OVERWRITE.
+func (a *App) Import(ctx context.Context, material string) (*KeyCheckResult, error) {
+	if err := a.checkKeyTransport(); err != nil {
+		return nil, err
+	}
+
+	recovery := false
+	if status, err := a.vault.SealStatus(ctx); err != nil {
+		slog.Warn("Cannot read seal status, importing shares as unseal keys", "error", err)
+	} else {
+		recovery = status.Type != "" && status.Type != "shamir"
+	}
+
+	initResponse, err := parseInitMaterial(material, recovery)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrKeysInvalid, err)
+	}
+
+	written, err := json.Marshal(initResponse)
+	if err != nil {
+		return nil, fmt.Errorf("marshal init response: %w", err)
+	}
+	result, err := a.checkInitResponse(ctx, string(written))
+	if err != nil {
+		return result, err
+	}
+
+	if !a.config.ForceOverwrite {
+		if err := a.checkSecretUnused(ctx); err != nil {
+			return result, err
+		}
+	}
+	if _, err := a.writeInitResponse(ctx, initResponse); err != nil {
+		return result, fmt.Errorf("update secret: %w", err)
+	}
+
+	// Compare what is read back with what was written, to catch encryption or chunking issues.
+	stored, err := a.readInitResponse(ctx)
+	if err != nil {
+		return result, fmt.Errorf("read back init response: %w", err)
+	}
+	if stored != string(written) {
+		return result, errors.New("the secret does not hold the imported init response")
+	}
+	return result, nil
+}
+
+// Parse init material: an init response JSON object, with only the fields Vault returns, as is or in a
+// versioned payload, or one key share per line, base64 or hex encoded.
+func parseInitMaterial(material string, recovery bool) (*api.InitResponse, error) {
+	material = strings.TrimSpace(material)
+	if material == "" {
+		return nil, errors.New("no init material")
+	}
+
+	if strings.HasPrefix(material, "{") {
+		// Payloads stored by the tool are accepted too.
+		material, err := unwrapPayload(material)
+		if err != nil {
+			return nil, err
+		}
+		decoder := json.NewDecoder(strings.NewReader(material))
+		decoder.DisallowUnknownFields()
+
+		var initResponse api.InitResponse
+		if err := decoder.Decode(&initResponse); err != nil {
+			return nil, fmt.Errorf("unmarshal: %w", err)
+		}
+		if len(initResponse.KeysB64) == 0 && len(initResponse.RecoveryKeysB64) == 0 {
+			return nil, errors.New("no keys_base64 nor recovery_keys_base64")
+		}
+		return &initResponse, nil
+	}
+
+	var keys, keysB64 []string
+	scanner := bufio.NewScanner(strings.NewReader(material))
+	for i := 0; scanner.Scan(); i++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+		share, err := decodeShare(line)
+		if err != nil {
+			return nil, fmt.Errorf("share %d: %w", i, err)
+		}
+		keys = append(keys, hex.EncodeToString(share))
+		keysB64 = append(keysB64, base64.StdEncoding.EncodeToString(share))
+	}
+
+	if recovery {
+		return &api.InitResponse{RecoveryKeys: keys, RecoveryKeysB64: keysB64}, nil
+	}
+	return &api.InitResponse{Keys: keys, KeysB64: keysB64}, nil
+}
+
+// Decode a key share, hex encoded as shown by `vault operator init`, or base64 encoded.
+func decodeShare(encoded string) ([]byte, error) {
+	if share, err := hex.DecodeString(encoded); err == nil && len(share) > 0 {
+		return share, nil
+	}
+	share, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil || len(share) == 0 {
+		return nil, errors.New("neither hex nor base64")
+	}
+	return share, nil
+}
+
+// Run the `import` subcommand, reading the init material from IMPORT_FILE, `-` for stdin. Returns the
+// process exit code.
+func runImport(ctx context.Context, app *App, path string, format outputFormat) int {
+	if path == "" {
+		fmt.Fprintln(os.Stderr, "IMPORT_FILE env is required")
+		return 1
+	}
+
+	var (
+		material []byte
+		err      error
+	)
+	if path == "-" {
+		material, err = io.ReadAll(os.Stdin)
+	} else {
+		material, err = os.ReadFile(path)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Read %s: %v\n", path, err)
+		return 1
+	}
+
+	output := commandOutput{Command: "import"}
+	result, err := app.Import(ctx, string(material))
+	output.step("import", storedShares(app, result, err), err)
+	if result != nil {
+		output.Result = result
+	}
+	return output.print(os.Stdout, format)
+}
+
+// Describe the checked shares, e.g. "5 unseal shares, threshold 3".
+func describeShares(result *KeyCheckResult) string {
+	kind := "unseal"
+	if result.Recovery {
+		kind = "recovery"
+	}
+	return fmt.Sprintf("%d %s shares, threshold %d", result.Shares, kind, result.Threshold)
+}
+
+// Describe the shares stored by an import, unless it failed.
+func storedShares(app *App, result *KeyCheckResult, err error) string {
+	if err != nil {
+		return ""
+	}
+	return fmt.Sprintf("%s, stored in %s", describeShares(result), app.config.SecretID)
+}
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/hashicorp/vault/api"
+)
+
+func TestImportShares(t *testing.T) {
+	app, vault, _ := newTestApp(0)
+
+	// Vault initialized manually, its shares typed in by the key holders.
+	initResponse, _ := vault.Init(context.Background(), &api.InitRequest{SecretShares: 5, SecretThreshold: 3})
+	material := strings.Join(initResponse.Keys[:2], "\n") + "\n\n" + initResponse.KeysB64[2] + "\n"
+
+	result, err := app.Import(context.Background(), material)
+	if err != nil {
+		t.Fatalf("import: %v", err)
+	}
+	if result.Shares != 3 || result.Threshold != 3 {
+		t.Fatalf("expected 3 shares with threshold 3, got %+v", result)
+	}
+
+	if _, err := app.CheckVaultStatus(context.Background()); err != nil || vault.sealed {
+		t.Fatalf("expected Vault unsealed with the imported shares, got sealed %v: %v", vault.sealed, err)
+	}
+}
+
+func TestImportRejectsInvalidMaterial(t *testing.T) {
+	tests := map[string]string{
+		"unknown field": `{"keys_base64":["AQ==","Ag==","Aw=="],"unseal_keys":[]}`,
+		"no keys":       `{"root_token":"root"}`,
+		"invalid share": "AQ==\nnot a share\n",
+		"empty":         "\n",
+	}
+	for name, material := range tests {
+		t.Run(name, func(t *testing.T) {
+			app, _, secretsManager := newTestApp(0)
+			if _, err := app.Import(context.Background(), material); !errors.Is(err, ErrKeysInvalid) {
+				t.Fatalf("expected the keys invalid, got %v", err)
+			}
+			if secretsManager.value != nil {
+				t.Fatal("expected the secret left untouched")
+			}
+		})
+	}
+}
@@ -0,0 +1,284 @@
+//go:build integration
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/credentials"
+	"github.com/aws/aws-sdk-go-v2/service/secretsmanager"
+	"github.com/hashicorp/vault/api"
+	"github.com/testcontainers/testcontainers-go"
+	"github.com/testcontainers/testcontainers-go/modules/localstack"
+	"github.com/testcontainers/testcontainers-go/network"
+	"github.com/testcontainers/testcontainers-go/wait"
+)
+
+// Integration tests run against real Vault servers using Raft storage and a LocalStack
+// Secrets Manager, started with testcontainers. They require Docker and are run with:
+//
+//	go test -tags integration ./...
+const (
+	localstackImage = "localstack/localstack:3.5"
+	vaultImage      = "hashicorp/vault:1.17"
+)
+
+type testEnv struct {
+	network        *testcontainers.DockerNetwork
+	secretsManager *secretsmanager.Client
+}
+
+func newTestEnv(t *testing.T) *testEnv {
+	t.Helper()
+	ctx := context.Background()
+
+	net, err := network.New(ctx)
+	if err != nil {
+		t.Fatalf("create network: %v", err)
+	}
+	t.Cleanup(func() { _ = net.Remove(ctx) })
+
+	localstackContainer, err := localstack.Run(ctx, localstackImage,
+		testcontainers.WithEnv(map[string]string{"SERVICES": "secretsmanager"}),
+	)
+	if err != nil {
+		t.Fatalf("start localstack: %v", err)
+	}
+	t.Cleanup(func() { _ = localstackContainer.Terminate(ctx) })
+
+	endpoint, err := localstackContainer.PortEndpoint(ctx, "4566/tcp", "http")
+	if err != nil {
+		t.Fatalf("localstack endpoint: %v", err)
+	}
+
+	secretsManager := secretsmanager.New(secretsmanager.Options{
+		Region:       "us-east-1",
+		Credentials:  credentials.NewStaticCredentialsProvider("test", "test", ""),
+		BaseEndpoint: aws.String(endpoint),
+	})
+
+	return &testEnv{network: net, secretsManager: secretsManager}
+}
+
+// Create an empty secret, as users are required to do before running the tool.
+func (e *testEnv) createSecret(t *testing.T) string {
+	t.Helper()
+
+	output, err := e.secretsManager.CreateSecret(context.Background(), &secretsmanager.CreateSecretInput{
+		Name: aws.String(t.Name()),
+	})
+	if err != nil {
+		t.Fatalf("create secret: %v", err)
+	}
+	return aws.ToString(output.ARN)
+}
+
+// Start an uninitialized Vault server with Raft storage, reachable by other nodes as http://<name>:8200.
+func (e *testEnv) startVault(t *testing.T, name string) testcontainers.Container {
+	t.Helper()
+	ctx := context.Background()
+
+	config, err := json.Marshal(map[string]any{
+		"storage": map[string]any{
+			"raft": map[string]any{"path": "/vault/file", "node_id": name},
+		},
+		"listener": []any{
+			map[string]any{"tcp": map[string]any{"address": "0.0.0.0:8200", "tls_disable": true}},
+		},
+		"api_addr":      fmt.Sprintf("http://%s:8200", name),
+		"cluster_addr":  fmt.Sprintf("http://%s:8201", name),
+		"disable_mlock": true,
+	})
+	if err != nil {
+		t.Fatalf("marshal vault config: %v", err)
+	}
+
+	container, err := testcontainers.GenericContainer(ctx, testcontainers.GenericContainerRequest{
+		ContainerRequest: testcontainers.ContainerRequest{
+			Image:          vaultImage,
+			Cmd:            []string{"server"},
+			Env:            map[string]string{"VAULT_LOCAL_CONFIG": string(config)},
+			ExposedPorts:   []string{"8200/tcp"},
+			Networks:       []string{e.network.Name},
+			NetworkAliases: map[string][]string{e.network.Name: {name}},
+			WaitingFor: wait.ForHTTP("/v1/sys/health").WithPort("8200/tcp").
+				WithStatusCodeMatcher(func(int) bool { return true }),
+		},
+		Started: true,
+	})
+	if err != nil {
+		t.Fatalf("start vault %s: %v", name, err)
+	}
+	t.Cleanup(func() { _ = container.Terminate(ctx) })
+
+	return container
+}
+
+// Create an App for the Vault container. The mapped port changes when a container restarts,
+// so a new App must be created after restarting Vault.
+func (e *testEnv) newApp(t *testing.T, container testcontainers.Container, config Config) *App {
+	t.Helper()
+
+	endpoint, err := container.PortEndpoint(context.Background(), "8200/tcp", "http")
+	if err != nil {
+		t.Fatalf("vault endpoint: %v", err)
+	}
+
+	vaultConfig := api.DefaultConfig()
+	vaultConfig.Address = endpoint
+
+	vaultClient, err := api.NewClient(vaultConfig)
+	if err != nil {
+		t.Fatalf("create vault client: %v", err)
+	}
+
+	return NewApp(config, newVaultClient(vaultClient, "", nil), e.secretsManager, nil, nil)
+}
+
+func testConfig(secretID string, replica int) Config {
+	return Config{
+		SecretID:          secretID,
+		SecretShares:      5,
+		SecretThreshold:   3,
+		Replica:           replica,
+		RaftLeaderAPIAddr: "http://vault-0:8200",
+		// The test Vault servers listen on plaintext HTTP, mapped to the Docker host.
+		AllowPlaintext: true,
+	}
+}
+
+// Run status checks until Vault is initialized and unsealed, as the main loop does.
+func reconcile(t *testing.T, app *App) *CheckResult {
+	t.Helper()
+
+	var (
+		result *CheckResult
+		err    error
+	)
+	for i := 0; i < 10; i++ {
+		result, err = app.CheckVaultStatus(context.Background())
+		if err == nil && result.Initialized && !result.Sealed {
+			return result
+		}
+		time.Sleep(2 * time.Second)
+	}
+	t.Fatalf("vault not ready after reconciling: result %+v, error %v", result, err)
+	return nil
+}
+
+func TestIntegrationInitJoinUnseal(t *testing.T) {
+	var (
+		env      = newTestEnv(t)
+		secretID = env.createSecret(t)
+		leader   = env.startVault(t, "vault-0")
+		follower = env.startVault(t, "vault-1")
+		ctx      = context.Background()
+	)
+
+	leaderApp := env.newApp(t, leader, testConfig(secretID, 0))
+	if err := leaderApp.CheckSecretExistence(ctx); err != nil {
+		t.Fatalf("check secret existence: %v", err)
+	}
+
+	result, err := leaderApp.CheckVaultStatus(ctx)
+	if err != nil {
+		t.Fatalf("check leader status: %v", err)
+	}
+	if result.Init == nil || result.Init.SecretVersionID == "" {
+		t.Fatalf("expected leader to be initialized and the secret updated, got %+v", result)
+	}
+	if result.Unseal == nil || result.Unseal.Sealed {
+		t.Fatalf("expected leader to be unsealed, got %+v", result.Unseal)
+	}
+
+	secret, err := env.secretsManager.GetSecretValue(ctx, &secretsmanager.GetSecretValueInput{SecretId: &secretID})
+	if err != nil {
+		t.Fatalf("get secret value: %v", err)
+	}
+	var initResponse api.InitResponse
+	if err := json.Unmarshal([]byte(aws.ToString(secret.SecretString)), &initResponse); err != nil {
+		t.Fatalf("unmarshal stored init response: %v", err)
+	}
+	if len(initResponse.KeysB64) != 5 || initResponse.RootToken == "" {
+		t.Fatalf("unexpected stored init response: %d keys", len(initResponse.KeysB64))
+	}
+
+	followerApp := env.newApp(t, follower, testConfig(secretID, 1))
+	result = reconcile(t, followerApp)
+	if result.Init != nil {
+		t.Fatalf("follower must not initialize Vault")
+	}
+
+	// Nothing to do on an initialized and unsealed node.
+	result, err = leaderApp.CheckVaultStatus(ctx)
+	if err != nil {
+		t.Fatalf("check leader status: %v", err)
+	}
+	if result.Init != nil || result.Join != nil || result.Unseal != nil {
+		t.Fatalf("expected no actions on a healthy node, got %+v", result)
+	}
+}
+
+func TestIntegrationUnsealAfterRestart(t *testing.T) {
+	var (
+		env      = newTestEnv(t)
+		secretID = env.createSecret(t)
+		vault    = env.startVault(t, "vault-0")
+		ctx      = context.Background()
+	)
+
+	reconcile(t, env.newApp(t, vault, testConfig(secretID, 0)))
+
+	timeout := 10 * time.Second
+	if err := vault.Stop(ctx, &timeout); err != nil {
+		t.Fatalf("stop vault: %v", err)
+	}
+	if err := vault.Start(ctx); err != nil {
+		t.Fatalf("start vault: %v", err)
+	}
+
+	app := env.newApp(t, vault, testConfig(secretID, 0))
+	result := reconcile(t, app)
+	if result.Init != nil {
+		t.Fatalf("restarted node must not be initialized again")
+	}
+}
+
+func TestIntegrationMissingSecret(t *testing.T) {
+	var (
+		env   = newTestEnv(t)
+		vault = env.startVault(t, "vault-0")
+		ctx   = context.Background()
+		app   = env.newApp(t, vault, testConfig("does-not-exist", 0))
+	)
+
+	if err := app.CheckSecretExistence(ctx); !errors.Is(err, ErrSecretMissing) {
+		t.Fatalf("expected ErrSecretMissing, got %v", err)
+	}
+}
+
+func TestIntegrationRecoverFromEmptySecret(t *testing.T) {
+	var (
+		env      = newTestEnv(t)
+		secretID = env.createSecret(t)
+		leader   = env.startVault(t, "vault-0")
+		follower = env.startVault(t, "vault-1")
+		ctx      = context.Background()
+	)
+
+	// The follower cannot join before the leader is initialized.
+	followerApp := env.newApp(t, follower, testConfig(secretID, 1))
+	if _, err := followerApp.CheckVaultStatus(ctx); err == nil {
+		t.Fatalf("expected follower check to fail before the leader is initialized")
+	}
+
+	// Once the leader is initialized, the follower recovers on the next checks.
+	reconcile(t, env.newApp(t, leader, testConfig(secretID, 0)))
+	reconcile(t, followerApp)
+}
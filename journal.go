@@ -0,0 +1,234 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+// Prefixes of the journal item sort keys, telling entries from claims.
+const (
+	journalEntryPrefix = "entry#"
+	journalClaimPrefix = "claim#"
+)
+
+// Format of the journal times: RFC 3339 in UTC with fixed-width nanoseconds, as RFC3339Nano drops trailing
+// zeros and the entry sort keys would not be in time order.
+const journalTimeFormat = "2006-01-02T15:04:05.000000000Z"
+
+// DynamoDB API subset used by the operation journal.
+type dynamoDBAPI interface {
+	PutItem(ctx context.Context, params *dynamodb.PutItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.PutItemOutput, error)
+	Query(ctx context.Context, params *dynamodb.QueryInput, optFns ...func(*dynamodb.Options)) (*dynamodb.QueryOutput, error)
+	DeleteItem(ctx context.Context, params *dynamodb.DeleteItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.DeleteItemOutput, error)
+}
+
+// Create SDK client for AWS DynamoDB.
+func newAWSDynamoDBClient(ctx context.Context) (*dynamodb.Client, error) {
+	cfg, err := loadAWSConfig(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("load SDK config: %w", err)
+	}
+
+	return dynamodb.NewFromConfig(cfg, func(o *dynamodb.Options) {
+		o.BaseEndpoint = endpointURL("dynamodb")
+	}), nil
+}
+
+// Journal of the side-effectful actions taken on the Vault clusters, shared by the instances of the tool and
+// read by operators. Kept in a DynamoDB table with the `cluster` partition key and `id` sort key, both strings.
+// Entries are never overwritten, and claims make sure a single node takes actions that must not be repeated.
+// Methods of a nil journal do nothing.
+type operationJournal struct {
+	client dynamoDBAPI
+	table  string
+	// Node taking the actions, recorded in the entries.
+	node string
+}
+
+func newOperationJournal(client dynamoDBAPI, table string) *operationJournal {
+	return &operationJournal{client: client, table: table, node: os.Getenv("HOSTNAME")}
+}
+
+// JournalEntry is an action recorded in the journal.
+type JournalEntry struct {
+	Time   time.Time `json:"time"`
+	Node   string    `json:"node"`
+	Action string    `json:"action"`
+	Detail string    `json:"detail,omitempty"`
+	Error  string    `json:"error,omitempty"`
+}
+
+// Record the action taken on the cluster. Failures are logged rather than failing the action, already taken.
+func (j *operationJournal) record(ctx context.Context, cluster, action, detail string, actionErr error) {
+	if j == nil {
+		return
+	}
+
+	now := time.Now().UTC().Format(journalTimeFormat)
+	item := map[string]types.AttributeValue{
+		"cluster": &types.AttributeValueMemberS{Value: cluster},
+		"id":      &types.AttributeValueMemberS{Value: journalEntryPrefix + now + "#" + j.node},
+		"time":    &types.AttributeValueMemberS{Value: now},
+		"node":    &types.AttributeValueMemberS{Value: j.node},
+		"action":  &types.AttributeValueMemberS{Value: action},
+	}
+	if detail != "" {
+		item["detail"] = &types.AttributeValueMemberS{Value: detail}
+	}
+	if actionErr != nil {
+		item["error"] = &types.AttributeValueMemberS{Value: actionErr.Error()}
+	}
+
+	_, err := j.client.PutItem(ctx, &dynamodb.PutItemInput{
+		TableName:                &j.table,
+		Item:                     item,
+		ConditionExpression:      aws.String("attribute_not_exists(#id)"),
+		ExpressionAttributeNames: map[string]string{"#id": "id"},
+	})
+	if err != nil {
+		slog.Warn("Cannot record the action in the journal", "action", action, "error", err)
+	}
+}
+
+// Claim the action on the cluster for this node, failing with ErrActionClaimed if another node claimed it.
+// Claims are kept once the action is taken, so it is never taken by another node until an operator deletes
+// the claim, and released if the action fails before taking effect.
+func (j *operationJournal) claim(ctx context.Context, cluster, action string) error {
+	if j == nil {
+		return nil
+	}
+
+	now := time.Now().UTC().Format(journalTimeFormat)
+	_, err := j.client.PutItem(ctx, &dynamodb.PutItemInput{
+		TableName: &j.table,
+		Item: map[string]types.AttributeValue{
+			"cluster": &types.AttributeValueMemberS{Value: cluster},
+			"id":      &types.AttributeValueMemberS{Value: journalClaimPrefix + action},
+			"time":    &types.AttributeValueMemberS{Value: now},
+			"node":    &types.AttributeValueMemberS{Value: j.node},
+			"action":  &types.AttributeValueMemberS{Value: action},
+		},
+		// The claiming node may retry the action.
+		ConditionExpression:                 aws.String("attribute_not_exists(#id) OR #node = :node"),
+		ExpressionAttributeNames:            map[string]string{"#id": "id", "#node": "node"},
+		ExpressionAttributeValues:           map[string]types.AttributeValue{":node": &types.AttributeValueMemberS{Value: j.node}},
+		ReturnValuesOnConditionCheckFailure: types.ReturnValuesOnConditionCheckFailureAllOld,
+	})
+
+	var claimed *types.ConditionalCheckFailedException
+	if errors.As(err, &claimed) {
+		entry := journalEntry(claimed.Item)
+		return fmt.Errorf("%w: %s claimed by %s at %s", ErrActionClaimed, action, entry.Node, entry.Time.Format(time.RFC3339))
+	}
+	if err != nil {
+		return fmt.Errorf("claim %s: %w", action, err)
+	}
+	return nil
+}
+
+// Release the claim of this node on the action, so another node may take it. Failures are logged, the claim
+// is then kept until an operator deletes it.
+func (j *operationJournal) release(ctx context.Context, cluster, action string) {
+	if j == nil {
+		return
+	}
+
+	_, err := j.client.DeleteItem(ctx, &dynamodb.DeleteItemInput{
+		TableName: &j.table,
+		Key: map[string]types.AttributeValue{
+			"cluster": &types.AttributeValueMemberS{Value: cluster},
+			"id":      &types.AttributeValueMemberS{Value: journalClaimPrefix + action},
+		},
+		ConditionExpression:       aws.String("#node = :node"),
+		ExpressionAttributeNames:  map[string]string{"#node": "node"},
+		ExpressionAttributeValues: map[string]types.AttributeValue{":node": &types.AttributeValueMemberS{Value: j.node}},
+	})
+	if err != nil {
+		slog.Warn("Cannot release the claim in the journal, it is kept until deleted", "action", action, "error", err)
+		return
+	}
+	slog.Info("Released the claim in the journal", "action", action)
+}
+
+// Returns the most recent entries of the cluster, most recent first.
+func (j *operationJournal) list(ctx context.Context, cluster string, limit int32) ([]JournalEntry, error) {
+	output, err := j.client.Query(ctx, &dynamodb.QueryInput{
+		TableName:                &j.table,
+		KeyConditionExpression:   aws.String("#cluster = :cluster AND begins_with(#id, :prefix)"),
+		ExpressionAttributeNames: map[string]string{"#cluster": "cluster", "#id": "id"},
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":cluster": &types.AttributeValueMemberS{Value: cluster},
+			":prefix":  &types.AttributeValueMemberS{Value: journalEntryPrefix},
+		},
+		ScanIndexForward: aws.Bool(false),
+		Limit:            &limit,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("query journal: %w", err)
+	}
+
+	entries := make([]JournalEntry, 0, len(output.Items))
+	for _, item := range output.Items {
+		entries = append(entries, journalEntry(item))
+	}
+	return entries, nil
+}
+
+func journalEntry(item map[string]types.AttributeValue) JournalEntry {
+	str := func(name string) string {
+		if value, ok := item[name].(*types.AttributeValueMemberS); ok {
+			return value.Value
+		}
+		return ""
+	}
+
+	t, _ := time.Parse(time.RFC3339Nano, str("time"))
+	return JournalEntry{Time: t, Node: str("node"), Action: str("action"), Detail: str("detail"), Error: str("error")}
+}
+
+// Name of the cluster in the journal and the secret tags: its name in fleet mode, otherwise its secret.
+func (a *App) journalCluster() string {
+	if a.config.Cluster != "" {
+		return a.config.Cluster
+	}
+	return a.config.SecretID
+}
+
+// Run the `journal` subcommand, printing the most recent entries of the cluster. Returns the process exit code.
+func runJournal(ctx context.Context, app *App, format outputFormat) int {
+	if app.config.Journal == nil {
+		fmt.Fprintln(os.Stderr, "JOURNAL_TABLE env is required")
+		return 1
+	}
+
+	output := commandOutput{Command: "journal"}
+	entries, err := app.config.Journal.list(ctx, app.journalCluster(), 20)
+	output.step("read journal", fmt.Sprintf("%d entries", len(entries)), err)
+	if err == nil {
+		output.Result = entries
+	}
+	if format == outputJSON || err != nil {
+		return output.print(os.Stdout, format)
+	}
+
+	for _, entry := range entries {
+		line := []string{entry.Time.Format(time.RFC3339), entry.Node, entry.Action}
+		if entry.Detail != "" {
+			line = append(line, entry.Detail)
+		}
+		if entry.Error != "" {
+			line = append(line, "error: "+entry.Error)
+		}
+		fmt.Println(strings.Join(line, "  "))
+	}
+	return 0
+}
@@ -0,0 +1,131 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+// In-memory DynamoDB table, evaluating the conditions used by the journal.
+type fakeDynamoDB struct {
+	items map[string]map[string]types.AttributeValue
+}
+
+func attr(item map[string]types.AttributeValue, name string) string {
+	if value, ok := item[name].(*types.AttributeValueMemberS); ok {
+		return value.Value
+	}
+	return ""
+}
+
+func (d *fakeDynamoDB) PutItem(_ context.Context, params *dynamodb.PutItemInput, _ ...func(*dynamodb.Options)) (*dynamodb.PutItemOutput, error) {
+	key := attr(params.Item, "cluster") + "/" + attr(params.Item, "id")
+	if old, ok := d.items[key]; ok {
+		sameNode := strings.Contains(aws.ToString(params.ConditionExpression), "#node = :node") &&
+			attr(old, "node") == attr(params.ExpressionAttributeValues, ":node")
+		if !sameNode {
+			return nil, &types.ConditionalCheckFailedException{Message: aws.String("conditional check failed"), Item: old}
+		}
+	}
+	d.items[key] = params.Item
+	return &dynamodb.PutItemOutput{}, nil
+}
+
+func (d *fakeDynamoDB) DeleteItem(_ context.Context, params *dynamodb.DeleteItemInput, _ ...func(*dynamodb.Options)) (*dynamodb.DeleteItemOutput, error) {
+	key := attr(params.Key, "cluster") + "/" + attr(params.Key, "id")
+	if old, ok := d.items[key]; ok && attr(old, "node") != attr(params.ExpressionAttributeValues, ":node") {
+		return nil, &types.ConditionalCheckFailedException{Message: aws.String("conditional check failed")}
+	}
+	delete(d.items, key)
+	return &dynamodb.DeleteItemOutput{}, nil
+}
+
+func (d *fakeDynamoDB) Query(_ context.Context, params *dynamodb.QueryInput, _ ...func(*dynamodb.Options)) (*dynamodb.QueryOutput, error) {
+	prefix := attr(params.ExpressionAttributeValues, ":cluster") + "/" + attr(params.ExpressionAttributeValues, ":prefix")
+	var keys []string
+	for key := range d.items {
+		if strings.HasPrefix(key, prefix) {
+			keys = append(keys, key)
+		}
+	}
+	sort.Sort(sort.Reverse(sort.StringSlice(keys)))
+
+	output := &dynamodb.QueryOutput{}
+	for _, key := range keys {
+		output.Items = append(output.Items, d.items[key])
+	}
+	return output, nil
+}
+
+func TestJournal(t *testing.T) {
+	table := &fakeDynamoDB{items: map[string]map[string]types.AttributeValue{}}
+	app, _, _ := newTestApp(0)
+	app.config.Journal = &operationJournal{client: table, table: "vault-init", node: "vault-0"}
+
+	if _, err := app.CheckVaultStatus(context.Background()); err != nil {
+		t.Fatalf("check status: %v", err)
+	}
+
+	entries, err := app.config.Journal.list(context.Background(), "vault", 20)
+	if err != nil {
+		t.Fatalf("list: %v", err)
+	}
+	var actions []string
+	for _, entry := range entries {
+		actions = append(actions, entry.Action)
+	}
+	// Most recent first.
+	if want := "unseal,init,secret written"; strings.Join(actions, ",") != want {
+		t.Fatalf("expected the %s entries, got %v", want, actions)
+	}
+
+	// Another node cannot initialize the cluster claimed by the first one.
+	other := &operationJournal{client: table, table: "vault-init", node: "vault-0-replacement"}
+	if err := other.claim(context.Background(), "vault", "init"); !errors.Is(err, ErrActionClaimed) || !strings.Contains(err.Error(), "vault-0") {
+		t.Fatalf("expected init claimed by vault-0, got %v", err)
+	}
+	if err := app.config.Journal.claim(context.Background(), "vault", "init"); err != nil {
+		t.Fatalf("expected the claiming node to claim again, got %v", err)
+	}
+}
+
+func TestJournalTimesSortInOrder(t *testing.T) {
+	// RFC3339Nano formats these as .1Z and .12Z, sorting the earlier after the later one.
+	earlier := time.Date(2024, 5, 1, 12, 0, 0, 100000000, time.UTC)
+	later := time.Date(2024, 5, 1, 12, 0, 0, 120000000, time.UTC)
+	if a, b := earlier.Format(journalTimeFormat), later.Format(journalTimeFormat); a >= b {
+		t.Fatalf("expected %s sorted before %s", a, b)
+	}
+	if parsed, err := time.Parse(time.RFC3339Nano, earlier.Format(journalTimeFormat)); err != nil || !parsed.Equal(earlier) {
+		t.Errorf("expected the time read back, got %v, %v", parsed, err)
+	}
+}
+
+func TestJournalReleasesFailedInitClaim(t *testing.T) {
+	table := &fakeDynamoDB{items: map[string]map[string]types.AttributeValue{}}
+	app, vault, _ := newTestApp(0)
+	app.config.Journal = &operationJournal{client: table, table: "vault-init", node: "vault-0"}
+	// Initialized in the meantime, so the init request fails.
+	vault.initialized = true
+
+	if _, err := app.Initialize(context.Background()); err == nil {
+		t.Fatal("expected the init request to fail")
+	}
+	other := &operationJournal{client: table, table: "vault-init", node: "vault-1"}
+	if err := other.claim(context.Background(), "vault", "init"); err != nil {
+		t.Fatalf("expected the claim released after the failed init, got %v", err)
+	}
+
+	// Only the claiming node releases its claim.
+	app.config.Journal.release(context.Background(), "vault", "init")
+	if err := app.config.Journal.claim(context.Background(), "vault", "init"); !errors.Is(err, ErrActionClaimed) {
+		t.Errorf("expected the claim of vault-1 kept, got %v", err)
+	}
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"os"
+
+	"github.com/hashicorp/vault/api"
+)
+
+// Check the stored init response could unseal Vault, without submitting the keys: it parses, holds distinct
+// well-formed shares, at least as many as the threshold, and the shares did not already fail to unseal Vault.
+// The threshold and share count are read from Vault if it is initialized, otherwise from the config.
+func (a *App) VerifyKeys(ctx context.Context) (*KeyCheckResult, error) {
+	secretString, err := a.readInitResponse(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("read init response: %w", err)
+	}
+	return a.checkInitResponse(ctx, secretString)
+}
+
+// Check the init response JSON could unseal Vault, as described by VerifyKeys.
+func (a *App) checkInitResponse(ctx context.Context, secretString string) (*KeyCheckResult, error) {
+	var initResponse api.InitResponse
+	if err := json.Unmarshal([]byte(secretString), &initResponse); err != nil {
+		return nil, fmt.Errorf("%w: unmarshal: %w", ErrKeysInvalid, err)
+	}
+
+	result := &KeyCheckResult{
+		Recovery:  len(initResponse.KeysB64) == 0 && len(initResponse.RecoveryKeysB64) > 0,
+		Threshold: a.config.SecretThreshold,
+	}
+	var expectedShares int
+	if status, err := a.vault.SealStatus(ctx); err != nil {
+		slog.Warn("Cannot read seal status, checking the keys against the configured threshold", "error", err)
+	} else if status.Initialized {
+		result.SealType = status.Type
+		result.Recovery = status.Type != "shamir"
+		result.Threshold = status.T
+		expectedShares = status.N
+	}
+	if result.Recovery && result.SealType == "" {
+		result.Threshold = a.config.RecoveryThreshold
+	}
+
+	keysB64, keysHex := initResponse.KeysB64, initResponse.Keys
+	if result.Recovery {
+		keysB64, keysHex = initResponse.RecoveryKeysB64, initResponse.RecoveryKeys
+	}
+	result.Shares = len(keysB64)
+
+	seen := make(map[string]bool, len(keysB64))
+	for i, keyB64 := range keysB64 {
+		key, err := base64.StdEncoding.DecodeString(keyB64)
+		if err != nil || len(key) == 0 {
+			return result, fmt.Errorf("%w: share %d is not base64", ErrKeysInvalid, i)
+		}
+		if seen[keyB64] {
+			return result, fmt.Errorf("%w: share %d is duplicated", ErrKeysInvalid, i)
+		}
+		seen[keyB64] = true
+
+		// Both encodings of the shares are stored, unless the shares were edited.
+		if i < len(keysHex) {
+			if decoded, err := hex.DecodeString(keysHex[i]); err != nil || !bytes.Equal(decoded, key) {
+				return result, fmt.Errorf("%w: share %d differs between its hex and base64 encodings", ErrKeysInvalid, i)
+			}
+		}
+	}
+
+	if result.Shares < result.Threshold {
+		return result, fmt.Errorf("%w: %d shares stored, %d required", ErrKeysInvalid, result.Shares, result.Threshold)
+	}
+	if expectedShares > 0 && result.Shares != expectedShares {
+		slog.Warn("The stored share count differs from Vault's", "stored", result.Shares, "vault", expectedShares)
+	}
+
+	fingerprint := fmt.Sprintf("%x", sha256.Sum256([]byte(secretString)))
+	if fingerprint == a.failedKeys {
+		return result, fmt.Errorf("%w: the keys already failed to unseal vault", ErrKeysInvalid)
+	}
+	return result, nil
+}
+
+// Run the `verify-keys` subcommand, printing the outcome of the check. Returns the process exit code.
+func runVerifyKeys(ctx context.Context, app *App, format outputFormat) int {
+	output := commandOutput{Command: "verify-keys"}
+
+	result, err := app.VerifyKeys(ctx)
+	if err == nil {
+		output.step("stored keys", describeShares(result), nil)
+	} else {
+		output.step("stored keys", "", err)
+	}
+	if result != nil {
+		output.Result = result
+	}
+	return output.print(os.Stdout, format)
+}
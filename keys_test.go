@@ -0,0 +1,62 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/hashicorp/vault/api"
+)
+
+func TestVerifyKeys(t *testing.T) {
+	app, _, secretsManager := newTestApp(0)
+	if _, err := app.CheckVaultStatus(context.Background()); err != nil {
+		t.Fatalf("initialize: %v", err)
+	}
+
+	result, err := app.VerifyKeys(context.Background())
+	if err != nil {
+		t.Fatalf("verify keys: %v", err)
+	}
+	if result.Shares != 5 || result.Threshold != 3 || result.Recovery {
+		t.Fatalf("expected 5 unseal shares with threshold 3, got %+v", result)
+	}
+
+	var initResponse api.InitResponse
+	if err := json.Unmarshal([]byte(secretsManager.storedInitResponse()), &initResponse); err != nil {
+		t.Fatalf("unmarshal: %v", err)
+	}
+
+	tests := map[string]func(*api.InitResponse){
+		"below threshold": func(r *api.InitResponse) {
+			r.Keys, r.KeysB64 = r.Keys[:2], r.KeysB64[:2]
+		},
+		"duplicated share": func(r *api.InitResponse) {
+			r.Keys[1], r.KeysB64[1] = r.Keys[0], r.KeysB64[0]
+		},
+		"mismatched encodings": func(r *api.InitResponse) {
+			r.Keys[0] = r.Keys[1]
+		},
+	}
+	for name, edit := range tests {
+		t.Run(name, func(t *testing.T) {
+			edited := initResponse
+			edited.Keys = append([]string(nil), initResponse.Keys...)
+			edited.KeysB64 = append([]string(nil), initResponse.KeysB64...)
+			edit(&edited)
+
+			value, _ := json.Marshal(edited)
+			secretsManager.value = aws.String(string(value))
+			if _, err := app.VerifyKeys(context.Background()); !errors.Is(err, ErrKeysInvalid) {
+				t.Fatalf("expected the keys invalid, got %v", err)
+			}
+		})
+	}
+
+	secretsManager.value = aws.String("not json")
+	if _, err := app.VerifyKeys(context.Background()); !errors.Is(err, ErrKeysInvalid) {
+		t.Fatalf("expected the keys invalid, got %v", err)
+	}
+}
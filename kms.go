@@ -0,0 +1,87 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/aws/arn"
+	"github.com/aws/aws-sdk-go-v2/service/kms"
+	"github.com/aws/aws-sdk-go-v2/service/kms/types"
+)
+
+// Subset of the AWS KMS API used by the App.
+// Satisfied by *kms.Client.
+type kmsAPI interface {
+	Decrypt(ctx context.Context, params *kms.DecryptInput, optFns ...func(*kms.Options)) (*kms.DecryptOutput, error)
+	DescribeKey(ctx context.Context, params *kms.DescribeKeyInput, optFns ...func(*kms.Options)) (*kms.DescribeKeyOutput, error)
+	Encrypt(ctx context.Context, params *kms.EncryptInput, optFns ...func(*kms.Options)) (*kms.EncryptOutput, error)
+	GenerateDataKey(ctx context.Context, params *kms.GenerateDataKeyInput, optFns ...func(*kms.Options)) (*kms.GenerateDataKeyOutput, error)
+}
+
+// Create SDK client for AWS KMS, in the region of the secret.
+func newAWSKMSClient(ctx context.Context) (*kms.Client, error) {
+	cfg, err := loadAWSConfig(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("load SDK config: %w", err)
+	}
+
+	return kms.NewFromConfig(cfg, func(o *kms.Options) {
+		o.BaseEndpoint = endpointURL("kms")
+		if region := secretRegion(); region != "" {
+			o.Region = region
+		}
+	}), nil
+}
+
+// Check the KMS keys Vault depends on are accessible and enabled: the key encrypting the secret,
+// unless it is the default aws/secretsmanager key, and the awskms seal and envelope keys, if configured.
+func (a *App) CheckKMSKeys(ctx context.Context) error {
+	keys := make(map[string]string)
+
+	if a.config.SealKMSKeyID != "" {
+		keys["seal"] = a.config.SealKMSKeyID
+	}
+	if a.config.EnvelopeKMSKeyID != "" {
+		keys["envelope"] = a.config.EnvelopeKMSKeyID
+	}
+
+	secret, err := a.describeSecret(ctx, false)
+	if err != nil {
+		return fmt.Errorf("describe secret: %w", err)
+	}
+	if keyID := aws.ToString(secret.KmsKeyId); keyID != "" {
+		keys["secret"] = keyID
+	}
+
+	for use, keyID := range keys {
+		if err := a.checkKMSKey(ctx, keyID); err != nil {
+			return fmt.Errorf("%s KMS key %s: %w", use, keyID, err)
+		}
+		slog.Debug("KMS key is enabled", "use", use, "keyID", keyID)
+	}
+	return nil
+}
+
+func (a *App) checkKMSKey(ctx context.Context, keyID string) error {
+	output, err := a.kms.DescribeKey(ctx, &kms.DescribeKeyInput{KeyId: &keyID}, withKeyRegion(keyID))
+	if err != nil {
+		return fmt.Errorf("%w: %w", ErrKMSKeyUnavailable, err)
+	}
+
+	if state := output.KeyMetadata.KeyState; state != types.KeyStateEnabled {
+		return fmt.Errorf("%w: key state is %s", ErrKMSKeyUnavailable, state)
+	}
+	return nil
+}
+
+// Sends KMS requests for key ARNs to the region of the key, as keys in other regions
+// cannot be described from the client region.
+func withKeyRegion(keyID string) func(*kms.Options) {
+	return func(o *kms.Options) {
+		if keyARN, err := arn.Parse(keyID); err == nil && keyARN.Region != "" {
+			o.Region = keyARN.Region
+		}
+	}
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/kms"
+	kmstypes "github.com/aws/aws-sdk-go-v2/service/kms/types"
+)
+
+// Describes the keys in the given states, by ID, ARN or alias, other keys are not found. Other calls panic.
+type keyStatesKMS struct {
+	kmsAPI
+	states map[string]kmstypes.KeyState
+	// Key IDs of the aliases.
+	aliases   map[string]string
+	described []string
+}
+
+func (k *keyStatesKMS) DescribeKey(_ context.Context, params *kms.DescribeKeyInput, _ ...func(*kms.Options)) (*kms.DescribeKeyOutput, error) {
+	keyID := aws.ToString(params.KeyId)
+	k.described = append(k.described, keyID)
+	if aliased, ok := k.aliases[keyID]; ok {
+		keyID = aliased
+	}
+	keyID = strings.TrimPrefix(keyID, "arn:aws:kms:us-east-1:123456789012:key/")
+	state, ok := k.states[keyID]
+	if !ok {
+		return nil, &kmstypes.NotFoundException{Message: aws.String("key not found")}
+	}
+	return &kms.DescribeKeyOutput{KeyMetadata: &kmstypes.KeyMetadata{
+		KeyId:    &keyID,
+		Arn:      aws.String("arn:aws:kms:us-east-1:123456789012:key/" + keyID),
+		KeyState: state,
+	}}, nil
+}
+
+func TestCheckKMSKeys(t *testing.T) {
+	enabled := map[string]kmstypes.KeyState{"seal": kmstypes.KeyStateEnabled, "envelope": kmstypes.KeyStateEnabled, "secret": kmstypes.KeyStateEnabled}
+
+	tests := map[string]struct {
+		states map[string]kmstypes.KeyState
+		// Keys of the seal, the envelope and the secret, empty if not used.
+		seal, envelope, secret string
+		described              string
+		err                    string
+	}{
+		"no keys":          {states: enabled},
+		"keys enabled":     {states: enabled, seal: "seal", envelope: "envelope", secret: "secret", described: "envelope,seal,secret"},
+		"seal key missing": {states: enabled, seal: "deleted", err: "seal KMS key deleted"},
+		"secret key disabled": {
+			states: map[string]kmstypes.KeyState{"secret": kmstypes.KeyStateDisabled},
+			secret: "secret",
+			err:    "secret KMS key secret: KMS key unavailable: key state is Disabled",
+		},
+		"envelope key pending deletion": {
+			states:   map[string]kmstypes.KeyState{"envelope": kmstypes.KeyStatePendingDeletion},
+			envelope: "envelope",
+			err:      "key state is PendingDeletion",
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			app, _, secretsManager := newTestApp(0)
+			client := &keyStatesKMS{states: test.states}
+			app.kms = client
+			app.config.SealKMSKeyID, app.config.EnvelopeKMSKeyID, secretsManager.kmsKeyID = test.seal, test.envelope, test.secret
+
+			err := app.CheckKMSKeys(context.Background())
+			if test.err != "" {
+				if !errors.Is(err, ErrKMSKeyUnavailable) || !strings.Contains(err.Error(), test.err) {
+					t.Fatalf("expected ErrKMSKeyUnavailable containing %q, got %v", test.err, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("check keys: %v", err)
+			}
+			sort.Strings(client.described)
+			if described := strings.Join(client.described, ","); described != test.described {
+				t.Errorf("expected the keys %q described, got %q", test.described, described)
+			}
+		})
+	}
+}
@@ -0,0 +1,175 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/spf13/viper"
+)
+
+// Directory the service account credentials are mounted in, in pods.
+const kubernetesServiceAccountDir = "/var/run/secrets/kubernetes.io/serviceaccount"
+
+// Key of the Kubernetes Secret data holding the payload.
+const kubernetesSecretKey = "init-response"
+
+// Key store keeping the payload in a Kubernetes Secret, using the in-cluster credentials of the pod. The
+// Secret is created if missing, and only its payload key is updated otherwise.
+type kubernetesSecretStore struct {
+	namespace string
+	name      string
+
+	// API server, and files of the service account token, reread as it is rotated.
+	host      string
+	client    *http.Client
+	tokenFile string
+}
+
+// Create the key store of the `kubernetes` backend, storing in the KUBERNETES_SECRET_NAME Secret of the
+// KUBERNETES_SECRET_NAMESPACE namespace, the namespace of the pod by default.
+func newKubernetesSecretStore() (keyStore, error) {
+	name := viper.GetString("kubernetes_secret_name")
+	if name == "" {
+		return nil, errors.New("KUBERNETES_SECRET_NAME env is required with the kubernetes secret backend")
+	}
+
+	// Set in all containers by the kubelet.
+	host, port := os.Getenv("KUBERNETES_SERVICE_HOST"), os.Getenv("KUBERNETES_SERVICE_PORT")
+	if host == "" || port == "" {
+		return nil, errors.New("the kubernetes secret backend only runs in a pod, KUBERNETES_SERVICE_HOST is not set")
+	}
+
+	namespace := viper.GetString("kubernetes_secret_namespace")
+	if namespace == "" {
+		data, err := os.ReadFile(filepath.Join(kubernetesServiceAccountDir, "namespace"))
+		if err != nil {
+			return nil, fmt.Errorf("read pod namespace: %w", err)
+		}
+		namespace = strings.TrimSpace(string(data))
+	}
+
+	ca, err := os.ReadFile(filepath.Join(kubernetesServiceAccountDir, "ca.crt"))
+	if err != nil {
+		return nil, fmt.Errorf("read cluster CA: %w", err)
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(ca) {
+		return nil, errors.New("no certificate in the cluster CA")
+	}
+
+	return kubernetesSecretStore{
+		namespace: namespace,
+		name:      name,
+		host:      "https://" + net.JoinHostPort(host, port),
+		client: &http.Client{Transport: &http.Transport{
+			TLSClientConfig: &tls.Config{RootCAs: pool, MinVersion: tls.VersionTLS12},
+		}},
+		tokenFile: filepath.Join(kubernetesServiceAccountDir, "token"),
+	}, nil
+}
+
+// Secret object of the Kubernetes API, with all its fields so updates keep them. The data is base64 encoded
+// by encoding/json, and the metadata kept as is.
+type kubernetesSecret struct {
+	APIVersion string            `json:"apiVersion"`
+	Kind       string            `json:"kind"`
+	Metadata   map[string]any    `json:"metadata"`
+	Type       string            `json:"type,omitempty"`
+	Immutable  *bool             `json:"immutable,omitempty"`
+	Data       map[string][]byte `json:"data"`
+}
+
+func (s kubernetesSecretStore) authHeader() (http.Header, error) {
+	token, err := os.ReadFile(s.tokenFile)
+	if err != nil {
+		return nil, fmt.Errorf("read service account token: %w", err)
+	}
+	return http.Header{"Authorization": {"Bearer " + strings.TrimSpace(string(token))}}, nil
+}
+
+func (s kubernetesSecretStore) secretsURL() string {
+	return s.host + "/api/v1/namespaces/" + url.PathEscape(s.namespace) + "/secrets"
+}
+
+// Returns the Secret, failing with ErrSecretMissing if it does not exist.
+func (s kubernetesSecretStore) get(ctx context.Context, header http.Header) (*kubernetesSecret, error) {
+	var secret kubernetesSecret
+	err := callRESTAPI(ctx, s.client, http.MethodGet, s.secretsURL()+"/"+url.PathEscape(s.name), header, nil, &secret)
+	var apiErr *restAPIError
+	if errors.As(err, &apiErr) && apiErr.StatusCode == http.StatusNotFound {
+		return nil, fmt.Errorf("get Kubernetes secret: %w: %w", ErrSecretMissing, err)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("get Kubernetes secret: %w", err)
+	}
+	return &secret, nil
+}
+
+func (s kubernetesSecretStore) readPayload(ctx context.Context) (string, error) {
+	header, err := s.authHeader()
+	if err != nil {
+		return "", err
+	}
+	secret, err := s.get(ctx, header)
+	if err != nil {
+		return "", err
+	}
+	payload := secret.Data[kubernetesSecretKey]
+	if len(payload) == 0 {
+		return "", fmt.Errorf("get Kubernetes secret: %w: no %s key", ErrSecretMissing, kubernetesSecretKey)
+	}
+	return string(payload), nil
+}
+
+func (s kubernetesSecretStore) writePayload(ctx context.Context, payload string) (storedVersion, error) {
+	header, err := s.authHeader()
+	if err != nil {
+		return storedVersion{}, err
+	}
+
+	secret, err := s.get(ctx, header)
+	if errors.Is(err, ErrSecretMissing) {
+		secret = &kubernetesSecret{
+			APIVersion: "v1",
+			Kind:       "Secret",
+			Metadata: map[string]any{
+				"name":      s.name,
+				"namespace": s.namespace,
+				"labels":    map[string]string{"app.kubernetes.io/managed-by": "vault-init"},
+			},
+			Type: "Opaque",
+		}
+	} else if err != nil {
+		return storedVersion{}, err
+	}
+	if secret.Data == nil {
+		secret.Data = map[string][]byte{}
+	}
+	secret.Data[kubernetesSecretKey] = []byte(payload)
+
+	// Updates carry the resource version read, failing if the Secret changed since.
+	var stored kubernetesSecret
+	if _, ok := secret.Metadata["resourceVersion"]; ok {
+		err = callRESTAPI(ctx, s.client, http.MethodPut, s.secretsURL()+"/"+url.PathEscape(s.name), header, secret, &stored)
+	} else {
+		err = callRESTAPI(ctx, s.client, http.MethodPost, s.secretsURL(), header, secret, &stored)
+	}
+	if err != nil {
+		return storedVersion{}, fmt.Errorf("write Kubernetes secret: %w", err)
+	}
+	version, _ := stored.Metadata["resourceVersion"].(string)
+	return storedVersion{ARN: "namespaces/" + s.namespace + "/secrets/" + s.name, VersionID: version}, nil
+}
+
+func (s kubernetesSecretStore) exists(ctx context.Context) (bool, error) {
+	return payloadStored(ctx, s)
+}
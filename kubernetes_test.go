@@ -0,0 +1,101 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+)
+
+// Kubernetes API server keeping a Secret of the vault namespace in memory.
+func newKubernetesServer(t *testing.T, secret *kubernetesSecret) *httptest.Server {
+	t.Helper()
+	version := 0
+	store := func(w http.ResponseWriter, r *http.Request) {
+		var received kubernetesSecret
+		if err := json.NewDecoder(r.Body).Decode(&received); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if r.Method == http.MethodPut && received.Metadata["resourceVersion"] != strconv.Itoa(version) {
+			http.Error(w, "conflict", http.StatusConflict)
+			return
+		}
+		version++
+		received.Metadata["resourceVersion"] = strconv.Itoa(version)
+		*secret = received
+		_ = json.NewEncoder(w).Encode(secret)
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/v1/namespaces/vault/secrets", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost || secret.Metadata != nil {
+			http.Error(w, "already exists", http.StatusConflict)
+			return
+		}
+		store(w, r)
+	})
+	mux.HandleFunc("/api/v1/namespaces/vault/secrets/vault-init", func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer token" {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		if secret.Metadata == nil {
+			http.Error(w, `{"reason": "NotFound"}`, http.StatusNotFound)
+			return
+		}
+		if r.Method == http.MethodPut {
+			store(w, r)
+			return
+		}
+		_ = json.NewEncoder(w).Encode(secret)
+	})
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestKubernetesSecretStore(t *testing.T) {
+	var secret kubernetesSecret
+	server := newKubernetesServer(t, &secret)
+	tokenFile := filepath.Join(t.TempDir(), "token")
+	if err := os.WriteFile(tokenFile, []byte("token\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	store := kubernetesSecretStore{namespace: "vault", name: "vault-init", host: server.URL, client: http.DefaultClient, tokenFile: tokenFile}
+
+	if _, err := store.readPayload(context.Background()); !errors.Is(err, ErrSecretMissing) {
+		t.Fatalf("expected ErrSecretMissing without the Secret, got %v", err)
+	}
+
+	app, vault, _ := newTestApp(0)
+	app.config.KeyStore = store
+	result, err := app.CheckVaultStatus(context.Background())
+	if err != nil {
+		t.Fatalf("check status: %v", err)
+	}
+	if vault.sealed {
+		t.Fatal("expected Vault unsealed with the keys of the Secret")
+	}
+	if result.Init.SecretVersionID != "1" || secret.Type != "Opaque" {
+		t.Errorf("expected the Secret created, got version %s of type %s", result.Init.SecretVersionID, secret.Type)
+	}
+
+	// Updates keep the other keys of the Secret.
+	secret.Data["ca.crt"] = []byte("certificate")
+	version, err := store.writePayload(context.Background(), "payload")
+	if err != nil {
+		t.Fatalf("write payload: %v", err)
+	}
+	if version.VersionID != "2" || string(secret.Data["ca.crt"]) != "certificate" {
+		t.Errorf("expected the Secret updated in place, got version %s and data %v", version.VersionID, secret.Data)
+	}
+	if payload, err := store.readPayload(context.Background()); err != nil || payload != "payload" {
+		t.Errorf("expected the payload written read back, got %q, %v", payload, err)
+	}
+}
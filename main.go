@@ -6,286 +6,857 @@ package main
 
 import (
 	"context"
-	"encoding/json"
+	"errors"
+	"fmt"
 	"log"
 	"log/slog"
+	"net"
+	"net/http"
 	"os"
+	"strconv"
+	"strings"
+	"sync/atomic"
 	"time"
 
-	"github.com/aws/aws-sdk-go-v2/aws"
-	"github.com/aws/aws-sdk-go-v2/config"
-	"github.com/aws/aws-sdk-go-v2/service/secretsmanager"
 	"github.com/hashicorp/vault/api"
-	"github.com/pkg/errors"
 	"github.com/spf13/viper"
+	"github.com/spiffe/go-spiffe/v2/svid/x509svid"
 )
 
 var (
-	secretsManagerSecretID string
-	vaultClient            *api.Client
-	secretsManagerClient   *secretsmanager.Client
+	maintenanceWindows  []maintenanceWindow
+	maintenanceLocation *time.Location
 )
 
 func init() {
 	// Viper configuration
 	viper.AutomaticEnv()
 	viper.SetDefault("check_interval", 10*time.Second)
+	viper.SetDefault("check_timeout", time.Minute)
+	viper.SetDefault("secret_check_interval", 5*time.Minute)
+	viper.SetDefault("root_token_check_interval", time.Hour)
+	viper.SetDefault("root_token_policy", rootTokenStore)
+	viper.SetDefault("payload_schema", payloadSchema)
+	viper.SetDefault("key_check_interval", time.Hour)
+	viper.SetDefault("snapshot_verify_interval", 24*time.Hour)
+	viper.SetDefault("secret_metadata_cache_ttl", time.Minute)
+	viper.SetDefault("write_retry_max_duration", 5*time.Minute)
 	viper.SetDefault("vault_secret_shares", 5)
 	viper.SetDefault("vault_secret_threshold", 3)
-	viper.SetDefault("log_level", slog.LevelInfo)
+	viper.SetDefault("vault_recovery_shares", 5)
+	viper.SetDefault("vault_recovery_threshold", 3)
+	viper.SetDefault("log_level", "info")
+	viper.SetDefault("secretsmanager_role_session_name", "vault-init")
+	viper.SetDefault("maintenance_timezone", "UTC")
+	viper.SetDefault("aws_retry_mode", "adaptive")
+	viper.SetDefault("aws_max_attempts", 10)
+	viper.SetDefault("aws_call_timeout", 10*time.Second)
+	viper.SetDefault("vault_api_max_retries", 0)
+	viper.SetDefault("bootstrap_token_ttl", 15*time.Minute)
+	viper.SetDefault("unseal_canary_soak", time.Minute)
+	viper.SetDefault("fleet_workers", 10)
+	viper.SetDefault("transit_mount_path", "transit")
+	viper.SetDefault("transit_token_period", 24*time.Hour)
+
+	// Falls back to the Vault API env, so the default only applies if neither is set.
+	_ = viper.BindEnv("vault_api_max_retries", "VAULT_API_MAX_RETRIES", "VAULT_MAX_RETRIES")
 
 	// Logging configuration
+	logLevel, err := parseLogLevel(viper.GetString("log_level"))
+	if err != nil {
+		log.Fatalf("LOG_LEVEL env is invalid: %v", err)
+	}
 	slog.SetDefault(slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{
-		Level: slog.Level(viper.GetInt("log_level")),
+		Level: logLevel,
 	})))
 
-	// Read required environment variables
-	secretsManagerSecretID = viper.GetString("secretsmanager_secret_id")
-	if secretsManagerSecretID == "" {
-		log.Fatal("SECRETSMANAGER_SECRET_ID env is required")
+	// Maintenance windows for disruptive operations
+	maintenanceWindows, err = parseMaintenanceWindows(viper.GetString("maintenance_windows"))
+	if err != nil {
+		log.Fatalf("MAINTENANCE_WINDOWS env is invalid: %v", err)
+	}
+	maintenanceLocation, err = time.LoadLocation(viper.GetString("maintenance_timezone"))
+	if err != nil {
+		log.Fatalf("MAINTENANCE_TIMEZONE env is invalid: %v", err)
 	}
 }
 
 func main() {
-	var (
-		ctx = context.Background()
-		err error
-	)
+	ctx := context.Background()
+
+	// Flags follow the subcommand name, e.g. `vault-init diagnose --output json`.
+	args := os.Args[min(len(os.Args), 2):]
+	if len(os.Args) > 2 && os.Args[1] == "dr" {
+		args = os.Args[3:]
+	}
+	flags, err := parseFlags(args)
+	if err != nil {
+		log.Fatalf("Parse flags: %v", err)
+	}
+	format := flags.Output
+	if format == outputJSON {
+		// Keeps stdout for the JSON output.
+		logLevel, _ := parseLogLevel(viper.GetString("log_level"))
+		slog.SetDefault(slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{
+			Level: logLevel,
+		})))
+	}
 
 	slog.Info("Starting up...")
 
+	// Checked here rather than in init, so tests can run without the env.
+	clustersFile := viper.GetString("clusters_file")
+	if viper.GetString("secretsmanager_secret_id") == "" && viper.GetString("secretsmanager_secret_filter") == "" && clustersFile == "" && secretBackend() == secretsManagerBackend {
+		log.Fatal("SECRETSMANAGER_SECRET_ID, SECRETSMANAGER_SECRET_FILTER or CLUSTERS_FILE env is required with the secretsmanager secret backend")
+	}
+
+	cfg, err := loadConfig()
+	if err != nil {
+		log.Fatalf("Load configuration: %v", err)
+	}
+
+	if table := viper.GetString("journal_table"); table != "" {
+		dynamoDBClient, err := newAWSDynamoDBClient(ctx)
+		if err != nil {
+			log.Fatalf("Create AWS DynamoDB client: %v", err)
+		}
+		cfg.Journal = newOperationJournal(dynamoDBClient, table)
+	}
+
 	slog.Debug("Creating AWS Secrets Manager client...")
-	secretsManagerClient, err = newAWSSecretManagerClient(ctx)
+	secretsManagerClient, account, err := newAWSSecretManagerClient(ctx)
 	if err != nil {
 		log.Fatalf("Create AWS Secret Manager client: %v", err)
 	}
+	cfg.CallerAccount = account
 
-	slog.Debug("Checking the secret exists", "secretID", secretsManagerSecretID)
-	if err = checkSecretExistence(ctx); err != nil {
-		log.Fatalf("Checking secret existence: %v", err)
+	for i, share := range cfg.ShareSecrets {
+		if share.RoleARN == "" {
+			continue
+		}
+		if cfg.ShareSecrets[i].client, err = newAWSShareSecretClient(ctx, share); err != nil {
+			log.Fatalf("Create AWS Secrets Manager client of share secret %s: %v", share.ID, err)
+		}
+	}
+
+	if cfg.SecretID == "" && clustersFile == "" && cfg.KeyStore == nil {
+		filter, err := parseKeyValues(viper.GetString("secretsmanager_secret_filter"))
+		if err != nil {
+			log.Fatalf("SECRETSMANAGER_SECRET_FILTER env is invalid: %v", err)
+		}
+		if cfg.SecretID, err = discoverSecret(ctx, secretsManagerClient, filter); err != nil {
+			log.Fatalf("Discover secret: %v", err)
+		}
+		cfg.SecretFilter = filter
+	}
+
+	slog.Debug("Creating AWS KMS client...")
+	kmsClient, err := newAWSKMSClient(ctx)
+	if err != nil {
+		log.Fatalf("Create AWS KMS client: %v", err)
+	}
+
+	var ssmClient ssmAPI
+	if cfg.SSMParameterName != "" {
+		slog.Debug("Creating AWS Systems Manager client...")
+		ssmClient, err = newAWSSSMClient(ctx)
+		if err != nil {
+			log.Fatalf("Create AWS Systems Manager client: %v", err)
+		}
+	}
+
+	if socket := viper.GetString("spiffe_socket"); socket != "" {
+		slog.Debug("Connecting to SPIFFE Workload API...", "socket", socket)
+		svidSource, err := newSVIDSource(ctx, socket)
+		if err != nil {
+			log.Fatalf("Connect to SPIFFE Workload API: %v", err)
+		}
+		cfg.SVIDSource = svidSource
 	}
 
 	slog.Debug("Creating HashiCorp Vault cient...")
-	vaultClient, err = newHashiCorpVaultClient()
+	vaultClient, err := newHashiCorpVaultClient(cfg.SVIDSource, "")
 	if err != nil {
 		log.Fatalf("Create HashiCorp Vault client: %v", err)
 	}
 
-	slog.Debug("Starting Vault check routine...")
-	ticker := time.NewTicker(viper.GetDuration("check_interval"))
+	healthParams, err := parseKeyValues(viper.GetString("vault_health_params"))
+	if err != nil {
+		log.Fatalf("VAULT_HEALTH_PARAMS env is invalid: %v", err)
+	}
+	chaos := newChaosConfig()
+	if chaos.enabled() {
+		slog.Warn("Chaos mode enabled, injecting failures", "awsThrottleRate", chaos.AWSThrottleRate, "vaultTimeoutRate", chaos.VaultTimeoutRate, "unsealFailureRate", chaos.UnsealFailureRate)
+	}
+	newVault := func(client *api.Client) vaultAPI {
+		var vault vaultAPI = newVaultClient(client, viper.GetString("vault_health_path"), healthParams)
+		if chaos.enabled() {
+			vault = &chaosVault{vaultAPI: vault, chaos: chaos}
+		}
+		return vault
+	}
 
-	if err := checkVaultStatus(ctx); err != nil {
-		slog.Error("Checking Vault for the first time", "error", err)
+	if clustersFile != "" {
+		clusters, err := loadClusters(clustersFile)
+		if err != nil {
+			log.Fatalf("CLUSTERS_FILE env is invalid: %v", err)
+		}
+		for _, cluster := range clusters {
+			if cluster.RootTokenSecretName != "" && cfg.RootTokenRoleARN == "" {
+				log.Fatalf("ROOT_TOKEN_BREAK_GLASS_ROLE_ARN env is required with the rootTokenSecretName of cluster %s", cluster.Name)
+			}
+			if cluster.RootTokenSecretName != "" && cfg.RootTokenWriterRoleARN == "" {
+				log.Fatalf("ROOT_TOKEN_WRITER_ROLE_ARN env is required with the rootTokenSecretName of cluster %s", cluster.Name)
+			}
+		}
+
+		if addr := viper.GetString("metrics_addr"); addr != "" {
+			go serveMetrics(addr)
+		}
+
+		// The keys checked before initializing come from the environment, so they are described once.
+		fleetKMS := newSharedKMS(kmsClient, viper.GetDuration("secret_metadata_cache_ttl"))
+		checkInterval := viper.GetDuration("check_interval")
+
+		members := make([]*fleetMember, 0, len(clusters))
+		for _, cluster := range clusters {
+			client, err := newHashiCorpVaultClient(cfg.SVIDSource, cluster.VaultAddr)
+			if err != nil {
+				log.Fatalf("Cluster %s vaultAddr is invalid: %v", cluster.Name, err)
+			}
+
+			app := NewApp(cluster.config(cfg), newVault(client), secretsManagerClient, fleetKMS, ssmClient)
+			members = append(members, newFleetMember(app, cluster.AlertWebhookURL, checkInterval))
+			slog.Debug("Managing cluster", "cluster", cluster.Name, "vaultAddr", cluster.VaultAddr, "secretID", cluster.SecretID)
+		}
+
+		checkFleetSecrets(ctx, secretsManagerClient, members)
+
+		workers := viper.GetInt("fleet_workers")
+		if workers <= 0 {
+			log.Fatal("FLEET_WORKERS env must be positive")
+		}
+		slog.Info("Managing clusters", "clusters", len(members), "workers", workers)
+		(&fleet{members: members, workers: workers, interval: checkInterval, timeout: viper.GetDuration("check_timeout")}).run(ctx)
+		return
 	}
 
-	for {
-		slog.Debug("Tick", "time", <-ticker.C)
-		if err := checkVaultStatus(ctx); err != nil {
-			slog.Error("Checking Vault", "error", err)
+	if cfg.DesiredState != nil && cfg.DesiredState.Snapshots != nil {
+		if cfg.SnapshotStore, err = newSnapshotStore(ctx, kmsClient); err != nil {
+			log.Fatalf("Create snapshot store: %v", err)
 		}
 	}
-}
 
-// Create SDK client for AWS Secrets Manager service.
-// The SDK client can be configured using environment variables. See:
-// - https://aws.github.io/aws-sdk-go-v2/docs/configuring-sdk
-// - https://pkg.go.dev/github.com/aws/aws-sdk-go-v2/config#EnvConfig
-func newAWSSecretManagerClient(ctx context.Context) (*secretsmanager.Client, error) {
-	cfg, err := config.LoadDefaultConfig(ctx)
-	if err != nil {
-		return nil, errors.Wrap(err, "load SDK config")
+	if addr := viper.GetString("unseal_canary_addr"); addr != "" && os.Getenv("HOSTNAME") != viper.GetString("unseal_canary_node") {
+		if viper.GetString("unseal_canary_node") == "" {
+			log.Fatal("UNSEAL_CANARY_NODE env is required with UNSEAL_CANARY_ADDR")
+		}
+		client, err := newHashiCorpVaultClient(cfg.SVIDSource, addr)
+		if err != nil {
+			log.Fatalf("UNSEAL_CANARY_ADDR env is invalid: %v", err)
+		}
+		cfg.UnsealCanary = newCanaryGate(newVault(client), viper.GetDuration("unseal_canary_soak"))
 	}
 
-	return secretsmanager.NewFromConfig(cfg), nil
-}
+	app := NewApp(cfg, newVault(vaultClient), secretsManagerClient, kmsClient, ssmClient)
 
-// Create API client for HashiCorp Vault.
-// The HashiCorp Vault API client can be configured using environment variables. See:
-// - https://developer.hashicorp.com/vault/docs/commands#environment-variables
-// - https://pkg.go.dev/github.com/hashicorp/vault/api#Config.ReadEnvironment
-func newHashiCorpVaultClient() (*api.Client, error) {
-	config := api.DefaultConfig()
+	if len(os.Args) > 1 && os.Args[1] == "status" {
+		os.Exit(runStatus(ctx, app, format))
+	}
 
-	if err := config.ReadEnvironment(); err != nil {
-		return nil, errors.Wrap(err, "failed to read environment")
+	if len(os.Args) > 1 && os.Args[1] == "reconcile" {
+		os.Exit(runReconcile(ctx, app, viper.GetDuration("check_timeout"), format))
 	}
 
-	client, err := api.NewClient(config)
-	if err != nil {
-		return nil, errors.Wrap(err, "failed to create client")
+	if len(os.Args) > 1 && os.Args[1] == "journal" {
+		os.Exit(runJournal(ctx, app, format))
 	}
 
-	return client, nil
-}
+	if len(os.Args) > 1 && os.Args[1] == "diagnose" {
+		os.Exit(runDiagnose(ctx, app, secretsManagerClient.Options(), format))
+	}
 
-func checkSecretExistence(ctx context.Context) error {
-	secret, err := secretsManagerClient.DescribeSecret(ctx, &secretsmanager.DescribeSecretInput{
-		SecretId: &secretsManagerSecretID,
-	})
-	if err != nil {
-		return errors.Wrap(err, "describe secret")
+	if len(os.Args) > 1 && os.Args[1] == "ceremony" {
+		os.Exit(runCeremony(ctx, app, viper.GetString("ceremony_file")))
 	}
 
-	slog.Debug("Secret exists", "arn", aws.ToString(secret.ARN))
-	return nil
-}
+	if len(os.Args) > 1 && os.Args[1] == "migrate-store" {
+		os.Exit(runMigrateStore(ctx, app, viper.GetString("migrate_source"), viper.GetString("migrate_gcp_kms_key"), format))
+	}
 
-// Check vault health status and initialize, join Raft cluster and unseal as needed.
-func checkVaultStatus(ctx context.Context) error {
-	slog.Debug("Checking vault status")
+	if len(os.Args) > 1 && os.Args[1] == "import" {
+		os.Exit(runImport(ctx, app, viper.GetString("import_file"), format))
+	}
 
-	healthResponse, err := vaultClient.Sys().Health()
-	if err != nil {
-		return errors.Wrap(err, "read health")
+	if len(os.Args) > 1 && os.Args[1] == "export" {
+		os.Exit(runExport(ctx, app, viper.GetString("export_recipient"), viper.GetString("export_file")))
+	}
+
+	if len(os.Args) > 1 && os.Args[1] == "verify-keys" {
+		os.Exit(runVerifyKeys(ctx, app, format))
+	}
+
+	if len(os.Args) > 1 && os.Args[1] == "transit-bootstrap" {
+		settings := transitSettings{
+			MountPath:       strings.Trim(viper.GetString("transit_mount_path"), "/"),
+			KeyName:         viper.GetString("transit_key_name"),
+			TokenSecretName: viper.GetString("transit_token_secret_name"),
+			TokenPeriod:     viper.GetDuration("transit_token_period"),
+		}
+		token, err := parseEnvFile(viper.GetString("transit_vault_token"))
+		if err != nil {
+			log.Fatalf("TRANSIT_VAULT_TOKEN env is invalid: %v", err)
+		}
+		token = strings.TrimSpace(token)
+		if viper.GetString("transit_vault_addr") == "" || token == "" || settings.KeyName == "" || settings.TokenSecretName == "" {
+			log.Fatal("TRANSIT_VAULT_ADDR, TRANSIT_VAULT_TOKEN, TRANSIT_KEY_NAME and TRANSIT_TOKEN_SECRET_NAME envs are required")
+		}
+		client, err := newHashiCorpVaultClient(cfg.SVIDSource, viper.GetString("transit_vault_addr"))
+		if err != nil {
+			log.Fatalf("TRANSIT_VAULT_ADDR env is invalid: %v", err)
+		}
+		client.SetToken(token)
+		os.Exit(runTransitBootstrap(ctx, app, client, settings, format))
 	}
 
-	slog.Debug("Got vault status", "data", healthResponse)
+	if len(os.Args) > 2 && os.Args[1] == "dr" && os.Args[2] == "restore" {
+		store, err := newSnapshotStore(ctx, kmsClient)
+		if err != nil {
+			log.Fatalf("Create snapshot store: %v", err)
+		}
+		os.Exit(runDRRestore(ctx, app, store, os.Getenv("VAULT_TOKEN"), flags.Force, format))
+	}
+
+	// Other key stores check their own backend.
+	if cfg.KeyStore == nil {
+		slog.Debug("Checking the secret exists", "secretID", cfg.SecretID)
+		err = app.CheckSecretExistence(ctx)
+		if errors.Is(err, ErrSecretMissing) && cfg.CreateSecret {
+			slog.Info("Secret is missing, creating it", "secretID", cfg.SecretID, "error", err)
+			err = app.CreateSecret(ctx)
+		}
+		if err != nil {
+			log.Fatalf("Checking secret existence: %v", err)
+		}
+
+		slog.Debug("Checking IAM permissions")
+		if err = app.Preflight(ctx); err != nil {
+			log.Fatalf("Checking IAM permissions: %v", err)
+		}
+	}
 
-	if healthResponse.Initialized && !healthResponse.Sealed {
-		slog.Debug("Nothing to do")
-		return nil
+	if err = app.ReplicateSecret(ctx); err != nil {
+		slog.Error("Replicating secret", "error", err)
+	}
+	if err = app.TagSecret(ctx); err != nil {
+		slog.Error("Tagging secret", "error", err)
+	}
+	if err = app.ConfigureRotation(ctx); err != nil {
+		slog.Error("Configuring secret rotation", "error", err)
+	}
+	if err = app.EnforceSecretKMSKey(ctx); err != nil {
+		slog.Error("Enforcing secret KMS key", "error", err)
 	}
 
-	if !healthResponse.Initialized {
-		var (
-			hostname = os.Getenv("HOSTNAME")
-			replica  = int(hostname[len(hostname)-1]) - 48
-		)
+	if addr := viper.GetString("metrics_addr"); addr != "" {
+		go serveMetrics(addr)
+	}
 
-		slog.Debug("Vault replica", "n", replica)
+	// Only the first replica verifies the snapshots, as they are the same for the whole cluster.
+	if addr := viper.GetString("snapshot_verify_addr"); addr != "" && cfg.Replica == 0 && viper.GetDuration("snapshot_verify_interval") > 0 {
+		store, err := newSnapshotStore(ctx, kmsClient)
+		if err != nil {
+			log.Fatalf("Create snapshot store: %v", err)
+		}
+		sentinel := viper.GetString("snapshot_verify_sentinel")
+		if sentinel == "" {
+			log.Fatal("SNAPSHOT_VERIFY_SENTINEL env is required with SNAPSHOT_VERIFY_ADDR")
+		}
+		client, err := newHashiCorpVaultClient(cfg.SVIDSource, addr)
+		if err != nil {
+			log.Fatalf("SNAPSHOT_VERIFY_ADDR env is invalid: %v", err)
+		}
+		go runSnapshotVerification(ctx, app, newVault(client), store, sentinel, os.Getenv("VAULT_TOKEN"), viper.GetDuration("snapshot_verify_interval"))
+	}
 
-		switch replica {
-		case 0:
-			err = initialize(ctx)
-			if err != nil {
-				return errors.Wrap(err, "initialize")
-			}
+	// Reconciles and actions triggered by SQS messages, the dashboard or the control API.
+	var events chan reconcileEvent
 
-		default:
-			err = joinRaftCluster(ctx)
-			if err != nil {
-				return errors.Wrap(err, "raft join")
-			}
+	var (
+		history = &checkHistory{}
+		paused  atomic.Bool
+	)
+	dashboardAddr := viper.GetString("dashboard_addr")
+	if dashboardAddr != "" {
+		token, err := parseEnvFile(viper.GetString("dashboard_token"))
+		if err != nil {
+			log.Fatalf("DASHBOARD_TOKEN env is invalid: %v", err)
+		}
+		if token == "" {
+			log.Fatal("DASHBOARD_TOKEN env is required with DASHBOARD_ADDR")
+		}
+		events = make(chan reconcileEvent)
+		go serveDashboard(dashboardAddr, newDashboard(os.Getenv("HOSTNAME"), strings.TrimSpace(token), history, events, &paused))
+	}
+	if addr := viper.GetString("control_api_addr"); addr != "" {
+		token, err := parseEnvFile(viper.GetString("control_api_token"))
+		if err != nil {
+			log.Fatalf("CONTROL_API_TOKEN env is invalid: %v", err)
+		}
+		if token == "" {
+			log.Fatal("CONTROL_API_TOKEN env is required with CONTROL_API_ADDR")
+		}
+		if events == nil {
+			events = make(chan reconcileEvent)
 		}
+		go serveControlAPI(addr, &controlAPI{token: strings.TrimSpace(token), history: history, events: events, paused: &paused})
 	}
 
-	if healthResponse.Sealed {
-		err = unseal(ctx)
+	slog.Debug("Starting Vault check routine...")
+
+	var (
+		checkTimeout  = viper.GetDuration("check_timeout")
+		checkInterval = viper.GetDuration("check_interval")
+		unavailable   = newCheckBackoff(checkInterval)
+	)
+	// Record the check, reading the Raft topology of unsealed nodes for the dashboard.
+	record := func(result *CheckResult, err error) {
+		history.record(result, err)
+		if dashboardAddr != "" && result != nil && (result.State == StateActive || result.State == StateStandby) {
+			history.recordTopology(app.RaftTopology(ctx))
+		}
+	}
+
+	result, err := checkVaultStatus(ctx, app, checkTimeout)
+	record(result, err)
+	if unavailable.record(err) != nil {
+		slog.Error("Checking Vault for the first time", "error", err)
+	}
+
+	// A nil channel never fires, which disables the periodic checks.
+	var ticks, secretCheck, keyCheck, rootTokenCheck <-chan time.Time
+	if checkInterval > 0 {
+		ticks = time.NewTicker(checkInterval).C
+	}
+	// Like at startup, other key stores check their own backend.
+	if interval := viper.GetDuration("secret_check_interval"); interval > 0 && cfg.KeyStore == nil {
+		secretCheck = time.NewTicker(interval).C
+	}
+	if interval := viper.GetDuration("key_check_interval"); interval > 0 {
+		keyCheck = time.NewTicker(interval).C
+	}
+	// Only the first replica, which writes the secret, checks the root token.
+	if interval := viper.GetDuration("root_token_check_interval"); interval > 0 && cfg.Replica == 0 {
+		rootTokenCheck = time.NewTicker(interval).C
+	}
+
+	if queueURL := viper.GetString("sqs_queue_url"); queueURL != "" {
+		sqsClient, err := newAWSSQSClient(ctx)
 		if err != nil {
-			return errors.Wrap(err, "unseal")
+			log.Fatalf("Create AWS SQS client: %v", err)
 		}
+
+		consumer := &sqsConsumer{
+			client:     sqsClient,
+			queueURL:   queueURL,
+			identities: []string{os.Getenv("HOSTNAME"), viper.GetString("sqs_target_id")},
+		}
+		if events == nil {
+			events = make(chan reconcileEvent)
+		}
+		go consumer.Run(ctx, events)
 	}
 
-	return nil
+	for {
+		select {
+		case t := <-ticks:
+			slog.Debug("Tick", "time", t)
+			if paused.Load() || unavailable.skip(t) {
+				continue
+			}
+			result, err := checkVaultStatus(ctx, app, checkTimeout)
+			record(result, err)
+			if unavailable.record(err) != nil {
+				slog.Error("Checking Vault", "error", err)
+			}
+
+		case event := <-events:
+			slog.Debug("Reconcile event", "target", event.Target, "manual", event.Manual)
+			if paused.Load() && !event.Manual {
+				// Dropped rather than released, which would redeliver it right away. The periodic checks
+				// catch up once resumed.
+				event.Done(nil)
+				continue
+			}
+			switch event.Action {
+			case actionSnapshot:
+				_, err := app.TakeSnapshot(ctx)
+				if err != nil {
+					slog.Error("Taking snapshot", "error", err)
+				}
+				event.Done(err)
+				continue
+			case actionUnseal:
+				_, err := app.UnsealNow(ctx)
+				if err != nil {
+					slog.Error("Unsealing", "error", err)
+				}
+				event.Done(err)
+				continue
+			}
+			result, err := checkVaultStatus(ctx, app, checkTimeout)
+			record(result, err)
+			if unavailable.record(err) != nil {
+				slog.Error("Checking Vault", "error", err)
+			}
+			event.Done(err)
+
+		case <-secretCheck:
+			slog.Debug("Re-verifying the secret", "secretID", cfg.SecretID)
+			if err := app.CheckSecretAccess(ctx); err != nil {
+				alert(ctx, "Secret verification failed, Vault cannot be unsealed until it is fixed", "secretID", cfg.SecretID, "error", err)
+			}
+
+		case <-keyCheck:
+			slog.Debug("Verifying the stored keys")
+			_, err := app.VerifyKeys(ctx)
+			switch {
+			case errors.Is(err, ErrKeysInvalid):
+				alert(ctx, "The stored keys cannot unseal Vault, fix them before Vault is sealed", "secretID", cfg.SecretID, "error", err)
+			case errors.Is(err, ErrSecretMissing):
+				slog.Debug("No stored keys to verify yet", "error", err)
+			case err != nil:
+				slog.Error("Verifying stored keys", "error", err)
+			}
+
+		case <-rootTokenCheck:
+			slog.Debug("Checking the stored root token")
+			if err := app.CheckRootToken(ctx); err != nil {
+				slog.Error("Checking root token", "error", err)
+			}
+		}
+	}
 }
 
-// Initialize vault server and save generated keys in AWS Secrets Manager secret.
-// The initialization process is just executed for the first replica of the statefulset,
-// where the hostname ends with a 0.
-func initialize(ctx context.Context) error {
-	slog.Info("Initializing vault server...")
+// Check Vault status with a deadline for the whole iteration, so a hung call doesn't block the loop.
+// A timeout of 0 disables the deadline.
+func checkVaultStatus(ctx context.Context, app *App, timeout time.Duration) (*CheckResult, error) {
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+	return app.CheckVaultStatus(ctx)
+}
 
-	initResponse, err := vaultClient.Sys().InitWithContext(ctx, &api.InitRequest{
-		SecretShares:    viper.GetInt("vault_secret_shares"),
-		SecretThreshold: viper.GetInt("vault_secret_threshold"),
-	})
+// Read the App configuration from the environment.
+func loadConfig() (Config, error) {
+	tags, err := parseKeyValues(viper.GetString("secretsmanager_tags"))
 	if err != nil {
-		return errors.Wrap(err, "init vault")
+		return Config{}, fmt.Errorf("SECRETSMANAGER_TAGS env is invalid: %w", err)
+	}
+
+	if viper.GetString("secretsmanager_rotation_lambda") != "" && viper.GetString("secretsmanager_rotation_schedule") == "" {
+		return Config{}, fmt.Errorf("SECRETSMANAGER_ROTATION_SCHEDULE env is required with SECRETSMANAGER_ROTATION_LAMBDA")
+	}
+
+	if viper.GetString("root_token_secret_name") != "" && viper.GetString("root_token_break_glass_role_arn") == "" {
+		return Config{}, fmt.Errorf("ROOT_TOKEN_BREAK_GLASS_ROLE_ARN env is required with ROOT_TOKEN_SECRET_NAME")
+	}
+	if viper.GetString("root_token_secret_name") != "" && viper.GetString("root_token_writer_role_arn") == "" {
+		return Config{}, fmt.Errorf("ROOT_TOKEN_WRITER_ROLE_ARN env is required with ROOT_TOKEN_SECRET_NAME")
 	}
 
-	slog.Info("Vault server initialized successfully, uploading result to AWS...", "secretID", secretsManagerSecretID)
+	var bootstrapSteps []BootstrapStep
+	if path := viper.GetString("bootstrap_file"); path != "" {
+		if bootstrapSteps, err = loadBootstrapSteps(path); err != nil {
+			return Config{}, fmt.Errorf("BOOTSTRAP_FILE env is invalid: %w", err)
+		}
+	}
+	var desiredState *DesiredState
+	if path := viper.GetString("desired_state_file"); path != "" {
+		if desiredState, err = loadDesiredState(path); err != nil {
+			return Config{}, fmt.Errorf("DESIRED_STATE_FILE env is invalid: %w", err)
+		}
+	}
 
-	data, err := json.Marshal(&initResponse)
+	bootstrapPolicy, err := parseEnvFile(viper.GetString("bootstrap_policy"))
 	if err != nil {
-		panic("couldn't marshal init response:" + err.Error())
+		return Config{}, fmt.Errorf("BOOTSTRAP_POLICY env is invalid: %w", err)
+	}
+	if err := validateBootstrap(bootstrapSteps, bootstrapPolicy, viper.GetDuration("bootstrap_token_ttl")); err != nil {
+		return Config{}, err
 	}
 
-	secretString := string(data)
+	keyStore, err := newKeyStore(secretBackend())
+	if err != nil {
+		return Config{}, fmt.Errorf("SECRET_BACKEND env is invalid: %w", err)
+	}
+	rootTokenPolicy, err := parseRootTokenPolicy(viper.GetString("root_token_policy"))
+	if err != nil {
+		return Config{}, fmt.Errorf("ROOT_TOKEN_POLICY env is invalid: %w", err)
+	}
 
-	for {
-		output, err := secretsManagerClient.UpdateSecret(ctx, &secretsmanager.UpdateSecretInput{
-			SecretId:     &secretsManagerSecretID,
-			SecretString: &secretString,
-		})
-		if err == nil {
-			slog.Info("Updated secret", "arn", *output.ARN, "version", *output.VersionId)
-			break
+	shareSecrets, err := parseShareSecrets(viper.GetString("share_secrets"))
+	if err != nil {
+		return Config{}, fmt.Errorf("SHARE_SECRETS env is invalid: %w", err)
+	}
+	if len(shareSecrets) > 0 && (viper.GetInt("vault_secret_shares") != len(shareSecrets) || viper.GetInt("vault_secret_threshold") < 2) {
+		return Config{}, fmt.Errorf("SHARE_SECRETS env lists %d secrets, VAULT_SECRET_SHARES must match it, and VAULT_SECRET_THRESHOLD be 2 or more", len(shareSecrets))
+	}
+
+	recipients, err := parseEnvFile(viper.GetString("payload_age_recipients"))
+	if err != nil {
+		return Config{}, fmt.Errorf("PAYLOAD_AGE_RECIPIENTS env is invalid: %w", err)
+	}
+	payloadRecipients, payloadIdentities, err := parsePayloadAge(recipients, viper.GetString("payload_age_identity_file"))
+	if err != nil {
+		return Config{}, err
+	}
+
+	if viper.GetString("fallback_file") != "" && len(payloadRecipients) == 0 && viper.GetString("envelope_kms_key_id") == "" {
+		return Config{}, errors.New("FALLBACK_FILE env requires PAYLOAD_AGE_RECIPIENTS or ENVELOPE_KMS_KEY_ID, so the init response is not persisted in plaintext")
+	}
+
+	// The s3 backend keeps the layout of the upstream projects, which store the bare init response.
+	schema := viper.GetInt("payload_schema")
+	if !viper.IsSet("payload_schema") && secretBackend() == "s3" {
+		schema = 1
+	}
+	if schema, err = parsePayloadSchema(schema); err != nil {
+		return Config{}, err
+	}
+
+	secretPolicy, err := parseEnvFile(viper.GetString("secretsmanager_resource_policy"))
+	if err != nil {
+		return Config{}, fmt.Errorf("SECRETSMANAGER_RESOURCE_POLICY env is invalid: %w", err)
+	}
+	secretPolicy, err = parseSecretResourcePolicy(secretPolicy)
+	if err != nil {
+		return Config{}, err
+	}
+
+	if viper.GetBool("secretsmanager_secret_gzip") && !viper.GetBool("secretsmanager_secret_binary") {
+		return Config{}, errors.New("SECRETSMANAGER_SECRET_GZIP env requires SECRETSMANAGER_SECRET_BINARY=true, as compressed values are binary")
+	}
+
+	keyStoreMirrors, err := newKeyStoreMirrors(secretBackend(), viper.GetString("secret_backend_mirrors"))
+	if err != nil {
+		return Config{}, fmt.Errorf("SECRET_BACKEND_MIRRORS env is invalid: %w", err)
+	}
+	for _, mirror := range keyStoreMirrors {
+		if mirror.store == nil && viper.GetString("secretsmanager_secret_id") == "" {
+			return Config{}, errors.New("SECRETSMANAGER_SECRET_ID env is required to mirror to the secretsmanager backend")
 		}
-		slog.Error("Cannot update secret", "error", err)
-		time.Sleep(3 * time.Second)
 	}
 
-	slog.Info("Initialization process completed")
-	return nil
+	return Config{
+		SecretID:               viper.GetString("secretsmanager_secret_id"),
+		KeyStore:               keyStore,
+		KeyStoreMirrors:        keyStoreMirrors,
+		ShareSecrets:           shareSecrets,
+		StatusSecretName:       viper.GetString("status_secret_name"),
+		ReplicaRegions:         parseReplicaRegions(viper.GetString("secretsmanager_replica_regions")),
+		Tags:                   tags,
+		RotationLambdaARN:      viper.GetString("secretsmanager_rotation_lambda"),
+		RotationSchedule:       viper.GetString("secretsmanager_rotation_schedule"),
+		SecretVersionID:        viper.GetString("secretsmanager_version_id"),
+		SecretVersionStage:     viper.GetString("secretsmanager_version_stage"),
+		RootTokenSecretName:    viper.GetString("root_token_secret_name"),
+		RootTokenRoleARN:       viper.GetString("root_token_break_glass_role_arn"),
+		RootTokenWriterRoleARN: viper.GetString("root_token_writer_role_arn"),
+		RootTokenMaxAge:        viper.GetDuration("root_token_max_age"),
+		RootTokenPolicy:        rootTokenPolicy,
+		SSMParameterName:       viper.GetString("ssm_parameter_name"),
+		SecretKMSKeyID:         viper.GetString("secretsmanager_kms_key_id"),
+		EnforceSecretKMSKey:    viper.GetBool("secretsmanager_enforce_kms_key"),
+		CreateSecret:           viper.GetBool("secretsmanager_create_secret"),
+		SecretResourcePolicy:   secretPolicy,
+		SecretBinary:           viper.GetBool("secretsmanager_secret_binary"),
+		CompressSecret:         viper.GetBool("secretsmanager_secret_gzip"),
+		EnvelopeKMSKeyID:       viper.GetString("envelope_kms_key_id"),
+		PayloadAgeRecipients:   payloadRecipients,
+		PayloadAgeIdentities:   payloadIdentities,
+		PayloadSchema:          schema,
+		SealKMSKeyID:           viper.GetString("vault_awskms_seal_key_id"),
+		SealMigrate:            viper.GetBool("vault_seal_migrate"),
+		AllowPlaintext:         viper.GetBool("vault_allow_plaintext"),
+		WriteEscalateAfter:     viper.GetDuration("write_retry_max_duration"),
+		FallbackFile:           viper.GetString("fallback_file"),
+		ForceOverwrite:         viper.GetBool("force_overwrite"),
+		SecretMetadataTTL:      viper.GetDuration("secret_metadata_cache_ttl"),
+		BootstrapSteps:         bootstrapSteps,
+		BootstrapPolicy:        bootstrapPolicy,
+		BootstrapTokenTTL:      viper.GetDuration("bootstrap_token_ttl"),
+		DesiredState:           desiredState,
+		VaultToken:             os.Getenv("VAULT_TOKEN"),
+		VaultAgent:             os.Getenv("VAULT_AGENT_ADDR") != "",
+		SecretShares:           viper.GetInt("vault_secret_shares"),
+		SecretThreshold:        viper.GetInt("vault_secret_threshold"),
+		RecoveryShares:         viper.GetInt("vault_recovery_shares"),
+		RecoveryThreshold:      viper.GetInt("vault_recovery_threshold"),
+		Replica:                replicaOrdinal(os.Getenv("HOSTNAME")),
+		RaftLeaderAPIAddr:      viper.GetString("raft_leader_api_addr"),
+		RaftLeaderCACert:       viper.GetString("raft_leader_ca_cert"),
+		RaftLeaderClientCert:   viper.GetString("raft_leader_client_cert"),
+		RaftLeaderClientKey:    viper.GetString("raft_leader_client_key"),
+	}, nil
 }
 
-// Join Raft cluster contacting leader, used to bootstrap follower replicas.
-func joinRaftCluster(ctx context.Context) error {
-	slog.Info("Joining RAFT cluster...")
+// Create API client for HashiCorp Vault.
+// The HashiCorp Vault API client can be configured using environment variables. See:
+// - https://developer.hashicorp.com/vault/docs/commands#environment-variables
+// - https://pkg.go.dev/github.com/hashicorp/vault/api#Config.ReadEnvironment
+//
+// The TLS settings may also be set with the VAULT_API_* variables, which take precedence.
+//
+// The address, if set, replaces VAULT_ADDR. Each client has its own transport, so the server certificate is
+// verified for the host of its own address.
+func newHashiCorpVaultClient(svidSource x509svid.Source, address string) (*api.Client, error) {
+	config := api.DefaultConfig()
+
+	if err := config.ReadEnvironment(); err != nil {
+		return nil, fmt.Errorf("failed to read environment: %w", err)
+	}
+	if address != "" {
+		config.Address = address
+	}
+
+	// No retries by default, as the status checks are retried every CHECK_INTERVAL anyway.
+	config.MaxRetries = viper.GetInt("vault_api_max_retries")
+	if wait := viper.GetDuration("vault_api_min_retry_wait"); wait > 0 {
+		config.MinRetryWait = wait
+	}
+	if wait := viper.GetDuration("vault_api_max_retry_wait"); wait > 0 {
+		config.MaxRetryWait = wait
+	}
+	if timeout := viper.GetDuration("vault_api_timeout"); timeout > 0 {
+		config.Timeout = timeout
+		config.HttpClient.Timeout = timeout
+	}
+
+	tlsConfig := vaultTLSConfig{
+		CACert:     viper.GetString("vault_api_ca_cert"),
+		ClientCert: viper.GetString("vault_api_client_cert"),
+		ClientKey:  viper.GetString("vault_api_client_key"),
+		ServerName: viper.GetString("vault_api_tls_server_name"),
+		Host:       vaultHost(config.Address),
 
-	opts := api.RaftJoinRequest{
-		LeaderAPIAddr:    viper.GetString("raft_leader_api_addr"),
-		LeaderCACert:     parseEnvFile(viper.GetString("raft_leader_ca_cert")),
-		LeaderClientCert: parseEnvFile(viper.GetString("raft_leader_client_cert")),
-		LeaderClientKey:  parseEnvFile(viper.GetString("raft_leader_client_key")),
+		AllowedNames: parseList(viper.GetString("vault_api_tls_allowed_names")),
+		SkipVerify:   viper.GetBool("vault_api_tls_skip_verify"),
+		SVIDSource:   svidSource,
+	}
+	if err := tlsConfig.apply(config.HttpClient.Transport.(*http.Transport)); err != nil {
+		return nil, fmt.Errorf("failed to configure TLS: %w", err)
 	}
 
-	res, err := vaultClient.Sys().RaftJoinWithContext(ctx, &opts)
+	if raw := viper.GetString("vault_api_proxy_url"); raw != "" {
+		proxy, err := parseProxy(raw)
+		if err != nil {
+			return nil, fmt.Errorf("VAULT_API_PROXY_URL env is invalid: %w", err)
+		}
+		config.HttpClient.Transport.(*http.Transport).Proxy = proxy
+	}
+
+	socket := viper.GetString("vault_api_socket")
+	if socket == "" && strings.HasPrefix(config.Address, "unix://") {
+		socket = strings.TrimPrefix(config.Address, "unix://")
+	}
+
+	client, err := api.NewClient(config)
 	if err != nil {
-		return err
+		return nil, fmt.Errorf("failed to create client: %w", err)
 	}
-	if !res.Joined {
-		return errors.Errorf("couldn't join with opts: %#v", opts)
+
+	// Replaces the dialer the Vault API sets up for unix:// addresses, which ignores contexts.
+	if socket != "" {
+		slog.Debug("Connecting to Vault through unix socket", "path", socket)
+		config.HttpClient.Transport.(*http.Transport).DialContext = dialUnix(socket)
+	}
+
+	return client, nil
+}
+
+// Returns a dialer connecting to the unix socket whatever the address requested.
+func dialUnix(socket string) func(ctx context.Context, network, addr string) (net.Conn, error) {
+	var dialer net.Dialer
+	return func(ctx context.Context, _, _ string) (net.Conn, error) {
+		return dialer.DialContext(ctx, "unix", socket)
 	}
+}
 
-	slog.Info("Joined RAFT cluster successfully")
-	return nil
+// Returns the statefulset replica ordinal from the last digit of the hostname, or -1 if there is none.
+func replicaOrdinal(hostname string) int {
+	if hostname == "" {
+		return -1
+	}
+	return int(hostname[len(hostname)-1]) - 48
 }
 
-// Fetch unseal keys from AWS Secrets Manager secret and unseal Vault server.
-func unseal(ctx context.Context) error {
-	slog.Info("Fetching unseal keys...", "secretID", secretsManagerSecretID)
+// Parses a log level by name (`debug`, `info`, `warn`, `error`, optionally with an offset such as `warn+2`)
+// or as a raw slog integer level (e.g. `-4`).
+func parseLogLevel(raw string) (slog.Level, error) {
+	if n, err := strconv.Atoi(raw); err == nil {
+		return slog.Level(n), nil
+	}
 
-	secret, err := secretsManagerClient.GetSecretValue(ctx, &secretsmanager.GetSecretValueInput{
-		SecretId: &secretsManagerSecretID,
-	})
-	if err != nil {
-		return errors.Wrap(err, "get AWS secret")
+	var level slog.Level
+	if err := level.UnmarshalText([]byte(raw)); err != nil {
+		return 0, fmt.Errorf("parse log level %q: %w", raw, err)
 	}
+	return level, nil
+}
 
-	var initResponse api.InitResponse
+// Parses comma-separated values, skipping empty ones.
+func parseList(raw string) []string {
+	var values []string
 
-	err = json.Unmarshal([]byte(*secret.SecretString), &initResponse)
-	if err != nil {
-		return errors.Wrap(err, "unmarshal")
+	for _, value := range strings.Split(raw, ",") {
+		if value = strings.TrimSpace(value); value != "" {
+			values = append(values, value)
+		}
 	}
+	return values
+}
 
-	slog.Info("Unseal keys received, unsealing vault server...")
+// Parses comma-separated `key=value` pairs.
+func parseKeyValues(raw string) (map[string]string, error) {
+	values := make(map[string]string)
 
-	for i, key := range initResponse.KeysB64 {
-		status, err := vaultClient.Sys().UnsealWithContext(ctx, key)
-		if err != nil {
-			return errors.Wrapf(err, "unseal shard %d", i)
+	for _, pair := range strings.Split(raw, ",") {
+		if strings.TrimSpace(pair) == "" {
+			continue
 		}
-		slog.Info("Unseal", "progress", status.Progress)
-		if status.Progress <= 0 {
-			break
+		key, value, ok := strings.Cut(pair, "=")
+		if !ok || strings.TrimSpace(key) == "" {
+			return nil, fmt.Errorf("invalid key-value pair %q", pair)
 		}
+		values[strings.TrimSpace(key)] = strings.TrimSpace(value)
 	}
+	return values, nil
+}
 
-	slog.Info("Vault server unsealed successfully")
-	return nil
+// Returns the SECRET_BACKEND env, defaulting to the plugin backend if KEY_STORE_PLUGIN is set, as it selected
+// it before backends were.
+func secretBackend() string {
+	if backend := viper.GetString("secret_backend"); backend != "" {
+		return backend
+	}
+	if viper.GetString("key_store_plugin") != "" {
+		return "plugin"
+	}
+	return secretsManagerBackend
 }
 
 // Returns file contents if raw string is in format `@<file-path>`.
-func parseEnvFile(raw string) string {
+func parseEnvFile(raw string) (string, error) {
 	if len(raw) == 0 || raw[0] != '@' {
-		return raw
+		return raw, nil
 	}
 
 	contents, err := os.ReadFile(raw[1:])
 	if err != nil {
-		panic(err)
+		return "", err
 	}
-	return string(contents)
+	return string(contents), nil
 }
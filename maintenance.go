@@ -0,0 +1,144 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// A recurring time window in which disruptive operations are allowed.
+// End may be before start, in which case the window spans midnight.
+type maintenanceWindow struct {
+	days       [7]bool
+	start, end time.Duration
+}
+
+var weekdays = map[string]time.Weekday{
+	"sun": time.Sunday,
+	"mon": time.Monday,
+	"tue": time.Tuesday,
+	"wed": time.Wednesday,
+	"thu": time.Thursday,
+	"fri": time.Friday,
+	"sat": time.Saturday,
+}
+
+// Parses maintenance windows in the format `<days> <HH:MM>-<HH:MM>`, separated by semicolons.
+// Days are a comma-separated list of weekdays or weekday ranges (e.g. `Mon-Fri,Sun`), or `*` for every day.
+func parseMaintenanceWindows(raw string) ([]maintenanceWindow, error) {
+	var windows []maintenanceWindow
+
+	for _, spec := range strings.Split(raw, ";") {
+		spec = strings.TrimSpace(spec)
+		if spec == "" {
+			continue
+		}
+
+		// Days may be separated by spaces too, e.g. `Sat, Sun`, so the hours follow the last one.
+		split := strings.LastIndexByte(spec, ' ')
+		if split < 0 {
+			return nil, fmt.Errorf("window %q: expected `<days> <HH:MM>-<HH:MM>`", spec)
+		}
+		days, hours := spec[:split], spec[split+1:]
+
+		var (
+			window maintenanceWindow
+			err    error
+		)
+
+		if err = parseWeekdays(strings.TrimSpace(days), &window.days); err != nil {
+			return nil, fmt.Errorf("window %q: %w", spec, err)
+		}
+
+		start, end, ok := strings.Cut(strings.TrimSpace(hours), "-")
+		if !ok {
+			return nil, fmt.Errorf("window %q: expected `<HH:MM>-<HH:MM>`", spec)
+		}
+		if window.start, err = parseTimeOfDay(start); err != nil {
+			return nil, fmt.Errorf("window %q: %w", spec, err)
+		}
+		if window.end, err = parseTimeOfDay(end); err != nil {
+			return nil, fmt.Errorf("window %q: %w", spec, err)
+		}
+
+		windows = append(windows, window)
+	}
+
+	return windows, nil
+}
+
+func parseWeekdays(raw string, days *[7]bool) error {
+	if raw == "*" {
+		for i := range days {
+			days[i] = true
+		}
+		return nil
+	}
+
+	for _, item := range strings.Split(raw, ",") {
+		first, last, isRange := strings.Cut(strings.ToLower(strings.TrimSpace(item)), "-")
+		if !isRange {
+			last = first
+		}
+		first, last = strings.TrimSpace(first), strings.TrimSpace(last)
+
+		from, ok := weekdays[first]
+		if !ok {
+			return fmt.Errorf("unknown weekday %q", first)
+		}
+		to, ok := weekdays[last]
+		if !ok {
+			return fmt.Errorf("unknown weekday %q", last)
+		}
+
+		for d := from; ; d = (d + 1) % 7 {
+			days[d] = true
+			if d == to {
+				break
+			}
+		}
+	}
+	return nil
+}
+
+func parseTimeOfDay(raw string) (time.Duration, error) {
+	t, err := time.Parse("15:04", raw)
+	if err != nil {
+		return 0, fmt.Errorf("invalid time of day %q", raw)
+	}
+	return time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute, nil
+}
+
+// Reports whether the time falls within the window.
+// For windows spanning midnight, the part after midnight belongs to the previous day.
+func (w maintenanceWindow) contains(t time.Time) bool {
+	var (
+		day    = t.Weekday()
+		offset = time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute
+	)
+
+	if w.start <= w.end {
+		return w.days[day] && offset >= w.start && offset < w.end
+	}
+
+	yesterday := (day + 6) % 7
+	return (w.days[day] && offset >= w.start) || (w.days[yesterday] && offset < w.end)
+}
+
+// Check that a disruptive operation is allowed to run at the given time.
+// When no maintenance windows are configured, disruptive operations are always allowed.
+// Initialization, Raft join and unseal are never subject to maintenance windows, unlike seal migrations,
+// Raft snapshots and DR restores.
+func checkMaintenanceWindow(operation string, now time.Time) error {
+	if len(maintenanceWindows) == 0 {
+		return nil
+	}
+
+	now = now.In(maintenanceLocation)
+	for _, window := range maintenanceWindows {
+		if window.contains(now) {
+			return nil
+		}
+	}
+	return fmt.Errorf("%w: %s", ErrOutsideMaintenanceWindow, operation)
+}
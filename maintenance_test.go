@@ -0,0 +1,149 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+)
+
+// Configure a maintenance window open on no day, restored at the end of the test.
+func closeMaintenanceWindows(t *testing.T) {
+	t.Helper()
+	windows := maintenanceWindows
+	t.Cleanup(func() { maintenanceWindows = windows })
+	maintenanceWindows = []maintenanceWindow{{}}
+}
+
+func TestParseMaintenanceWindows(t *testing.T) {
+	tests := map[string]struct {
+		raw     string
+		days    []time.Weekday
+		start   time.Duration
+		end     time.Duration
+		invalid bool
+	}{
+		"single day":       {raw: "Sat 02:00-06:00", days: []time.Weekday{time.Saturday}, start: 2 * time.Hour, end: 6 * time.Hour},
+		"days list":        {raw: "Sat,Sun 02:00-06:00", days: []time.Weekday{time.Saturday, time.Sunday}, start: 2 * time.Hour, end: 6 * time.Hour},
+		"spaced days list": {raw: " Sat, Sun 02:00-06:00 ;", days: []time.Weekday{time.Saturday, time.Sunday}, start: 2 * time.Hour, end: 6 * time.Hour},
+		"range":            {raw: "Mon-Wed 09:30-10:00", days: []time.Weekday{time.Monday, time.Tuesday, time.Wednesday}, start: 9*time.Hour + 30*time.Minute, end: 10 * time.Hour},
+		"wrapping range":   {raw: "fri-mon 23:00-01:00", days: []time.Weekday{time.Friday, time.Saturday, time.Sunday, time.Monday}, start: 23 * time.Hour, end: time.Hour},
+		"every day":        {raw: "* 00:00-23:59", days: []time.Weekday{0, 1, 2, 3, 4, 5, 6}, end: 23*time.Hour + 59*time.Minute},
+		"unknown day":      {raw: "Someday 02:00-06:00", invalid: true},
+		"no hours":         {raw: "Sat", invalid: true},
+		"no end":           {raw: "Sat 02:00", invalid: true},
+		"bad time":         {raw: "Sat 2am-6am", invalid: true},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			windows, err := parseMaintenanceWindows(tt.raw)
+			if tt.invalid {
+				if err == nil {
+					t.Fatalf("expected an error, got %+v", windows)
+				}
+				return
+			}
+			if err != nil || len(windows) != 1 {
+				t.Fatalf("expected one window, got %+v: %v", windows, err)
+			}
+
+			var days [7]bool
+			for _, day := range tt.days {
+				days[day] = true
+			}
+			if want := (maintenanceWindow{days: days, start: tt.start, end: tt.end}); windows[0] != want {
+				t.Fatalf("expected %+v, got %+v", want, windows[0])
+			}
+		})
+	}
+}
+
+func TestMaintenanceWindowContains(t *testing.T) {
+	windows, err := parseMaintenanceWindows("Sat,Sun 02:00-06:00; Mon-Fri 23:00-01:00")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// October 17, 2026 is a Saturday.
+	at := func(day, hour, minute int) time.Time {
+		return time.Date(2026, time.October, day, hour, minute, 0, 0, time.UTC)
+	}
+	tests := map[string]struct {
+		time time.Time
+		want bool
+	}{
+		"weekend start":            {time: at(17, 2, 0), want: true},
+		"weekend before end":       {time: at(18, 5, 59), want: true},
+		"weekend end":              {time: at(18, 6, 0), want: false},
+		"weekend before start":     {time: at(17, 1, 59), want: false},
+		"weekday before midnight":  {time: at(16, 23, 30), want: true},
+		"weekday after midnight":   {time: at(20, 0, 30), want: true},
+		"friday night on saturday": {time: at(17, 0, 30), want: true},
+		"sunday night on monday":   {time: at(19, 0, 30), want: false},
+		"weekday end":              {time: at(20, 1, 0), want: false},
+		"weekday afternoon":        {time: at(21, 15, 0), want: false},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			got := windows[0].contains(tt.time) || windows[1].contains(tt.time)
+			if got != tt.want {
+				t.Fatalf("expected %s within the windows: %t, got %t", tt.time.Format(time.RFC1123), tt.want, got)
+			}
+		})
+	}
+}
+
+func TestSealMigrationWaitsForMaintenanceWindow(t *testing.T) {
+	app, vault, _ := newTestApp(0)
+	if _, err := app.CheckVaultStatus(context.Background()); err != nil {
+		t.Fatalf("initialize: %v", err)
+	}
+	closeMaintenanceWindows(t)
+
+	vault.sealed, vault.migration = true, true
+	app.config.SealMigrate = true
+	result, err := app.CheckVaultStatus(context.Background())
+	if err != nil {
+		t.Fatalf("check status: %v", err)
+	}
+	if result.Unseal != nil || !vault.sealed {
+		t.Fatalf("expected the seal migration left for a maintenance window, got %+v", result.Unseal)
+	}
+
+	// Unsealing without migrating is not disruptive.
+	vault.migration = false
+	if _, err := app.CheckVaultStatus(context.Background()); err != nil || vault.sealed {
+		t.Fatalf("expected Vault unsealed, got %v", err)
+	}
+}
+
+func TestSnapshotWaitsForMaintenanceWindow(t *testing.T) {
+	closeMaintenanceWindows(t)
+	app, _, _ := newTestApp(0)
+	app.config.SnapshotStore = &snapshotStore{
+		client: &fakeS3{objects: []types.Object{
+			{Key: aws.String("vault/1.snap"), LastModified: aws.Time(time.Now().Add(-48 * time.Hour))},
+		}},
+		bucket: "backups",
+		prefix: "vault/",
+	}
+
+	// No client, as no snapshot must be taken.
+	status := app.convergeSnapshots(context.Background(), nil, &SnapshotSpec{Every: "24h", interval: 24 * time.Hour})
+	if status.Condition != SpecConverging {
+		t.Fatalf("expected the snapshot left for a maintenance window, got %+v", status)
+	}
+}
+
+func TestCheckMaintenanceWindow(t *testing.T) {
+	if err := checkMaintenanceWindow("test", time.Now()); err != nil {
+		t.Fatalf("expected operations allowed without windows, got %v", err)
+	}
+	closeMaintenanceWindows(t)
+	if err := checkMaintenanceWindow("test", time.Now()); !errors.Is(err, ErrOutsideMaintenanceWindow) {
+		t.Fatalf("expected the operation refused, got %v", err)
+	}
+}
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/service/secretsmanager"
+)
+
+// Cache of the secret metadata, so repeated checks don't describe the secret on every call.
+// Errors are never cached.
+type secretMetadataCache struct {
+	mu        sync.Mutex
+	secret    *secretsmanager.DescribeSecretOutput
+	fetchedAt time.Time
+}
+
+// Describe the secret, reusing the cached metadata if it is younger than the configured TTL,
+// unless refresh is set.
+func (a *App) describeSecret(ctx context.Context, refresh bool) (*secretsmanager.DescribeSecretOutput, error) {
+	a.metadata.mu.Lock()
+	defer a.metadata.mu.Unlock()
+
+	if !refresh && a.metadata.secret != nil && time.Since(a.metadata.fetchedAt) < a.config.SecretMetadataTTL {
+		return a.metadata.secret, nil
+	}
+
+	secret, err := a.secretsManager.DescribeSecret(ctx, &secretsmanager.DescribeSecretInput{
+		SecretId: &a.config.SecretID,
+	})
+	if err != nil {
+		a.metadata.secret = nil
+		return nil, err
+	}
+
+	slog.Debug("Described secret", "refresh", refresh)
+	a.metadata.secret = secret
+	a.metadata.fetchedAt = time.Now()
+	return secret, nil
+}
+
+// Drop the cached metadata after changing it.
+func (a *App) invalidateSecretMetadata() {
+	a.metadata.mu.Lock()
+	defer a.metadata.mu.Unlock()
+
+	a.metadata.secret = nil
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"errors"
+	"log/slog"
+	"net/http"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+var (
+	stateGauge = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "vault_init_state",
+		Help: "State of the Vault node observed by the last status check, 1 for the current state.",
+	}, []string{"cluster", "state"})
+
+	actionsCounter = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "vault_init_actions_total",
+		Help: "Actions taken on the Vault node by outcome.",
+	}, []string{"cluster", "action", "outcome"})
+
+	sharesCounter = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "vault_init_unseal_shares_accepted_total",
+		Help: "Unseal key shares accepted by Vault, by index in the stored init response.",
+	}, []string{"cluster", "share"})
+)
+
+// Metrics are labeled with the cluster name, empty unless several clusters are managed.
+func init() {
+	prometheus.MustRegister(stateGauge, actionsCounter, sharesCounter)
+}
+
+func recordState(cluster string, state VaultState) {
+	for _, s := range vaultStates {
+		value := 0.0
+		if s == state {
+			value = 1
+		}
+		stateGauge.WithLabelValues(cluster, string(s)).Set(value)
+	}
+}
+
+// Count an action and pass its error through.
+func recordAction(cluster, action string, err error) error {
+	outcome := "success"
+	if err != nil {
+		outcome = "failure"
+	}
+	actionsCounter.WithLabelValues(cluster, action, outcome).Inc()
+	return err
+}
+
+// Serve Prometheus metrics on /metrics. Runs until the server fails.
+func serveMetrics(addr string) {
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", promhttp.Handler())
+
+	slog.Info("Serving metrics", "addr", addr)
+	if err := http.ListenAndServe(addr, mux); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		slog.Error("Serving metrics", "error", err)
+	}
+}
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/secretsmanager"
+)
+
+// Prefixes of the migration sources read from SSM and from a GCS bucket.
+const (
+	migrationSSMPrefix = "ssm:"
+	migrationGCSPrefix = "gcs:"
+)
+
+// Migrate an init response kept by another store into the secret, e.g. the unseal keys of the original
+// vault-init in its GCS bucket, decrypted with the gcpKMSKey Cloud KMS key. The init response is imported
+// like with Import, then, if Vault is sealed, proven by unsealing it with the stored keys, read back like
+// the replicas do.
+func (a *App) MigrateStore(ctx context.Context, source, gcpKMSKey string) (*KeyCheckResult, error) {
+	secretString, err := a.readMigrationSource(ctx, source, gcpKMSKey)
+	if err != nil {
+		return nil, fmt.Errorf("read %s: %w", source, err)
+	}
+	result, err := a.Import(ctx, secretString)
+	if err != nil {
+		return result, err
+	}
+
+	status, err := a.vault.SealStatus(ctx)
+	switch {
+	case err != nil:
+		return result, fmt.Errorf("read seal status to check the migrated keys: %w", err)
+	case !status.Initialized:
+		slog.Warn("Vault is not initialized, the migrated keys are not checked by unsealing it")
+	case !status.Sealed:
+		slog.Info("Vault is already unsealed, the migrated keys were only checked against its seal status")
+	case result.Recovery:
+		slog.Info("Vault uses an auto-unseal seal, the migrated recovery keys were only checked against its seal status")
+	default:
+		if _, err := a.Unseal(ctx, false); err != nil {
+			return result, fmt.Errorf("unseal with the migrated keys: %w", err)
+		}
+		result.Unsealed = true
+	}
+	return result, nil
+}
+
+// Read the init response JSON from the source: a file path, `-` for stdin, a Secrets Manager secret name
+// prefixed with `secretsmanager:`, an SSM parameter name prefixed with `ssm:`, or a GCS bucket of the
+// original vault-init prefixed with `gcs:`.
+func (a *App) readMigrationSource(ctx context.Context, source, gcpKMSKey string) (string, error) {
+	if source == "-" {
+		contents, err := io.ReadAll(os.Stdin)
+		return string(contents), err
+	}
+
+	if name, ok := strings.CutPrefix(source, migrationSSMPrefix); ok {
+		value, err := a.readSSMParameter(ctx, name)
+		if err != nil {
+			return "", err
+		}
+		return joinChunks(ctx, value, ssmChunkReader(a.ssm))
+	}
+
+	if bucket, ok := strings.CutPrefix(source, migrationGCSPrefix); ok {
+		gcs, err := newGCSVaultInitSource(bucket, gcpKMSKey)
+		if err != nil {
+			return "", err
+		}
+		return gcs.read(ctx)
+	}
+
+	name, ok := strings.CutPrefix(source, secretsManagerStorePrefix)
+	if !ok {
+		contents, err := os.ReadFile(source)
+		return string(contents), err
+	}
+
+	secret, err := a.secretsManager.GetSecretValue(ctx, &secretsmanager.GetSecretValueInput{
+		SecretId: &name,
+	})
+	if err != nil {
+		return "", fmt.Errorf("get AWS secret: %w", err)
+	}
+	if secret.SecretString == nil {
+		return "", fmt.Errorf("get AWS secret: %w: no secret string", ErrSecretMissing)
+	}
+	return aws.ToString(secret.SecretString), nil
+}
+
+// Run the `migrate-store` subcommand with the source in MIGRATE_SOURCE, and the Cloud KMS key of GCS
+// sources in MIGRATE_GCP_KMS_KEY. Returns the process exit code.
+func runMigrateStore(ctx context.Context, app *App, source, gcpKMSKey string, format outputFormat) int {
+	if source == "" {
+		fmt.Fprintln(os.Stderr, "MIGRATE_SOURCE env is required")
+		return 1
+	}
+
+	output := commandOutput{Command: "migrate-store"}
+	result, err := app.MigrateStore(ctx, source, gcpKMSKey)
+	output.step("migrate "+source, storedShares(app, result, err), err)
+	if result != nil {
+		output.Result = result
+	}
+	return output.print(os.Stdout, format)
+}
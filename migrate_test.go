@@ -0,0 +1,102 @@
+package main
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/hashicorp/vault/api"
+)
+
+func TestMigrateStore(t *testing.T) {
+	app, vault, _ := newTestApp(0)
+
+	// Vault initialized by the original vault-init, its keys decrypted from the GCS bucket.
+	initResponse, _ := vault.Init(context.Background(), &api.InitRequest{SecretShares: 5, SecretThreshold: 3})
+	contents, _ := json.Marshal(initResponse)
+	source := filepath.Join(t.TempDir(), "unseal-keys.json")
+	if err := os.WriteFile(source, contents, 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	result, err := app.MigrateStore(context.Background(), source, "")
+	if err != nil {
+		t.Fatalf("migrate: %v", err)
+	}
+	if result.Shares != 5 || result.Threshold != 3 {
+		t.Fatalf("expected 5 shares with threshold 3, got %+v", result)
+	}
+	if !result.Unsealed || vault.sealed {
+		t.Fatal("expected Vault unsealed with the migrated keys")
+	}
+
+	if _, err := app.MigrateStore(context.Background(), source, ""); !errors.Is(err, ErrSecretInUse) {
+		t.Fatalf("expected the secret in use, got %v", err)
+	}
+}
+
+func TestMigrateStoreRejectsInvalidKeys(t *testing.T) {
+	app, _, secretsManager := newTestApp(0)
+
+	source := filepath.Join(t.TempDir(), "unseal-keys.json")
+	if err := os.WriteFile(source, []byte(`{"keys_base64":["AQ=="]}`), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := app.MigrateStore(context.Background(), source, ""); !errors.Is(err, ErrKeysInvalid) {
+		t.Fatalf("expected the keys invalid, got %v", err)
+	}
+	if secretsManager.value != nil {
+		t.Fatal("expected the secret left untouched")
+	}
+}
+
+func TestMigrateStoreFromGCS(t *testing.T) {
+	const kmsKey = "projects/vault/locations/global/keyRings/vault/cryptoKeys/vault-init"
+	initResponse := `{"keys_base64":["AQ=="],"root_token":"root"}`
+
+	// Cloud KMS ciphertexts are the plaintext reversed here.
+	mux := http.NewServeMux()
+	mux.HandleFunc("/computeMetadata/v1/instance/service-accounts/default/token", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"access_token": "token"}`)
+	})
+	mux.HandleFunc("/storage/v1/b/vault-init/o/unseal-keys.json.enc", func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("alt") != "media" || r.Header.Get("Authorization") != "Bearer token" {
+			http.Error(w, "bad request", http.StatusBadRequest)
+			return
+		}
+		fmt.Fprintln(w, base64.StdEncoding.EncodeToString(reversed([]byte(initResponse))))
+	})
+	mux.HandleFunc("/v1/"+kmsKey+":decrypt", func(w http.ResponseWriter, r *http.Request) {
+		var request struct {
+			Ciphertext []byte `json:"ciphertext"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		_ = json.NewEncoder(w).Encode(map[string][]byte{"plaintext": reversed(request.Ciphertext)})
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	source, err := newGCSVaultInitSource("vault-init", kmsKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	source.storageEndpoint, source.kmsEndpoint, source.metadataURL = server.URL, server.URL, server.URL
+	if read, err := source.read(context.Background()); err != nil || read != initResponse {
+		t.Fatalf("expected the init response decrypted, got %q, %v", read, err)
+	}
+
+	if _, err := newGCSVaultInitSource("vault-init", "vault-init"); err == nil {
+		t.Error("expected a Cloud KMS key name required")
+	}
+}
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strings"
+)
+
+// Key store of a mirror backend, named for the logs. A nil store is the AWS Secrets Manager secret.
+type keyStoreMirror struct {
+	backend string
+	store   keyStore
+}
+
+// Returns the stores of the SECRET_BACKEND_MIRRORS backends, comma separated, each distinct from the others
+// and from the primary backend.
+func newKeyStoreMirrors(primary, raw string) ([]keyStoreMirror, error) {
+	var mirrors []keyStoreMirror
+	seen := map[string]bool{primary: true}
+	for _, backend := range strings.Split(raw, ",") {
+		backend = strings.TrimSpace(backend)
+		if backend == "" {
+			continue
+		}
+		if seen[backend] {
+			return nil, fmt.Errorf("backend %s is used twice", backend)
+		}
+		seen[backend] = true
+
+		store, err := newKeyStore(backend)
+		if err != nil {
+			return nil, err
+		}
+		mirrors = append(mirrors, keyStoreMirror{backend: backend, store: store})
+	}
+	return mirrors, nil
+}
+
+// Key store writing the payload to the primary store and all the mirrors, and reading it from the first
+// store holding it, so losing a store loses no keys.
+type mirroredKeyStore struct {
+	primary keyStore
+	mirrors []keyStoreMirror
+}
+
+// Returns the version of the primary store. Writes are attempted on all the stores, and fail if any fails,
+// so they are retried until every store holds the payload.
+func (s mirroredKeyStore) writePayload(ctx context.Context, payload string) (storedVersion, error) {
+	version, err := s.primary.writePayload(ctx, payload)
+	errs := []error{err}
+	for _, mirror := range s.mirrors {
+		mirrorVersion, err := mirror.store.writePayload(ctx, payload)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("mirror %s: %w", mirror.backend, err))
+			continue
+		}
+		slog.Info("Updated mirror", "backend", mirror.backend, "version", mirrorVersion.VersionID)
+	}
+	return version, errors.Join(errs...)
+}
+
+// Returns the payload of the primary store, or of the first mirror holding one if the primary fails. The
+// error of the primary is returned if no store holds the payload.
+func (s mirroredKeyStore) readPayload(ctx context.Context) (string, error) {
+	payload, primaryErr := s.primary.readPayload(ctx)
+	if primaryErr == nil {
+		return payload, nil
+	}
+	for _, mirror := range s.mirrors {
+		payload, err := mirror.store.readPayload(ctx)
+		if err != nil {
+			slog.Warn("Cannot read mirror", "backend", mirror.backend, "error", err)
+			continue
+		}
+		slog.Warn("Read the payload from a mirror", "backend", mirror.backend, "primaryError", primaryErr)
+		return payload, nil
+	}
+	return "", primaryErr
+}
+
+// Whether any store holds a payload.
+func (s mirroredKeyStore) exists(ctx context.Context) (bool, error) {
+	stored, err := s.primary.exists(ctx)
+	if err != nil || stored {
+		return stored, err
+	}
+	for _, mirror := range s.mirrors {
+		stored, err := mirror.store.exists(ctx)
+		if err != nil {
+			return false, fmt.Errorf("mirror %s: %w", mirror.backend, err)
+		}
+		if stored {
+			return true, nil
+		}
+	}
+	return false, nil
+}
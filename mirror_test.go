@@ -0,0 +1,61 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+// Key store failing all calls.
+type failingKeyStore struct{}
+
+var errStoreDown = errors.New("store down")
+
+func (failingKeyStore) readPayload(context.Context) (string, error) { return "", errStoreDown }
+
+func (failingKeyStore) writePayload(context.Context, string) (storedVersion, error) {
+	return storedVersion{}, errStoreDown
+}
+
+func (failingKeyStore) exists(context.Context) (bool, error) { return false, errStoreDown }
+
+func TestMirroredKeyStore(t *testing.T) {
+	app, vault, secretsManager := newTestApp(0)
+	mirror := &memoryKeyStore{}
+	app.config.KeyStoreMirrors = []keyStoreMirror{{backend: "memory", store: mirror}}
+
+	if _, err := app.CheckVaultStatus(context.Background()); err != nil {
+		t.Fatalf("check status: %v", err)
+	}
+	if vault.sealed || secretsManager.value == nil || mirror.payload != *secretsManager.value {
+		t.Fatal("expected the init response written to the secret and the mirror")
+	}
+
+	// The mirror serves the keys when the secret loses them, and keeps them from being overwritten.
+	secretsManager.value = nil
+	if payload, err := app.keyStore().readPayload(context.Background()); err != nil || payload != mirror.payload {
+		t.Errorf("expected the payload of the mirror, got %q, %v", payload, err)
+	}
+	if err := app.checkSecretUnused(context.Background()); !errors.Is(err, ErrSecretInUse) {
+		t.Errorf("expected ErrSecretInUse, got %v", err)
+	}
+
+	// Writes fail while a store is down, and are retried.
+	app.config.KeyStoreMirrors = append(app.config.KeyStoreMirrors, keyStoreMirror{backend: "down", store: failingKeyStore{}})
+	if _, err := app.keyStore().writePayload(context.Background(), "payload"); !errors.Is(err, errStoreDown) {
+		t.Errorf("expected the mirror error, got %v", err)
+	}
+	if mirror.payload != "payload" {
+		t.Error("expected the other stores written")
+	}
+}
+
+func TestNewKeyStoreMirrors(t *testing.T) {
+	mirrors, err := newKeyStoreMirrors("plugin", " secretsmanager, ")
+	if err != nil || len(mirrors) != 1 || mirrors[0].store != nil {
+		t.Fatalf("expected the secretsmanager mirror, got %v, %v", mirrors, err)
+	}
+	if _, err := newKeyStoreMirrors(secretsManagerBackend, "secretsmanager"); err == nil {
+		t.Error("expected the primary backend rejected as mirror")
+	}
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+)
+
+// Output formats of the subcommands, selected with the --output flag.
+type outputFormat string
+
+const (
+	outputText outputFormat = "text"
+	outputJSON outputFormat = "json"
+)
+
+// Flags of the subcommands.
+type commandFlags struct {
+	Output outputFormat
+	// Whether to restore a snapshot onto an initialized Vault, for `dr restore`.
+	Force bool
+}
+
+// Parse the flags of a subcommand, the arguments after its name.
+func parseFlags(args []string) (commandFlags, error) {
+	flags := flag.NewFlagSet("vault-init", flag.ContinueOnError)
+	flags.SetOutput(io.Discard)
+	output := flags.String("output", string(outputText), "")
+	force := flags.Bool("force", false, "")
+	if err := flags.Parse(args); err != nil {
+		return commandFlags{}, err
+	}
+
+	switch format := outputFormat(*output); format {
+	case outputText, outputJSON:
+		return commandFlags{Output: format, Force: *force}, nil
+	default:
+		return commandFlags{}, fmt.Errorf("unknown output format %q, expected text or json", format)
+	}
+}
+
+// Outcome of a subcommand, printed as OK and FAIL lines, or as JSON for scripts.
+type commandOutput struct {
+	Command string        `json:"command"`
+	OK      bool          `json:"ok"`
+	Steps   []commandStep `json:"steps"`
+	// Result of the subcommand, with a schema of its own. Omitted if the subcommand failed before getting it.
+	Result any `json:"result,omitempty"`
+}
+
+type commandStep struct {
+	Name   string `json:"name"`
+	OK     bool   `json:"ok"`
+	Detail string `json:"detail,omitempty"`
+	Error  string `json:"error,omitempty"`
+}
+
+// Add a step to the output, failing the subcommand if err is not nil.
+func (o *commandOutput) step(name, detail string, err error) {
+	step := commandStep{Name: name, OK: err == nil, Detail: detail}
+	if err != nil {
+		step.Error = err.Error()
+	}
+	o.Steps = append(o.Steps, step)
+}
+
+// Print the output in the format, returning the process exit code: 1 if any step failed.
+func (o *commandOutput) print(w io.Writer, format outputFormat) int {
+	o.OK = true
+	for _, step := range o.Steps {
+		o.OK = o.OK && step.OK
+	}
+
+	if format == outputJSON {
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		if err := encoder.Encode(o); err != nil {
+			return 1
+		}
+	} else {
+		for _, step := range o.Steps {
+			switch {
+			case !step.OK:
+				fmt.Fprintf(w, "FAIL %s: %s\n", step.Name, step.Error)
+			case step.Detail != "":
+				fmt.Fprintf(w, "OK   %s: %s\n", step.Name, step.Detail)
+			default:
+				fmt.Fprintf(w, "OK   %s\n", step.Name)
+			}
+		}
+	}
+
+	if !o.OK {
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"testing"
+)
+
+func TestParseFlags(t *testing.T) {
+	tests := map[string]struct {
+		args    []string
+		want    commandFlags
+		invalid bool
+	}{
+		"default":    {args: nil, want: commandFlags{Output: outputText}},
+		"json":       {args: []string{"--output", "json"}, want: commandFlags{Output: outputJSON}},
+		"json equal": {args: []string{"-output=json"}, want: commandFlags{Output: outputJSON}},
+		"force":      {args: []string{"--force", "--output", "json"}, want: commandFlags{Output: outputJSON, Force: true}},
+		"unknown":    {args: []string{"--output", "yaml"}, invalid: true},
+		"bad flag":   {args: []string{"--verbose"}, invalid: true},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			got, err := parseFlags(tt.args)
+			if tt.invalid {
+				if err == nil {
+					t.Fatalf("expected an error, got %+v", got)
+				}
+				return
+			}
+			if err != nil || got != tt.want {
+				t.Fatalf("expected %+v, got %+v: %v", tt.want, got, err)
+			}
+		})
+	}
+}
+
+func TestCommandOutput(t *testing.T) {
+	output := commandOutput{Command: "verify-keys", Result: &KeyCheckResult{Shares: 2, Threshold: 3}}
+	output.step("secret", "readable", nil)
+	output.step("stored keys", "", errors.New("2 shares stored, 3 required"))
+
+	var text bytes.Buffer
+	if code := output.print(&text, outputText); code != 1 {
+		t.Fatalf("expected exit code 1, got %d", code)
+	}
+	if want := "OK   secret: readable\nFAIL stored keys: 2 shares stored, 3 required\n"; text.String() != want {
+		t.Fatalf("expected %q, got %q", want, text.String())
+	}
+
+	var buf bytes.Buffer
+	output.print(&buf, outputJSON)
+	var decoded struct {
+		Command string
+		OK      bool
+		Steps   []commandStep
+		Result  KeyCheckResult
+	}
+	if err := json.Unmarshal(buf.Bytes(), &decoded); err != nil {
+		t.Fatalf("unmarshal: %v", err)
+	}
+	if decoded.Command != "verify-keys" || decoded.OK || len(decoded.Steps) != 2 || decoded.Steps[1].OK || decoded.Result.Shares != 2 {
+		t.Fatalf("unexpected JSON output: %s", buf.String())
+	}
+}
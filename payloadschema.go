@@ -0,0 +1,64 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// Latest schema of the stored payload. Schema 1 is the bare init response, as Vault returns it and the
+// upstream vault-init projects store it. Schema 2 wraps it as `{"schema": 2, "data": {...}}`, so payloads
+// written by later versions are told apart, and older ones migrated when read.
+const payloadSchema = 2
+
+// Payload of schema 2 and later.
+type versionedPayload struct {
+	Schema int             `json:"schema"`
+	Data   json.RawMessage `json:"data"`
+}
+
+// Migrations of the payload data from each schema to the next, applied in order when reading older payloads.
+// Changing the data, e.g. adding fields, requires a new schema and its migration here.
+var payloadMigrations = map[int]func(data json.RawMessage) (json.RawMessage, error){
+	// Schema 2 only adds the wrapper.
+	1: func(data json.RawMessage) (json.RawMessage, error) { return data, nil },
+}
+
+// Returns the init response JSON as a payload of the schema, the latest if 0.
+func wrapPayload(initResponse []byte, schema int) ([]byte, error) {
+	if schema == 1 {
+		return initResponse, nil
+	}
+	if schema == 0 {
+		schema = payloadSchema
+	}
+	return json.Marshal(versionedPayload{Schema: schema, Data: initResponse})
+}
+
+// Returns the init response JSON of a payload of any schema up to the latest, migrating older ones.
+// Payloads that are not JSON objects are returned as is, for the init response parsing to reject them.
+func unwrapPayload(payload string) (string, error) {
+	schema, data := 1, json.RawMessage(payload)
+	var versioned versionedPayload
+	if json.Unmarshal([]byte(payload), &versioned) == nil && versioned.Schema > 0 {
+		schema, data = versioned.Schema, versioned.Data
+	}
+	if schema > payloadSchema {
+		return "", fmt.Errorf("%w: payload schema %d is newer than schema %d supported by this version, upgrade vault-init", ErrKeysInvalid, schema, payloadSchema)
+	}
+
+	for ; schema < payloadSchema; schema++ {
+		var err error
+		if data, err = payloadMigrations[schema](data); err != nil {
+			return "", fmt.Errorf("%w: migrate payload from schema %d: %w", ErrKeysInvalid, schema, err)
+		}
+	}
+	return string(data), nil
+}
+
+// Parse the PAYLOAD_SCHEMA env.
+func parsePayloadSchema(schema int) (int, error) {
+	if schema < 1 || schema > payloadSchema {
+		return 0, fmt.Errorf("PAYLOAD_SCHEMA env must be between 1 and %d, got %d", payloadSchema, schema)
+	}
+	return schema, nil
+}
@@ -0,0 +1,47 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/hashicorp/vault/api"
+)
+
+func TestPayloadSchema(t *testing.T) {
+	app, vault, secretsManager := newTestApp(0)
+	if _, err := app.CheckVaultStatus(context.Background()); err != nil {
+		t.Fatalf("check status: %v", err)
+	}
+
+	var stored versionedPayload
+	if err := json.Unmarshal([]byte(aws.ToString(secretsManager.value)), &stored); err != nil || stored.Schema != payloadSchema {
+		t.Fatalf("expected the init response stored with schema %d, got %s", payloadSchema, aws.ToString(secretsManager.value))
+	}
+	if err := app.checkSecretUnused(context.Background()); !errors.Is(err, ErrSecretInUse) {
+		t.Errorf("expected the versioned payload in use, got %v", err)
+	}
+
+	// Secrets written before the schema hold the bare init response.
+	secretsManager.value = aws.String(secretsManager.storedInitResponse())
+	vault.sealed = true
+	if _, err := app.CheckVaultStatus(context.Background()); err != nil || vault.sealed {
+		t.Fatalf("expected Vault unsealed with the schema 1 payload, got %v", err)
+	}
+
+	// Payloads written by later versions are not misread.
+	secretsManager.value = aws.String(`{"schema": 3, "data": {"keys_base64": ["AQ=="]}}`)
+	if _, err := app.readInitResponse(context.Background()); !errors.Is(err, ErrKeysInvalid) {
+		t.Errorf("expected a newer schema rejected, got %v", err)
+	}
+
+	app.config.PayloadSchema = 1
+	if _, err := app.writeInitResponse(context.Background(), &api.InitResponse{KeysB64: []string{"AQ=="}}); err != nil {
+		t.Fatal(err)
+	}
+	if value := aws.ToString(secretsManager.value); value != `{"keys":null,"keys_base64":["AQ=="],"recovery_keys":null,"recovery_keys_base64":null,"root_token":""}` {
+		t.Errorf("expected the bare init response written with schema 1, got %s", value)
+	}
+}
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"golang.org/x/crypto/openpgp"
+	"golang.org/x/crypto/openpgp/armor"
+
+	// Hash openpgp falls back to for keys without hash preferences, even when not signing.
+	_ "golang.org/x/crypto/ripemd160"
+)
+
+// Read a PGP public key from the file at path, ASCII armored or base64 encoded as accepted by Vault.
+func readPGPKey(path string) (*openpgp.Entity, error) {
+	contents, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return parsePGPKey(string(contents))
+}
+
+// Parse a PGP public key, ASCII armored or base64 encoded as accepted by Vault.
+func parsePGPKey(key string) (*openpgp.Entity, error) {
+	key = strings.TrimSpace(key)
+
+	var (
+		entities openpgp.EntityList
+		err      error
+	)
+	if strings.HasPrefix(key, "-----BEGIN PGP") {
+		entities, err = openpgp.ReadArmoredKeyRing(strings.NewReader(key))
+	} else {
+		var binary []byte
+		if binary, err = base64.StdEncoding.DecodeString(key); err != nil {
+			return nil, errors.New("neither ASCII armored nor base64 encoded")
+		}
+		entities, err = openpgp.ReadKeyRing(bytes.NewReader(binary))
+	}
+	if err != nil {
+		return nil, fmt.Errorf("read PGP key: %w", err)
+	}
+	if len(entities) != 1 {
+		return nil, fmt.Errorf("expected a single PGP key, got %d", len(entities))
+	}
+	return entities[0], nil
+}
+
+// Encrypt the plaintext to the PGP key, returning it ASCII armored.
+func pgpEncrypt(plaintext string, key *openpgp.Entity) (string, error) {
+	var buf bytes.Buffer
+	armored, err := armor.Encode(&buf, "PGP MESSAGE", nil)
+	if err != nil {
+		return "", fmt.Errorf("armor: %w", err)
+	}
+	w, err := openpgp.Encrypt(armored, openpgp.EntityList{key}, nil, &openpgp.FileHints{IsBinary: true}, nil)
+	if err != nil {
+		return "", fmt.Errorf("encrypt: %w", err)
+	}
+	if _, err := io.WriteString(w, plaintext); err != nil {
+		return "", fmt.Errorf("encrypt: %w", err)
+	}
+	if err := w.Close(); err != nil {
+		return "", fmt.Errorf("encrypt: %w", err)
+	}
+	if err := armored.Close(); err != nil {
+		return "", fmt.Errorf("armor: %w", err)
+	}
+	return buf.String(), nil
+}
+
+// Returns the PGP public key of the file base64 encoded, as Vault takes it in init requests.
+func pgpKeyBase64(path string) (string, error) {
+	key, err := readPGPKey(path)
+	if err != nil {
+		return "", err
+	}
+	var buf bytes.Buffer
+	if err := key.Serialize(&buf); err != nil {
+		return "", fmt.Errorf("serialize PGP key: %w", err)
+	}
+	return base64.StdEncoding.EncodeToString(buf.Bytes()), nil
+}
+
+// ASCII armor a base64 encoded PGP message, as Vault returns the values it encrypts, so its recipient
+// decrypts it with `gpg --decrypt` directly.
+func pgpArmor(messageB64 string) (string, error) {
+	message, err := base64.StdEncoding.DecodeString(messageB64)
+	if err != nil {
+		return "", fmt.Errorf("decode PGP message: %w", err)
+	}
+
+	var buf bytes.Buffer
+	armored, err := armor.Encode(&buf, "PGP MESSAGE", nil)
+	if err != nil {
+		return "", fmt.Errorf("armor: %w", err)
+	}
+	if _, err := armored.Write(message); err != nil {
+		return "", fmt.Errorf("armor: %w", err)
+	}
+	if err := armored.Close(); err != nil {
+		return "", fmt.Errorf("armor: %w", err)
+	}
+	return buf.String(), nil
+}
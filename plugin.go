@@ -0,0 +1,121 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os/exec"
+	"strings"
+	"time"
+
+	"github.com/spf13/viper"
+)
+
+// Time a plugin may run when the context has no deadline.
+const pluginTimeout = 30 * time.Second
+
+// Exit code of key store plugins reading a payload that was never stored.
+const pluginExitNotFound = 3
+
+// Run the plugin executable with the operation as argument, writing the request as JSON to its stdin and
+// decoding its stdout as JSON into the response, unless nil. Plugins fail by exiting with a non-zero code,
+// their stderr being the error message.
+func runPlugin(ctx context.Context, path, operation string, request, response any) error {
+	if _, ok := ctx.Deadline(); !ok {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, pluginTimeout)
+		defer cancel()
+	}
+
+	input, err := json.Marshal(request)
+	if err != nil {
+		return fmt.Errorf("marshal plugin request: %w", err)
+	}
+
+	var stdout, stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, path, operation)
+	cmd.Stdin = bytes.NewReader(input)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		if message := strings.TrimSpace(stderr.String()); message != "" {
+			err = fmt.Errorf("%w: %s", err, message)
+		}
+		return fmt.Errorf("plugin %s %s: %w", path, operation, err)
+	}
+
+	if response == nil {
+		return nil
+	}
+	if err := json.Unmarshal(stdout.Bytes(), response); err != nil {
+		return fmt.Errorf("plugin %s %s: parse response: %w", path, operation, err)
+	}
+	return nil
+}
+
+// Request of the key store plugins. Value is only set to write it.
+type keyStoreRequest struct {
+	SecretID string `json:"secretID"`
+	Value    string `json:"value,omitempty"`
+}
+
+// Response of the key store plugins. Value is only set for reads, and the version is optional.
+type keyStoreResponse struct {
+	Value     string `json:"value"`
+	ARN       string `json:"arn"`
+	VersionID string `json:"versionID"`
+}
+
+// Key store run by an executable, called with the `read` or `write` operation.
+type pluginKeyStore struct {
+	path     string
+	secretID string
+}
+
+// Create the key store of the `plugin` backend, running the KEY_STORE_PLUGIN executable.
+func newPluginKeyStore() (keyStore, error) {
+	path := viper.GetString("key_store_plugin")
+	if path == "" {
+		return nil, errors.New("KEY_STORE_PLUGIN env is required with the plugin secret backend")
+	}
+	return pluginKeyStore{path: path, secretID: viper.GetString("secretsmanager_secret_id")}, nil
+}
+
+func (s pluginKeyStore) readPayload(ctx context.Context) (string, error) {
+	var response keyStoreResponse
+	err := runPlugin(ctx, s.path, "read", keyStoreRequest{SecretID: s.secretID}, &response)
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) && exitErr.ExitCode() == pluginExitNotFound {
+		return "", fmt.Errorf("%w: %w", ErrSecretMissing, err)
+	}
+	if err != nil {
+		return "", err
+	}
+	if response.Value == "" {
+		return "", fmt.Errorf("plugin %s read: %w: empty value", s.path, ErrSecretMissing)
+	}
+	return response.Value, nil
+}
+
+func (s pluginKeyStore) writePayload(ctx context.Context, payload string) (storedVersion, error) {
+	var response keyStoreResponse
+	if err := runPlugin(ctx, s.path, "write", keyStoreRequest{SecretID: s.secretID, Value: payload}, &response); err != nil {
+		return storedVersion{}, err
+	}
+	return storedVersion{ARN: response.ARN, VersionID: response.VersionID}, nil
+}
+
+func (s pluginKeyStore) exists(ctx context.Context) (bool, error) {
+	return payloadStored(ctx, s)
+}
+
+// Notification sink run by an executable, called with the `notify` operation and the alert as request.
+type pluginNotifier struct {
+	path string
+}
+
+func (n pluginNotifier) notify(ctx context.Context, notification alertNotification) error {
+	return runPlugin(ctx, n.path, "notify", notification, nil)
+}
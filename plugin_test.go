@@ -0,0 +1,83 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// Plugin keeping the key store request and the notifications in files next to it.
+const testPlugin = `#!/bin/sh
+dir="$(dirname "$0")"
+case "$1" in
+read) [ -f "$dir/store.json" ] || exit 3; cat "$dir/store.json" ;;
+write) cat > "$dir/store.json"; echo '{"versionID": "v1"}' ;;
+notify) cat > "$dir/alert.json" ;;
+*) echo "unknown operation $1" >&2; exit 1 ;;
+esac
+`
+
+func writeTestPlugin(t *testing.T) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "plugin")
+	if err := os.WriteFile(path, []byte(testPlugin), 0o700); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestPluginKeyStore(t *testing.T) {
+	app, vault, secretsManager := newTestApp(0)
+	store := pluginKeyStore{path: writeTestPlugin(t), secretID: "vault"}
+	app.config.KeyStore = store
+
+	if _, err := store.readPayload(context.Background()); !errors.Is(err, ErrSecretMissing) {
+		t.Fatalf("expected ErrSecretMissing before initialization, got %v", err)
+	}
+
+	result, err := app.CheckVaultStatus(context.Background())
+	if err != nil {
+		t.Fatalf("check status: %v", err)
+	}
+	if vault.sealed {
+		t.Fatal("expected Vault unsealed with the keys of the plugin")
+	}
+	if result.Init.SecretVersionID != "v1" {
+		t.Errorf("expected the version of the plugin, got %q", result.Init.SecretVersionID)
+	}
+	if secretsManager.value != nil {
+		t.Error("expected nothing written to the secret")
+	}
+
+	// Initializing again must not overwrite the stored keys.
+	if err := app.checkSecretUnused(context.Background()); !errors.Is(err, ErrSecretInUse) {
+		t.Errorf("expected ErrSecretInUse, got %v", err)
+	}
+}
+
+func TestPluginNotifier(t *testing.T) {
+	path := writeTestPlugin(t)
+	notification := alertNotification{Text: "unseal failed", Attributes: map[string]string{"cluster": "prod"}}
+	if err := (pluginNotifier{path: path}).notify(context.Background(), notification); err != nil {
+		t.Fatalf("notify: %v", err)
+	}
+
+	data, err := os.ReadFile(filepath.Join(filepath.Dir(path), "alert.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got alertNotification
+	if err := json.Unmarshal(data, &got); err != nil {
+		t.Fatal(err)
+	}
+	if got.Text != notification.Text || got.Attributes["cluster"] != "prod" {
+		t.Errorf("expected %+v sent to the plugin, got %+v", notification, got)
+	}
+
+	if err := runPlugin(context.Background(), path, "rotate", nil, nil); err == nil {
+		t.Error("expected unknown operations to fail")
+	}
+}
@@ -0,0 +1,214 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/kms"
+	kmstypes "github.com/aws/aws-sdk-go-v2/service/kms/types"
+	"github.com/aws/aws-sdk-go-v2/service/secretsmanager"
+	"github.com/aws/aws-sdk-go-v2/service/secretsmanager/types"
+	"github.com/aws/smithy-go"
+	"github.com/cenkalti/backoff/v4"
+)
+
+// PermissionCheck is the result of exercising an IAM action required by the App.
+type PermissionCheck struct {
+	Action string
+	Err    error
+}
+
+// Version of the secret the pre-flight removes the AWSCURRENT label from, which never holds it.
+const preflightVersionID = "00000000-0000-0000-0000-000000000000"
+
+// How long the pre-flight retries the checks failing for other reasons than denied access, e.g. throttling
+// or timeouts, and the first interval between them.
+var (
+	preflightRetryDuration = 2 * time.Minute
+	preflightRetryInterval = time.Second
+)
+
+// Exercise the IAM actions required by the App against the secret, without modifying it:
+// GetSecretValue also requires kms:Decrypt on the secret KMS key, and PutSecretValue is
+// exercised with an empty value, which is rejected. PutSecretValue is only checked
+// for replica 0, the only one storing the init response. With ENVELOPE_KMS_KEY_ID, replica 0
+// generates a data key and decrypts it back, while the others decrypt the data key stored
+// in the envelope, if any.
+func (a *App) CheckPermissions(ctx context.Context) []PermissionCheck {
+	var checks []PermissionCheck
+
+	secret, err := a.describeSecret(ctx, true)
+	checks = append(checks, PermissionCheck{Action: "secretsmanager:DescribeSecret", Err: permissionError(err)})
+
+	value, err := a.checkGetSecretValue(ctx, secret != nil)
+	checks = append(checks, PermissionCheck{Action: "secretsmanager:GetSecretValue", Err: permissionError(err)})
+
+	if a.config.EnvelopeKMSKeyID != "" {
+		checks = append(checks, a.checkEnvelopeKey(ctx, value)...)
+	}
+
+	if a.config.SSMParameterName != "" {
+		_, err = a.readSSMParameter(ctx, a.config.SSMParameterName)
+		if errors.Is(err, ErrSecretMissing) {
+			err = nil
+		}
+		checks = append(checks, PermissionCheck{Action: "ssm:GetParameter", Err: permissionError(err)})
+	}
+
+	if a.config.Replica == 0 {
+		// Secrets Manager authorizes the call before validating it, so a value that is neither a string
+		// nor binary is rejected without adding a version once the action is allowed. Whichever validation
+		// error is returned, e.g. InvalidRequestException for a secret scheduled for deletion, the action is
+		// allowed unless access is denied.
+		_, err = a.secretsManager.PutSecretValue(ctx, &secretsmanager.PutSecretValueInput{
+			SecretId: &a.config.SecretID,
+		})
+		checks = append(checks, PermissionCheck{Action: "secretsmanager:PutSecretValue", Err: probeError(err)})
+
+		// Archiving the value before init labels its version. Removing AWSCURRENT without moving it is
+		// rejected the same way, and the version does not exist anyway.
+		_, err = a.secretsManager.UpdateSecretVersionStage(ctx, &secretsmanager.UpdateSecretVersionStageInput{
+			SecretId:            &a.config.SecretID,
+			VersionStage:        aws.String("AWSCURRENT"),
+			RemoveFromVersionId: aws.String(preflightVersionID),
+		})
+		checks = append(checks, PermissionCheck{Action: "secretsmanager:UpdateSecretVersionStage", Err: probeError(err)})
+	}
+
+	// Listing secrets needs the action on every resource, so it is only checked when the secret was discovered
+	// by its tags.
+	if a.config.SecretFilter != nil {
+		_, err = a.secretsManager.ListSecrets(ctx, &secretsmanager.ListSecretsInput{MaxResults: aws.Int32(1)})
+		checks = append(checks, PermissionCheck{Action: "secretsmanager:ListSecrets", Err: permissionError(err)})
+	}
+
+	return checks
+}
+
+// Returns the error of a call made to exercise an action, which is expected to be rejected once the action is
+// allowed: only denied access fails the check.
+func probeError(err error) error {
+	var apiErr smithy.APIError
+	if errors.As(err, &apiErr) && !isAccessDenied(err) {
+		slog.Debug("Call rejected after authorization", "operation", apiErr.ErrorCode(), "error", err)
+		return nil
+	}
+	return permissionError(err)
+}
+
+// Read the secret value, returning it, if any. Missing values are only allowed if the secret exists, as
+// it has no value until the init response is written.
+func (a *App) checkGetSecretValue(ctx context.Context, secretExists bool) (string, error) {
+	output, err := a.secretsManager.GetSecretValue(ctx, &secretsmanager.GetSecretValueInput{
+		SecretId: &a.config.SecretID,
+	})
+	var notFound *types.ResourceNotFoundException
+	if errors.As(err, &notFound) && secretExists {
+		return "", nil
+	}
+	if err != nil {
+		return "", err
+	}
+	return aws.ToString(output.SecretString), nil
+}
+
+// Exercise kms:Decrypt on the envelope KMS key, and kms:GenerateDataKey on replica 0, which writes the
+// init response. Other replicas can only decrypt the data key of a stored envelope.
+func (a *App) checkEnvelopeKey(ctx context.Context, stored string) []PermissionCheck {
+	var (
+		checks []PermissionCheck
+		keyID  = a.config.EnvelopeKMSKeyID
+		blob   []byte
+	)
+	if a.config.Replica == 0 {
+		dataKey, err := a.kms.GenerateDataKey(ctx, &kms.GenerateDataKeyInput{
+			KeyId:             &keyID,
+			KeySpec:           kmstypes.DataKeySpecAes256,
+			EncryptionContext: envelopeContext,
+		}, withKeyRegion(keyID))
+		checks = append(checks, PermissionCheck{Action: "kms:GenerateDataKey", Err: permissionError(err)})
+		if err == nil {
+			blob = dataKey.CiphertextBlob
+		}
+	} else {
+		var e envelope
+		if json.Unmarshal([]byte(stored), &e) == nil && len(e.EncryptedKey) > 0 {
+			keyID, blob = e.KMSKeyID, e.EncryptedKey
+		}
+	}
+	if blob == nil {
+		return checks
+	}
+
+	_, err := a.kms.Decrypt(ctx, &kms.DecryptInput{
+		KeyId:             &keyID,
+		CiphertextBlob:    blob,
+		EncryptionContext: envelopeContext,
+	}, withKeyRegion(keyID))
+	return append(checks, PermissionCheck{Action: "kms:Decrypt", Err: permissionError(err)})
+}
+
+// Check the required IAM permissions, returning an error naming every action denied. Checks failing for other
+// reasons, e.g. throttling or timeouts, are retried for a while, then only logged, as the actions may well be
+// allowed.
+func (a *App) Preflight(ctx context.Context) error {
+	b := backoff.NewExponentialBackOff()
+	b.InitialInterval = preflightRetryInterval
+	b.MaxElapsedTime = preflightRetryDuration
+
+	err := backoff.RetryNotify(func() error {
+		var denied, failed []error
+		for _, check := range a.CheckPermissions(ctx) {
+			switch {
+			case check.Err == nil:
+				slog.Debug("Permission check passed", "action", check.Action)
+			case errors.Is(check.Err, ErrPermissionDenied):
+				denied = append(denied, fmt.Errorf("%s: %w", check.Action, check.Err))
+			default:
+				failed = append(failed, fmt.Errorf("%s: %w", check.Action, check.Err))
+			}
+		}
+		if len(denied) > 0 {
+			return backoff.Permanent(errors.Join(denied...))
+		}
+		return errors.Join(failed...)
+	}, backoff.WithContext(b, ctx), func(err error, next time.Duration) {
+		slog.Warn("Cannot check every IAM permission, retrying", "error", err, "retryIn", next)
+	})
+	if err != nil && !errors.Is(err, ErrPermissionDenied) {
+		slog.Warn("Cannot check every IAM permission, continuing as none was denied", "error", err)
+		return nil
+	}
+	return err
+}
+
+// Re-verify the secret is still there and readable, alerting on the failures the startup checks would have
+// caught: the secret deleted, or access to it or its KMS key revoked.
+func (a *App) CheckSecretAccess(ctx context.Context) error {
+	if err := a.CheckSecretExistence(ctx); err != nil {
+		return err
+	}
+	if _, err := a.checkGetSecretValue(ctx, true); err != nil {
+		return fmt.Errorf("get secret value: %w", permissionError(err))
+	}
+	return nil
+}
+
+// Wraps access denied API errors with ErrPermissionDenied.
+func permissionError(err error) error {
+	if isAccessDenied(err) {
+		return fmt.Errorf("%w: %w", ErrPermissionDenied, err)
+	}
+	return err
+}
+
+// Whether the error is an API error denying access.
+func isAccessDenied(err error) bool {
+	var apiErr smithy.APIError
+	return errors.As(err, &apiErr) && apiErr.ErrorCode() == "AccessDeniedException"
+}
@@ -0,0 +1,180 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/kms"
+	"github.com/aws/aws-sdk-go-v2/service/secretsmanager"
+	"github.com/aws/aws-sdk-go-v2/service/secretsmanager/types"
+	"github.com/aws/smithy-go"
+)
+
+// Secrets Manager denying PutSecretValue to the role.
+type readOnlySecretsManager struct {
+	*fakeSecretsManager
+}
+
+func (readOnlySecretsManager) PutSecretValue(context.Context, *secretsmanager.PutSecretValueInput, ...func(*secretsmanager.Options)) (*secretsmanager.PutSecretValueOutput, error) {
+	return nil, &smithy.GenericAPIError{Code: "AccessDeniedException", Message: "not authorized to perform secretsmanager:PutSecretValue"}
+}
+
+// Secrets Manager rejecting PutSecretValue after authorizing it, as for a secret scheduled for deletion.
+type deletedSecretsManager struct {
+	*fakeSecretsManager
+}
+
+func (deletedSecretsManager) PutSecretValue(context.Context, *secretsmanager.PutSecretValueInput, ...func(*secretsmanager.Options)) (*secretsmanager.PutSecretValueOutput, error) {
+	return nil, &types.InvalidRequestException{Message: aws.String("You can't perform this operation on the secret because it was marked for deletion.")}
+}
+
+// Secrets Manager denying the archiving and listing actions to the role.
+type lockedDownSecretsManager struct {
+	*fakeSecretsManager
+}
+
+func (lockedDownSecretsManager) UpdateSecretVersionStage(context.Context, *secretsmanager.UpdateSecretVersionStageInput, ...func(*secretsmanager.Options)) (*secretsmanager.UpdateSecretVersionStageOutput, error) {
+	return nil, &smithy.GenericAPIError{Code: "AccessDeniedException", Message: "not authorized to perform secretsmanager:UpdateSecretVersionStage"}
+}
+
+func (lockedDownSecretsManager) ListSecrets(context.Context, *secretsmanager.ListSecretsInput, ...func(*secretsmanager.Options)) (*secretsmanager.ListSecretsOutput, error) {
+	return nil, &smithy.GenericAPIError{Code: "AccessDeniedException", Message: "not authorized to perform secretsmanager:ListSecrets"}
+}
+
+func TestPreflightChecksArchivingAndDiscovery(t *testing.T) {
+	app, _, secretsManager := newTestApp(0)
+	app.config.SecretFilter = map[string]string{"vault-init/cluster": "prod"}
+	if err := app.Preflight(context.Background()); err != nil {
+		t.Fatalf("expected the permissions granted, got %v", err)
+	}
+
+	app.secretsManager = lockedDownSecretsManager{secretsManager}
+	err := app.Preflight(context.Background())
+	for _, action := range []string{"secretsmanager:UpdateSecretVersionStage", "secretsmanager:ListSecrets"} {
+		if !errors.Is(err, ErrPermissionDenied) || !strings.Contains(err.Error(), action) {
+			t.Errorf("expected %s denied, got %v", action, err)
+		}
+	}
+}
+
+func TestPreflightChecksPutSecretValue(t *testing.T) {
+	app, _, secretsManager := newTestApp(0)
+	if err := app.Preflight(context.Background()); err != nil {
+		t.Fatalf("expected the permissions granted, got %v", err)
+	}
+	if secretsManager.value != nil || secretsManager.binary != nil {
+		t.Fatalf("expected the secret left unchanged, got %q", *secretsManager.value)
+	}
+
+	app.secretsManager = readOnlySecretsManager{secretsManager}
+	err := app.Preflight(context.Background())
+	if !errors.Is(err, ErrPermissionDenied) || !strings.Contains(err.Error(), "secretsmanager:PutSecretValue") {
+		t.Fatalf("expected PutSecretValue denied, got %v", err)
+	}
+
+	// Only denied access fails the check.
+	app.secretsManager = deletedSecretsManager{secretsManager}
+	if err := app.Preflight(context.Background()); err != nil {
+		t.Fatalf("expected PutSecretValue allowed, got %v", err)
+	}
+
+	// Other replicas never write the secret.
+	app.secretsManager = readOnlySecretsManager{secretsManager}
+	app.config.Replica = 1
+	if err := app.Preflight(context.Background()); err != nil {
+		t.Fatalf("expected PutSecretValue not checked, got %v", err)
+	}
+}
+
+// Secrets Manager throttling GetSecretValue the given number of times.
+type throttledSecretsManager struct {
+	*fakeSecretsManager
+	throttles int
+	calls     int
+}
+
+func (s *throttledSecretsManager) GetSecretValue(ctx context.Context, params *secretsmanager.GetSecretValueInput, optFns ...func(*secretsmanager.Options)) (*secretsmanager.GetSecretValueOutput, error) {
+	s.calls++
+	if s.calls <= s.throttles {
+		return nil, &smithy.GenericAPIError{Code: "ThrottlingException", Message: "Rate exceeded"}
+	}
+	return s.fakeSecretsManager.GetSecretValue(ctx, params, optFns...)
+}
+
+// Retry the pre-flight checks every millisecond for the given duration, restored at the end of the test.
+func fastPreflightRetries(t *testing.T, duration time.Duration) {
+	t.Helper()
+	interval, maxDuration := preflightRetryInterval, preflightRetryDuration
+	t.Cleanup(func() { preflightRetryInterval, preflightRetryDuration = interval, maxDuration })
+	preflightRetryInterval, preflightRetryDuration = time.Millisecond, duration
+}
+
+func TestPreflightRetriesTransientErrors(t *testing.T) {
+	fastPreflightRetries(t, time.Minute)
+	app, _, secretsManager := newTestApp(0)
+	throttled := &throttledSecretsManager{fakeSecretsManager: secretsManager, throttles: 2}
+	app.secretsManager = throttled
+
+	if err := app.Preflight(context.Background()); err != nil || throttled.calls != 3 {
+		t.Fatalf("expected the throttled check retried until it passed, got %v after %d calls", err, throttled.calls)
+	}
+
+	// Still failing once the retries are exhausted, the actions are not known to be denied.
+	fastPreflightRetries(t, 10*time.Millisecond)
+	throttled.calls, throttled.throttles = 0, 1000
+	if err := app.Preflight(context.Background()); err != nil {
+		t.Fatalf("expected startup to continue, got %v", err)
+	}
+}
+
+// KMS denying Decrypt to the role.
+type encryptOnlyKMS struct {
+	dataKeyKMS
+}
+
+func (encryptOnlyKMS) Decrypt(context.Context, *kms.DecryptInput, ...func(*kms.Options)) (*kms.DecryptOutput, error) {
+	return nil, &smithy.GenericAPIError{Code: "AccessDeniedException", Message: "not authorized to perform kms:Decrypt"}
+}
+
+func TestPreflightChecksEnvelopeKey(t *testing.T) {
+	app, _, _ := newTestApp(0)
+	app.config.EnvelopeKMSKeyID = "alias/vault-init"
+	app.kms = dataKeyKMS{}
+	if err := app.Preflight(context.Background()); err != nil {
+		t.Fatalf("expected the permissions granted, got %v", err)
+	}
+
+	app.kms = encryptOnlyKMS{}
+	err := app.Preflight(context.Background())
+	if !errors.Is(err, ErrPermissionDenied) || !strings.Contains(err.Error(), "kms:Decrypt") {
+		t.Fatalf("expected kms:Decrypt denied, got %v", err)
+	}
+}
+
+// Secrets Manager denying GetSecretValue to the role.
+type writeOnlySecretsManager struct {
+	*fakeSecretsManager
+}
+
+func (writeOnlySecretsManager) GetSecretValue(context.Context, *secretsmanager.GetSecretValueInput, ...func(*secretsmanager.Options)) (*secretsmanager.GetSecretValueOutput, error) {
+	return nil, &smithy.GenericAPIError{Code: "AccessDeniedException", Message: "not authorized to perform secretsmanager:GetSecretValue"}
+}
+
+func TestCheckSecretAccess(t *testing.T) {
+	app, _, secretsManager := newTestApp(0)
+	if _, err := app.CheckVaultStatus(context.Background()); err != nil {
+		t.Fatalf("initialize: %v", err)
+	}
+	if err := app.CheckSecretAccess(context.Background()); err != nil {
+		t.Fatalf("expected the secret readable, got %v", err)
+	}
+
+	app.secretsManager = writeOnlySecretsManager{secretsManager}
+	if err := app.CheckSecretAccess(context.Background()); !errors.Is(err, ErrPermissionDenied) {
+		t.Fatalf("expected the revoked access detected, got %v", err)
+	}
+}
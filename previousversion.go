@@ -0,0 +1,64 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+)
+
+// Staging label Secrets Manager moves to the version a write replaces.
+const previousVersionStage = "AWSPREVIOUS"
+
+// Context key of the staging label of the secret version to read, overriding SECRETSMANAGER_VERSION_STAGE.
+// Chunks written before their versions were recorded and share secrets are read at the same label, so all
+// the parts of the init response come from the same write.
+type secretVersionStageKey struct{}
+
+// Returns the staging label of the context, nil if it has none.
+func secretVersionStage(ctx context.Context) *string {
+	if stage, ok := ctx.Value(secretVersionStageKey{}).(string); ok {
+		return &stage
+	}
+	return nil
+}
+
+// Unseal with the stored keys, falling back to the AWSPREVIOUS version of the secret when the current one
+// is corrupt or its keys do not match Vault, e.g. after a bad manual edit or a write by another cluster,
+// rather than retrying it forever. Both the failure and the fallback are alerted, as the current version
+// must be fixed before the previous one is rotated out.
+func (a *App) unsealWithFallback(ctx context.Context, migrate bool) (*UnsealResult, error) {
+	result, err := a.Unseal(ctx, migrate)
+	if err == nil || !a.canUnsealPreviousVersion(migrate) || !isBadKeys(err) {
+		return result, err
+	}
+
+	alert(ctx, "The current secret version cannot unseal Vault, trying the AWSPREVIOUS version", "secretID", a.config.SecretID, "error", err)
+	failedKeys := a.failedKeys
+	previous, previousErr := a.Unseal(context.WithValue(ctx, secretVersionStageKey{}, previousVersionStage), migrate)
+	if previousErr != nil {
+		// The current keys stay the ones not submitted again, so neither version is retried until it changes.
+		a.failedKeys = failedKeys
+		if errors.Is(previousErr, ErrSecretMissing) {
+			slog.Warn("Secret has no AWSPREVIOUS version to fall back to", "secretID", a.config.SecretID)
+		}
+		return result, fmt.Errorf("%w, nor could the AWSPREVIOUS version: %w", err, previousErr)
+	}
+	previous.PreviousVersion = true
+	alert(ctx, "Vault unsealed with the AWSPREVIOUS secret version, the current version must be fixed", "secretID", a.config.SecretID)
+	return previous, nil
+}
+
+// Whether the keys may be read from the AWSPREVIOUS version: only Secrets Manager keeps it, and a version
+// pinned by the operator is never replaced.
+func (a *App) canUnsealPreviousVersion(migrate bool) bool {
+	return a.config.KeyStore == nil && a.config.SSMParameterName == "" &&
+		a.config.SecretVersionID == "" && a.config.SecretVersionStage == "" &&
+		(!migrate || a.config.SealMigrate)
+}
+
+// Whether the unseal failed because of the stored keys, rather than e.g. Vault or AWS being unavailable, or
+// keys that already failed.
+func isBadKeys(err error) bool {
+	return errors.Is(err, ErrKeysInvalid) || errors.Is(err, ErrKeyMismatch)
+}
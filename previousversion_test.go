@@ -0,0 +1,67 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+)
+
+func TestUnsealFallsBackToPreviousVersion(t *testing.T) {
+	app, vault, secretsManager := newTestApp(0)
+	if _, err := app.CheckVaultStatus(context.Background()); err != nil {
+		t.Fatalf("initialize: %v", err)
+	}
+
+	// Secret overwritten by a bad manual edit.
+	vault.sealed = true
+	secretsManager.previous = secretsManager.value
+	secretsManager.value = aws.String("not json")
+
+	result, err := app.CheckVaultStatus(context.Background())
+	if err != nil {
+		t.Fatalf("check status: %v", err)
+	}
+	if result.Unseal == nil || !result.Unseal.PreviousVersion || vault.sealed {
+		t.Fatalf("expected Vault unsealed with the previous version, got %+v", result.Unseal)
+	}
+}
+
+func TestUnsealFallbackNeedsUnpinnedVersion(t *testing.T) {
+	app, vault, secretsManager := newTestApp(0)
+	if _, err := app.CheckVaultStatus(context.Background()); err != nil {
+		t.Fatalf("initialize: %v", err)
+	}
+
+	vault.sealed = true
+	secretsManager.previous = secretsManager.value
+	secretsManager.value = aws.String("not json")
+	app.config.SecretVersionStage = "AWSCURRENT"
+
+	_, err := app.CheckVaultStatus(context.Background())
+	if !errors.Is(err, ErrKeysInvalid) || !vault.sealed {
+		t.Fatalf("expected the pinned version not to fall back, got %v", err)
+	}
+}
+
+func TestUnsealFallbackIsNotRetried(t *testing.T) {
+	app, vault, secretsManager := newTestApp(0)
+	if _, err := app.CheckVaultStatus(context.Background()); err != nil {
+		t.Fatalf("initialize: %v", err)
+	}
+
+	// Vault restored from a backup of another cluster, matching neither version.
+	vault.sealed = true
+	vault.keys = []string{"other"}
+	secretsManager.previous = secretsManager.value
+
+	if _, err := app.CheckVaultStatus(context.Background()); !errors.Is(err, ErrKeyMismatch) {
+		t.Fatalf("expected a key mismatch, got %v", err)
+	}
+	unseals := vault.unseals
+	_, err := app.CheckVaultStatus(context.Background())
+	if !errors.Is(err, ErrUnsealFailed) || vault.unseals != unseals {
+		t.Fatalf("expected neither version submitted again, got %v after %d unseals", err, vault.unseals-unseals)
+	}
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/secretsmanager"
+	"github.com/aws/aws-sdk-go-v2/service/secretsmanager/types"
+)
+
+// Tags of the secret recording the progress of the actions following initialization, which need the root
+// token, so that a restart resumes them rather than skipping them.
+const (
+	// Bootstrap steps applied, as `<applied>/<total>`.
+	bootstrapProgressTag = "vault-init:bootstrap-progress"
+	// Revocation of the root token with the revoke-after-bootstrap policy, `pending` until `done`.
+	rootTokenRevocationTag = "vault-init:root-token-revocation"
+)
+
+// Record the progress tag on the secret. Only the Secrets Manager secret is tagged, so the progress is kept in
+// memory only with other key stores.
+func (a *App) saveProgress(ctx context.Context, key, value string) {
+	if !a.usesSecretsManager() {
+		return
+	}
+	_, err := a.secretsManager.TagResource(ctx, &secretsmanager.TagResourceInput{
+		SecretId: &a.config.SecretID,
+		Tags:     []types.Tag{{Key: &key, Value: &value}},
+	})
+	if err != nil {
+		slog.Error("Cannot record progress on the secret, a restart will not resume it", "tag", key, "value", value, "error", err)
+		return
+	}
+	a.invalidateSecretMetadata()
+}
+
+// Returns the value of the progress tag of the secret, empty if unset.
+func (a *App) loadProgress(ctx context.Context, key string) (string, error) {
+	if !a.usesSecretsManager() {
+		return "", nil
+	}
+	secret, err := a.describeSecret(ctx, false)
+	if err != nil {
+		return "", fmt.Errorf("describe secret: %w", err)
+	}
+	for _, tag := range secret.Tags {
+		if aws.ToString(tag.Key) == key {
+			return aws.ToString(tag.Value), nil
+		}
+	}
+	return "", nil
+}
+
+// Resume the bootstrap and the root token revocation interrupted by a restart, reading the root token back
+// from the store. Done once, on the first check finding Vault unsealed.
+func (a *App) resumeProgress(ctx context.Context) error {
+	bootstrap, err := a.loadProgress(ctx, bootstrapProgressTag)
+	if err != nil {
+		return err
+	}
+	revocation, err := a.loadProgress(ctx, rootTokenRevocationTag)
+	if err != nil {
+		return err
+	}
+	a.progressResumed = true
+
+	if revocation == "pending" && a.revokedRootToken == "" {
+		if a.revokedRootToken = a.storedRootToken(ctx); a.revokedRootToken == "" {
+			alert(ctx, "Revoking the root token was interrupted by a restart and the root token cannot be read back, revoke it manually")
+		} else {
+			slog.Info("Resuming the root token revocation interrupted by a restart")
+		}
+	}
+
+	var applied, total int
+	if _, err := fmt.Sscanf(bootstrap, "%d/%d", &applied, &total); err == nil && applied < total && a.rootToken == "" {
+		if a.rootToken = a.storedRootToken(ctx); a.rootToken == "" {
+			alert(ctx, "Bootstrap was interrupted by a restart and the root token is not stored, apply the remaining steps manually", "stepsApplied", applied, "steps", total)
+		} else {
+			slog.Info("Resuming the bootstrap interrupted by a restart", "stepsApplied", applied, "steps", total)
+			a.bootstrapApplied = applied
+		}
+	}
+	return nil
+}
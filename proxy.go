@@ -0,0 +1,29 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+)
+
+// Parses a proxy setting for an HTTP client: a proxy URL (`http`, `https` or `socks5`), `none` to connect
+// directly, or empty to use the HTTP_PROXY, HTTPS_PROXY and NO_PROXY envs of the process.
+func parseProxy(raw string) (func(*http.Request) (*url.URL, error), error) {
+	switch raw {
+	case "":
+		return http.ProxyFromEnvironment, nil
+	case "none":
+		return nil, nil
+	}
+
+	proxyURL, err := url.Parse(raw)
+	if err != nil {
+		return nil, fmt.Errorf("parse proxy URL: %w", err)
+	}
+	switch proxyURL.Scheme {
+	case "http", "https", "socks5":
+	default:
+		return nil, fmt.Errorf("unsupported proxy scheme %q", proxyURL.Scheme)
+	}
+	return http.ProxyURL(proxyURL), nil
+}
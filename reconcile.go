@@ -0,0 +1,65 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+)
+
+// Run the `status` subcommand, printing the Vault state without acting on it. Returns the process exit code.
+func runStatus(ctx context.Context, app *App, format outputFormat) int {
+	output := commandOutput{Command: "status"}
+
+	result, err := app.readState(ctx)
+	if err != nil {
+		output.step("vault status", "", err)
+	} else {
+		output.step("vault status", string(result.State), nil)
+		output.Result = result
+	}
+	return output.print(os.Stdout, format)
+}
+
+// Run the `reconcile` subcommand, checking Vault once and initializing, joining or unsealing it as needed.
+// Returns the process exit code.
+func runReconcile(ctx context.Context, app *App, timeout time.Duration, format outputFormat) int {
+	output := commandOutput{Command: "reconcile"}
+
+	result, err := checkVaultStatus(ctx, app, timeout)
+	detail := ""
+	if result != nil {
+		output.Result = result
+		detail = string(result.State)
+		if actions := (dashboardEvent{Result: result}).Actions(); len(actions) > 0 {
+			detail = fmt.Sprintf("%s, %s", detail, strings.Join(actions, ", "))
+		}
+	}
+	output.step("reconcile", detail, err)
+	if result != nil {
+		for _, status := range result.Spec {
+			output.step("spec "+status.Field, describeSpecStatus(status), specError(status))
+		}
+	}
+	return output.print(os.Stdout, format)
+}
+
+func describeSpecStatus(status SpecStatus) string {
+	if status.Condition == SpecConverged {
+		return status.Desired
+	}
+	return fmt.Sprintf("%s, desired %s, observed %s", status.Condition, status.Desired, status.Observed)
+}
+
+// Fails the step of fields that cannot converge by themselves.
+func specError(status SpecStatus) error {
+	switch status.Condition {
+	case SpecFailed:
+		return errors.New(status.Error)
+	case SpecDiverged:
+		return fmt.Errorf("diverged, desired %s, observed %s", status.Desired, status.Observed)
+	}
+	return nil
+}
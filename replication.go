@@ -0,0 +1,81 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/secretsmanager"
+	"github.com/aws/aws-sdk-go-v2/service/secretsmanager/types"
+)
+
+// ReplicaRegion is a region the secret is replicated to by AWS Secrets Manager.
+type ReplicaRegion struct {
+	Region string
+	// KMS key to encrypt the replica with. Empty to use aws/secretsmanager.
+	KMSKeyID string
+}
+
+// Parses comma-separated replica regions, each optionally followed by `=<kms-key-id>`.
+func parseReplicaRegions(raw string) []ReplicaRegion {
+	var regions []ReplicaRegion
+
+	for _, item := range strings.Split(raw, ",") {
+		region, kmsKeyID, _ := strings.Cut(strings.TrimSpace(item), "=")
+		if region == "" {
+			continue
+		}
+		regions = append(regions, ReplicaRegion{Region: region, KMSKeyID: kmsKeyID})
+	}
+	return regions
+}
+
+// Replicate the secret to the configured replica regions it is not replicated to yet.
+func (a *App) ReplicateSecret(ctx context.Context) error {
+	if len(a.config.ReplicaRegions) == 0 {
+		return nil
+	}
+
+	secret, err := a.describeSecret(ctx, false)
+	if err != nil {
+		return fmt.Errorf("describe secret: %w", err)
+	}
+
+	replicated := make(map[string]bool, len(secret.ReplicationStatus))
+	for _, status := range secret.ReplicationStatus {
+		replicated[aws.ToString(status.Region)] = true
+	}
+
+	var missing []types.ReplicaRegionType
+	for _, replica := range a.config.ReplicaRegions {
+		if replicated[replica.Region] {
+			continue
+		}
+
+		region := types.ReplicaRegionType{Region: aws.String(replica.Region)}
+		if replica.KMSKeyID != "" {
+			region.KmsKeyId = aws.String(replica.KMSKeyID)
+		}
+		missing = append(missing, region)
+	}
+	if len(missing) == 0 {
+		slog.Debug("Secret already replicated to all replica regions")
+		return nil
+	}
+
+	output, err := a.secretsManager.ReplicateSecretToRegions(ctx, &secretsmanager.ReplicateSecretToRegionsInput{
+		SecretId:          &a.config.SecretID,
+		AddReplicaRegions: missing,
+	})
+	if err != nil {
+		return fmt.Errorf("replicate secret: %w", err)
+	}
+	a.invalidateSecretMetadata()
+
+	for _, status := range output.ReplicationStatus {
+		slog.Info("Secret replication", "region", aws.ToString(status.Region), "status", status.Status, "message", aws.ToString(status.StatusMessage))
+	}
+	return nil
+}
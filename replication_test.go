@@ -0,0 +1,76 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/secretsmanager"
+	"github.com/aws/aws-sdk-go-v2/service/secretsmanager/types"
+)
+
+// Replicates the secret to the regions requested, by region with their KMS keys, unless failing with err.
+type replicatingSecretsManager struct {
+	*fakeSecretsManager
+	replicas map[string]string
+	requests int
+	err      error
+}
+
+func (s *replicatingSecretsManager) DescribeSecret(ctx context.Context, params *secretsmanager.DescribeSecretInput, optFns ...func(*secretsmanager.Options)) (*secretsmanager.DescribeSecretOutput, error) {
+	output, err := s.fakeSecretsManager.DescribeSecret(ctx, params, optFns...)
+	for region := range s.replicas {
+		output.ReplicationStatus = append(output.ReplicationStatus, types.ReplicationStatusType{Region: aws.String(region), Status: types.StatusTypeInSync})
+	}
+	return output, err
+}
+
+func (s *replicatingSecretsManager) ReplicateSecretToRegions(_ context.Context, params *secretsmanager.ReplicateSecretToRegionsInput, _ ...func(*secretsmanager.Options)) (*secretsmanager.ReplicateSecretToRegionsOutput, error) {
+	s.requests++
+	if s.err != nil {
+		return nil, s.err
+	}
+	output := &secretsmanager.ReplicateSecretToRegionsOutput{}
+	for _, region := range params.AddReplicaRegions {
+		s.replicas[aws.ToString(region.Region)] = aws.ToString(region.KmsKeyId)
+		output.ReplicationStatus = append(output.ReplicationStatus, types.ReplicationStatusType{Region: region.Region, Status: types.StatusTypeInProgress})
+	}
+	return output, nil
+}
+
+func TestParseReplicaRegions(t *testing.T) {
+	want := []ReplicaRegion{{Region: "eu-west-1"}, {Region: "us-west-2", KMSKeyID: "alias/vault"}}
+	if regions := parseReplicaRegions(" eu-west-1, ,us-west-2=alias/vault"); !reflect.DeepEqual(regions, want) {
+		t.Errorf("expected %+v, got %+v", want, regions)
+	}
+}
+
+func TestReplicateSecret(t *testing.T) {
+	app, _, secretsManager := newTestApp(0)
+	client := &replicatingSecretsManager{fakeSecretsManager: secretsManager, replicas: map[string]string{"eu-west-1": ""}}
+	app.secretsManager = client
+	app.config.ReplicaRegions = parseReplicaRegions("eu-west-1,us-west-2=alias/vault")
+
+	// Only the missing region is added, with its KMS key.
+	if err := app.ReplicateSecret(context.Background()); err != nil {
+		t.Fatalf("replicate: %v", err)
+	}
+	want := map[string]string{"eu-west-1": "", "us-west-2": "alias/vault"}
+	if !reflect.DeepEqual(client.replicas, want) {
+		t.Fatalf("expected the secret replicated to %v, got %v", want, client.replicas)
+	}
+
+	// Replicated everywhere, as the secret metadata described before replicating is not reused.
+	if err := app.ReplicateSecret(context.Background()); err != nil || client.requests != 1 {
+		t.Fatalf("expected no other replication request, got %d requests, %v", client.requests, err)
+	}
+
+	app.config.ReplicaRegions = parseReplicaRegions("ap-southeast-2")
+	client.err = &types.InvalidRequestException{Message: aws.String("a secret with this name already exists in ap-southeast-2")}
+	var invalid *types.InvalidRequestException
+	if err := app.ReplicateSecret(context.Background()); !errors.As(err, &invalid) {
+		t.Errorf("expected the replication failure returned, got %v", err)
+	}
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// Time a call to the REST API of a key store may take when the context has no deadline.
+const restAPITimeout = 30 * time.Second
+
+// Error of a REST API call answered with an unexpected status.
+type restAPIError struct {
+	StatusCode int
+	Message    string
+}
+
+func (e *restAPIError) Error() string {
+	if e.Message == "" {
+		return fmt.Sprintf("unexpected status %d", e.StatusCode)
+	}
+	return fmt.Sprintf("unexpected status %d: %s", e.StatusCode, e.Message)
+}
+
+// Call the REST API with the client, sending the request as a form if url.Values, as JSON otherwise unless
+// nil, and decoding the JSON response into response unless nil, or reading it as is into a *[]byte.
+// Statuses other than 2xx fail with a *restAPIError holding the start of the body.
+func callRESTAPI(ctx context.Context, client *http.Client, method, endpoint string, header http.Header, request, response any) error {
+	if _, ok := ctx.Deadline(); !ok {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, restAPITimeout)
+		defer cancel()
+	}
+
+	var (
+		body        io.Reader
+		contentType string
+	)
+	switch request := request.(type) {
+	case nil:
+	case url.Values:
+		body, contentType = strings.NewReader(request.Encode()), "application/x-www-form-urlencoded"
+	default:
+		data, err := json.Marshal(request)
+		if err != nil {
+			return fmt.Errorf("marshal request: %w", err)
+		}
+		body, contentType = bytes.NewReader(data), "application/json"
+	}
+	req, err := http.NewRequestWithContext(ctx, method, endpoint, body)
+	if err != nil {
+		return fmt.Errorf("create request: %w", err)
+	}
+	for name, values := range header {
+		req.Header[name] = values
+	}
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+
+	res, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode < 200 || res.StatusCode >= 300 {
+		message, _ := io.ReadAll(io.LimitReader(res.Body, 512))
+		return &restAPIError{StatusCode: res.StatusCode, Message: strings.TrimSpace(string(message))}
+	}
+	if response == nil {
+		return nil
+	}
+	if raw, ok := response.(*[]byte); ok {
+		if *raw, err = io.ReadAll(res.Body); err != nil {
+			return fmt.Errorf("read response: %w", err)
+		}
+		return nil
+	}
+	if err := json.NewDecoder(res.Body).Decode(response); err != nil {
+		return fmt.Errorf("parse response: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,79 @@
+package main
+
+// CheckResult describes the Vault state observed by a status check and the actions taken on it.
+// Action results are nil when the corresponding action was not needed.
+type CheckResult struct {
+	State       VaultState `json:"state"`
+	Initialized bool       `json:"initialized"`
+	Sealed      bool       `json:"sealed"`
+	// Whether Vault is a healthy standby or performance standby node.
+	Standby            bool `json:"standby"`
+	PerformanceStandby bool `json:"performanceStandby"`
+	// Whether Vault is a disaster recovery secondary, which is never initialized or unsealed.
+	DRSecondary bool `json:"drSecondary"`
+
+	Init      *InitResult      `json:"init,omitempty"`
+	Join      *JoinResult      `json:"join,omitempty"`
+	Unseal    *UnsealResult    `json:"unseal,omitempty"`
+	Bootstrap *BootstrapResult `json:"bootstrap,omitempty"`
+	// Whether the root token was revoked, with the revoke-after-bootstrap root token policy.
+	RootTokenRevoked bool `json:"rootTokenRevoked,omitempty"`
+
+	// Status of the desired state fields.
+	Spec []SpecStatus `json:"spec,omitempty"`
+}
+
+// InitResult describes a Vault initialization and where its response was stored.
+type InitResult struct {
+	SealType        string `json:"sealType"`
+	SecretShares    int    `json:"secretShares"`
+	SecretThreshold int    `json:"secretThreshold"`
+	// Recovery shares and threshold, with auto-unseal seals instead of secret shares.
+	RecoveryShares    int `json:"recoveryShares"`
+	RecoveryThreshold int `json:"recoveryThreshold"`
+
+	SecretARN       string `json:"secretARN"`
+	SecretVersionID string `json:"secretVersionID"`
+	// Staging label of the archived previous secret value, if the secret had one.
+	ArchivedStage string `json:"archivedStage"`
+	// Secret holding the root token, if stored apart from the unseal keys.
+	RootTokenSecretARN string `json:"rootTokenSecretARN"`
+}
+
+// JoinResult describes a Raft join request.
+type JoinResult struct {
+	LeaderAPIAddr string `json:"leaderAPIAddr"`
+	Joined        bool   `json:"joined"`
+}
+
+// UnsealResult describes the seal status after submitting unseal keys.
+type UnsealResult struct {
+	KeysSubmitted int  `json:"keysSubmitted"`
+	Threshold     int  `json:"threshold"`
+	Progress      int  `json:"progress"`
+	Sealed        bool `json:"sealed"`
+	// Whether the keys were submitted to migrate the seal.
+	Migrate bool `json:"migrate"`
+	// Indexes of the submitted shares in the stored init response, in submission order.
+	SharesSubmitted []int `json:"sharesSubmitted"`
+	// Whether the keys of the AWSPREVIOUS secret version were submitted, the current version failing.
+	PreviousVersion bool `json:"previousVersion,omitempty"`
+}
+
+// BootstrapResult describes the post-init configuration applied with the bootstrap token.
+type BootstrapResult struct {
+	TokenAccessor string `json:"tokenAccessor"`
+	StepsApplied  int    `json:"stepsApplied"`
+}
+
+// KeyCheckResult describes the stored keys checked without unsealing Vault.
+type KeyCheckResult struct {
+	// Seal type reported by Vault, empty if it could not be read.
+	SealType string `json:"sealType"`
+	// Whether the keys are recovery keys of an auto-unseal seal.
+	Recovery  bool `json:"recovery"`
+	Shares    int  `json:"shares"`
+	Threshold int  `json:"threshold"`
+	// Whether the keys unsealed Vault, when migrated into a sealed Vault.
+	Unsealed bool `json:"unsealed,omitempty"`
+}
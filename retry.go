@@ -0,0 +1,73 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+	"os"
+	"time"
+
+	"github.com/cenkalti/backoff/v4"
+)
+
+// Retry a write of the init response, which must eventually succeed as Vault cannot be initialized again.
+// Retries use jittered exponential backoff and are deliberately unbounded, as giving up would lose the only
+// copy of the keys, held in memory: the check, and so the node, is blocked until the write succeeds or the
+// process stops. Once the write has been failing for longer than the configured max duration, it is
+// escalated once with an alert and, if configured, by persisting the encrypted init response to the fallback
+// file.
+func (a *App) retryWrite(ctx context.Context, operation string, initResponse []byte, write func() error) error {
+	b := backoff.NewExponentialBackOff()
+	b.InitialInterval = time.Second
+	b.MaxInterval = time.Minute
+	b.MaxElapsedTime = 0
+
+	var (
+		start     = time.Now()
+		escalated bool
+	)
+	err := backoff.RetryNotify(write, backoff.WithContext(b, ctx), func(err error, next time.Duration) {
+		slog.Error("Cannot "+operation, "error", err, "retryIn", next)
+
+		if escalated || time.Since(start) < a.config.WriteEscalateAfter {
+			return
+		}
+		escalated = true
+		a.escalateWrite(ctx, operation, initResponse, err)
+	})
+	if err != nil {
+		return err
+	}
+
+	if escalated && a.config.FallbackFile != "" {
+		if err := os.Remove(a.config.FallbackFile); err != nil {
+			slog.Error("Cannot remove fallback file, remove it manually", "path", a.config.FallbackFile, "error", err)
+		} else {
+			slog.Info("Removed fallback file", "path", a.config.FallbackFile)
+		}
+	}
+	return nil
+}
+
+func (a *App) escalateWrite(ctx context.Context, operation string, initResponse []byte, err error) {
+	if a.config.FallbackFile == "" {
+		alert(ctx, "Cannot store the Vault init response, it is only kept in memory until the write succeeds", "operation", operation, "error", err)
+		return
+	}
+
+	// Never persisted in plaintext, as the file may outlive the pod, e.g. on a persistent volume.
+	if len(a.config.PayloadAgeRecipients) == 0 && a.config.EnvelopeKMSKeyID == "" {
+		alert(ctx, "Cannot store the Vault init response, nor persist it to the fallback file without encrypting it", "operation", operation, "error", err)
+		return
+	}
+	sealed, serr := a.sealPayload(ctx, initResponse)
+	if serr != nil {
+		alert(ctx, "Cannot store the Vault init response, nor encrypt it for the fallback file", "operation", operation, "error", err, "fallbackError", serr)
+		return
+	}
+
+	if ferr := os.WriteFile(a.config.FallbackFile, sealed, 0o600); ferr != nil {
+		alert(ctx, "Cannot store the Vault init response, nor persist it to the fallback file", "operation", operation, "error", err, "fallbackError", ferr)
+		return
+	}
+	alert(ctx, "Cannot store the Vault init response, persisted it to the fallback file until the write succeeds", "operation", operation, "error", err, "path", a.config.FallbackFile)
+}
@@ -0,0 +1,41 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"filippo.io/age"
+)
+
+func TestFallbackFileIsEncrypted(t *testing.T) {
+	identity, err := age.GenerateX25519Identity()
+	if err != nil {
+		t.Fatal(err)
+	}
+	initResponse := []byte(`{"keys_base64": ["a2V5"], "root_token": "root"}`)
+
+	app, _, _ := newTestApp(0)
+	app.config.FallbackFile = filepath.Join(t.TempDir(), "init.json")
+	app.escalateWrite(context.Background(), "update secret", initResponse, errors.New("unavailable"))
+	if _, err := os.Stat(app.config.FallbackFile); !errors.Is(err, os.ErrNotExist) {
+		t.Fatalf("expected the init response not persisted in plaintext, got %v", err)
+	}
+
+	app.config.PayloadAgeRecipients = []age.Recipient{identity.Recipient()}
+	app.config.PayloadAgeIdentities = []age.Identity{identity}
+	app.escalateWrite(context.Background(), "update secret", initResponse, errors.New("unavailable"))
+	persisted, err := os.ReadFile(app.config.FallbackFile)
+	if err != nil {
+		t.Fatalf("read fallback file: %v", err)
+	}
+	if !isAgePayload(string(persisted)) || strings.Contains(string(persisted), "root_token") {
+		t.Fatalf("expected the fallback file to hold an age payload, got %q", persisted)
+	}
+	if opened, err := app.openPayload(context.Background(), string(persisted)); err != nil || opened != string(initResponse) {
+		t.Fatalf("expected the init response decrypted, got %q: %v", opened, err)
+	}
+}
@@ -0,0 +1,201 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/secretsmanager"
+	"github.com/hashicorp/vault/api"
+)
+
+// Store the root token in its own secret, created by the tool if missing, and restrict reading it
+// to the break-glass role, and managing it to that role and the role of the tool, with a resource policy.
+func (a *App) StoreRootToken(ctx context.Context, rootToken string) (string, error) {
+	data, err := json.Marshal(map[string]string{"root_token": rootToken})
+	if err != nil {
+		return "", fmt.Errorf("marshal root token: %w", err)
+	}
+	secretString := string(data)
+
+	arn, err := a.putManagedSecret(ctx, a.config.RootTokenSecretName, "Vault root token, written by vault-init", secretString, "")
+	if err != nil {
+		return "", fmt.Errorf("root token secret: %w", err)
+	}
+
+	policy, err := breakGlassPolicy(a.config.RootTokenRoleARN, a.config.RootTokenWriterRoleARN)
+	if err != nil {
+		return arn, err
+	}
+
+	_, err = a.secretsManager.PutResourcePolicy(ctx, &secretsmanager.PutResourcePolicyInput{
+		SecretId:          &arn,
+		ResourcePolicy:    &policy,
+		BlockPublicPolicy: aws.Bool(true),
+	})
+	if err != nil {
+		return arn, fmt.Errorf("put root token secret policy: %w", err)
+	}
+
+	slog.Info("Stored root token", "arn", arn, "breakGlassRole", a.config.RootTokenRoleARN, "writerRole", a.config.RootTokenWriterRoleARN)
+	return arn, nil
+}
+
+// Resource policy denying every action on the secret to every principal except the break-glass role, and
+// the writer role, i.e. the tool, which may do anything but read it, to store, remove and protect the token.
+func breakGlassPolicy(roleARN, writerRoleARN string) (string, error) {
+	policy, err := json.Marshal(map[string]any{
+		"Version": "2012-10-17",
+		"Statement": []any{
+			map[string]any{
+				"Sid":       "BreakGlassOnly",
+				"Effect":    "Deny",
+				"Principal": "*",
+				"Action":    "secretsmanager:GetSecretValue",
+				"Resource":  "*",
+				"Condition": map[string]any{
+					"ArnNotEquals": map[string]string{"aws:PrincipalArn": roleARN},
+				},
+			},
+			map[string]any{
+				"Sid":       "BreakGlassAndWriterOnly",
+				"Effect":    "Deny",
+				"Principal": "*",
+				"NotAction": "secretsmanager:GetSecretValue",
+				"Resource":  "*",
+				"Condition": map[string]any{
+					"ArnNotEquals": map[string][]string{"aws:PrincipalArn": {roleARN, writerRoleARN}},
+				},
+			},
+		},
+	})
+	if err != nil {
+		return "", fmt.Errorf("marshal root token secret policy: %w", err)
+	}
+	return string(policy), nil
+}
+
+// What becomes of the root token after initialization, set with ROOT_TOKEN_POLICY.
+type rootTokenPolicy string
+
+const (
+	// Store the root token with the unseal keys, or in the root token secret.
+	rootTokenStore rootTokenPolicy = "store"
+	// Never store the root token. It is only used in memory to apply the bootstrap steps.
+	rootTokenDiscard rootTokenPolicy = "discard"
+	// Store the root token until Vault is bootstrapped, then revoke it and remove it from the store.
+	rootTokenRevokeAfterBootstrap rootTokenPolicy = "revoke-after-bootstrap"
+)
+
+func parseRootTokenPolicy(raw string) (rootTokenPolicy, error) {
+	switch policy := rootTokenPolicy(raw); policy {
+	case rootTokenStore, rootTokenDiscard, rootTokenRevokeAfterBootstrap:
+		return policy, nil
+	}
+	return "", fmt.Errorf("unknown root token policy %q, expected store, discard or revoke-after-bootstrap", raw)
+}
+
+// Revoke the root token, and remove it from the init response or the root token secret. The token is stored
+// until revoked so that it is not lost if the revocation fails.
+func (a *App) RevokeRootToken(ctx context.Context, rootToken string) error {
+	client, err := a.vault.WithToken(rootToken)
+	if err != nil {
+		return err
+	}
+	if err := client.Auth().Token().RevokeSelfWithContext(ctx, ""); err != nil {
+		return fmt.Errorf("revoke: %w", err)
+	}
+
+	// Removed even if the context is done, as the token is no longer valid.
+	ctx = context.WithoutCancel(ctx)
+	if a.config.RootTokenSecretName != "" {
+		if _, err := a.StoreRootToken(ctx, ""); err != nil {
+			return fmt.Errorf("remove revoked root token from secret: %w", err)
+		}
+		slog.Info("Revoked root token and removed it from the root token secret")
+		return nil
+	}
+
+	secretString, err := a.readInitResponse(ctx)
+	if err != nil {
+		return fmt.Errorf("read init response: %w", err)
+	}
+	var initResponse api.InitResponse
+	if err := json.Unmarshal([]byte(secretString), &initResponse); err != nil {
+		return fmt.Errorf("unmarshal: %w", err)
+	}
+	initResponse.RootToken = ""
+	version, err := a.writeInitResponse(ctx, &initResponse)
+	if err != nil {
+		return fmt.Errorf("remove revoked root token from secret: %w", err)
+	}
+	slog.Info("Revoked root token and removed it from the secret", "version", version.VersionID)
+	return nil
+}
+
+// Check the root token stored with the unseal keys is still valid, alerting if it is not, and revoke it once
+// older than the configured max age, removing it from the secret. Root tokens stored apart are not checked,
+// as only the break-glass role can read them.
+func (a *App) CheckRootToken(ctx context.Context) error {
+	secretString, err := a.readInitResponse(ctx)
+	if err != nil {
+		return fmt.Errorf("read init response: %w", err)
+	}
+
+	var initResponse api.InitResponse
+	if err := json.Unmarshal([]byte(secretString), &initResponse); err != nil {
+		return fmt.Errorf("unmarshal: %w", err)
+	}
+	if initResponse.RootToken == "" {
+		slog.Debug("No root token stored with the unseal keys")
+		return nil
+	}
+
+	client, err := a.vault.WithToken(initResponse.RootToken)
+	if err != nil {
+		return err
+	}
+
+	secret, err := client.Auth().Token().LookupSelfWithContext(ctx)
+	if err != nil {
+		var responseErr *api.ResponseError
+		if errors.As(err, &responseErr) && responseErr.StatusCode == http.StatusForbidden {
+			alert(ctx, "The stored root token is no longer valid, break-glass procedures relying on it will fail", "secretID", a.config.SecretID)
+			return nil
+		}
+		return fmt.Errorf("look up root token: %w", vaultError(err))
+	}
+
+	created, ok := secret.Data["creation_time"].(json.Number)
+	if !ok || a.config.RootTokenMaxAge <= 0 {
+		slog.Debug("Stored root token is valid")
+		return nil
+	}
+	createdAt, err := created.Int64()
+	if err != nil {
+		return fmt.Errorf("parse root token creation time: %w", err)
+	}
+	age := time.Since(time.Unix(createdAt, 0))
+	if age < a.config.RootTokenMaxAge {
+		slog.Debug("Stored root token is valid", "age", age)
+		return nil
+	}
+
+	slog.Info("Revoking root token older than the max age", "age", age, "maxAge", a.config.RootTokenMaxAge)
+	if err := client.Auth().Token().RevokeSelfWithContext(ctx, ""); err != nil {
+		return fmt.Errorf("revoke root token: %w", err)
+	}
+
+	initResponse.RootToken = ""
+	version, err := a.writeInitResponse(ctx, &initResponse)
+	if err != nil {
+		return fmt.Errorf("remove revoked root token from secret: %w", err)
+	}
+	slog.Info("Revoked root token and removed it from the secret", "version", version.VersionID)
+	return nil
+}
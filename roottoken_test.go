@@ -0,0 +1,210 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/vault/api"
+)
+
+func TestRootTokenPolicy(t *testing.T) {
+	var revoked []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/auth/token/revoke-self" {
+			http.NotFound(w, r)
+			return
+		}
+		revoked = append(revoked, r.Header.Get("X-Vault-Token"))
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+
+	storedRootToken := func(secretsManager *fakeSecretsManager) string {
+		t.Helper()
+		var stored api.InitResponse
+		if err := json.Unmarshal([]byte(secretsManager.storedInitResponse()), &stored); err != nil {
+			t.Fatal(err)
+		}
+		return stored.RootToken
+	}
+
+	app, _, secretsManager := newTestApp(0)
+	app.config.RootTokenPolicy = rootTokenDiscard
+	if _, err := app.CheckVaultStatus(context.Background()); err != nil {
+		t.Fatalf("check status: %v", err)
+	}
+	if token := storedRootToken(secretsManager); token != "" {
+		t.Errorf("expected the root token discarded, got %q stored", token)
+	}
+
+	app, vault, secretsManager := newTestApp(0)
+	vault.apiAddr = server.URL
+	app.config.RootTokenPolicy = rootTokenRevokeAfterBootstrap
+	result, err := app.CheckVaultStatus(context.Background())
+	if err != nil {
+		t.Fatalf("check status: %v", err)
+	}
+	if !result.RootTokenRevoked || len(revoked) != 1 || revoked[0] != "root" {
+		t.Fatalf("expected the root token revoked, got %v", revoked)
+	}
+	if token := storedRootToken(secretsManager); token != "" {
+		t.Errorf("expected the revoked root token removed, got %q stored", token)
+	}
+
+	// The token is revoked once.
+	if result, err := app.CheckVaultStatus(context.Background()); err != nil || result.RootTokenRevoked {
+		t.Errorf("expected nothing revoked again, got %v", err)
+	}
+
+	if _, err := parseRootTokenPolicy("revoke"); err == nil {
+		t.Error("expected unknown policies rejected")
+	}
+}
+
+func TestRootTokenRevocationResumesAfterRestart(t *testing.T) {
+	var revoked []string
+	failing := true
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/auth/token/revoke-self" || failing {
+			http.Error(w, "unavailable", http.StatusServiceUnavailable)
+			return
+		}
+		revoked = append(revoked, r.Header.Get("X-Vault-Token"))
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+
+	app, vault, secretsManager := newTestApp(0)
+	vault.apiAddr = server.URL
+	app.config.RootTokenPolicy = rootTokenRevokeAfterBootstrap
+	if _, err := app.CheckVaultStatus(context.Background()); err == nil {
+		t.Fatalf("expected the revocation to fail")
+	}
+	if tag := secretsManager.tags["vault"][rootTokenRevocationTag]; tag != "pending" {
+		t.Fatalf("expected the revocation recorded as pending, got %q", tag)
+	}
+
+	// Restarted process, reading the root token back from the init response.
+	failing = false
+	restarted, _, _ := newTestApp(0)
+	restarted.vault, restarted.secretsManager = vault, secretsManager
+	restarted.config.RootTokenPolicy = rootTokenRevokeAfterBootstrap
+	result, err := restarted.CheckVaultStatus(context.Background())
+	if err != nil {
+		t.Fatalf("check status: %v", err)
+	}
+	if !result.RootTokenRevoked || len(revoked) != 1 || revoked[0] != "root" {
+		t.Fatalf("expected the root token revoked after the restart, got %v", revoked)
+	}
+	if tag := secretsManager.tags["vault"][rootTokenRevocationTag]; tag != "done" {
+		t.Fatalf("expected the revocation recorded as done, got %q", tag)
+	}
+}
+
+func TestBreakGlassPolicy(t *testing.T) {
+	raw, err := breakGlassPolicy("arn:aws:iam::111111111111:role/break-glass", "arn:aws:iam::111111111111:role/vault-init")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var policy struct {
+		Statement []struct {
+			Action    string
+			NotAction string
+			Condition map[string]map[string]any
+		}
+	}
+	if err := json.Unmarshal([]byte(raw), &policy); err != nil {
+		t.Fatal(err)
+	}
+	if len(policy.Statement) != 2 {
+		t.Fatalf("expected reading and managing the secret denied apart, got %s", raw)
+	}
+
+	read, manage := policy.Statement[0], policy.Statement[1]
+	if read.Action != "secretsmanager:GetSecretValue" || read.Condition["ArnNotEquals"]["aws:PrincipalArn"] != "arn:aws:iam::111111111111:role/break-glass" {
+		t.Errorf("expected reading denied to all but the break-glass role, got %s", raw)
+	}
+	exempted, _ := manage.Condition["ArnNotEquals"]["aws:PrincipalArn"].([]any)
+	if manage.NotAction != "secretsmanager:GetSecretValue" || len(exempted) != 2 || exempted[1] != "arn:aws:iam::111111111111:role/vault-init" {
+		t.Errorf("expected every other action denied to all but the break-glass and writer roles, got %s", raw)
+	}
+}
+
+// Returns a context sending the alerts to a webhook recording their text.
+func recordAlerts(t *testing.T) (context.Context, *[]string) {
+	t.Helper()
+	var alerts []string
+	webhook := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var notification alertNotification
+		if err := json.NewDecoder(r.Body).Decode(&notification); err == nil {
+			alerts = append(alerts, notification.Text)
+		}
+	}))
+	t.Cleanup(webhook.Close)
+	return withAlertTarget(context.Background(), alertTarget{WebhookURL: webhook.URL}), &alerts
+}
+
+func TestCheckRootToken(t *testing.T) {
+	tests := map[string]struct {
+		// Creation time of the token, invalid if zero.
+		created time.Time
+		maxAge  time.Duration
+		revoked bool
+		alerted bool
+	}{
+		"valid":           {created: time.Now().Add(-time.Hour)},
+		"younger":         {created: time.Now().Add(-time.Hour), maxAge: 24 * time.Hour},
+		"older":           {created: time.Now().Add(-48 * time.Hour), maxAge: 24 * time.Hour, revoked: true},
+		"no longer valid": {alerted: true},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			var revoked bool
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				switch {
+				case test.created.IsZero():
+					http.Error(w, `{"errors":["permission denied"]}`, http.StatusForbidden)
+				case r.URL.Path == "/v1/auth/token/lookup-self":
+					fmt.Fprintf(w, `{"data":{"creation_time":%d}}`, test.created.Unix())
+				case r.URL.Path == "/v1/auth/token/revoke-self":
+					revoked = true
+					w.WriteHeader(http.StatusNoContent)
+				default:
+					http.NotFound(w, r)
+				}
+			}))
+			defer server.Close()
+
+			app, vault, secretsManager := newTestApp(0)
+			if _, err := app.CheckVaultStatus(context.Background()); err != nil {
+				t.Fatalf("initialize: %v", err)
+			}
+			vault.apiAddr = server.URL
+			app.config.RootTokenMaxAge = test.maxAge
+
+			ctx, alerts := recordAlerts(t)
+			if err := app.CheckRootToken(ctx); err != nil {
+				t.Fatalf("check root token: %v", err)
+			}
+			if revoked != test.revoked {
+				t.Errorf("expected revoked %v, got %v", test.revoked, revoked)
+			}
+			var stored api.InitResponse
+			if err := json.Unmarshal([]byte(secretsManager.storedInitResponse()), &stored); err != nil {
+				t.Fatal(err)
+			}
+			if removed := stored.RootToken == ""; removed != test.revoked {
+				t.Errorf("expected the root token removed %v, got %q stored", test.revoked, stored.RootToken)
+			}
+			if alerted := len(*alerts) > 0; alerted != test.alerted {
+				t.Errorf("expected alerted %v, got %v", test.alerted, *alerts)
+			}
+		})
+	}
+}
@@ -0,0 +1,47 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/secretsmanager"
+	"github.com/aws/aws-sdk-go-v2/service/secretsmanager/types"
+)
+
+// Associate the configured rotation Lambda and schedule with the secret, without rotating it.
+// The rekey itself is performed by Vault; this only records the rotation policy in AWS Secrets Manager.
+func (a *App) ConfigureRotation(ctx context.Context) error {
+	if a.config.RotationLambdaARN == "" {
+		return nil
+	}
+
+	secret, err := a.describeSecret(ctx, false)
+	if err != nil {
+		return fmt.Errorf("describe secret: %w", err)
+	}
+
+	if aws.ToString(secret.RotationLambdaARN) == a.config.RotationLambdaARN &&
+		secret.RotationRules != nil &&
+		aws.ToString(secret.RotationRules.ScheduleExpression) == a.config.RotationSchedule {
+		slog.Debug("Secret rotation already configured")
+		return nil
+	}
+
+	_, err = a.secretsManager.RotateSecret(ctx, &secretsmanager.RotateSecretInput{
+		SecretId:          &a.config.SecretID,
+		RotationLambdaARN: &a.config.RotationLambdaARN,
+		RotationRules: &types.RotationRulesType{
+			ScheduleExpression: &a.config.RotationSchedule,
+		},
+		RotateImmediately: aws.Bool(false),
+	})
+	if err != nil {
+		return fmt.Errorf("rotate secret: %w", err)
+	}
+	a.invalidateSecretMetadata()
+
+	slog.Info("Configured secret rotation", "lambdaARN", a.config.RotationLambdaARN, "schedule", a.config.RotationSchedule)
+	return nil
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/secretsmanager"
+	"github.com/aws/aws-sdk-go-v2/service/secretsmanager/types"
+)
+
+// Records the rotation configured on the secret, unless failing with err.
+type rotatingSecretsManager struct {
+	*fakeSecretsManager
+	lambdaARN, schedule string
+	requests            int
+	err                 error
+}
+
+func (s *rotatingSecretsManager) DescribeSecret(ctx context.Context, params *secretsmanager.DescribeSecretInput, optFns ...func(*secretsmanager.Options)) (*secretsmanager.DescribeSecretOutput, error) {
+	output, err := s.fakeSecretsManager.DescribeSecret(ctx, params, optFns...)
+	if s.lambdaARN != "" {
+		output.RotationLambdaARN = &s.lambdaARN
+		output.RotationRules = &types.RotationRulesType{ScheduleExpression: &s.schedule}
+	}
+	return output, err
+}
+
+func (s *rotatingSecretsManager) RotateSecret(_ context.Context, params *secretsmanager.RotateSecretInput, _ ...func(*secretsmanager.Options)) (*secretsmanager.RotateSecretOutput, error) {
+	s.requests++
+	if s.err != nil {
+		return nil, s.err
+	}
+	if aws.ToBool(params.RotateImmediately) {
+		return nil, errors.New("expected the secret not rotated immediately")
+	}
+	s.lambdaARN, s.schedule = aws.ToString(params.RotationLambdaARN), aws.ToString(params.RotationRules.ScheduleExpression)
+	return &secretsmanager.RotateSecretOutput{}, nil
+}
+
+func TestConfigureRotation(t *testing.T) {
+	const lambdaARN = "arn:aws:lambda:us-east-1:123456789012:function:vault-rekey"
+
+	app, _, secretsManager := newTestApp(0)
+	client := &rotatingSecretsManager{fakeSecretsManager: secretsManager, lambdaARN: lambdaARN, schedule: "rate(30 days)"}
+	app.secretsManager = client
+	app.config.RotationLambdaARN, app.config.RotationSchedule = lambdaARN, "rate(90 days)"
+
+	if err := app.ConfigureRotation(context.Background()); err != nil {
+		t.Fatalf("configure rotation: %v", err)
+	}
+	if client.requests != 1 || client.schedule != "rate(90 days)" {
+		t.Fatalf("expected the schedule updated, got %d requests and %q", client.requests, client.schedule)
+	}
+
+	// Already configured.
+	if err := app.ConfigureRotation(context.Background()); err != nil || client.requests != 1 {
+		t.Fatalf("expected no other request, got %d requests, %v", client.requests, err)
+	}
+
+	app.config.RotationSchedule = "rate(7 days)"
+	client.err = &types.InvalidRequestException{Message: aws.String("rotation Lambda cannot be invoked")}
+	var invalid *types.InvalidRequestException
+	if err := app.ConfigureRotation(context.Background()); !errors.As(err, &invalid) {
+		t.Errorf("expected the rotation failure returned, got %v", err)
+	}
+}
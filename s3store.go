@@ -0,0 +1,129 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/kms"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/spf13/viper"
+)
+
+// Objects of the upstream vault-init layout: the init response JSON and the root token, each encrypted
+// with KMS.
+const (
+	vaultInitUnsealKeysObject = "unseal-keys.json.enc"
+	vaultInitRootTokenObject  = "root-token.enc"
+)
+
+// Key store keeping the payload in an S3 bucket with the layout of vault-init-aws, this tool's origin, and
+// of sethvargo/vault-init, so clusters they initialized are adopted as is. The payload is encrypted with a
+// KMS key, which takes at most 4 KiB, and the root token is also written apart for the tools reading it.
+type s3KeyStore struct {
+	client   s3API
+	kms      kmsAPI
+	bucket   string
+	kmsKeyID string
+}
+
+// Create the key store of the `s3` backend, storing in the S3_BUCKET_NAME bucket encrypted with the
+// KMS_KEY_ID key, the envs of the upstream projects.
+func newS3KeyStore() (keyStore, error) {
+	bucket := viper.GetString("s3_bucket_name")
+	if bucket == "" {
+		return nil, errors.New("S3_BUCKET_NAME env is required with the s3 secret backend")
+	}
+	kmsKeyID := viper.GetString("kms_key_id")
+	if kmsKeyID == "" {
+		return nil, errors.New("KMS_KEY_ID env is required with the s3 secret backend")
+	}
+
+	ctx := context.Background()
+	client, err := newAWSS3Client(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("create AWS S3 client: %w", err)
+	}
+	kmsClient, err := newAWSKMSClient(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("create AWS KMS client: %w", err)
+	}
+	return s3KeyStore{client: client, kms: kmsClient, bucket: bucket, kmsKeyID: kmsKeyID}, nil
+}
+
+func (s s3KeyStore) readPayload(ctx context.Context) (string, error) {
+	object, err := s.client.GetObject(ctx, &s3.GetObjectInput{Bucket: &s.bucket, Key: aws.String(vaultInitUnsealKeysObject)})
+	var noSuchKey *types.NoSuchKey
+	if errors.As(err, &noSuchKey) {
+		return "", fmt.Errorf("get S3 object: %w: %w", ErrSecretMissing, err)
+	}
+	if err != nil {
+		return "", fmt.Errorf("get S3 object: %w", err)
+	}
+	defer object.Body.Close()
+	ciphertext, err := io.ReadAll(object.Body)
+	if err != nil {
+		return "", fmt.Errorf("read S3 object: %w", err)
+	}
+
+	// vault-init-aws writes the ciphertext as is, while the GCP KMS API returns it base64 encoded, as
+	// sethvargo/vault-init writes it. KMS ciphertexts are binary, so they never decode as base64.
+	if decoded, err := base64.StdEncoding.DecodeString(strings.TrimSpace(string(ciphertext))); err == nil {
+		ciphertext = decoded
+	}
+	plaintext, err := s.kms.Decrypt(ctx, &kms.DecryptInput{KeyId: &s.kmsKeyID, CiphertextBlob: ciphertext}, withKeyRegion(s.kmsKeyID))
+	if err != nil {
+		return "", fmt.Errorf("decrypt S3 object: %w", err)
+	}
+	return string(plaintext.Plaintext), nil
+}
+
+func (s s3KeyStore) writePayload(ctx context.Context, payload string) (storedVersion, error) {
+	version, err := s.put(ctx, vaultInitUnsealKeysObject, payload)
+	if err != nil {
+		return storedVersion{}, err
+	}
+
+	// Payloads encrypted by the tool hide the root token, and the previous one must not outlive it.
+	var initResponse struct {
+		RootToken string `json:"root_token"`
+	}
+	if json.Unmarshal([]byte(payload), &initResponse) != nil || initResponse.RootToken == "" {
+		if _, err := s.client.DeleteObject(ctx, &s3.DeleteObjectInput{Bucket: &s.bucket, Key: aws.String(vaultInitRootTokenObject)}); err != nil {
+			return storedVersion{}, fmt.Errorf("delete S3 object: %w", err)
+		}
+		return version, nil
+	}
+	if _, err := s.put(ctx, vaultInitRootTokenObject, initResponse.RootToken); err != nil {
+		return storedVersion{}, err
+	}
+	return version, nil
+}
+
+// Write the plaintext encrypted with KMS to the object.
+func (s s3KeyStore) put(ctx context.Context, key, plaintext string) (storedVersion, error) {
+	encrypted, err := s.kms.Encrypt(ctx, &kms.EncryptInput{KeyId: &s.kmsKeyID, Plaintext: []byte(plaintext)}, withKeyRegion(s.kmsKeyID))
+	if err != nil {
+		return storedVersion{}, fmt.Errorf("encrypt %s: %w", key, err)
+	}
+	output, err := s.client.PutObject(ctx, &s3.PutObjectInput{
+		Bucket: &s.bucket,
+		Key:    &key,
+		Body:   bytes.NewReader(encrypted.CiphertextBlob),
+	})
+	if err != nil {
+		return storedVersion{}, fmt.Errorf("put S3 object: %w", err)
+	}
+	return storedVersion{ARN: "arn:aws:s3:::" + s.bucket + "/" + key, VersionID: aws.ToString(output.VersionId)}, nil
+}
+
+func (s s3KeyStore) exists(ctx context.Context) (bool, error) {
+	return payloadStored(ctx, s)
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"github.com/hashicorp/vault/api"
+)
+
+func TestS3KeyStore(t *testing.T) {
+	bucket := &memoryS3{objects: map[string][]byte{}, metadata: map[string]map[string]string{}}
+	store := s3KeyStore{client: bucket, kms: dataKeyKMS{}, bucket: "vault-init", kmsKeyID: "alias/vault-init"}
+
+	if stored, err := store.exists(context.Background()); err != nil || stored {
+		t.Fatalf("expected no payload in the empty bucket, got %t, %v", stored, err)
+	}
+
+	// Adopt a Vault initialized by vault-init-aws, with the KMS ciphertext stored as is.
+	app, vault, _ := newTestApp(0)
+	app.config.KeyStore = store
+	initResponse, err := vault.Init(context.Background(), &api.InitRequest{SecretShares: 5, SecretThreshold: 3})
+	if err != nil {
+		t.Fatal(err)
+	}
+	payload, err := json.Marshal(initResponse)
+	if err != nil {
+		t.Fatal(err)
+	}
+	bucket.objects[vaultInitUnsealKeysObject] = reversed(payload)
+	if _, err := app.CheckVaultStatus(context.Background()); err != nil {
+		t.Fatalf("check status: %v", err)
+	}
+	if vault.sealed || vault.inits != 1 {
+		t.Fatal("expected Vault unsealed with the keys of the bucket")
+	}
+
+	// sethvargo/vault-init stores the ciphertext base64 encoded.
+	bucket.objects[vaultInitUnsealKeysObject] = []byte(base64.StdEncoding.EncodeToString(reversed(payload)))
+	if read, err := store.readPayload(context.Background()); err != nil || read != string(payload) {
+		t.Fatalf("expected the base64 encoded payload decrypted, got %q, %v", read, err)
+	}
+
+	if _, err := store.writePayload(context.Background(), string(payload)); err != nil {
+		t.Fatalf("write payload: %v", err)
+	}
+	if token := string(reversed(bucket.objects[vaultInitRootTokenObject])); token != "root" {
+		t.Errorf("expected the root token written apart, got %q", token)
+	}
+
+	// Encrypted payloads hide the root token, which is removed rather than left stale.
+	if _, err := store.writePayload(context.Background(), "age-encryption.org/v1"); err != nil {
+		t.Fatalf("write payload: %v", err)
+	}
+	if _, ok := bucket.objects[vaultInitRootTokenObject]; ok {
+		t.Error("expected the root token object deleted")
+	}
+
+	delete(bucket.objects, vaultInitUnsealKeysObject)
+	if _, err := store.readPayload(context.Background()); !errors.Is(err, ErrSecretMissing) {
+		t.Errorf("expected ErrSecretMissing without the object, got %v", err)
+	}
+}
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+)
+
+// Size the payload of a compressed secret value may decompress to, bounding the memory a tampered value
+// could claim.
+const maxDecompressedSecretSize = 16 << 20
+
+// Magic bytes all gzip streams start with.
+var gzipMagic = []byte{0x1f, 0x8b}
+
+// Returns the SecretBinary value holding the payload, gzip compressed if compress is set.
+func encodeSecretBinary(payload string, compress bool) ([]byte, error) {
+	if !compress {
+		return []byte(payload), nil
+	}
+
+	var buf bytes.Buffer
+	w, err := gzip.NewWriterLevel(&buf, gzip.BestCompression)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := io.WriteString(w, payload); err != nil {
+		return nil, fmt.Errorf("compress payload: %w", err)
+	}
+	if err := w.Close(); err != nil {
+		return nil, fmt.Errorf("compress payload: %w", err)
+	}
+	return buf.Bytes(), nil
+}
+
+// Returns the payload of a SecretBinary value, decompressed if it is gzip compressed.
+func decodeSecretBinary(value []byte) (string, error) {
+	if !bytes.HasPrefix(value, gzipMagic) {
+		return string(value), nil
+	}
+
+	r, err := gzip.NewReader(bytes.NewReader(value))
+	if err != nil {
+		return "", fmt.Errorf("decompress secret binary: %w", err)
+	}
+	payload, err := io.ReadAll(io.LimitReader(r, maxDecompressedSecretSize+1))
+	if err != nil {
+		return "", fmt.Errorf("decompress secret binary: %w", err)
+	}
+	if len(payload) > maxDecompressedSecretSize {
+		return "", fmt.Errorf("decompress secret binary: exceeds %d bytes", maxDecompressedSecretSize)
+	}
+	return string(payload), nil
+}
@@ -0,0 +1,43 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"testing"
+)
+
+func TestSecretBinary(t *testing.T) {
+	app, vault, secretsManager := newTestApp(0)
+	app.config.SecretBinary, app.config.CompressSecret = true, true
+	if _, err := app.CheckVaultStatus(context.Background()); err != nil {
+		t.Fatalf("check status: %v", err)
+	}
+	if secretsManager.value != nil || !bytes.HasPrefix(secretsManager.binary, gzipMagic) {
+		t.Fatal("expected the init response stored as compressed binary")
+	}
+	if err := app.checkSecretUnused(context.Background()); !errors.Is(err, ErrSecretInUse) {
+		t.Errorf("expected the binary value in use, got %v", err)
+	}
+
+	vault.sealed = true
+	if _, err := app.CheckVaultStatus(context.Background()); err != nil || vault.sealed {
+		t.Fatalf("expected Vault unsealed with the compressed keys, got %v", err)
+	}
+
+	// Uncompressed binary values, and string values, are read whatever the configuration.
+	payload, err := decodeSecretBinary(secretsManager.binary)
+	if err != nil {
+		t.Fatal(err)
+	}
+	secretsManager.binary = []byte(payload)
+	if read, err := app.readSecretValue(context.Background()); err != nil || read != payload {
+		t.Errorf("expected the uncompressed binary value read as is, got %q, %v", read, err)
+	}
+	app.config.SecretBinary, app.config.CompressSecret = false, false
+	secretsManager.binary, secretsManager.value = nil, &payload
+	vault.sealed = true
+	if _, err := app.CheckVaultStatus(context.Background()); err != nil || vault.sealed {
+		t.Fatalf("expected Vault unsealed with the string value, got %v", err)
+	}
+}
@@ -0,0 +1,127 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/secretsmanager"
+	"github.com/hashicorp/vault/api"
+)
+
+// Secret holding one unseal key share, possibly in another AWS account.
+type shareSecret struct {
+	// Name or ARN of the secret, created by the tool if missing and named. Names are resolved in the account
+	// of the role.
+	ID string
+	// Role assumed to access the secret, empty to use the credentials of the tool.
+	RoleARN string
+	// Client of the role. Nil for the client of the App.
+	client secretsManagerAPI
+}
+
+// Parse the SHARE_SECRETS env: secrets separated by commas, each optionally followed by `=<role-arn>`.
+func parseShareSecrets(raw string) ([]shareSecret, error) {
+	var shares []shareSecret
+	for _, entry := range strings.Split(raw, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		id, roleARN, _ := strings.Cut(entry, "=")
+		if id == "" {
+			return nil, fmt.Errorf("share secret %d: name is empty", len(shares))
+		}
+		shares = append(shares, shareSecret{ID: id, RoleARN: roleARN})
+	}
+	if len(shares) == 1 {
+		return nil, errors.New("a single share secret holds all the shares")
+	}
+	return shares, nil
+}
+
+func (a *App) shareClient(share shareSecret) secretsManagerAPI {
+	if share.client != nil {
+		return share.client
+	}
+	return a.secretsManager
+}
+
+// Write each unseal key share to its secret, returning the init response without the shares. Shares are
+// sealed like the init response, and all must be written for the init response to be.
+func (a *App) writeShares(ctx context.Context, initResponse *api.InitResponse) (*api.InitResponse, error) {
+	if len(initResponse.KeysB64) == 0 {
+		slog.Warn("No unseal key shares to split with an auto-unseal seal, the recovery keys are stored in the init response")
+		return initResponse, nil
+	}
+	if len(initResponse.KeysB64) != len(a.config.ShareSecrets) {
+		return nil, fmt.Errorf("%d shares for %d share secrets", len(initResponse.KeysB64), len(a.config.ShareSecrets))
+	}
+
+	for i, share := range a.config.ShareSecrets {
+		data, err := json.Marshal(&api.InitResponse{Keys: []string{initResponse.Keys[i]}, KeysB64: []string{initResponse.KeysB64[i]}})
+		if err != nil {
+			return nil, fmt.Errorf("marshal share %d: %w", i, err)
+		}
+		if data, err = a.sealPayload(ctx, data); err != nil {
+			return nil, fmt.Errorf("encrypt share %d: %w", i, err)
+		}
+
+		// Secrets of other accounts use their aws/secretsmanager key, the key of the secret may not be shared.
+		kmsKeyID := a.config.SecretKMSKeyID
+		if share.RoleARN != "" {
+			kmsKeyID = ""
+		}
+		arn, err := putManagedSecret(ctx, a.shareClient(share), share.ID, fmt.Sprintf("Vault unseal key share %d of %s", i+1, a.config.SecretID), string(data), kmsKeyID)
+		a.config.Journal.record(ctx, a.journalCluster(), "share written", share.ID, err)
+		if err != nil {
+			return nil, fmt.Errorf("write share %d: %w", i, err)
+		}
+		slog.Info("Stored unseal key share", "share", i+1, "arn", arn)
+	}
+
+	stripped := *initResponse
+	stripped.Keys, stripped.KeysB64 = nil, nil
+	return &stripped, nil
+}
+
+// Add the shares of the share secrets to the init response JSON. Shares that cannot be read are skipped,
+// as the others may still reach the threshold.
+func (a *App) joinShares(ctx context.Context, secretString string) (string, error) {
+	var initResponse api.InitResponse
+	if err := json.Unmarshal([]byte(secretString), &initResponse); err != nil {
+		return "", fmt.Errorf("unmarshal init response: %w", err)
+	}
+
+	for i, share := range a.config.ShareSecrets {
+		secret, err := a.shareClient(share).GetSecretValue(ctx, &secretsmanager.GetSecretValueInput{
+			SecretId:     &share.ID,
+			VersionStage: secretVersionStage(ctx),
+		})
+		if err != nil {
+			slog.Warn("Cannot read unseal key share", "share", i+1, "secretID", share.ID, "error", err)
+			continue
+		}
+		value, err := a.openPayload(ctx, aws.ToString(secret.SecretString))
+		var shareResponse api.InitResponse
+		if err == nil {
+			err = json.Unmarshal([]byte(value), &shareResponse)
+		}
+		if err != nil {
+			slog.Warn("Cannot decode unseal key share", "share", i+1, "secretID", share.ID, "error", err)
+			continue
+		}
+		initResponse.Keys = append(initResponse.Keys, shareResponse.Keys...)
+		initResponse.KeysB64 = append(initResponse.KeysB64, shareResponse.KeysB64...)
+	}
+
+	data, err := json.Marshal(&initResponse)
+	if err != nil {
+		return "", fmt.Errorf("marshal init response: %w", err)
+	}
+	return string(data), nil
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/hashicorp/vault/api"
+)
+
+func TestShareSecrets(t *testing.T) {
+	app, vault, secretsManager := newTestApp(0)
+	otherAccount := newFakeSecretsManager()
+	shares, err := parseShareSecrets("share-1,share-2,share-3,share-4=arn:aws:iam::222222222222:role/vault-init,share-5=arn:aws:iam::222222222222:role/vault-init")
+	if err != nil || len(shares) != 5 || shares[3].RoleARN == "" {
+		t.Fatalf("expected 5 share secrets, got %+v, %v", shares, err)
+	}
+	for i := range shares {
+		if shares[i].RoleARN != "" {
+			shares[i].client = otherAccount
+		}
+	}
+	app.config.ShareSecrets = shares
+
+	if _, err := app.CheckVaultStatus(context.Background()); err != nil || vault.sealed {
+		t.Fatalf("expected Vault initialized and unsealed with the shares, got %v", err)
+	}
+
+	var stored api.InitResponse
+	if err := json.Unmarshal([]byte(secretsManager.storedInitResponse()), &stored); err != nil {
+		t.Fatal(err)
+	}
+	if len(stored.KeysB64) != 0 || stored.RootToken == "" {
+		t.Fatalf("expected the secret to hold the root token only, got %+v", stored)
+	}
+	for i, share := range shares {
+		client := secretsManager
+		if share.RoleARN != "" {
+			client = otherAccount
+		}
+		if err := json.Unmarshal([]byte(client.managed[share.ID]), &stored); err != nil || len(stored.KeysB64) != 1 || stored.KeysB64[0] != vault.keys[i] {
+			t.Errorf("expected share %d in %s, got %+v, %v", i, share.ID, stored, err)
+		}
+	}
+
+	// Losing the other account leaves a quorum, losing one more share does not.
+	delete(otherAccount.managed, "share-4")
+	delete(otherAccount.managed, "share-5")
+	vault.sealed = true
+	if _, err := app.CheckVaultStatus(context.Background()); err != nil || vault.sealed {
+		t.Fatalf("expected Vault unsealed with 3 shares, got %v", err)
+	}
+	delete(secretsManager.managed, "share-3")
+	vault.sealed = true
+	if _, err := app.CheckVaultStatus(context.Background()); err == nil {
+		t.Fatal("expected unsealing to fail with 2 shares")
+	}
+}
+
+func TestParseShareSecrets(t *testing.T) {
+	for _, raw := range []string{"share-1", "share-1,=arn:aws:iam::222222222222:role/vault-init"} {
+		if _, err := parseShareSecrets(raw); err == nil {
+			t.Errorf("%s: expected an error", raw)
+		}
+	}
+	if shares, err := parseShareSecrets(""); err != nil || len(shares) != 0 {
+		t.Errorf("expected no share secrets, got %v, %v", shares, err)
+	}
+}
@@ -0,0 +1,134 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/spf13/viper"
+)
+
+// Subset of the AWS S3 API used to read and write Raft snapshots, and the payload of the s3 backend.
+// Satisfied by *s3.Client.
+type s3API interface {
+	DeleteObject(ctx context.Context, params *s3.DeleteObjectInput, optFns ...func(*s3.Options)) (*s3.DeleteObjectOutput, error)
+	GetObject(ctx context.Context, params *s3.GetObjectInput, optFns ...func(*s3.Options)) (*s3.GetObjectOutput, error)
+	ListObjectsV2(ctx context.Context, params *s3.ListObjectsV2Input, optFns ...func(*s3.Options)) (*s3.ListObjectsV2Output, error)
+	PutObject(ctx context.Context, params *s3.PutObjectInput, optFns ...func(*s3.Options)) (*s3.PutObjectOutput, error)
+}
+
+// Create SDK client for AWS S3.
+func newAWSS3Client(ctx context.Context) (*s3.Client, error) {
+	cfg, err := loadAWSConfig(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("load SDK config: %w", err)
+	}
+
+	return s3.NewFromConfig(cfg, func(o *s3.Options) {
+		o.BaseEndpoint = endpointURL("s3")
+		o.ClientLogMode = withoutBodyLogging(o.ClientLogMode)
+	}), nil
+}
+
+// Create the snapshot store configured by the SNAPSHOT_S3_* envs, encrypting the snapshots as configured by
+// the SNAPSHOT_AGE_* and SNAPSHOT_KMS_KEY_ID envs with the KMS client.
+func newSnapshotStore(ctx context.Context, kmsClient kmsAPI) (*snapshotStore, error) {
+	bucket := viper.GetString("snapshot_s3_bucket")
+	if bucket == "" {
+		return nil, errors.New("SNAPSHOT_S3_BUCKET env is required")
+	}
+
+	client, err := newAWSS3Client(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("create AWS S3 client: %w", err)
+	}
+	encryption, err := newSnapshotEncryption(viper.GetString("snapshot_age_recipient"), viper.GetString("snapshot_age_identity_file"), viper.GetString("snapshot_kms_key_id"), kmsClient)
+	if err != nil {
+		return nil, err
+	}
+	return &snapshotStore{client: client, bucket: bucket, prefix: viper.GetString("snapshot_s3_prefix"), encryption: encryption}, nil
+}
+
+// Location of Raft snapshots in S3.
+type snapshotStore struct {
+	client s3API
+	bucket string
+	prefix string
+	// Encryption of the uploaded snapshots, also decrypting the downloaded ones.
+	encryption *snapshotEncryption
+}
+
+// Returns the key of the most recently modified snapshot under the prefix.
+func (s *snapshotStore) latest(ctx context.Context) (string, error) {
+	latest, err := s.latestObject(ctx)
+	if err != nil {
+		return "", err
+	}
+	if latest == nil {
+		return "", fmt.Errorf("no snapshot in s3://%s/%s", s.bucket, s.prefix)
+	}
+	return aws.ToString(latest.Key), nil
+}
+
+// Returns the most recently modified snapshot under the prefix, nil if there is none.
+func (s *snapshotStore) latestObject(ctx context.Context) (*types.Object, error) {
+	var latest *types.Object
+
+	paginator := s3.NewListObjectsV2Paginator(s.client, &s3.ListObjectsV2Input{
+		Bucket: &s.bucket,
+		Prefix: &s.prefix,
+	})
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("list snapshots: %w", err)
+		}
+		for i, object := range page.Contents {
+			if latest == nil || aws.ToTime(object.LastModified).After(aws.ToTime(latest.LastModified)) {
+				latest = &page.Contents[i]
+			}
+		}
+	}
+	return latest, nil
+}
+
+// Open the snapshot with the key, decrypted if it is encrypted. The caller closes the returned snapshot.
+func (s *snapshotStore) open(ctx context.Context, key string) (io.ReadCloser, error) {
+	output, err := s.client.GetObject(ctx, &s3.GetObjectInput{
+		Bucket: &s.bucket,
+		Key:    &key,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("get snapshot: %w", err)
+	}
+
+	snapshot, err := s.encryption.decrypt(ctx, output.Body, output.Metadata)
+	if err != nil {
+		output.Body.Close()
+		return nil, err
+	}
+	return struct {
+		io.Reader
+		io.Closer
+	}{snapshot, output.Body}, nil
+}
+
+// Upload the snapshot under the prefix with the name, returning its key. The metadata of encrypted
+// snapshots are stored with them.
+func (s *snapshotStore) upload(ctx context.Context, name string, snapshot io.ReadSeeker, metadata map[string]string) (string, error) {
+	key := s.prefix + name
+	_, err := s.client.PutObject(ctx, &s3.PutObjectInput{
+		Bucket:   &s.bucket,
+		Key:      &key,
+		Body:     snapshot,
+		Metadata: metadata,
+	})
+	if err != nil {
+		return "", fmt.Errorf("put snapshot: %w", err)
+	}
+	return key, nil
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+)
+
+// S3 bucket listing the objects in pages of two.
+type fakeS3 struct {
+	s3API
+	objects []types.Object
+}
+
+func (f *fakeS3) ListObjectsV2(_ context.Context, params *s3.ListObjectsV2Input, _ ...func(*s3.Options)) (*s3.ListObjectsV2Output, error) {
+	start := 0
+	if params.ContinuationToken != nil {
+		start = 2
+	}
+	end := min(start+2, len(f.objects))
+
+	output := &s3.ListObjectsV2Output{Contents: f.objects[start:end]}
+	if end < len(f.objects) {
+		output.IsTruncated = aws.Bool(true)
+		output.NextContinuationToken = aws.String("next")
+	}
+	return output, nil
+}
+
+func TestSnapshotStoreLatest(t *testing.T) {
+	now := time.Now()
+	store := &snapshotStore{
+		client: &fakeS3{objects: []types.Object{
+			{Key: aws.String("vault/1.snap"), LastModified: aws.Time(now.Add(-3 * time.Hour))},
+			{Key: aws.String("vault/2.snap"), LastModified: aws.Time(now.Add(-2 * time.Hour))},
+			{Key: aws.String("vault/4.snap"), LastModified: aws.Time(now)},
+			{Key: aws.String("vault/3.snap"), LastModified: aws.Time(now.Add(-time.Hour))},
+		}},
+		bucket: "backups",
+		prefix: "vault/",
+	}
+
+	key, err := store.latest(context.Background())
+	if err != nil {
+		t.Fatalf("latest: %v", err)
+	}
+	if key != "vault/4.snap" {
+		t.Fatalf("expected the most recent snapshot, got %s", key)
+	}
+
+	store.client = &fakeS3{}
+	if _, err := store.latest(context.Background()); err == nil {
+		t.Fatalf("expected an error without snapshots")
+	}
+}
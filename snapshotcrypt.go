@@ -0,0 +1,176 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+
+	"filippo.io/age"
+	"github.com/aws/aws-sdk-go-v2/service/kms"
+	"github.com/aws/aws-sdk-go-v2/service/kms/types"
+)
+
+// S3 object metadata holding the encrypted KMS data key of a snapshot, and its KMS key.
+const (
+	snapshotDataKeyMetadata  = "vault-init-data-key"
+	snapshotKMSKeyIDMetadata = "vault-init-kms-key-id"
+)
+
+// Header all age files start with, telling encrypted snapshots from plain ones.
+var ageHeader = []byte("age-encryption.org/")
+
+// KMS encryption context bound to the data keys of snapshots.
+var snapshotEncryptionContext = map[string]string{"purpose": "vault-init-snapshot"}
+
+// Encryption of the Raft snapshots, streamed with age to an age recipient or to a KMS data key, so the
+// snapshots, holding the whole Vault dataset, are not only protected by the bucket encryption.
+type snapshotEncryption struct {
+	// Recipient the snapshots are encrypted to, and identities decrypting them. Nil and empty if not used.
+	recipient  age.Recipient
+	identities []age.Identity
+
+	// KMS key generating a data key for each snapshot, stored encrypted in the object metadata.
+	// Empty if not used, but decrypting snapshots with a data key still requires the KMS client.
+	kms      kmsAPI
+	kmsKeyID string
+}
+
+// Create the snapshot encryption configured by the SNAPSHOT_AGE_* and SNAPSHOT_KMS_KEY_ID envs, as
+// the parameters. Without them, snapshots are uploaded as is, but KMS encrypted ones are still decrypted.
+func newSnapshotEncryption(ageRecipient, ageIdentityFile, kmsKeyID string, kmsClient kmsAPI) (*snapshotEncryption, error) {
+	if ageRecipient != "" && kmsKeyID != "" {
+		return nil, errors.New("SNAPSHOT_AGE_RECIPIENT and SNAPSHOT_KMS_KEY_ID envs are mutually exclusive")
+	}
+
+	encryption := &snapshotEncryption{kms: kmsClient, kmsKeyID: kmsKeyID}
+	if ageRecipient != "" {
+		recipient, err := age.ParseX25519Recipient(ageRecipient)
+		if err != nil {
+			return nil, fmt.Errorf("SNAPSHOT_AGE_RECIPIENT env is invalid: %w", err)
+		}
+		encryption.recipient = recipient
+	}
+	if ageIdentityFile != "" {
+		file, err := os.Open(ageIdentityFile)
+		if err != nil {
+			return nil, fmt.Errorf("SNAPSHOT_AGE_IDENTITY_FILE env is invalid: %w", err)
+		}
+		defer file.Close()
+		if encryption.identities, err = age.ParseIdentities(file); err != nil {
+			return nil, fmt.Errorf("SNAPSHOT_AGE_IDENTITY_FILE env is invalid: %w", err)
+		}
+	}
+	return encryption, nil
+}
+
+// Whether uploaded snapshots are encrypted, rather than only downloaded ones decrypted. Methods of a nil
+// encryption neither encrypt nor decrypt.
+func (e *snapshotEncryption) encrypts() bool {
+	return e != nil && (e.recipient != nil || e.kmsKeyID != "")
+}
+
+// Returns a writer encrypting to w, closed to finish the encryption, and the metadata to upload with it.
+func (e *snapshotEncryption) encrypt(ctx context.Context, w io.Writer) (io.WriteCloser, map[string]string, error) {
+	if e.recipient != nil {
+		encrypted, err := age.Encrypt(w, e.recipient)
+		if err != nil {
+			return nil, nil, fmt.Errorf("encrypt snapshot: %w", err)
+		}
+		return encrypted, nil, nil
+	}
+
+	dataKey, err := e.kms.GenerateDataKey(ctx, &kms.GenerateDataKeyInput{
+		KeyId:             &e.kmsKeyID,
+		KeySpec:           types.DataKeySpecAes256,
+		EncryptionContext: snapshotEncryptionContext,
+	}, withKeyRegion(e.kmsKeyID))
+	if err != nil {
+		return nil, nil, fmt.Errorf("generate data key: %w", err)
+	}
+
+	recipient, err := dataKeyRecipient(dataKey.Plaintext)
+	if err != nil {
+		return nil, nil, err
+	}
+	encrypted, err := age.Encrypt(w, recipient)
+	if err != nil {
+		return nil, nil, fmt.Errorf("encrypt snapshot: %w", err)
+	}
+	return encrypted, map[string]string{
+		snapshotDataKeyMetadata:  base64.StdEncoding.EncodeToString(dataKey.CiphertextBlob),
+		snapshotKMSKeyIDMetadata: e.kmsKeyID,
+	}, nil
+}
+
+// Returns the snapshot decrypted if it is encrypted, as is otherwise, using the data key in the metadata
+// if any, or the age identities.
+func (e *snapshotEncryption) decrypt(ctx context.Context, snapshot io.Reader, metadata map[string]string) (io.Reader, error) {
+	buffered := bufio.NewReader(snapshot)
+	header, err := buffered.Peek(len(ageHeader))
+	if err != nil && !errors.Is(err, io.EOF) {
+		return nil, fmt.Errorf("read snapshot: %w", err)
+	}
+	if !bytes.Equal(header, ageHeader) {
+		return buffered, nil
+	}
+
+	var identities []age.Identity
+	if encryptedKey, ok := metadata[snapshotDataKeyMetadata]; ok {
+		identity, err := e.dataKeyIdentity(ctx, encryptedKey, metadata[snapshotKMSKeyIDMetadata])
+		if err != nil {
+			return nil, err
+		}
+		identities = []age.Identity{identity}
+	} else if e != nil {
+		identities = e.identities
+	}
+	if len(identities) == 0 {
+		return nil, errors.New("snapshot is encrypted with age, set SNAPSHOT_AGE_IDENTITY_FILE to decrypt it")
+	}
+
+	decrypted, err := age.Decrypt(buffered, identities...)
+	if err != nil {
+		return nil, fmt.Errorf("decrypt snapshot: %w", err)
+	}
+	return decrypted, nil
+}
+
+func (e *snapshotEncryption) dataKeyIdentity(ctx context.Context, encryptedKey, keyID string) (age.Identity, error) {
+	if e == nil || e.kms == nil {
+		return nil, errors.New("snapshot is encrypted with a KMS data key, but no KMS client is configured")
+	}
+	blob, err := base64.StdEncoding.DecodeString(encryptedKey)
+	if err != nil {
+		return nil, fmt.Errorf("decode data key: %w", err)
+	}
+
+	dataKey, err := e.kms.Decrypt(ctx, &kms.DecryptInput{
+		KeyId:             &keyID,
+		CiphertextBlob:    blob,
+		EncryptionContext: snapshotEncryptionContext,
+	}, withKeyRegion(keyID))
+	if err != nil {
+		return nil, fmt.Errorf("decrypt data key: %w", err)
+	}
+	identity, err := age.NewScryptIdentity(base64.StdEncoding.EncodeToString(dataKey.Plaintext))
+	if err != nil {
+		return nil, fmt.Errorf("data key identity: %w", err)
+	}
+	return identity, nil
+}
+
+// Returns an age recipient for the data key. age only takes symmetric keys as scrypt passphrases, and as the
+// data key is random, scrypt adds nothing to its strength, so the lowest work factor is used.
+func dataKeyRecipient(dataKey []byte) (age.Recipient, error) {
+	recipient, err := age.NewScryptRecipient(base64.StdEncoding.EncodeToString(dataKey))
+	if err != nil {
+		return nil, fmt.Errorf("data key recipient: %w", err)
+	}
+	recipient.SetWorkFactor(1)
+	return recipient, nil
+}
@@ -0,0 +1,164 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"io"
+	"strings"
+	"testing"
+
+	"filippo.io/age"
+	"github.com/aws/aws-sdk-go-v2/service/kms"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+)
+
+// KMS generating data keys, and encrypting, with the plaintext reversed as ciphertext. Other calls panic.
+type dataKeyKMS struct {
+	kmsAPI
+}
+
+func (dataKeyKMS) GenerateDataKey(context.Context, *kms.GenerateDataKeyInput, ...func(*kms.Options)) (*kms.GenerateDataKeyOutput, error) {
+	plaintext := make([]byte, 32)
+	if _, err := rand.Read(plaintext); err != nil {
+		return nil, err
+	}
+	return &kms.GenerateDataKeyOutput{Plaintext: plaintext, CiphertextBlob: reversed(plaintext)}, nil
+}
+
+func (dataKeyKMS) Encrypt(_ context.Context, params *kms.EncryptInput, _ ...func(*kms.Options)) (*kms.EncryptOutput, error) {
+	return &kms.EncryptOutput{CiphertextBlob: reversed(params.Plaintext)}, nil
+}
+
+func (dataKeyKMS) Decrypt(_ context.Context, params *kms.DecryptInput, _ ...func(*kms.Options)) (*kms.DecryptOutput, error) {
+	return &kms.DecryptOutput{Plaintext: reversed(params.CiphertextBlob)}, nil
+}
+
+func reversed(b []byte) []byte {
+	r := make([]byte, len(b))
+	for i := range b {
+		r[len(b)-1-i] = b[i]
+	}
+	return r
+}
+
+// S3 bucket keeping the uploaded objects and their metadata in memory.
+type memoryS3 struct {
+	s3API
+	objects  map[string][]byte
+	metadata map[string]map[string]string
+}
+
+func (m *memoryS3) PutObject(_ context.Context, params *s3.PutObjectInput, _ ...func(*s3.Options)) (*s3.PutObjectOutput, error) {
+	body, err := io.ReadAll(params.Body)
+	if err != nil {
+		return nil, err
+	}
+	m.objects[*params.Key] = body
+	m.metadata[*params.Key] = params.Metadata
+	return &s3.PutObjectOutput{}, nil
+}
+
+func (m *memoryS3) DeleteObject(_ context.Context, params *s3.DeleteObjectInput, _ ...func(*s3.Options)) (*s3.DeleteObjectOutput, error) {
+	delete(m.objects, *params.Key)
+	delete(m.metadata, *params.Key)
+	return &s3.DeleteObjectOutput{}, nil
+}
+
+func (m *memoryS3) GetObject(_ context.Context, params *s3.GetObjectInput, _ ...func(*s3.Options)) (*s3.GetObjectOutput, error) {
+	if _, ok := m.objects[*params.Key]; !ok {
+		return nil, &types.NoSuchKey{}
+	}
+	return &s3.GetObjectOutput{
+		Body:     io.NopCloser(bytes.NewReader(m.objects[*params.Key])),
+		Metadata: m.metadata[*params.Key],
+	}, nil
+}
+
+// Encrypt the snapshot with the store encryption, upload it and open it back.
+func roundTripSnapshot(t *testing.T, store *snapshotStore, snapshot string) (string, error) {
+	t.Helper()
+	ctx := context.Background()
+
+	var buf bytes.Buffer
+	w, metadata, err := store.encryption.encrypt(ctx, &buf)
+	if err != nil {
+		t.Fatalf("encrypt: %v", err)
+	}
+	if _, err := io.WriteString(w, snapshot); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(buf.String(), snapshot) {
+		t.Fatal("expected the uploaded snapshot encrypted")
+	}
+
+	key, err := store.upload(ctx, "raft.snap.age", bytes.NewReader(buf.Bytes()), metadata)
+	if err != nil {
+		t.Fatalf("upload: %v", err)
+	}
+	r, err := store.open(ctx, key)
+	if err != nil {
+		return "", err
+	}
+	defer r.Close()
+	data, err := io.ReadAll(r)
+	return string(data), err
+}
+
+func TestSnapshotEncryption(t *testing.T) {
+	snapshot := strings.Repeat("raft snapshot ", 10000)
+	newStore := func(encryption *snapshotEncryption) *snapshotStore {
+		return &snapshotStore{
+			client:     &memoryS3{objects: map[string][]byte{}, metadata: map[string]map[string]string{}},
+			bucket:     "backups",
+			encryption: encryption,
+		}
+	}
+
+	// KMS encrypted snapshots are decrypted with the data key in their metadata.
+	encryption, err := newSnapshotEncryption("", "", "alias/snapshots", dataKeyKMS{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, err := roundTripSnapshot(t, newStore(encryption), snapshot); err != nil || got != snapshot {
+		t.Fatalf("expected the KMS encrypted snapshot decrypted, got %d bytes, %v", len(got), err)
+	}
+
+	identity, err := age.GenerateX25519Identity()
+	if err != nil {
+		t.Fatal(err)
+	}
+	encryption, err = newSnapshotEncryption(identity.Recipient().String(), "", "", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	store := newStore(encryption)
+	if _, err := roundTripSnapshot(t, store, snapshot); err == nil {
+		t.Fatal("expected an error decrypting without the age identity")
+	}
+	encryption.identities = []age.Identity{identity}
+	if got, err := roundTripSnapshot(t, store, snapshot); err != nil || got != snapshot {
+		t.Fatalf("expected the age encrypted snapshot decrypted, got %d bytes, %v", len(got), err)
+	}
+
+	// Snapshots uploaded by other tools are restored as is.
+	store = newStore(nil)
+	if _, err := store.upload(context.Background(), "raft.snap", strings.NewReader(snapshot), nil); err != nil {
+		t.Fatal(err)
+	}
+	r, err := store.open(context.Background(), "raft.snap")
+	if err != nil {
+		t.Fatalf("open: %v", err)
+	}
+	if data, _ := io.ReadAll(r); string(data) != snapshot {
+		t.Fatal("expected the plain snapshot as is")
+	}
+
+	if _, err := newSnapshotEncryption(identity.Recipient().String(), "", "alias/snapshots", nil); err == nil {
+		t.Error("expected age and KMS encryption rejected together")
+	}
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"time"
+
+	"github.com/hashicorp/vault/api"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var snapshotVerifiedGauge = prometheus.NewGauge(prometheus.GaugeOpts{
+	Name: "vault_init_snapshot_verified_timestamp_seconds",
+	Help: "Time of the last successful restore of the latest Raft snapshot into the scratch Vault.",
+})
+
+func init() {
+	prometheus.MustRegister(snapshotVerifiedGauge)
+}
+
+// Prove the latest Raft snapshot is restorable, restoring it into a scratch Vault as `dr restore` would and
+// reading the sentinel secret from it. The scratch Vault, never the one managed by the App, must use Raft
+// storage and ends up holding a copy of the restored data, so it must be as protected as the cluster.
+// Returns the steps run, up to the first failing one.
+func (a *App) VerifySnapshot(ctx context.Context, scratch vaultAPI, store *snapshotStore, sentinel, token string) []DRStep {
+	if scratch.Address() == a.vault.Address() {
+		return []DRStep{{Name: "check scratch vault", Err: errors.New("the scratch Vault is the managed one, refusing to restore into it")}}
+	}
+
+	scratchApp := NewApp(a.config, scratch, a.secretsManager, a.kms, a.ssm)
+	// The scratch Vault holds the previous verification, and is not subject to the maintenance windows.
+	steps := scratchApp.restoreLatestSnapshot(ctx, store, token, true)
+	if steps[len(steps)-1].Err != nil {
+		return steps
+	}
+
+	step := DRStep{Name: "read sentinel", Detail: sentinel}
+	client, err := scratch.WithToken(a.adminToken(ctx, token))
+	if err == nil {
+		var secret *api.Secret
+		secret, err = client.Logical().ReadWithContext(ctx, sentinel)
+		if err == nil && secret == nil {
+			err = errors.New("sentinel secret not found in the restored snapshot")
+		}
+	}
+	step.Err = err
+	return append(steps, step)
+}
+
+// Verify the latest snapshot every interval, alerting on failures. Runs until the context is done.
+func runSnapshotVerification(ctx context.Context, app *App, scratch vaultAPI, store *snapshotStore, sentinel, token string, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		slog.Info("Verifying the latest Raft snapshot is restorable", "scratchAddr", scratch.Address())
+		steps := app.VerifySnapshot(ctx, scratch, store, sentinel, token)
+		if last := steps[len(steps)-1]; last.Err != nil {
+			alert(ctx, "The latest Raft snapshot could not be restored, backups may be unusable", "step", last.Name, "error", last.Err)
+			continue
+		}
+		snapshotVerifiedGauge.SetToCurrentTime()
+		slog.Info("Verified the latest Raft snapshot is restorable")
+	}
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+// S3 bucket holding a single snapshot.
+type snapshotS3 struct {
+	fakeS3
+}
+
+func (f *snapshotS3) GetObject(context.Context, *s3.GetObjectInput, ...func(*s3.Options)) (*s3.GetObjectOutput, error) {
+	return &s3.GetObjectOutput{Body: io.NopCloser(strings.NewReader("snapshot"))}, nil
+}
+
+// Scratch Vault restoring snapshots through its API, holding the sentinel secret if sentinel is set.
+func scratchVault(t *testing.T, sentinel bool) vaultAPI {
+	t.Helper()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/v1/sys/storage/raft/snapshot-force":
+			w.WriteHeader(http.StatusNoContent)
+		case "/v1/sys/storage/raft/autopilot/state":
+			io.WriteString(w, `{"data": {"healthy": true, "leader": "scratch", "voters": ["scratch"]}}`)
+		case "/v1/sys/mounts":
+			io.WriteString(w, `{"data": {"kv/": {"type": "kv"}}}`)
+		case "/v1/sys/auth":
+			io.WriteString(w, `{"data": {"token/": {"type": "token"}}}`)
+		case "/v1/kv/sentinel":
+			if !sentinel {
+				http.NotFound(w, r)
+				return
+			}
+			io.WriteString(w, `{"data": {"restored": true}}`)
+		default:
+			t.Errorf("unexpected request %s %s", r.Method, r.URL.Path)
+		}
+	}))
+	t.Cleanup(server.Close)
+
+	vault := newFakeVault()
+	vault.apiAddr = server.URL
+	return addressedVault{fakeVault: vault, address: server.URL}
+}
+
+func TestRunSnapshotVerification(t *testing.T) {
+	store := &snapshotStore{
+		client: &snapshotS3{fakeS3{objects: []types.Object{{Key: aws.String("vault/1.snap"), LastModified: aws.Time(time.Now())}}}},
+		bucket: "backups",
+		prefix: "vault/",
+	}
+
+	tests := map[string]struct {
+		sentinel bool
+		verified bool
+	}{
+		"restored":         {sentinel: true, verified: true},
+		"sentinel missing": {},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			snapshotVerifiedGauge.Set(0)
+			app, _, _ := newTestApp(0)
+			ctx, alerts := recordAlerts(t)
+			ctx, cancel := context.WithTimeout(ctx, 500*time.Millisecond)
+			defer cancel()
+
+			runSnapshotVerification(ctx, app, scratchVault(t, test.sentinel), store, "kv/sentinel", "token", 100*time.Millisecond)
+
+			if verified := testutil.ToFloat64(snapshotVerifiedGauge) > 0; verified != test.verified {
+				t.Errorf("expected verified %t, got %t", test.verified, verified)
+			}
+			if !test.verified && (len(*alerts) == 0 || !strings.Contains((*alerts)[0], "could not be restored")) {
+				t.Errorf("expected the failed verification alerted, got %q", *alerts)
+			}
+		})
+	}
+}
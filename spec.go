@@ -0,0 +1,387 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"reflect"
+	"strconv"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/hashicorp/vault/api"
+)
+
+// Desired state of the Vault cluster, which the status checks converge toward. Loaded from the
+// DESIRED_STATE_FILE, defaulting to an initialized and unsealed Vault.
+type DesiredState struct {
+	Initialized bool `json:"initialized"`
+	Sealed      bool `json:"sealed"`
+
+	// Number of Raft peers expected in the cluster. 0 to not check it.
+	Peers int `json:"peers,omitempty"`
+	// Raft autopilot settings, with the names and formats of the Vault API. Settings not set are left as is.
+	Autopilot json.RawMessage `json:"autopilot,omitempty"`
+	// Raft snapshots taken and uploaded to the snapshot store. Nil to not take snapshots.
+	Snapshots *SnapshotSpec `json:"snapshots,omitempty"`
+}
+
+// SnapshotSpec declares the Raft snapshots the active node takes.
+type SnapshotSpec struct {
+	// Interval between snapshots, as a Go duration.
+	Every string `json:"every"`
+
+	interval time.Duration
+}
+
+// Desired state without a DESIRED_STATE_FILE.
+var defaultDesiredState = DesiredState{Initialized: true}
+
+// Settings of the Vault autopilot configuration API.
+var autopilotSettings = map[string]bool{
+	"cleanup_dead_servers":               true,
+	"last_contact_threshold":             true,
+	"dead_server_last_contact_threshold": true,
+	"max_trailing_logs":                  true,
+	"min_quorum":                         true,
+	"server_stabilization_time":          true,
+	"disable_upgrade_migration":          true,
+}
+
+func loadDesiredState(path string) (*DesiredState, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	state := defaultDesiredState
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&state); err != nil {
+		return nil, fmt.Errorf("parse desired state: %w", err)
+	}
+
+	if state.Peers < 0 {
+		return nil, errors.New("peers must not be negative")
+	}
+	if state.Autopilot != nil {
+		var settings map[string]json.RawMessage
+		if err := json.Unmarshal(state.Autopilot, &settings); err != nil {
+			return nil, fmt.Errorf("parse autopilot: %w", err)
+		}
+		for name := range settings {
+			if !autopilotSettings[name] {
+				return nil, fmt.Errorf("unknown autopilot setting %q", name)
+			}
+		}
+		if _, err := mergeAutopilotConfig(&api.AutopilotConfig{}, state.Autopilot); err != nil {
+			return nil, fmt.Errorf("parse autopilot: %w", err)
+		}
+	}
+	if state.Snapshots != nil {
+		if state.Snapshots.interval, err = time.ParseDuration(state.Snapshots.Every); err != nil {
+			return nil, fmt.Errorf("parse snapshots interval: %w", err)
+		}
+		if state.Snapshots.interval <= 0 {
+			return nil, errors.New("snapshots interval must be positive")
+		}
+	}
+	return &state, nil
+}
+
+// Returns the current autopilot configuration with the settings overriding it.
+func mergeAutopilotConfig(current *api.AutopilotConfig, settings json.RawMessage) (*api.AutopilotConfig, error) {
+	data, err := json.Marshal(current)
+	if err != nil {
+		return nil, err
+	}
+	var merged map[string]any
+	if err := json.Unmarshal(data, &merged); err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(settings, &merged); err != nil {
+		return nil, err
+	}
+	if data, err = json.Marshal(merged); err != nil {
+		return nil, err
+	}
+
+	var config api.AutopilotConfig
+	if err := json.Unmarshal(data, &config); err != nil {
+		return nil, err
+	}
+	return &config, nil
+}
+
+// Conditions of the desired state fields.
+type SpecCondition string
+
+const (
+	SpecConverged  SpecCondition = "converged"
+	SpecConverging SpecCondition = "converging"
+	// The field cannot converge without an operator, e.g. Vault cannot be uninitialized.
+	SpecDiverged SpecCondition = "diverged"
+	SpecFailed   SpecCondition = "failed"
+)
+
+// SpecStatus is the status of a field of the desired state after a status check.
+type SpecStatus struct {
+	Field     string        `json:"field"`
+	Desired   string        `json:"desired"`
+	Observed  string        `json:"observed,omitempty"`
+	Condition SpecCondition `json:"condition"`
+	Error     string        `json:"error,omitempty"`
+}
+
+func specStatus(field, desired, observed string, err error) SpecStatus {
+	status := SpecStatus{Field: field, Desired: desired, Observed: observed, Condition: SpecConverged}
+	switch {
+	case err != nil:
+		status.Condition = SpecFailed
+		status.Error = err.Error()
+	case desired != observed:
+		status.Condition = SpecConverging
+	}
+	return status
+}
+
+// Returns the desired state of the cluster.
+func (a *App) desiredState() *DesiredState {
+	if a.config.DesiredState != nil {
+		return a.config.DesiredState
+	}
+	return &defaultDesiredState
+}
+
+// Converge the cluster-wide fields of the desired state and report the status of every field. Vault was
+// observed in the state of the result before the check acted on it. The cluster-wide fields are only handled
+// by the active node, so they are reported once for the cluster.
+func (a *App) convergeSpec(ctx context.Context, result *CheckResult) []SpecStatus {
+	spec := a.desiredState()
+
+	initialized := result.Initialized || result.Init != nil || result.Join != nil
+	initStatus := specStatus("initialized", strconv.FormatBool(spec.Initialized), strconv.FormatBool(initialized), nil)
+	if initialized && !spec.Initialized {
+		initStatus.Condition = SpecDiverged
+	}
+	statuses := []SpecStatus{initStatus}
+
+	if result.State != StateDRSecondary && spec.Initialized {
+		sealStatus := specStatus("sealed", strconv.FormatBool(spec.Sealed), strconv.FormatBool(result.Sealed), nil)
+		// Sealing is left to operators, as a sealed node needs the keys to serve again.
+		if !result.Sealed && spec.Sealed {
+			sealStatus.Condition = SpecDiverged
+		}
+		statuses = append(statuses, sealStatus)
+	}
+
+	if result.State != StateActive || (spec.Peers == 0 && spec.Autopilot == nil && spec.Snapshots == nil) {
+		return statuses
+	}
+
+	client, err := a.specAdminClient(ctx)
+	if err != nil {
+		return append(statuses, specStatus("token", "", "", err))
+	}
+
+	if spec.Peers > 0 {
+		statuses = append(statuses, a.convergePeers(ctx, client, spec.Peers))
+	}
+	if spec.Autopilot != nil {
+		statuses = append(statuses, a.convergeAutopilot(ctx, client, spec.Autopilot))
+	}
+	if spec.Snapshots != nil {
+		statuses = append(statuses, a.convergeSnapshots(ctx, client, spec.Snapshots))
+	}
+
+	for _, status := range statuses {
+		if status.Condition == SpecFailed {
+			// The token may have been revoked or rotated since it was read.
+			a.specToken = ""
+			break
+		}
+	}
+	return statuses
+}
+
+// Returns the client to converge the cluster-wide fields with. Through a Vault Agent, requests are sent
+// without a token for the agent to add its auto-auth one, so neither the root token nor VAULT_TOKEN is read.
+func (a *App) specAdminClient(ctx context.Context) (*api.Client, error) {
+	if a.config.VaultAgent {
+		return a.vault.WithToken("")
+	}
+	return a.vault.WithToken(a.specAdminToken(ctx))
+}
+
+// Returns the token to converge the cluster-wide fields with, read once rather than on every check.
+func (a *App) specAdminToken(ctx context.Context) string {
+	if a.specToken == "" {
+		a.specToken = a.adminToken(ctx, a.config.VaultToken)
+	}
+	return a.specToken
+}
+
+// Report the number of Raft peers. Peers are added and removed by deploying nodes, not by the check.
+func (a *App) convergePeers(ctx context.Context, client *api.Client, peers int) SpecStatus {
+	state, err := readAutopilotState(ctx, client)
+	if err != nil {
+		return specStatus("peers", strconv.Itoa(peers), "", err)
+	}
+	return specStatus("peers", strconv.Itoa(peers), strconv.Itoa(len(state.Servers)), nil)
+}
+
+// Apply the autopilot settings if the configuration differs from them.
+func (a *App) convergeAutopilot(ctx context.Context, client *api.Client, settings json.RawMessage) SpecStatus {
+	desired := string(settings)
+
+	current, err := client.Sys().RaftAutopilotConfigurationWithContext(ctx)
+	if err == nil && current == nil {
+		err = errors.New("no autopilot configuration, Vault may not use Raft storage")
+	}
+	if err != nil {
+		return specStatus("autopilot", desired, "", fmt.Errorf("read autopilot configuration: %w", err))
+	}
+
+	config, err := mergeAutopilotConfig(current, settings)
+	if err != nil {
+		return specStatus("autopilot", desired, "", err)
+	}
+	if reflect.DeepEqual(config, current) {
+		return specStatus("autopilot", desired, desired, nil)
+	}
+
+	slog.Info("Applying autopilot configuration", "autopilot", desired)
+	err = client.Sys().PutRaftAutopilotConfigurationWithContext(ctx, config)
+	a.config.Journal.record(ctx, a.journalCluster(), "autopilot", desired, err)
+	if err != nil {
+		return specStatus("autopilot", desired, "", fmt.Errorf("put autopilot configuration: %w", err))
+	}
+	return specStatus("autopilot", desired, desired, nil)
+}
+
+// Take a snapshot and upload it to the snapshot store when the latest one is older than the interval.
+func (a *App) convergeSnapshots(ctx context.Context, client *api.Client, spec *SnapshotSpec) SpecStatus {
+	desired := "every " + spec.Every
+
+	if a.config.SnapshotStore == nil {
+		return specStatus("snapshots", desired, "", errors.New("no snapshot store configured"))
+	}
+
+	// The store is listed once, after which the snapshots taken by this node are tracked.
+	if a.lastSnapshot.IsZero() {
+		latest, err := a.config.SnapshotStore.latestObject(ctx)
+		if err != nil {
+			return specStatus("snapshots", desired, "", err)
+		}
+		if latest != nil {
+			a.lastSnapshot = aws.ToTime(latest.LastModified)
+		}
+	}
+
+	now := time.Now()
+	if age := now.Sub(a.lastSnapshot); age < spec.interval {
+		return specStatus("snapshots", desired, desired, nil)
+	}
+	if err := checkMaintenanceWindow("raft snapshot", now); err != nil {
+		return specStatus("snapshots", desired, "due, outside the maintenance windows", nil)
+	}
+
+	key, err := a.takeSnapshot(ctx, client, now)
+	a.config.Journal.record(ctx, a.journalCluster(), "snapshot", key, err)
+	if err != nil {
+		return specStatus("snapshots", desired, "", err)
+	}
+	a.lastSnapshot = now
+	slog.Info("Uploaded Raft snapshot", "bucket", a.config.SnapshotStore.bucket, "key", key)
+	return specStatus("snapshots", desired, desired, nil)
+}
+
+// Take a Raft snapshot right away, as requested by an operator, returning its key. Like the snapshots of the
+// desired state, it is only taken within the maintenance windows.
+func (a *App) TakeSnapshot(ctx context.Context) (string, error) {
+	if a.config.SnapshotStore == nil {
+		return "", errors.New("no snapshot store configured, set SNAPSHOT_S3_BUCKET")
+	}
+	now := time.Now()
+	if err := checkMaintenanceWindow("raft snapshot", now); err != nil {
+		return "", err
+	}
+	client, err := a.specAdminClient(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	key, err := a.takeSnapshot(ctx, client, now)
+	a.config.Journal.record(ctx, a.journalCluster(), "snapshot", key, err)
+	if err != nil {
+		return "", err
+	}
+	a.lastSnapshot = now
+	slog.Info("Uploaded Raft snapshot", "bucket", a.config.SnapshotStore.bucket, "key", key)
+	return key, nil
+}
+
+// Returns the Raft autopilot state, listing the peers of the cluster, read with the token converging the
+// desired state.
+func (a *App) RaftTopology(ctx context.Context) (*api.AutopilotState, error) {
+	client, err := a.specAdminClient(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return readAutopilotState(ctx, client)
+}
+
+func readAutopilotState(ctx context.Context, client *api.Client) (*api.AutopilotState, error) {
+	state, err := client.Sys().RaftAutopilotStateWithContext(ctx)
+	if err == nil && state == nil {
+		err = errors.New("no autopilot state, Vault may not use Raft storage")
+	}
+	if err != nil {
+		return nil, fmt.Errorf("read autopilot state: %w", err)
+	}
+	return state, nil
+}
+
+// Take a Raft snapshot and upload it, encrypted if configured, returning its key. The snapshot is buffered in
+// a temporary file, as uploads need its size.
+func (a *App) takeSnapshot(ctx context.Context, client *api.Client, now time.Time) (string, error) {
+	store := a.config.SnapshotStore
+	file, err := os.CreateTemp("", "vault-snapshot-*")
+	if err != nil {
+		return "", fmt.Errorf("create snapshot file: %w", err)
+	}
+	defer os.Remove(file.Name())
+	defer file.Close()
+
+	var (
+		name                = "raft-" + now.UTC().Format("20060102T150405Z") + ".snap"
+		snapshot  io.Writer = file
+		encrypted io.WriteCloser
+		metadata  map[string]string
+	)
+	if store.encryption.encrypts() {
+		if encrypted, metadata, err = store.encryption.encrypt(ctx, file); err != nil {
+			return "", err
+		}
+		snapshot = encrypted
+		name += ".age"
+	}
+
+	if err := client.Sys().RaftSnapshotWithContext(ctx, snapshot); err != nil {
+		return "", fmt.Errorf("take snapshot: %w", err)
+	}
+	if encrypted != nil {
+		if err := encrypted.Close(); err != nil {
+			return "", fmt.Errorf("encrypt snapshot: %w", err)
+		}
+	}
+	if _, err := file.Seek(0, 0); err != nil {
+		return "", fmt.Errorf("read snapshot file: %w", err)
+	}
+	return store.upload(ctx, name, file, metadata)
+}
@@ -0,0 +1,140 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestLoadDesiredState(t *testing.T) {
+	load := func(spec string) (*DesiredState, error) {
+		t.Helper()
+		path := filepath.Join(t.TempDir(), "spec.json")
+		if err := os.WriteFile(path, []byte(spec), 0o600); err != nil {
+			t.Fatal(err)
+		}
+		return loadDesiredState(path)
+	}
+
+	state, err := load(`{"peers": 5, "autopilot": {"cleanup_dead_servers": true, "min_quorum": 3}, "snapshots": {"every": "6h"}}`)
+	if err != nil {
+		t.Fatalf("load: %v", err)
+	}
+	if !state.Initialized || state.Sealed {
+		t.Errorf("expected initialized and unsealed by default, got %+v", state)
+	}
+	if state.Snapshots.interval != 6*time.Hour {
+		t.Errorf("expected snapshots every 6h, got %s", state.Snapshots.interval)
+	}
+
+	for _, spec := range []string{
+		`{"replicas": 3}`,
+		`{"autopilot": {"min_quorum": 3, "quorum": 3}}`,
+		`{"autopilot": {"last_contact_threshold": "soon"}}`,
+		`{"snapshots": {"every": "daily"}}`,
+		`{"snapshots": {"every": "0s"}}`,
+	} {
+		if _, err := load(spec); err == nil {
+			t.Errorf("expected %s rejected", spec)
+		}
+	}
+}
+
+func TestDesiredStateSealed(t *testing.T) {
+	app, vault, _ := newTestApp(0)
+	app.config.DesiredState = &DesiredState{Initialized: true, Sealed: true}
+
+	result, err := app.CheckVaultStatus(context.Background())
+	if err != nil {
+		t.Fatalf("check status: %v", err)
+	}
+	if vault.inits != 1 || !vault.sealed {
+		t.Fatalf("expected Vault initialized and left sealed, got %d inits, sealed %t", vault.inits, vault.sealed)
+	}
+	for _, status := range result.Spec {
+		if status.Condition != SpecConverged {
+			t.Errorf("expected %s converged, got %+v", status.Field, status)
+		}
+	}
+
+	// Vault unsealed by an operator cannot be sealed back.
+	vault.sealed = false
+	result, err = app.CheckVaultStatus(context.Background())
+	if err != nil {
+		t.Fatalf("check status: %v", err)
+	}
+	if got := result.Spec[1]; got.Field != "sealed" || got.Condition != SpecDiverged {
+		t.Errorf("expected sealed diverged, got %+v", got)
+	}
+}
+
+func TestDesiredStateUninitialized(t *testing.T) {
+	app, vault, _ := newTestApp(0)
+	app.config.DesiredState = &DesiredState{}
+
+	result, err := app.CheckVaultStatus(context.Background())
+	if err != nil {
+		t.Fatalf("check status: %v", err)
+	}
+	if vault.inits != 0 {
+		t.Fatal("expected Vault left uninitialized")
+	}
+	if len(result.Spec) != 1 || result.Spec[0].Condition != SpecConverged {
+		t.Errorf("expected initialized converged, got %+v", result.Spec)
+	}
+}
+
+func TestDesiredStateThroughVaultAgent(t *testing.T) {
+	var tokens []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/sys/storage/raft/autopilot/state" {
+			http.NotFound(w, r)
+			return
+		}
+		tokens = append(tokens, r.Header.Get("X-Vault-Token"))
+		json.NewEncoder(w).Encode(map[string]any{"data": map[string]any{
+			"healthy": true,
+			"servers": map[string]any{"vault-0": map[string]any{}, "vault-1": map[string]any{}, "vault-2": map[string]any{}},
+		}})
+	}))
+	defer server.Close()
+
+	app, vault, _ := newTestApp(0)
+	vault.apiAddr = server.URL
+	app.config.DesiredState = &DesiredState{Initialized: true, Peers: 3}
+	app.config.VaultToken = "environment"
+	app.config.VaultAgent = true
+	if _, err := app.CheckVaultStatus(context.Background()); err != nil {
+		t.Fatalf("initialize: %v", err)
+	}
+
+	result, err := app.CheckVaultStatus(context.Background())
+	if err != nil {
+		t.Fatalf("check status: %v", err)
+	}
+	if len(tokens) != 1 || tokens[0] != "" {
+		t.Fatalf("expected the autopilot state read without a token for the agent to add, got %q", tokens)
+	}
+	if got := result.Spec[len(result.Spec)-1]; got.Field != "peers" || got.Condition != SpecConverged {
+		t.Errorf("expected peers converged, got %+v", got)
+	}
+}
+
+func TestTakeSnapshot(t *testing.T) {
+	app, _, _ := newTestApp(0)
+	if _, err := app.TakeSnapshot(context.Background()); err == nil {
+		t.Fatal("expected an error without snapshot store")
+	}
+
+	closeMaintenanceWindows(t)
+	app.config.SnapshotStore = &snapshotStore{bucket: "backups"}
+	if _, err := app.TakeSnapshot(context.Background()); !errors.Is(err, ErrOutsideMaintenanceWindow) {
+		t.Fatalf("expected the snapshot refused outside the maintenance windows, got %v", err)
+	}
+}
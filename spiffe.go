@@ -0,0 +1,32 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/spiffe/go-spiffe/v2/workloadapi"
+)
+
+// Maximum wait for the first SVID from the SPIFFE Workload API at startup.
+const svidWaitTimeout = 30 * time.Second
+
+// Create a source of the workload X.509 SVID from the SPIFFE Workload API socket (e.g. a SPIRE agent).
+// The source keeps watching the Workload API, so rotated SVIDs are used for new connections.
+func newSVIDSource(ctx context.Context, socket string) (*workloadapi.X509Source, error) {
+	ctx, cancel := context.WithTimeout(ctx, svidWaitTimeout)
+	defer cancel()
+
+	source, err := workloadapi.NewX509Source(ctx, workloadapi.WithClientOptions(workloadapi.WithAddr(socket)))
+	if err != nil {
+		return nil, fmt.Errorf("watch X.509 SVID: %w", err)
+	}
+
+	svid, err := source.GetX509SVID()
+	if err != nil {
+		return nil, fmt.Errorf("get X.509 SVID: %w", err)
+	}
+	slog.Info("Obtained SPIFFE X.509 SVID", "id", svid.ID.String(), "expiresAt", svid.Certificates[0].NotAfter)
+	return source, nil
+}
@@ -0,0 +1,181 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"strconv"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/sqs"
+	"github.com/aws/aws-sdk-go-v2/service/sqs/types"
+)
+
+// Subset of the AWS SQS API used to receive reconcile events.
+// Satisfied by *sqs.Client.
+type sqsAPI interface {
+	ReceiveMessage(ctx context.Context, params *sqs.ReceiveMessageInput, optFns ...func(*sqs.Options)) (*sqs.ReceiveMessageOutput, error)
+	DeleteMessage(ctx context.Context, params *sqs.DeleteMessageInput, optFns ...func(*sqs.Options)) (*sqs.DeleteMessageOutput, error)
+	ChangeMessageVisibility(ctx context.Context, params *sqs.ChangeMessageVisibilityInput, optFns ...func(*sqs.Options)) (*sqs.ChangeMessageVisibilityOutput, error)
+}
+
+// Create SDK client for AWS SQS.
+func newAWSSQSClient(ctx context.Context) (*sqs.Client, error) {
+	cfg, err := loadAWSConfig(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("load SDK config: %w", err)
+	}
+
+	return sqs.NewFromConfig(cfg, func(o *sqs.Options) {
+		o.BaseEndpoint = endpointURL("sqs")
+	}), nil
+}
+
+// A message received from the SQS queue, or a request from the dashboard or the control API, triggering a
+// reconcile of this Vault node, or another action run by the check loop.
+type reconcileEvent struct {
+	// Instance or pod the event is about. Empty if the event is not targeted.
+	Target string
+	// Action to run, a status check if empty.
+	Action eventAction
+	// Requested through the control API, so the action runs even with automation paused.
+	Manual bool
+	// Acknowledge the event, deleting the message, or release it for redelivery on failure.
+	Done func(err error)
+}
+
+// Actions other than a status check run by the check loop, so they never overlap with a check.
+type eventAction string
+
+const (
+	// Take a Raft snapshot right away.
+	actionSnapshot eventAction = "snapshot"
+	// Unseal Vault right away, if sealed.
+	actionUnseal eventAction = "unseal"
+)
+
+// Subset of an EventBridge event, or a plain message, identifying the node it is about.
+type eventMessage struct {
+	Target string `json:"target"`
+	Detail struct {
+		EC2InstanceID string `json:"EC2InstanceId"`
+		Name          string `json:"name"`
+	} `json:"detail"`
+}
+
+func (m eventMessage) target() string {
+	switch {
+	case m.Target != "":
+		return m.Target
+	case m.Detail.EC2InstanceID != "":
+		return m.Detail.EC2InstanceID
+	default:
+		return m.Detail.Name
+	}
+}
+
+// Visibility timeout of released messages, doubling with each receive up to the maximum, so messages for
+// nodes that never consume them, e.g. other instances of the Auto Scaling group, are received less and less
+// often until the redrive policy of the queue moves them to its dead-letter queue.
+const (
+	sqsReleaseTimeout    = 30 * time.Second
+	sqsMaxReleaseTimeout = 15 * time.Minute
+)
+
+// SQS queue consumer triggering reconciles. Events targeting other nodes are released for them to consume.
+type sqsConsumer struct {
+	client   sqsAPI
+	queueURL string
+	// Identifiers of this node, e.g. its hostname and EC2 instance ID.
+	identities []string
+}
+
+// Long-poll the queue and send events for this node until the context is done.
+func (c *sqsConsumer) Run(ctx context.Context, events chan<- reconcileEvent) {
+	for ctx.Err() == nil {
+		output, err := c.client.ReceiveMessage(ctx, &sqs.ReceiveMessageInput{
+			QueueUrl:            &c.queueURL,
+			MaxNumberOfMessages: 10,
+			WaitTimeSeconds:     20,
+			MessageSystemAttributeNames: []types.MessageSystemAttributeName{
+				types.MessageSystemAttributeNameApproximateReceiveCount,
+			},
+		})
+		if err != nil {
+			slog.Error("Cannot receive SQS messages", "queueURL", c.queueURL, "error", err)
+			time.Sleep(5 * time.Second)
+			continue
+		}
+
+		for _, message := range output.Messages {
+			c.handle(ctx, message, events)
+		}
+	}
+}
+
+func (c *sqsConsumer) handle(ctx context.Context, message types.Message, events chan<- reconcileEvent) {
+	var body eventMessage
+	if err := json.Unmarshal([]byte(aws.ToString(message.Body)), &body); err != nil {
+		slog.Debug("SQS message is not JSON, reconciling anyway", "messageID", aws.ToString(message.MessageId))
+	}
+
+	target := body.target()
+	if target != "" && !c.isSelf(target) {
+		slog.Debug("SQS message targets another node", "target", target)
+		c.release(ctx, message)
+		return
+	}
+
+	done := make(chan error, 1)
+	events <- reconcileEvent{
+		Target: target,
+		Done:   func(err error) { done <- err },
+	}
+
+	if err := <-done; err != nil {
+		c.release(ctx, message)
+		return
+	}
+
+	_, err := c.client.DeleteMessage(ctx, &sqs.DeleteMessageInput{
+		QueueUrl:      &c.queueURL,
+		ReceiptHandle: message.ReceiptHandle,
+	})
+	if err != nil {
+		slog.Error("Cannot delete SQS message", "messageID", aws.ToString(message.MessageId), "error", err)
+	}
+}
+
+func (c *sqsConsumer) isSelf(target string) bool {
+	for _, identity := range c.identities {
+		if identity != "" && identity == target {
+			return true
+		}
+	}
+	return false
+}
+
+// Make the message visible again after a timeout growing with its receive count, so other consumers can
+// receive it.
+func (c *sqsConsumer) release(ctx context.Context, message types.Message) {
+	received, _ := strconv.Atoi(message.Attributes[string(types.MessageSystemAttributeNameApproximateReceiveCount)])
+	_, err := c.client.ChangeMessageVisibility(ctx, &sqs.ChangeMessageVisibilityInput{
+		QueueUrl:          &c.queueURL,
+		ReceiptHandle:     message.ReceiptHandle,
+		VisibilityTimeout: int32(releaseTimeout(received).Seconds()),
+	})
+	if err != nil {
+		slog.Error("Cannot release SQS message", "messageID", aws.ToString(message.MessageId), "error", err)
+	}
+}
+
+// Returns the visibility timeout of a message released after the given number of receives.
+func releaseTimeout(received int) time.Duration {
+	timeout := sqsReleaseTimeout
+	for i := 1; i < received && timeout < sqsMaxReleaseTimeout; i++ {
+		timeout *= 2
+	}
+	return min(timeout, sqsMaxReleaseTimeout)
+}
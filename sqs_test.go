@@ -0,0 +1,91 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/sqs"
+	"github.com/aws/aws-sdk-go-v2/service/sqs/types"
+)
+
+// SQS queue recording the deleted and released messages by receipt handle. Receiving panics.
+type fakeSQS struct {
+	sqsAPI
+	deleted  []string
+	released map[string]int32
+}
+
+func (q *fakeSQS) DeleteMessage(_ context.Context, params *sqs.DeleteMessageInput, _ ...func(*sqs.Options)) (*sqs.DeleteMessageOutput, error) {
+	q.deleted = append(q.deleted, aws.ToString(params.ReceiptHandle))
+	return &sqs.DeleteMessageOutput{}, nil
+}
+
+func (q *fakeSQS) ChangeMessageVisibility(_ context.Context, params *sqs.ChangeMessageVisibilityInput, _ ...func(*sqs.Options)) (*sqs.ChangeMessageVisibilityOutput, error) {
+	q.released[aws.ToString(params.ReceiptHandle)] = params.VisibilityTimeout
+	return &sqs.ChangeMessageVisibilityOutput{}, nil
+}
+
+func TestSQSConsumerHandle(t *testing.T) {
+	tests := map[string]struct {
+		body string
+		// Number of receives of the message so far.
+		received string
+		checkErr error
+		// Whether a check runs, and the target it is for.
+		checked bool
+		target  string
+		deleted bool
+		// Visibility timeout of the released message, in seconds.
+		released int32
+	}{
+		"self by host name":           {body: `{"target":"vault-0"}`, checked: true, target: "vault-0", deleted: true},
+		"self by instance ID":         {body: `{"detail":{"EC2InstanceId":"i-0123"}}`, checked: true, target: "i-0123", deleted: true},
+		"untargeted":                  {body: `{"detail-type":"EC2 Instance State-change Notification"}`, checked: true, deleted: true},
+		"not JSON":                    {body: "reconcile", checked: true, deleted: true},
+		"other node":                  {body: `{"target":"vault-1"}`, received: "1", released: 30},
+		"other node, redelivered":     {body: `{"detail":{"EC2InstanceId":"i-9999"}}`, received: "4", released: 240},
+		"other node, long unconsumed": {body: `{"target":"web-3"}`, received: "30", released: 900},
+		"failed check":                {body: `{"target":"vault-0"}`, received: "2", checkErr: errors.New("unseal failed"), checked: true, target: "vault-0", released: 60},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			queue := &fakeSQS{released: map[string]int32{}}
+			consumer := &sqsConsumer{client: queue, queueURL: "https://sqs.test/queue", identities: []string{"vault-0", "i-0123"}}
+
+			events := make(chan reconcileEvent, 1)
+			var checked []reconcileEvent
+			go func() {
+				for event := range events {
+					checked = append(checked, event)
+					event.Done(test.checkErr)
+				}
+			}()
+
+			message := types.Message{
+				MessageId:     aws.String("message"),
+				ReceiptHandle: aws.String("receipt"),
+				Body:          aws.String(test.body),
+				Attributes:    map[string]string{string(types.MessageSystemAttributeNameApproximateReceiveCount): test.received},
+			}
+			consumer.handle(context.Background(), message, events)
+			close(events)
+
+			if (len(checked) == 1) != test.checked {
+				t.Fatalf("expected checked %v, got %d checks", test.checked, len(checked))
+			}
+			if test.checked && (checked[0].Target != test.target || checked[0].Manual) {
+				t.Errorf("expected an automatic check for %q, got %+v", test.target, checked[0])
+			}
+			if deleted := len(queue.deleted) == 1; deleted != test.deleted {
+				t.Errorf("expected deleted %v, got %v", test.deleted, queue.deleted)
+			}
+			timeout, released := queue.released["receipt"]
+			if released != (test.released > 0) || timeout != test.released {
+				t.Errorf("expected released for %ds, got %v", test.released, queue.released)
+			}
+		})
+	}
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ssm"
+	"github.com/aws/aws-sdk-go-v2/service/ssm/types"
+)
+
+// Subset of the AWS Systems Manager API used by the App.
+// Satisfied by *ssm.Client.
+type ssmAPI interface {
+	GetParameter(ctx context.Context, params *ssm.GetParameterInput, optFns ...func(*ssm.Options)) (*ssm.GetParameterOutput, error)
+	PutParameter(ctx context.Context, params *ssm.PutParameterInput, optFns ...func(*ssm.Options)) (*ssm.PutParameterOutput, error)
+}
+
+// Create SDK client for AWS Systems Manager.
+func newAWSSSMClient(ctx context.Context) (*ssm.Client, error) {
+	cfg, err := loadAWSConfig(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("load SDK config: %w", err)
+	}
+
+	return ssm.NewFromConfig(cfg, func(o *ssm.Options) {
+		o.BaseEndpoint = endpointURL("ssm")
+	}), nil
+}
+
+// Read an SSM SecureString parameter holding the init response or a chunk of it, decrypting it.
+func (a *App) readSSMParameter(ctx context.Context, name string) (string, error) {
+	return getSSMParameter(ctx, a.ssm, name)
+}
+
+// Same as App.readSSMParameter, with another client.
+func getSSMParameter(ctx context.Context, client ssmAPI, name string) (string, error) {
+	output, err := client.GetParameter(ctx, &ssm.GetParameterInput{
+		Name:           &name,
+		WithDecryption: aws.Bool(true),
+	})
+	if err != nil {
+		var notFound *types.ParameterNotFound
+		if errors.As(err, &notFound) {
+			return "", fmt.Errorf("get SSM parameter: %w: %w", ErrSecretMissing, err)
+		}
+		return "", fmt.Errorf("get SSM parameter: %w", err)
+	}
+	if output.Parameter == nil || output.Parameter.Value == nil {
+		return "", fmt.Errorf("get SSM parameter: %w: no value", ErrSecretMissing)
+	}
+
+	slog.Debug("Read SSM parameter", "name", name, "version", output.Parameter.Version)
+	return *output.Parameter.Value, nil
+}
+
+// Returns the reader of the chunks of an init response stored in SSM parameters, for joinChunks, reading
+// each at its version if set.
+func ssmChunkReader(client ssmAPI) func(ctx context.Context, name, version string) (string, error) {
+	return func(ctx context.Context, name, version string) (string, error) {
+		if version != "" {
+			name += ":" + version
+		}
+		return getSSMParameter(ctx, client, name)
+	}
+}
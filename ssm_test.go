@@ -0,0 +1,51 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ssm"
+)
+
+// SSM parameters that must be read decrypted, unless failing with err.
+type decryptingSSM struct {
+	*memorySSM
+	err error
+}
+
+func (d *decryptingSSM) GetParameter(ctx context.Context, params *ssm.GetParameterInput, optFns ...func(*ssm.Options)) (*ssm.GetParameterOutput, error) {
+	if d.err != nil {
+		return nil, d.err
+	}
+	if !aws.ToBool(params.WithDecryption) {
+		return nil, errors.New("expected the parameter read decrypted")
+	}
+	return d.memorySSM.GetParameter(ctx, params, optFns...)
+}
+
+func TestReadSSMParameter(t *testing.T) {
+	app, vault := initializedTestApp(t, 0)
+	client := &decryptingSSM{memorySSM: newMemorySSM()}
+	app.ssm = client
+	app.config.SSMParameterName = "/vault/init"
+
+	// Not migrated yet.
+	if _, err := app.readInitResponse(context.Background()); !errors.Is(err, ErrSecretMissing) {
+		t.Fatalf("expected ErrSecretMissing, got %v", err)
+	}
+
+	// Unsealed with the keys of the parameter, not the ones of the secret.
+	secretsManager := app.secretsManager.(*fakeSecretsManager)
+	client.versions["/vault/init"] = []string{*secretsManager.value}
+	secretsManager.value = aws.String("{}")
+	if _, err := app.CheckVaultStatus(context.Background()); err != nil || vault.sealed {
+		t.Fatalf("expected Vault unsealed with the keys of the parameter, got sealed %t, %v", vault.sealed, err)
+	}
+
+	client.err = errors.New("AccessDeniedException: not authorized to perform ssm:GetParameter")
+	if _, err := app.readSSMParameter(context.Background(), "/vault/init"); err == nil || errors.Is(err, ErrSecretMissing) {
+		t.Errorf("expected the access denied returned, got %v", err)
+	}
+}
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strconv"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ssm"
+	"github.com/aws/aws-sdk-go-v2/service/ssm/types"
+	"github.com/spf13/viper"
+)
+
+// Maximum size of an advanced tier SSM parameter value. Standard tier parameters take up to 4KB.
+const maxSSMParameterSize = 8192
+
+// Key store keeping the payload in the SSM_PARAMETER_NAME SecureString parameter, encrypted with
+// SSM_KMS_KEY_ID or the aws/ssm key. Parameters are written with intelligent tiering, so SSM moves those
+// exceeding the standard tier limit to the advanced tier, and payloads exceeding the advanced tier limit too
+// are split into `<name>-chunk-<n>` parameters, the parameter holding a chunk manifest instead.
+type ssmKeyStore struct {
+	client   ssmAPI
+	name     string
+	kmsKeyID string
+}
+
+// Create the key store of the `ssm` backend.
+func newSSMKeyStore() (keyStore, error) {
+	name := viper.GetString("ssm_parameter_name")
+	if name == "" {
+		return nil, errors.New("SSM_PARAMETER_NAME env is required with the ssm secret backend")
+	}
+	client, err := newAWSSSMClient(context.Background())
+	if err != nil {
+		return nil, fmt.Errorf("create AWS SSM client: %w", err)
+	}
+	return ssmKeyStore{client: client, name: name, kmsKeyID: viper.GetString("ssm_kms_key_id")}, nil
+}
+
+func (s ssmKeyStore) readPayload(ctx context.Context) (string, error) {
+	value, err := getSSMParameter(ctx, s.client, s.name)
+	if err != nil {
+		return "", err
+	}
+	return joinChunks(ctx, value, ssmChunkReader(s.client))
+}
+
+func (s ssmKeyStore) writePayload(ctx context.Context, payload string) (storedVersion, error) {
+	value := payload
+	if len(payload) > maxSSMParameterSize {
+		var manifest chunkManifest
+		for i := 0; i*maxSSMParameterSize < len(payload); i++ {
+			name := fmt.Sprintf("%s-chunk-%d", s.name, i+1)
+			version, err := s.put(ctx, name, payload[i*maxSSMParameterSize:min((i+1)*maxSSMParameterSize, len(payload))])
+			if err != nil {
+				return storedVersion{}, fmt.Errorf("chunk %d: %w", i+1, err)
+			}
+			manifest.Chunks = append(manifest.Chunks, name)
+			manifest.Versions = append(manifest.Versions, version)
+		}
+		slog.Info("Init response exceeds the SSM parameter size limit, stored in chunks", "size", len(payload), "chunks", len(manifest.Chunks))
+
+		data, err := json.Marshal(manifest)
+		if err != nil {
+			return storedVersion{}, fmt.Errorf("marshal chunk manifest: %w", err)
+		}
+		value = string(data)
+	}
+
+	version, err := s.put(ctx, s.name, value)
+	if err != nil {
+		return storedVersion{}, err
+	}
+	return storedVersion{ARN: s.name, VersionID: version}, nil
+}
+
+// Write the value to the parameter, returning its new version.
+func (s ssmKeyStore) put(ctx context.Context, name, value string) (string, error) {
+	input := &ssm.PutParameterInput{
+		Name:      &name,
+		Value:     &value,
+		Type:      types.ParameterTypeSecureString,
+		Tier:      types.ParameterTierIntelligentTiering,
+		Overwrite: aws.Bool(true),
+	}
+	if s.kmsKeyID != "" {
+		input.KeyId = &s.kmsKeyID
+	}
+	output, err := s.client.PutParameter(ctx, input)
+	if err != nil {
+		return "", fmt.Errorf("put SSM parameter %s: %w", name, err)
+	}
+	return strconv.FormatInt(output.Version, 10), nil
+}
+
+func (s ssmKeyStore) exists(ctx context.Context) (bool, error) {
+	return payloadStored(ctx, s)
+}
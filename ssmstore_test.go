@@ -0,0 +1,77 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ssm"
+	"github.com/aws/aws-sdk-go-v2/service/ssm/types"
+)
+
+// In-memory SSM parameters, keeping every version. Parameters are read by name or as `<name>:<version>`.
+type memorySSM struct {
+	versions map[string][]string
+	tiers    map[string]types.ParameterTier
+}
+
+func newMemorySSM() *memorySSM {
+	return &memorySSM{versions: map[string][]string{}, tiers: map[string]types.ParameterTier{}}
+}
+
+func (m *memorySSM) GetParameter(_ context.Context, params *ssm.GetParameterInput, _ ...func(*ssm.Options)) (*ssm.GetParameterOutput, error) {
+	name, version, _ := strings.Cut(aws.ToString(params.Name), ":")
+	versions := m.versions[name]
+	i := len(versions)
+	if version != "" {
+		fmt.Sscan(version, &i)
+	}
+	if i < 1 || i > len(versions) {
+		return nil, &types.ParameterNotFound{Message: aws.String("parameter not found")}
+	}
+	return &ssm.GetParameterOutput{Parameter: &types.Parameter{Name: &name, Value: &versions[i-1], Version: int64(i)}}, nil
+}
+
+func (m *memorySSM) PutParameter(_ context.Context, params *ssm.PutParameterInput, _ ...func(*ssm.Options)) (*ssm.PutParameterOutput, error) {
+	name := aws.ToString(params.Name)
+	if len(aws.ToString(params.Value)) > maxSSMParameterSize {
+		return nil, fmt.Errorf("parameter %s value exceeds %d bytes", name, maxSSMParameterSize)
+	}
+	m.versions[name] = append(m.versions[name], aws.ToString(params.Value))
+	m.tiers[name] = params.Tier
+	return &ssm.PutParameterOutput{Version: int64(len(m.versions[name]))}, nil
+}
+
+func TestSSMKeyStore(t *testing.T) {
+	client := newMemorySSM()
+	store := ssmKeyStore{client: client, name: "/vault/init"}
+	ctx := context.Background()
+
+	if exists, err := store.exists(ctx); err != nil || exists {
+		t.Fatalf("expected no payload stored, got %v, %v", exists, err)
+	}
+
+	small := `{"keys_base64": ["a"]}`
+	if _, err := store.writePayload(ctx, small); err != nil {
+		t.Fatalf("write payload: %v", err)
+	}
+	if payload, err := store.readPayload(ctx); err != nil || payload != small {
+		t.Fatalf("expected the payload read back, got %q, %v", payload, err)
+	}
+	if client.tiers["/vault/init"] != types.ParameterTierIntelligentTiering {
+		t.Fatalf("expected intelligent tiering, got %q", client.tiers["/vault/init"])
+	}
+
+	large := strings.Repeat("x", 2*maxSSMParameterSize+1)
+	if _, err := store.writePayload(ctx, large); err != nil {
+		t.Fatalf("write large payload: %v", err)
+	}
+	if len(client.versions["/vault/init-chunk-3"]) != 1 {
+		t.Fatalf("expected the large payload split in 3 chunks, got %v", client.versions)
+	}
+	if payload, err := store.readPayload(ctx); err != nil || payload != large {
+		t.Fatalf("expected the large payload read back, got %d bytes, %v", len(payload), err)
+	}
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"context"
+	"fmt"
+)
+
+// VaultState is the state of a Vault node the status checks act upon.
+type VaultState string
+
+const (
+	// Not initialized: the first replica initializes Vault, the rest join its Raft cluster.
+	StateUninitialized VaultState = "uninitialized"
+	// Initialized but sealed: the node is unsealed with the stored keys.
+	StateSealed VaultState = "sealed"
+	// Sealed with a seal migration pending.
+	StateMigrating VaultState = "migrating"
+	// Unsealed standby or performance standby node.
+	StateStandby VaultState = "standby"
+	// Unsealed active node.
+	StateActive VaultState = "active"
+	// Disaster recovery secondary, never initialized nor unsealed as it uses the keys of its primary cluster.
+	StateDRSecondary VaultState = "dr-secondary"
+)
+
+var vaultStates = []VaultState{StateUninitialized, StateSealed, StateMigrating, StateStandby, StateActive, StateDRSecondary}
+
+// Read the state of the Vault node from its health and, if sealed, its seal status.
+func (a *App) readState(ctx context.Context) (*CheckResult, error) {
+	health, err := a.vault.Health(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("read health: %w", vaultError(err))
+	}
+
+	// The Vault API maps the standby (429), performance standby (473) and DR secondary (472) health codes
+	// to 299 like the uninitialized and sealed ones, so the state is read from the response instead.
+	result := &CheckResult{
+		Initialized:        health.Initialized,
+		Sealed:             health.Sealed,
+		Standby:            health.Standby,
+		PerformanceStandby: health.PerformanceStandby,
+		DRSecondary:        health.ReplicationDRMode == "secondary",
+	}
+
+	switch {
+	case result.DRSecondary:
+		result.State = StateDRSecondary
+	case !result.Initialized:
+		result.State = StateUninitialized
+	case result.Sealed:
+		status, err := a.vault.SealStatus(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("read seal status: %w", vaultError(err))
+		}
+		result.State = StateSealed
+		if status.Migration {
+			result.State = StateMigrating
+		}
+	case result.Standby || result.PerformanceStandby:
+		result.State = StateStandby
+	default:
+		result.State = StateActive
+	}
+	return result, nil
+}
@@ -0,0 +1,164 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestReadState(t *testing.T) {
+	tests := map[string]struct {
+		vault fakeVault
+		state VaultState
+	}{
+		"uninitialized": {vault: fakeVault{sealed: true}, state: StateUninitialized},
+		"sealed":        {vault: fakeVault{initialized: true, sealed: true}, state: StateSealed},
+		"migrating":     {vault: fakeVault{initialized: true, sealed: true, migration: true}, state: StateMigrating},
+		"standby":       {vault: fakeVault{initialized: true, standby: true}, state: StateStandby},
+		"active":        {vault: fakeVault{initialized: true}, state: StateActive},
+		// Never initialized by the tool, as it uses the keys of its primary cluster.
+		"dr secondary": {vault: fakeVault{sealed: true, drSecondary: true}, state: StateDRSecondary},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			app, _, _ := newTestApp(0)
+			app.vault = &test.vault
+
+			result, err := app.readState(context.Background())
+			if err != nil {
+				t.Fatalf("read state: %v", err)
+			}
+			if result.State != test.state {
+				t.Fatalf("expected %s, got %s", test.state, result.State)
+			}
+		})
+	}
+}
+
+// Vault initialized by the first replica, its keys stored in the secret, and left sealed.
+func initializedTestApp(t *testing.T, replica int) (*App, *fakeVault) {
+	t.Helper()
+	app, vault, _ := newTestApp(replica)
+	first, firstVault, _ := newTestApp(0)
+	first.secretsManager = app.secretsManager
+	if _, err := first.CheckVaultStatus(context.Background()); err != nil {
+		t.Fatalf("initialize: %v", err)
+	}
+	vault.initialized, vault.keys, vault.threshold = true, firstVault.keys, firstVault.threshold
+	return app, vault
+}
+
+func TestCheckVaultStatusTransitions(t *testing.T) {
+	tests := map[string]struct {
+		// Returns the app to check, with its Vault in the initial state.
+		setup func(t *testing.T) (*App, *fakeVault)
+		// State read by the check, and state of Vault after it.
+		state, next VaultState
+		err         error
+		inits       int
+		joins       int
+		unsealed    bool
+	}{
+		"first replica initializes and unseals": {
+			setup: func(t *testing.T) (*App, *fakeVault) {
+				app, vault, _ := newTestApp(0)
+				return app, vault
+			},
+			state: StateUninitialized, next: StateActive, inits: 1, unsealed: true,
+		},
+		"other replicas join and unseal": {
+			setup: func(t *testing.T) (*App, *fakeVault) {
+				app, vault := initializedTestApp(t, 1)
+				vault.initialized = false
+				vault.standby = true
+				return app, vault
+			},
+			state: StateUninitialized, next: StateStandby, joins: 1, unsealed: true,
+		},
+		"sealed node unseals": {
+			setup: func(t *testing.T) (*App, *fakeVault) {
+				return initializedTestApp(t, 0)
+			},
+			state: StateSealed, next: StateActive, unsealed: true,
+		},
+		"seal migration refused without VAULT_SEAL_MIGRATE": {
+			setup: func(t *testing.T) (*App, *fakeVault) {
+				app, vault := initializedTestApp(t, 0)
+				vault.migration = true
+				return app, vault
+			},
+			state: StateMigrating, next: StateMigrating, err: ErrUnsealFailed,
+		},
+		"seal migration waits for a maintenance window": {
+			setup: func(t *testing.T) (*App, *fakeVault) {
+				closeMaintenanceWindows(t)
+				app, vault := initializedTestApp(t, 0)
+				app.config.SealMigrate = true
+				vault.migration = true
+				return app, vault
+			},
+			state: StateMigrating, next: StateMigrating,
+		},
+		"seal migration unseals": {
+			setup: func(t *testing.T) (*App, *fakeVault) {
+				app, vault := initializedTestApp(t, 0)
+				app.config.SealMigrate = true
+				vault.migration = true
+				return app, vault
+			},
+			state: StateMigrating, next: StateActive, unsealed: true,
+		},
+		"standby left alone": {
+			setup: func(t *testing.T) (*App, *fakeVault) {
+				app, vault := initializedTestApp(t, 1)
+				vault.sealed, vault.standby = false, true
+				return app, vault
+			},
+			state: StateStandby, next: StateStandby,
+		},
+		"dr secondary left alone": {
+			setup: func(t *testing.T) (*App, *fakeVault) {
+				app, vault, _ := newTestApp(0)
+				vault.drSecondary = true
+				return app, vault
+			},
+			state: StateDRSecondary, next: StateDRSecondary,
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			app, vault := test.setup(t)
+			app.config.RaftLeaderAPIAddr = "https://vault-0.test:8200"
+			inits, joins := vault.inits, vault.joins
+
+			result, err := app.CheckVaultStatus(context.Background())
+			if !errors.Is(err, test.err) {
+				t.Fatalf("expected error %v, got %v", test.err, err)
+			}
+			if result.State != test.state {
+				t.Fatalf("expected the check to read %s, got %s", test.state, result.State)
+			}
+			if gauge := testutil.ToFloat64(stateGauge.WithLabelValues("", string(test.state))); gauge != 1 {
+				t.Errorf("expected the %s state recorded, got %v", test.state, gauge)
+			}
+
+			next, err := app.readState(context.Background())
+			if err != nil {
+				t.Fatalf("read state: %v", err)
+			}
+			if next.State != test.next {
+				t.Errorf("expected Vault left %s, got %s", test.next, next.State)
+			}
+			if vault.inits-inits != test.inits || vault.joins-joins != test.joins {
+				t.Errorf("expected %d inits and %d joins, got %d and %d", test.inits, test.joins, vault.inits-inits, vault.joins-joins)
+			}
+			if unsealed := result.Unseal != nil && !result.Unseal.Sealed; unsealed != test.unsealed {
+				t.Errorf("expected unsealed %v, got %+v", test.unsealed, result.Unseal)
+			}
+		})
+	}
+}
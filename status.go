@@ -0,0 +1,95 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"os"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/secretsmanager"
+	"github.com/aws/aws-sdk-go-v2/service/secretsmanager/types"
+)
+
+// Tags linking the status secret and the secret holding the keys, for External Secrets Operator to find the
+// status secret by tags, and operators to find one from the other.
+const (
+	statusSecretTag = "vault-init:status-secret"
+	statusOfTag     = "vault-init:status-of"
+)
+
+// Status of the Vault node published for External Secrets Operator, as a flat JSON object whose properties
+// ExternalSecrets extract. Never holds keys nor tokens.
+type publishedStatus struct {
+	Cluster     string     `json:"cluster,omitempty"`
+	Node        string     `json:"node"`
+	SecretID    string     `json:"secretID"`
+	State       VaultState `json:"state"`
+	Initialized bool       `json:"initialized"`
+	Sealed      bool       `json:"sealed"`
+	DRSecondary bool       `json:"drSecondary"`
+	// Time the status last changed, as the secret is only updated on changes.
+	ChangedAt time.Time `json:"changedAt"`
+}
+
+// Publish the observed Vault status to the status secret, creating it on first use and tagging both secrets.
+// The secret is only written when the status changed, so its versions track the state transitions.
+func (a *App) PublishStatus(ctx context.Context, result *CheckResult) error {
+	status := publishedStatus{
+		Cluster:     a.config.Cluster,
+		Node:        os.Getenv("HOSTNAME"),
+		SecretID:    a.config.SecretID,
+		State:       result.State,
+		Initialized: result.Initialized,
+		Sealed:      result.Sealed,
+		DRSecondary: result.DRSecondary,
+	}
+	if a.publishedStatus != nil && *a.publishedStatus == status {
+		return nil
+	}
+
+	published := status
+	published.ChangedAt = time.Now().UTC()
+	value, err := json.Marshal(published)
+	if err != nil {
+		return fmt.Errorf("marshal status: %w", err)
+	}
+
+	arn, err := a.putManagedSecret(ctx, a.config.StatusSecretName, "Status of the Vault cluster using "+a.config.SecretID, string(value), "")
+	if err != nil {
+		return err
+	}
+	a.publishedStatus = &status
+	slog.Debug("Published status", "statusSecret", arn, "state", status.State)
+
+	if a.statusTagged {
+		return nil
+	}
+	if err := a.tagStatusSecrets(ctx); err != nil {
+		return err
+	}
+	a.statusTagged = true
+	return nil
+}
+
+func (a *App) tagStatusSecrets(ctx context.Context) error {
+	_, err := a.secretsManager.TagResource(ctx, &secretsmanager.TagResourceInput{
+		SecretId: &a.config.StatusSecretName,
+		Tags:     []types.Tag{{Key: aws.String(statusOfTag), Value: &a.config.SecretID}},
+	})
+	if err != nil {
+		return fmt.Errorf("tag status secret: %w", err)
+	}
+
+	_, err = a.secretsManager.TagResource(ctx, &secretsmanager.TagResourceInput{
+		SecretId: &a.config.SecretID,
+		Tags:     []types.Tag{{Key: aws.String(statusSecretTag), Value: &a.config.StatusSecretName}},
+	})
+	if err != nil {
+		return fmt.Errorf("tag secret: %w", err)
+	}
+	a.invalidateSecretMetadata()
+	return nil
+}
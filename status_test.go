@@ -0,0 +1,50 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestPublishStatus(t *testing.T) {
+	app, _, secretsManager := newTestApp(0)
+	app.config.StatusSecretName = "vault-status"
+
+	if _, err := app.CheckVaultStatus(context.Background()); err != nil {
+		t.Fatalf("check status: %v", err)
+	}
+	var status publishedStatus
+	if err := json.Unmarshal([]byte(secretsManager.managed["vault-status"]), &status); err != nil {
+		t.Fatalf("unmarshal status: %v", err)
+	}
+	if status.State != StateUninitialized || status.SecretID != "vault" {
+		t.Fatalf("expected the uninitialized state published, got %+v", status)
+	}
+	if secretsManager.tags["vault"][statusSecretTag] != "vault-status" || secretsManager.tags["vault-status"][statusOfTag] != "vault" {
+		t.Fatalf("expected both secrets tagged, got %v", secretsManager.tags)
+	}
+
+	// The next check observes Vault unsealed by the first one.
+	if _, err := app.CheckVaultStatus(context.Background()); err != nil {
+		t.Fatalf("check status: %v", err)
+	}
+	published := secretsManager.managed["vault-status"]
+	if err := json.Unmarshal([]byte(published), &status); err != nil {
+		t.Fatalf("unmarshal status: %v", err)
+	}
+	if status.State != StateActive || !status.Initialized || status.Sealed {
+		t.Fatalf("expected the active state published, got %+v", status)
+	}
+	if strings.Contains(published, "root") || strings.Contains(published, "keys") {
+		t.Fatalf("expected no keys nor tokens in the status, got %s", published)
+	}
+
+	// Unchanged statuses are not written again.
+	if _, err := app.CheckVaultStatus(context.Background()); err != nil {
+		t.Fatalf("check status: %v", err)
+	}
+	if secretsManager.managed["vault-status"] != published {
+		t.Fatal("expected the unchanged status not written again")
+	}
+}
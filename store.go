@@ -0,0 +1,202 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"log/slog"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/secretsmanager"
+	"github.com/aws/aws-sdk-go-v2/service/secretsmanager/types"
+)
+
+// Store of the init response payload, after envelope encryption. The AWS Secrets Manager secret is the
+// built-in store, and the backends selected with SECRET_BACKEND provide others.
+type keyStore interface {
+	// Read the stored payload, failing with ErrSecretMissing if there is none.
+	readPayload(ctx context.Context) (string, error)
+	// Store the payload, returning the stored version.
+	writePayload(ctx context.Context, payload string) (storedVersion, error)
+	// Whether a payload is stored, which initializing again would overwrite.
+	exists(ctx context.Context) (bool, error)
+}
+
+// Name of the built-in backend, storing in the AWS Secrets Manager secret.
+const secretsManagerBackend = "secretsmanager"
+
+// Constructors of the other backends selectable with SECRET_BACKEND, creating the store from their envs.
+var keyStoreBackends = map[string]func() (keyStore, error){
+	"plugin":           newPluginKeyStore,
+	"gcpsecretmanager": newGCPSecretManagerStore,
+	"azurekeyvault":    newAzureKeyVaultStore,
+	"kubernetes":       newKubernetesSecretStore,
+	"file":             newFileKeyStore,
+	"s3":               newS3KeyStore,
+	"ssm":              newSSMKeyStore,
+}
+
+// Returns the store of the backend, nil for the built-in one.
+func newKeyStore(backend string) (keyStore, error) {
+	if backend == secretsManagerBackend {
+		return nil, nil
+	}
+	newStore, ok := keyStoreBackends[backend]
+	if !ok {
+		backends := []string{secretsManagerBackend}
+		for name := range keyStoreBackends {
+			backends = append(backends, name)
+		}
+		sort.Strings(backends)
+		return nil, fmt.Errorf("unknown secret backend %q, expected one of %s", backend, strings.Join(backends, ", "))
+	}
+	return newStore()
+}
+
+// Whether the store holds a payload, for stores telling it only by reading it.
+func payloadStored(ctx context.Context, store keyStore) (bool, error) {
+	_, err := store.readPayload(ctx)
+	if errors.Is(err, ErrSecretMissing) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// Identifies a stored version of the payload. Fields the store has no equivalent for are empty.
+type storedVersion struct {
+	ARN       string
+	VersionID string
+}
+
+// Returns the store of the init response, mirrored if configured.
+func (a *App) keyStore() keyStore {
+	var primary keyStore = secretsManagerStore{app: a}
+	if a.config.KeyStore != nil {
+		primary = a.config.KeyStore
+	}
+	if len(a.config.KeyStoreMirrors) == 0 {
+		return primary
+	}
+
+	mirrors := make([]keyStoreMirror, len(a.config.KeyStoreMirrors))
+	for i, mirror := range a.config.KeyStoreMirrors {
+		if mirror.store == nil {
+			mirror.store = secretsManagerStore{app: a}
+		}
+		mirrors[i] = mirror
+	}
+	return mirroredKeyStore{primary: primary, mirrors: mirrors}
+}
+
+// Whether the AWS Secrets Manager secret stores the init response, as the primary store or a mirror.
+func (a *App) usesSecretsManager() bool {
+	if a.config.KeyStore == nil {
+		return true
+	}
+	for _, mirror := range a.config.KeyStoreMirrors {
+		if mirror.store == nil {
+			return true
+		}
+	}
+	return false
+}
+
+// Context key of the client request token of the Secrets Manager write of a payload.
+type writeTokenKey struct{}
+
+// Returns the context of a payload write, whose client request token is derived from the secret and the
+// unencrypted payload. Retries after a write was applied but not confirmed then find the version stored
+// rather than adding another, possibly diverging if the payload is encrypted again.
+func withWriteToken(ctx context.Context, secretID string, payload []byte) context.Context {
+	sum := sha256.Sum256(append([]byte(secretID+"\n"), payload...))
+	token := fmt.Sprintf("%x-%x-%x-%x-%x", sum[0:4], sum[4:6], sum[6:8], sum[8:10], sum[10:16])
+	return context.WithValue(ctx, writeTokenKey{}, token)
+}
+
+// Built-in store, keeping the payload in the AWS Secrets Manager secret, as a string split in chunks if too
+// large, or as binary if configured.
+type secretsManagerStore struct {
+	app *App
+}
+
+func (s secretsManagerStore) readPayload(ctx context.Context) (string, error) {
+	slog.Info("Fetching unseal keys...", "secretID", s.app.config.SecretID)
+	secretString, err := s.app.readSecretValue(ctx)
+	if err != nil {
+		return "", err
+	}
+	return joinChunks(ctx, secretString, s.app.readSecretChunk)
+}
+
+func (s secretsManagerStore) writePayload(ctx context.Context, payload string) (storedVersion, error) {
+	input := &secretsmanager.PutSecretValueInput{SecretId: &s.app.config.SecretID}
+	if token, ok := ctx.Value(writeTokenKey{}).(string); ok {
+		input.ClientRequestToken = &token
+	}
+	if s.app.config.SecretBinary {
+		binary, err := encodeSecretBinary(payload, s.app.config.CompressSecret)
+		if err != nil {
+			return storedVersion{}, err
+		}
+		if len(binary) <= maxSecretSize {
+			input.SecretBinary = binary
+		} else {
+			slog.Info("Binary init response exceeds the secret size limit, stored as a string", "size", len(binary))
+		}
+	}
+	if input.SecretBinary == nil {
+		secretString, err := s.app.chunkPayload(ctx, payload)
+		if err != nil {
+			return storedVersion{}, err
+		}
+		input.SecretString = &secretString
+	}
+
+	output, err := s.app.secretsManager.PutSecretValue(ctx, input)
+	var exists *types.ResourceExistsException
+	if errors.As(err, &exists) && input.ClientRequestToken != nil {
+		// A previous attempt stored the payload, encrypted differently. It is only kept if still current,
+		// as writing the same payload again later must replace what was written meanwhile.
+		current, currentErr := s.currentVersion(ctx, *input.ClientRequestToken)
+		if currentErr != nil {
+			return storedVersion{}, currentErr
+		}
+		if current != nil {
+			return storedVersion{ARN: aws.ToString(current.ARN), VersionID: aws.ToString(current.VersionId)}, nil
+		}
+		slog.Info("Init response was stored before but is no longer current, storing it again", "versionID", *input.ClientRequestToken)
+		input.ClientRequestToken = nil
+		output, err = s.app.secretsManager.PutSecretValue(ctx, input)
+	}
+	if err != nil {
+		return storedVersion{}, err
+	}
+	return storedVersion{ARN: aws.ToString(output.ARN), VersionID: aws.ToString(output.VersionId)}, nil
+}
+
+// Returns the version of the secret if it is the current one, nil otherwise.
+func (s secretsManagerStore) currentVersion(ctx context.Context, versionID string) (*secretsmanager.GetSecretValueOutput, error) {
+	secret, err := s.app.secretsManager.GetSecretValue(ctx, &secretsmanager.GetSecretValueInput{
+		SecretId:  &s.app.config.SecretID,
+		VersionId: &versionID,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("get AWS secret version %s: %w", versionID, err)
+	}
+	if !slices.Contains(secret.VersionStages, "AWSCURRENT") {
+		return nil, nil
+	}
+	return secret, nil
+}
+
+func (s secretsManagerStore) exists(ctx context.Context) (bool, error) {
+	err := s.app.checkSecretsManagerUnused(ctx)
+	if errors.Is(err, ErrSecretInUse) {
+		return true, nil
+	}
+	return false, err
+}
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"filippo.io/age"
+	"github.com/hashicorp/vault/api"
+)
+
+// Key store keeping the payload in memory.
+type memoryKeyStore struct {
+	payload string
+}
+
+func (s *memoryKeyStore) readPayload(context.Context) (string, error) {
+	if s.payload == "" {
+		return "", ErrSecretMissing
+	}
+	return s.payload, nil
+}
+
+func (s *memoryKeyStore) writePayload(_ context.Context, payload string) (storedVersion, error) {
+	s.payload = payload
+	return storedVersion{VersionID: "memory"}, nil
+}
+
+func (s *memoryKeyStore) exists(ctx context.Context) (bool, error) {
+	return payloadStored(ctx, s)
+}
+
+func TestNewKeyStore(t *testing.T) {
+	store := &memoryKeyStore{}
+	keyStoreBackends["memory"] = func() (keyStore, error) { return store, nil }
+	defer delete(keyStoreBackends, "memory")
+
+	if got, err := newKeyStore(secretsManagerBackend); got != nil || err != nil {
+		t.Errorf("expected no store for the built-in backend, got %v, %v", got, err)
+	}
+	if _, err := newKeyStore("gcs"); err == nil {
+		t.Error("expected unknown backends rejected")
+	}
+
+	got, err := newKeyStore("memory")
+	if err != nil {
+		t.Fatal(err)
+	}
+	app, vault, secretsManager := newTestApp(0)
+	app.config.KeyStore = got
+	if _, err := app.CheckVaultStatus(context.Background()); err != nil {
+		t.Fatalf("check status: %v", err)
+	}
+	if vault.sealed || store.payload == "" || secretsManager.value != nil {
+		t.Fatal("expected Vault unsealed with the keys stored in memory only")
+	}
+	if err := app.checkSecretUnused(context.Background()); !errors.Is(err, ErrSecretInUse) {
+		t.Errorf("expected ErrSecretInUse, got %v", err)
+	}
+}
+
+func TestSecretsManagerStoreExists(t *testing.T) {
+	app, _, _ := newTestApp(0)
+	store := app.keyStore()
+	if stored, err := store.exists(context.Background()); err != nil || stored {
+		t.Fatalf("expected no payload before initialization, got %v, %v", stored, err)
+	}
+	if _, err := app.CheckVaultStatus(context.Background()); err != nil {
+		t.Fatalf("check status: %v", err)
+	}
+	if stored, err := store.exists(context.Background()); err != nil || !stored {
+		t.Errorf("expected the payload stored after initialization, got %v, %v", stored, err)
+	}
+}
+
+func TestSecretsManagerStoreIdempotentWrites(t *testing.T) {
+	app, _, secretsManager := newTestApp(0)
+	identity, err := age.GenerateX25519Identity()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Encrypted differently on each write.
+	app.config.PayloadAgeRecipients = []age.Recipient{identity.Recipient()}
+	app.config.PayloadAgeIdentities = []age.Identity{identity}
+
+	first := &api.InitResponse{KeysB64: []string{"AQ=="}, RootToken: "root"}
+	written, err := app.writeInitResponse(context.Background(), first)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Retried after the write was applied, but not confirmed.
+	retried, err := app.writeInitResponse(context.Background(), first)
+	if err != nil {
+		t.Fatalf("retry: %v", err)
+	}
+	if retried.VersionID != written.VersionID || secretsManager.version != 1 {
+		t.Fatalf("expected the retry to find version %s, got %s and %d versions", written.VersionID, retried.VersionID, secretsManager.version)
+	}
+
+	// The same init response written again after another one is stored as a new version.
+	if _, err := app.writeInitResponse(context.Background(), &api.InitResponse{KeysB64: []string{"Ag=="}}); err != nil {
+		t.Fatal(err)
+	}
+	again, err := app.writeInitResponse(context.Background(), first)
+	if err != nil {
+		t.Fatalf("write again: %v", err)
+	}
+	if again.VersionID == written.VersionID || secretsManager.version != 3 {
+		t.Fatalf("expected a new version, got %s and %d versions", again.VersionID, secretsManager.version)
+	}
+	if stored, err := app.readInitResponse(context.Background()); err != nil || !strings.Contains(stored, "AQ==") {
+		t.Errorf("expected the first init response current, got %s, %v", stored, err)
+	}
+}
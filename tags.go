@@ -0,0 +1,112 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"runtime/debug"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/secretsmanager"
+	"github.com/aws/aws-sdk-go-v2/service/secretsmanager/types"
+)
+
+// Apply the configured tags to the secret. Existing tags with other keys are kept.
+func (a *App) TagSecret(ctx context.Context) error {
+	if len(a.config.Tags) == 0 {
+		return nil
+	}
+
+	keys := make([]string, 0, len(a.config.Tags))
+	for key := range a.config.Tags {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	tags := make([]types.Tag, 0, len(keys))
+	for _, key := range keys {
+		tags = append(tags, types.Tag{Key: aws.String(key), Value: aws.String(a.config.Tags[key])})
+	}
+
+	_, err := a.secretsManager.TagResource(ctx, &secretsmanager.TagResourceInput{
+		SecretId: &a.config.SecretID,
+		Tags:     tags,
+	})
+	if err != nil {
+		return fmt.Errorf("tag secret: %w", err)
+	}
+	a.invalidateSecretMetadata()
+
+	slog.Debug("Tagged secret", "tags", a.config.Tags)
+	return nil
+}
+
+// Tags describing the cluster whose keys the secret holds, set after initialization.
+const (
+	clusterTag       = "vault-init:cluster"
+	vaultVersionTag  = "vault-init:vault-version"
+	initializedAtTag = "vault-init:initialized-at"
+	sharesTag        = "vault-init:shares"
+	thresholdTag     = "vault-init:threshold"
+	toolVersionTag   = "vault-init:tool-version"
+)
+
+// Tag the secret with the metadata of the cluster just initialized, so auditors and other automation find
+// which secret belongs to which cluster without reading it. Secrets of other key stores are left untagged.
+func (a *App) TagClusterMetadata(ctx context.Context, result *InitResult) error {
+	if !a.usesSecretsManager() {
+		return nil
+	}
+
+	shares, threshold := result.SecretShares, result.SecretThreshold
+	if result.RecoveryShares > 0 {
+		shares, threshold = result.RecoveryShares, result.RecoveryThreshold
+	}
+	metadata := map[string]string{
+		clusterTag:       a.journalCluster(),
+		initializedAtTag: time.Now().UTC().Format(time.RFC3339),
+		sharesTag:        strconv.Itoa(shares),
+		thresholdTag:     strconv.Itoa(threshold),
+		toolVersionTag:   toolVersion(),
+	}
+	if health, err := a.vault.Health(ctx); err != nil {
+		slog.Warn("Cannot read the Vault version to tag the secret with", "error", err)
+	} else if health.Version != "" {
+		metadata[vaultVersionTag] = health.Version
+	}
+
+	keys := make([]string, 0, len(metadata))
+	for key := range metadata {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	tags := make([]types.Tag, 0, len(keys))
+	for _, key := range keys {
+		tags = append(tags, types.Tag{Key: aws.String(key), Value: aws.String(metadata[key])})
+	}
+
+	_, err := a.secretsManager.TagResource(ctx, &secretsmanager.TagResourceInput{
+		SecretId: &a.config.SecretID,
+		Tags:     tags,
+	})
+	if err != nil {
+		return fmt.Errorf("tag secret: %w", err)
+	}
+	a.invalidateSecretMetadata()
+
+	slog.Info("Tagged secret with the cluster metadata", "tags", metadata)
+	return nil
+}
+
+// Returns the version of this tool, as recorded by go install or a build from a tagged module, and
+// "(devel)" when built from a checkout.
+func toolVersion() string {
+	info, ok := debug.ReadBuildInfo()
+	if !ok || info.Main.Version == "" {
+		return "(devel)"
+	}
+	return info.Main.Version
+}
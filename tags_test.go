@@ -0,0 +1,41 @@
+package main
+
+import (
+	"context"
+	"testing"
+)
+
+func TestInitTagsSecretWithClusterMetadata(t *testing.T) {
+	app, _, secretsManager := newTestApp(0)
+	app.config.Cluster = "prod"
+
+	if _, err := app.CheckVaultStatus(context.Background()); err != nil {
+		t.Fatalf("initialize: %v", err)
+	}
+
+	tags := secretsManager.tags["vault"]
+	expected := map[string]string{
+		clusterTag:      "prod",
+		vaultVersionTag: "1.15.4",
+		sharesTag:       "5",
+		thresholdTag:    "3",
+		toolVersionTag:  toolVersion(),
+	}
+	for key, value := range expected {
+		if tags[key] != value {
+			t.Errorf("expected tag %s=%q, got %q", key, value, tags[key])
+		}
+	}
+	if tags[initializedAtTag] == "" {
+		t.Errorf("expected the %s tag, got %v", initializedAtTag, tags)
+	}
+
+	// Outside fleet mode, the cluster is named after its secret.
+	app, _, secretsManager = newTestApp(0)
+	if _, err := app.CheckVaultStatus(context.Background()); err != nil {
+		t.Fatalf("initialize: %v", err)
+	}
+	if tag := secretsManager.tags["vault"][clusterTag]; tag != "vault" {
+		t.Errorf("expected the cluster named after the secret, got %q", tag)
+	}
+}
@@ -0,0 +1,202 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"slices"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/secretsmanager"
+	"github.com/aws/aws-sdk-go-v2/service/secretsmanager/types"
+	"github.com/hashicorp/vault/api"
+)
+
+// Settings of the transit auto-unseal bootstrap.
+type transitSettings struct {
+	// Transit secrets engine mount and key on the management Vault.
+	MountPath string
+	KeyName   string
+	// Secret the token of the seal stanza is stored in, and the period of the token.
+	TokenSecretName string
+	TokenPeriod     time.Duration
+}
+
+// Seal stanza of the workload cluster, printed for operators. The token is read from the secret.
+type transitSeal struct {
+	Address         string `json:"address"`
+	MountPath       string `json:"mountPath"`
+	KeyName         string `json:"keyName"`
+	TokenSecretARN  string `json:"tokenSecretARN"`
+	TokenPolicyName string `json:"tokenPolicyName"`
+}
+
+// Returns the policy allowing the seal to use the key, and only that.
+func transitPolicy(settings transitSettings) (string, string) {
+	name := "vault-init-transit-" + settings.KeyName
+	policy := fmt.Sprintf(`path "%[1]s/encrypt/%[2]s" {
+  capabilities = ["update"]
+}
+
+path "%[1]s/decrypt/%[2]s" {
+  capabilities = ["update"]
+}
+`, settings.MountPath, settings.KeyName)
+	return name, policy
+}
+
+// Prepare the management Vault to auto-unseal the workload cluster with transit: enable the secrets engine
+// and create the key if missing, write the policy of the seal, and mint a periodic orphan token with it,
+// stored in the token secret. A stored token still valid with the policy is kept. Each step is added to
+// the output, up to the first failing one.
+func (a *App) BootstrapTransit(ctx context.Context, management *api.Client, settings transitSettings, output *commandOutput) *transitSeal {
+	seal := &transitSeal{Address: management.Address(), MountPath: settings.MountPath, KeyName: settings.KeyName}
+
+	detail, err := ensureTransitMount(ctx, management, settings.MountPath)
+	output.step("check transit mount", detail, err)
+	if err != nil {
+		return nil
+	}
+
+	detail, err = ensureTransitKey(ctx, management, settings)
+	output.step("check transit key", detail, err)
+	if err != nil {
+		return nil
+	}
+
+	name, policy := transitPolicy(settings)
+	seal.TokenPolicyName = name
+	err = management.Sys().PutPolicyWithContext(ctx, name, policy)
+	output.step("write seal policy", name, err)
+	if err != nil {
+		return nil
+	}
+
+	arn, valid, err := a.storedTransitToken(ctx, management, settings.TokenSecretName, name)
+	if err != nil {
+		output.step("check stored token", "", err)
+		return nil
+	}
+	if valid {
+		output.step("check stored token", "valid, kept", nil)
+		seal.TokenSecretARN = arn
+		return seal
+	}
+
+	token, err := management.Auth().Token().CreateOrphanWithContext(ctx, &api.TokenCreateRequest{
+		Policies:        []string{name},
+		NoDefaultPolicy: true,
+		Period:          settings.TokenPeriod.String(),
+		DisplayName:     "vault-init-transit-seal",
+		Renewable:       aws.Bool(true),
+	})
+	if err == nil && (token == nil || token.Auth == nil) {
+		err = errors.New("no token in the response")
+	}
+	if err != nil {
+		output.step("create seal token", "", err)
+		return nil
+	}
+	output.step("create seal token", "accessor "+token.Auth.Accessor, nil)
+
+	// The token is only known to the management Vault otherwise.
+	ctx = context.WithoutCancel(ctx)
+	seal.TokenSecretARN, err = a.putManagedSecret(ctx, settings.TokenSecretName, "Transit seal token of "+a.config.SecretID, token.Auth.ClientToken, a.config.SecretKMSKeyID)
+	a.config.Journal.record(ctx, a.journalCluster(), "transit token stored", settings.TokenSecretName, err)
+	output.step("store seal token", seal.TokenSecretARN, err)
+	if err != nil {
+		return nil
+	}
+	return seal
+}
+
+// Enable the transit secrets engine at the path unless mounted, failing if another engine is.
+func ensureTransitMount(ctx context.Context, client *api.Client, path string) (string, error) {
+	mounts, err := client.Sys().ListMountsWithContext(ctx)
+	if err != nil {
+		return "", fmt.Errorf("list mounts: %w", err)
+	}
+	if mount, ok := mounts[path+"/"]; ok {
+		if mount.Type != "transit" {
+			return "", fmt.Errorf("%s is a %s mount, not transit", path, mount.Type)
+		}
+		return "mounted", nil
+	}
+
+	if err := client.Sys().MountWithContext(ctx, path, &api.MountInput{Type: "transit", Description: "Auto-unseal keys"}); err != nil {
+		return "", fmt.Errorf("enable transit: %w", err)
+	}
+	return "enabled", nil
+}
+
+// Create the key unless it exists, failing if it cannot encrypt or may be deleted, which would brick the
+// clusters sealed with it.
+func ensureTransitKey(ctx context.Context, client *api.Client, settings transitSettings) (string, error) {
+	path := settings.MountPath + "/keys/" + settings.KeyName
+	key, err := client.Logical().ReadWithContext(ctx, path)
+	if err != nil {
+		return "", fmt.Errorf("read key: %w", err)
+	}
+	if key == nil {
+		if _, err := client.Logical().WriteWithContext(ctx, path, map[string]any{"type": "aes256-gcm96"}); err != nil {
+			return "", fmt.Errorf("create key: %w", err)
+		}
+		return "created", nil
+	}
+
+	if supported, _ := key.Data["supports_encryption"].(bool); !supported {
+		return "", fmt.Errorf("key %s of type %v does not support encryption", settings.KeyName, key.Data["type"])
+	}
+	if deletable, _ := key.Data["deletion_allowed"].(bool); deletable {
+		return "", fmt.Errorf("key %s allows deletion, which would make the sealed clusters unrecoverable", settings.KeyName)
+	}
+	return fmt.Sprintf("exists, version %v", key.Data["latest_version"]), nil
+}
+
+// Check the token stored in the secret is valid and has the seal policy, returning the secret ARN.
+// Secrets missing or holding an invalid token are not errors.
+func (a *App) storedTransitToken(ctx context.Context, management *api.Client, secretName, policy string) (string, bool, error) {
+	secret, err := a.secretsManager.GetSecretValue(ctx, &secretsmanager.GetSecretValueInput{SecretId: &secretName})
+	var notFound *types.ResourceNotFoundException
+	if errors.As(err, &notFound) {
+		return "", false, nil
+	}
+	if err != nil {
+		return "", false, fmt.Errorf("get AWS secret: %w", err)
+	}
+
+	lookup, err := management.Auth().Token().LookupWithContext(ctx, aws.ToString(secret.SecretString))
+	if err != nil {
+		// Expired or revoked tokens are replaced.
+		return "", false, nil
+	}
+	policies, err := lookup.TokenPolicies()
+	if err != nil || !slices.Contains(policies, policy) {
+		return "", false, nil
+	}
+	return aws.ToString(secret.ARN), true, nil
+}
+
+// Run the `transit-bootstrap` subcommand. Returns the process exit code.
+func runTransitBootstrap(ctx context.Context, app *App, management *api.Client, settings transitSettings, format outputFormat) int {
+	output := commandOutput{Command: "transit-bootstrap"}
+	seal := app.BootstrapTransit(ctx, management, settings, &output)
+	if seal != nil {
+		output.Result = seal
+	}
+	code := output.print(os.Stdout, format)
+
+	if seal != nil && format == outputText {
+		fmt.Printf(`
+seal "transit" {
+  address    = %q
+  mount_path = "%s/"
+  key_name   = %q
+  # token read from %s
+}
+`, seal.Address, seal.MountPath, seal.KeyName, seal.TokenSecretARN)
+	}
+	return code
+}
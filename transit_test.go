@@ -0,0 +1,109 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/vault/api"
+)
+
+// Management Vault serving the transit bootstrap requests, with the key deletable if asked.
+func newTransitVault(t *testing.T, deletable bool) (*api.Client, map[string]int) {
+	t.Helper()
+	var (
+		calls   = map[string]int{}
+		mounted bool
+		key     bool
+	)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls[r.Method+" "+r.URL.Path]++
+		reply := func(body any) {
+			_ = json.NewEncoder(w).Encode(body)
+		}
+		switch r.Method + " " + r.URL.Path {
+		case "GET /v1/sys/mounts":
+			mounts := map[string]any{}
+			if mounted {
+				mounts["transit/"] = map[string]any{"type": "transit"}
+			}
+			reply(map[string]any{"data": mounts})
+		case "POST /v1/sys/mounts/transit":
+			mounted = true
+			w.WriteHeader(http.StatusNoContent)
+		case "GET /v1/transit/keys/seal":
+			if !key {
+				w.WriteHeader(http.StatusNotFound)
+				return
+			}
+			reply(map[string]any{"data": map[string]any{"supports_encryption": true, "deletion_allowed": deletable, "latest_version": 1}})
+		case "PUT /v1/transit/keys/seal":
+			key = true
+			w.WriteHeader(http.StatusNoContent)
+		case "PUT /v1/sys/policies/acl/vault-init-transit-seal":
+			w.WriteHeader(http.StatusNoContent)
+		case "POST /v1/auth/token/create-orphan":
+			reply(map[string]any{"auth": map[string]any{"client_token": "hvs.seal", "accessor": "accessor", "policies": []string{"vault-init-transit-seal"}}})
+		case "POST /v1/auth/token/lookup":
+			reply(map[string]any{"data": map[string]any{"policies": []string{"vault-init-transit-seal"}}})
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	t.Cleanup(server.Close)
+
+	config := api.DefaultConfig()
+	config.Address = server.URL
+	client, err := api.NewClient(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	client.SetToken("management")
+	return client, calls
+}
+
+func TestBootstrapTransit(t *testing.T) {
+	app, _, secretsManager := newTestApp(0)
+	client, calls := newTransitVault(t, false)
+	settings := transitSettings{MountPath: "transit", KeyName: "seal", TokenSecretName: "vault-transit-token", TokenPeriod: 24 * time.Hour}
+
+	output := commandOutput{}
+	seal := app.BootstrapTransit(context.Background(), client, settings, &output)
+	if seal == nil {
+		t.Fatalf("bootstrap failed: %+v", output.Steps)
+	}
+	if secretsManager.managed["vault-transit-token"] != "hvs.seal" {
+		t.Fatalf("expected the token stored, got %q", secretsManager.managed["vault-transit-token"])
+	}
+	if calls["POST /v1/sys/mounts/transit"] != 1 || calls["PUT /v1/transit/keys/seal"] != 1 {
+		t.Errorf("expected the mount and key created, got %v", calls)
+	}
+
+	// Running it again keeps everything, including the stored token.
+	output = commandOutput{}
+	if seal := app.BootstrapTransit(context.Background(), client, settings, &output); seal == nil {
+		t.Fatalf("second bootstrap failed: %+v", output.Steps)
+	}
+	if calls["POST /v1/sys/mounts/transit"] != 1 || calls["PUT /v1/transit/keys/seal"] != 1 || calls["POST /v1/auth/token/create-orphan"] != 1 {
+		t.Errorf("expected nothing created again, got %v", calls)
+	}
+}
+
+func TestBootstrapTransitDeletableKey(t *testing.T) {
+	app, _, _ := newTestApp(0)
+	client, _ := newTransitVault(t, true)
+	settings := transitSettings{MountPath: "transit", KeyName: "seal", TokenSecretName: "vault-transit-token", TokenPeriod: time.Hour}
+
+	// The key is created on the first run, and found deletable on the second.
+	app.BootstrapTransit(context.Background(), client, settings, &commandOutput{})
+	output := commandOutput{}
+	if seal := app.BootstrapTransit(context.Background(), client, settings, &output); seal != nil {
+		t.Fatal("expected a deletable key rejected")
+	}
+	if last := output.Steps[len(output.Steps)-1]; last.Name != "check transit key" || last.OK {
+		t.Errorf("expected the key check to fail, got %+v", last)
+	}
+}
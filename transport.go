@@ -0,0 +1,34 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"net/url"
+)
+
+// Check the Vault address is safe to send or receive unseal keys over: HTTPS, or plaintext HTTP to a
+// loopback address or unix socket, which never leaves the host. Plaintext HTTP to other addresses
+// is refused unless allowed by the config.
+func (a *App) checkKeyTransport() error {
+	if a.config.AllowPlaintext {
+		return nil
+	}
+
+	address, err := url.Parse(a.vault.Address())
+	if err != nil {
+		return fmt.Errorf("parse vault address: %w", err)
+	}
+	if address.Scheme != "http" {
+		return nil
+	}
+
+	// Unix socket addresses are set to http://localhost by the Vault API.
+	host := address.Hostname()
+	if host == "localhost" {
+		return nil
+	}
+	if ip := net.ParseIP(host); ip != nil && ip.IsLoopback() {
+		return nil
+	}
+	return fmt.Errorf("%w: %s", ErrPlaintextTransport, address.Redacted())
+}
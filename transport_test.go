@@ -0,0 +1,45 @@
+package main
+
+import (
+	"errors"
+	"testing"
+)
+
+// Fake Vault reached at another address.
+type addressedVault struct {
+	*fakeVault
+	address string
+}
+
+func (v addressedVault) Address() string {
+	return v.address
+}
+
+func TestCheckKeyTransport(t *testing.T) {
+	tests := map[string]struct {
+		address        string
+		allowPlaintext bool
+		err            error
+	}{
+		"http loopback IPv4": {address: "http://127.0.0.1:8200"},
+		"http loopback IPv6": {address: "http://[::1]:8200"},
+		// Also the address of unix sockets.
+		"http localhost":                 {address: "http://localhost:8200"},
+		"https":                          {address: "https://vault.test:8200"},
+		"http remote":                    {address: "http://vault.test:8200", err: ErrPlaintextTransport},
+		"http remote IP":                 {address: "http://10.0.0.1:8200", err: ErrPlaintextTransport},
+		"http remote, plaintext allowed": {address: "http://vault.test:8200", allowPlaintext: true},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			app, vault, _ := newTestApp(0)
+			app.vault = addressedVault{fakeVault: vault, address: test.address}
+			app.config.AllowPlaintext = test.allowPlaintext
+
+			if err := app.checkKeyTransport(); !errors.Is(err, test.err) {
+				t.Fatalf("expected error %v, got %v", test.err, err)
+			}
+		})
+	}
+}
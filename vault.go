@@ -0,0 +1,130 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/hashicorp/vault/api"
+)
+
+// Subset of the Vault API used by the App, so it can run against other implementations of the API,
+// such as OpenBao servers, or fakes. Satisfied by *vaultClient.
+type vaultAPI interface {
+	Health(ctx context.Context) (*api.HealthResponse, error)
+	SealStatus(ctx context.Context) (*api.SealStatusResponse, error)
+	Init(ctx context.Context, request *api.InitRequest) (*api.InitResponse, error)
+	Unseal(ctx context.Context, opts *api.UnsealOpts) (*api.SealStatusResponse, error)
+	ResetUnseal(ctx context.Context) error
+	RaftJoin(ctx context.Context, request *api.RaftJoinRequest) (*api.RaftJoinResponse, error)
+
+	// Address of the Vault API.
+	Address() string
+	// Client authenticated with the token, for the operations requiring one.
+	WithToken(token string) (*api.Client, error)
+}
+
+// Query parameters the Vault API sends to the health endpoint, so every state is reported with a 2xx code.
+var defaultHealthParams = map[string]string{
+	"uninitcode":             "299",
+	"sealedcode":             "299",
+	"standbycode":            "299",
+	"drsecondarycode":        "299",
+	"performancestandbycode": "299",
+}
+
+// Vault API implementation using the Vault API client.
+type vaultClient struct {
+	client *api.Client
+
+	// Health endpoint path, relative to /v1/, and query parameters overriding the defaults.
+	// Empty to use the Vault API client defaults.
+	healthPath   string
+	healthParams map[string]string
+}
+
+func newVaultClient(client *api.Client, healthPath string, healthParams map[string]string) *vaultClient {
+	return &vaultClient{client: client, healthPath: healthPath, healthParams: healthParams}
+}
+
+// Read the Vault health, from the configured health path and query parameters if any. Responses with error
+// status codes are accepted if their body is a health response, for proxies remapping the status codes.
+func (v *vaultClient) Health(ctx context.Context) (*api.HealthResponse, error) {
+	if v.healthPath == "" && len(v.healthParams) == 0 {
+		return v.client.Sys().HealthWithContext(ctx)
+	}
+
+	path := v.healthPath
+	if path == "" {
+		path = "sys/health"
+	}
+
+	params := make(map[string][]string)
+	for key, value := range defaultHealthParams {
+		params[key] = []string{value}
+	}
+	for key, value := range v.healthParams {
+		params[key] = []string{value}
+	}
+
+	resp, err := v.client.Logical().ReadRawWithDataWithContext(ctx, path, params)
+	if resp == nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	body, readErr := io.ReadAll(resp.Body)
+	if readErr != nil {
+		return nil, fmt.Errorf("read health response: %w", readErr)
+	}
+
+	// Error responses decode to a zero health response, which would look uninitialized.
+	var health struct {
+		api.HealthResponse
+		Initialized *bool `json:"initialized"`
+	}
+	if decodeErr := json.Unmarshal(body, &health); decodeErr != nil || health.Initialized == nil {
+		if err != nil {
+			return nil, err
+		}
+		return nil, fmt.Errorf("decode health response: %w", errors.Join(decodeErr, errors.New("no initialized field")))
+	}
+	health.HealthResponse.Initialized = *health.Initialized
+	return &health.HealthResponse, nil
+}
+
+func (v *vaultClient) SealStatus(ctx context.Context) (*api.SealStatusResponse, error) {
+	return v.client.Sys().SealStatusWithContext(ctx)
+}
+
+func (v *vaultClient) Init(ctx context.Context, request *api.InitRequest) (*api.InitResponse, error) {
+	return v.client.Sys().InitWithContext(ctx, request)
+}
+
+func (v *vaultClient) Unseal(ctx context.Context, opts *api.UnsealOpts) (*api.SealStatusResponse, error) {
+	return v.client.Sys().UnsealWithOptionsWithContext(ctx, opts)
+}
+
+func (v *vaultClient) ResetUnseal(ctx context.Context) error {
+	_, err := v.client.Sys().ResetUnsealProcessWithContext(ctx)
+	return err
+}
+
+func (v *vaultClient) RaftJoin(ctx context.Context, request *api.RaftJoinRequest) (*api.RaftJoinResponse, error) {
+	return v.client.Sys().RaftJoinWithContext(ctx, request)
+}
+
+func (v *vaultClient) Address() string {
+	return v.client.Address()
+}
+
+func (v *vaultClient) WithToken(token string) (*api.Client, error) {
+	client, err := v.client.Clone()
+	if err != nil {
+		return nil, fmt.Errorf("clone client: %w", err)
+	}
+	client.SetToken(token)
+	return client, nil
+}
@@ -0,0 +1,47 @@
+package main
+
+import (
+	"errors"
+	"log/slog"
+	"time"
+
+	"github.com/cenkalti/backoff/v4"
+)
+
+// Backs off the periodic Vault checks while Vault is unavailable, instead of retrying it every tick.
+type checkBackoff struct {
+	backoff *backoff.ExponentialBackOff
+	until   time.Time
+}
+
+func newCheckBackoff(interval time.Duration) *checkBackoff {
+	b := backoff.NewExponentialBackOff()
+	if interval > 0 {
+		b.InitialInterval = interval
+	}
+	b.MaxInterval = 5 * time.Minute
+	b.MaxElapsedTime = 0
+
+	return &checkBackoff{backoff: b}
+}
+
+// Whether the check at the given time is skipped.
+func (c *checkBackoff) skip(t time.Time) bool {
+	return t.Before(c.until)
+}
+
+// Backs off the checks if the check error is ErrVaultUnavailable, returning any other error.
+// Resets the backoff otherwise.
+func (c *checkBackoff) record(err error) error {
+	if !errors.Is(err, ErrVaultUnavailable) {
+		c.backoff.Reset()
+		c.until = time.Time{}
+		return err
+	}
+
+	// Randomized around the interval, so capped to keep the checks at most MaxInterval apart.
+	next := min(c.backoff.NextBackOff(), c.backoff.MaxInterval)
+	c.until = time.Now().Add(next)
+	slog.Warn("Vault unavailable, backing off", "error", err, "retryIn", next)
+	return nil
+}
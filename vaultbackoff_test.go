@@ -0,0 +1,90 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/vault/api"
+)
+
+func TestVaultError(t *testing.T) {
+	tests := map[string]struct {
+		err         error
+		unavailable bool
+	}{
+		"rate limited":         {err: &api.ResponseError{StatusCode: http.StatusTooManyRequests}, unavailable: true},
+		"performance standby":  {err: &api.ResponseError{StatusCode: 473}, unavailable: true},
+		"sealed":               {err: &api.ResponseError{StatusCode: http.StatusServiceUnavailable}, unavailable: true},
+		"wrapped":              {err: fmt.Errorf("unseal: %w", &api.ResponseError{StatusCode: http.StatusServiceUnavailable}), unavailable: true},
+		"internal error":       {err: &api.ResponseError{StatusCode: http.StatusInternalServerError}},
+		"invalid request":      {err: &api.ResponseError{StatusCode: http.StatusBadRequest}},
+		"not a Vault response": {err: errors.New("connection refused")},
+	}
+
+	for name, test := range tests {
+		err := vaultError(test.err)
+		if errors.Is(err, ErrVaultUnavailable) != test.unavailable {
+			t.Errorf("%s: expected unavailable %v, got %v", name, test.unavailable, err)
+		}
+		if !errors.Is(err, test.err) {
+			t.Errorf("%s: expected the response error kept, got %v", name, err)
+		}
+	}
+}
+
+// Vault answering the health checks with an error.
+type unhealthyVault struct {
+	*fakeVault
+	err error
+}
+
+func (v unhealthyVault) Health(context.Context) (*api.HealthResponse, error) {
+	return nil, v.err
+}
+
+func TestCheckVaultStatusRateLimited(t *testing.T) {
+	app, vault, _ := newTestApp(0)
+	app.vault = unhealthyVault{fakeVault: vault, err: &api.ResponseError{StatusCode: http.StatusTooManyRequests}}
+
+	if _, err := app.CheckVaultStatus(context.Background()); !errors.Is(err, ErrVaultUnavailable) {
+		t.Fatalf("expected Vault unavailable, got %v", err)
+	}
+}
+
+func TestCheckBackoff(t *testing.T) {
+	backoff := newCheckBackoff(time.Second)
+	unavailable := fmt.Errorf("read health: %w", ErrVaultUnavailable)
+
+	if err := backoff.record(unavailable); err != nil {
+		t.Fatalf("expected the unavailable Vault not reported as an error, got %v", err)
+	}
+	if !backoff.skip(time.Now()) {
+		t.Fatal("expected the next check skipped")
+	}
+	first := backoff.until
+
+	// Backs off further while Vault stays unavailable, up to the max interval.
+	for i := 0; i < 20; i++ {
+		_ = backoff.record(unavailable)
+	}
+	if !backoff.until.After(first) || backoff.until.After(time.Now().Add(5*time.Minute)) {
+		t.Fatalf("expected the backoff to grow up to 5m, got %v", time.Until(backoff.until))
+	}
+
+	// Other errors are reported, and reset the backoff.
+	failed := errors.New("unseal failed")
+	if err := backoff.record(failed); err != failed {
+		t.Fatalf("expected the error returned, got %v", err)
+	}
+	if backoff.skip(time.Now()) {
+		t.Fatal("expected checks resumed")
+	}
+	_ = backoff.record(unavailable)
+	if time.Until(backoff.until) > 2*time.Second {
+		t.Fatalf("expected the backoff reset, got %v", time.Until(backoff.until))
+	}
+}
@@ -0,0 +1,195 @@
+package main
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+
+	"github.com/spiffe/go-spiffe/v2/spiffetls/tlsconfig"
+	"github.com/spiffe/go-spiffe/v2/svid/x509svid"
+)
+
+// TLS settings of the Vault API client, overriding the VAULT_* environment variables read by the
+// Vault API. Certificates and keys may be PEM, base64-encoded PEM or use the `@<file-path>` format.
+type vaultTLSConfig struct {
+	CACert     string
+	ClientCert string
+	ClientKey  string
+	ServerName string
+	// Host of the Vault API address, the server certificate is verified for when connecting to an IP address,
+	// as IP addresses are not sent as server names.
+	Host string
+	// Names the server certificate may be valid for, instead of the server name.
+	AllowedNames []string
+	// Whether to skip verifying the server certificate. Every connection is logged as a warning.
+	SkipVerify bool
+	// Source of the SPIFFE X.509 SVID to use as client certificate instead of ClientCert and ClientKey.
+	SVIDSource x509svid.Source
+}
+
+// Configure the TLS settings of the Vault API client transport. Files are read again on every TLS handshake,
+// so renewed certificates are used by new connections without restarting.
+func (c vaultTLSConfig) apply(transport *http.Transport) error {
+	if transport.TLSClientConfig.InsecureSkipVerify {
+		slog.Warn("TLS verification of the Vault API is disabled by VAULT_SKIP_VERIFY, use VAULT_API_TLS_ALLOWED_NAMES for name mismatches")
+	}
+	if c.CACert == "" && c.ClientCert == "" && c.ClientKey == "" && c.ServerName == "" && len(c.AllowedNames) == 0 && !c.SkipVerify && c.SVIDSource == nil {
+		return nil
+	}
+	if (c.ClientCert == "") != (c.ClientKey == "") {
+		return errors.New("client certificate and key must be set together")
+	}
+	if c.ClientCert != "" && c.SVIDSource != nil {
+		return errors.New("client certificate and SPIFFE SVID are mutually exclusive")
+	}
+
+	// Fail at startup on invalid settings rather than on the first handshake.
+	if c.CACert != "" {
+		if _, err := c.rootCAs(); err != nil {
+			return err
+		}
+	}
+	if c.ClientCert != "" {
+		if _, err := c.clientCertificate(nil); err != nil {
+			return err
+		}
+	}
+
+	tlsConfig := transport.TLSClientConfig.Clone()
+	if c.ServerName != "" {
+		tlsConfig.ServerName = c.ServerName
+	}
+	if c.ClientCert != "" {
+		tlsConfig.GetClientCertificate = c.clientCertificate
+	}
+	if c.SVIDSource != nil {
+		tlsConfig.GetClientCertificate = tlsconfig.GetClientCertificate(c.SVIDSource)
+	}
+	switch {
+	case c.SkipVerify:
+		slog.Warn("TLS verification of the Vault API is disabled by VAULT_API_TLS_SKIP_VERIFY, every connection is logged")
+		tlsConfig.InsecureSkipVerify = true
+		tlsConfig.VerifyConnection = auditConnection
+
+	case c.CACert != "" || len(c.AllowedNames) > 0:
+		// Verified by verifyConnection instead, against the CA certificates read at handshake time
+		// and the allowed names.
+		roots := tlsConfig.RootCAs
+		tlsConfig.InsecureSkipVerify = true
+		tlsConfig.VerifyConnection = func(state tls.ConnectionState) error {
+			return c.verifyConnection(state, roots)
+		}
+	}
+	transport.TLSClientConfig = tlsConfig
+	return nil
+}
+
+func (c vaultTLSConfig) clientCertificate(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+	certPEM, err := readPEM(c.ClientCert)
+	if err != nil {
+		return nil, fmt.Errorf("read client certificate: %w", err)
+	}
+	keyPEM, err := readPEM(c.ClientKey)
+	if err != nil {
+		return nil, fmt.Errorf("read client key: %w", err)
+	}
+
+	cert, err := tls.X509KeyPair(certPEM, keyPEM)
+	if err != nil {
+		return nil, fmt.Errorf("load client certificate: %w", err)
+	}
+	return &cert, nil
+}
+
+func (c vaultTLSConfig) rootCAs() (*x509.CertPool, error) {
+	caPEM, err := readPEM(c.CACert)
+	if err != nil {
+		return nil, fmt.Errorf("read CA certificate: %w", err)
+	}
+
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(caPEM) {
+		return nil, errors.New("no CA certificate found")
+	}
+	return pool, nil
+}
+
+// Verify the server certificate chains to the CA certificates, or the given roots if none are configured
+// (nil for the system roots), and is valid for the server name, or host, or one of the allowed names.
+func (c vaultTLSConfig) verifyConnection(state tls.ConnectionState, roots *x509.CertPool) error {
+	if len(state.PeerCertificates) == 0 {
+		return errors.New("no server certificate")
+	}
+
+	if c.CACert != "" {
+		var err error
+		if roots, err = c.rootCAs(); err != nil {
+			return err
+		}
+	}
+
+	intermediates := x509.NewCertPool()
+	for _, cert := range state.PeerCertificates[1:] {
+		intermediates.AddCert(cert)
+	}
+
+	leaf := state.PeerCertificates[0]
+	if _, err := leaf.Verify(x509.VerifyOptions{Roots: roots, Intermediates: intermediates}); err != nil {
+		return err
+	}
+
+	names := c.AllowedNames
+	if len(names) == 0 {
+		name := state.ServerName
+		if name == "" {
+			name = c.Host
+		}
+		names = []string{name}
+	}
+	var err error
+	for _, name := range names {
+		if err = leaf.VerifyHostname(name); err == nil {
+			return nil
+		}
+	}
+	return fmt.Errorf("server certificate not valid for %s: %w", strings.Join(names, ", "), err)
+}
+
+// Log connections whose server certificate is not verified.
+func auditConnection(state tls.ConnectionState) error {
+	var subject string
+	var names []string
+	if len(state.PeerCertificates) > 0 {
+		subject = state.PeerCertificates[0].Subject.String()
+		names = state.PeerCertificates[0].DNSNames
+	}
+	slog.Warn("Connected to Vault API without verifying its certificate", "serverName", state.ServerName, "subject", subject, "dnsNames", names)
+	return nil
+}
+
+// Returns PEM data given as is, base64-encoded or in the `@<file-path>` format.
+func readPEM(raw string) ([]byte, error) {
+	if strings.HasPrefix(raw, "@") {
+		return os.ReadFile(raw[1:])
+	}
+	if strings.Contains(raw, "-----BEGIN") {
+		return []byte(raw), nil
+	}
+	return base64.StdEncoding.DecodeString(strings.TrimSpace(raw))
+}
+
+// Returns the host of the Vault API address, empty if invalid.
+func vaultHost(address string) string {
+	u, err := url.Parse(address)
+	if err != nil {
+		return ""
+	}
+	return u.Hostname()
+}